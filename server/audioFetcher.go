@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"song-recognition/utils"
+)
+
+var (
+	errURLNotAllowed = errors.New("url not allowed")
+	errURLTooLarge   = errors.New("remote audio too large")
+)
+
+// audioFetcher downloads recordings for URL classification. Only URLs whose scheme and
+// host are on the configured allow-lists are fetched, including every redirect hop, so
+// the endpoint cannot be used to reach internal services.
+type audioFetcher struct {
+	client         *http.Client
+	allowedHosts   []string // exact hosts, or ".example.com" for any subdomain
+	allowedSchemes []string
+	maxBytes       int64
+}
+
+func newAudioFetcherFromEnv() *audioFetcher {
+	timeout, err := time.ParseDuration(utils.GetEnv("DRONE_URL_TIMEOUT", "15s"))
+	if err != nil || timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	maxBytes, err := strconv.ParseInt(utils.GetEnv("DRONE_URL_MAX_BYTES", strconv.Itoa(defaultMaxRequestBytes)), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		maxBytes = defaultMaxRequestBytes
+	}
+
+	fetcher := &audioFetcher{
+		allowedHosts:   splitList(utils.GetEnv("DRONE_URL_ALLOWED_HOSTS", "")),
+		allowedSchemes: splitList(utils.GetEnv("DRONE_URL_ALLOWED_SCHEMES", "https")),
+		maxBytes:       maxBytes,
+	}
+	fetcher.client = &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return fetcher.checkURL(req.URL)
+		},
+	}
+	return fetcher
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkURL reports whether u may be fetched.
+func (f *audioFetcher) checkURL(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	schemeAllowed := false
+	for _, allowed := range f.allowedSchemes {
+		if scheme == allowed {
+			schemeAllowed = true
+			break
+		}
+	}
+	if !schemeAllowed {
+		return fmt.Errorf("%w: scheme %q is not allowed", errURLNotAllowed, u.Scheme)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" || u.User != nil {
+		return fmt.Errorf("%w: invalid host", errURLNotAllowed)
+	}
+	for _, allowed := range f.allowedHosts {
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q is not on the allow-list", errURLNotAllowed, host)
+}
+
+// fetch downloads rawURL into dir and returns the path of the downloaded file. The file
+// keeps the URL's extension so format detection has a hint.
+func (f *audioFetcher) fetch(ctx context.Context, rawURL string, dir string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errURLNotAllowed, err)
+	}
+	if err := f.checkURL(u); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, errURLNotAllowed) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to download audio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download audio: remote returned %s", resp.Status)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return "", fmt.Errorf("%w: %d bytes exceeds %d", errURLTooLarge, resp.ContentLength, f.maxBytes)
+	}
+
+	if err := utils.CreateFolder(dir); err != nil {
+		return "", fmt.Errorf("unable to create %s folder: %w", dir, err)
+	}
+	ext := strings.ToLower(filepath.Ext(u.Path))
+	if ext == "" || len(ext) > 5 {
+		ext = ".audio"
+	}
+	path := filepath.Join(dir, fmt.Sprintf("url_%d%s", time.Now().UnixNano(), ext))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download file: %w", err)
+	}
+	// Read one byte past the limit so bodies without a Content-Length are caught too
+	written, err := io.Copy(file, io.LimitReader(resp.Body, f.maxBytes+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > f.maxBytes {
+		err = fmt.Errorf("%w: exceeds %d bytes", errURLTooLarge, f.maxBytes)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		if errors.Is(err, errURLTooLarge) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to download audio: %w", err)
+	}
+	return path, nil
+}
@@ -3,11 +3,9 @@ package main
 import (
 	"encoding/json"
 	"flag"
-	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"song-recognition/drone"
 )
@@ -33,59 +31,32 @@ func main() {
 		log.Printf("No existing prototypes found, starting fresh\n")
 	}
 
-	// Find noise files
-	files, err := collectWAVFiles(*noiseDir)
+	log.Printf("Building noise prototypes from %s...\n", *noiseDir)
+	noisePrototypes, stats, err := drone.IngestDirectory(drone.IngestOptions{
+		Dir:         *noiseDir,
+		LabelFrom:   drone.LabelFromFilename,
+		Category:    "noise", // Category is "noise" not "drone"
+		NoisePrefix: true,
+		Progress: func(path string, proto drone.Prototype, err error) {
+			if err != nil {
+				log.Printf("  ERROR %s: %v", filepath.Base(path), err)
+				return
+			}
+			log.Printf("  ✓ Created noise prototype %s from %s (label: %s)", proto.ID, filepath.Base(path), proto.Label)
+		},
+	})
 	if err != nil {
 		log.Fatalf("failed to list directory: %v", err)
 	}
 
-	if len(files) == 0 {
-		log.Fatalf("no WAV files found in %s", *noiseDir)
-	}
-
-	log.Printf("Found %d noise WAV files in %s\n", len(files), *noiseDir)
-	log.Println("Building noise prototypes...")
-
-	// Add noise prototypes
-	noiseCount := 0
-	for _, filePath := range files {
-		label := inferLabel(filePath)
-		log.Printf("Processing: %s (label: %s, category: noise)", filepath.Base(filePath), label)
-
-		proto, err := drone.BuildPrototypeFromPath(
-			filePath,
-			label,
-			"noise", // Category is "noise" not "drone"
-			fmt.Sprintf("Noise/non-drone sample: %s", filepath.Base(filePath)),
-			filePath,
-			nil,
-		)
-		if err != nil {
-			log.Printf("  ERROR: %v", err)
-			continue
-		}
-
-		existingPrototypes = append(existingPrototypes, proto)
-		noiseCount++
-		log.Printf("  ✓ Created noise prototype %s", proto.ID)
-	}
-
+	noiseCount := len(noisePrototypes)
 	if noiseCount == 0 {
-		log.Fatalf("no noise prototypes were created")
+		log.Fatalf("no noise prototypes were created from %d audio files in %s", stats.Files, *noiseDir)
 	}
+	existingPrototypes = append(existingPrototypes, noisePrototypes...)
 
 	// Write combined prototypes
-	outDir := filepath.Dir(*outputFile)
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		log.Fatalf("failed to create output directory: %v", err)
-	}
-
-	data, err := json.MarshalIndent(existingPrototypes, "", "  ")
-	if err != nil {
-		log.Fatalf("failed to marshal prototypes: %v", err)
-	}
-
-	if err := os.WriteFile(*outputFile, data, 0644); err != nil {
+	if err := drone.WritePrototypes(*outputFile, existingPrototypes); err != nil {
 		log.Fatalf("failed to write output file: %v", err)
 	}
 
@@ -103,40 +74,3 @@ func main() {
 		log.Printf("  %s: %d", category, count)
 	}
 }
-
-func collectWAVFiles(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	var files []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		if !strings.EqualFold(filepath.Ext(entry.Name()), ".wav") {
-			continue
-		}
-		files = append(files, filepath.Join(dir, entry.Name()))
-	}
-
-	return files, nil
-}
-
-func inferLabel(path string) string {
-	base := filepath.Base(path)
-	name := strings.TrimSuffix(base, filepath.Ext(base))
-
-	// Clean up the name
-	name = strings.ToLower(name)
-	name = strings.ReplaceAll(name, "_", " ")
-	name = strings.ReplaceAll(name, "-", " ")
-
-	// Prefix with "noise" if not already there
-	if !strings.Contains(name, "noise") && !strings.Contains(name, "ambient") {
-		name = "noise " + name
-	}
-
-	return name
-}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"song-recognition/drone"
+)
+
+// BenchConfig holds benchmark parameters
+type BenchConfig struct {
+	ModelPath string
+	Dir       string
+	K         int
+	Verbose   bool
+}
+
+// fileTiming is the time one recording spent in each stage of classification.
+type fileTiming struct {
+	Path       string
+	Convert    time.Duration
+	Preprocess time.Duration
+	Extract    time.Duration
+	Predict    time.Duration
+	Total      time.Duration
+	Err        error
+}
+
+// stagePercentiles summarises one stage's latency over the classified files.
+type stagePercentiles struct {
+	Stage string
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// benchReport is the result of classifying every recording in a directory.
+type benchReport struct {
+	Files      []fileTiming
+	Failed     int
+	Elapsed    time.Duration
+	Stages     []stagePercentiles
+	Throughput float64 // classified files per second of wall time
+}
+
+func main() {
+	config := parseFlags()
+
+	log.SetFlags(log.Ldate | log.Ltime)
+	log.Println("=== End-to-End Latency Benchmark ===")
+	log.Printf("Model: %s\n", config.ModelPath)
+	log.Printf("Recordings: %s\n", config.Dir)
+	log.Println()
+
+	classifier, err := drone.NewClassifierFromFile(config.ModelPath, config.K)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to load model: %v", err)
+	}
+
+	files, err := drone.IngestFiles(config.Dir, drone.DefaultIngestExtensions)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to read %s: %v", config.Dir, err)
+	}
+	if len(files) == 0 {
+		log.Fatalf("ERROR: No recordings found in %s", config.Dir)
+	}
+
+	report := runBench(classifier, files)
+	if config.Verbose {
+		for _, timing := range report.Files {
+			if timing.Err != nil {
+				log.Printf("  %s: %v\n", timing.Path, timing.Err)
+			}
+		}
+	}
+	printBenchReport(os.Stdout, report)
+}
+
+func parseFlags() BenchConfig {
+	config := BenchConfig{}
+
+	flag.StringVar(&config.ModelPath, "model", "drone/prototypes.json",
+		"Path to trained model (prototypes JSON)")
+	flag.StringVar(&config.Dir, "dir", "Drone-Training-Data",
+		"Directory of recordings to classify")
+	flag.IntVar(&config.K, "k", 3,
+		"Number of nearest neighbors")
+	flag.BoolVar(&config.Verbose, "verbose", false,
+		"Log the recordings that could not be classified")
+
+	flag.Parse()
+
+	return config
+}
+
+// runBench classifies each file in turn through the same conversion, preprocessing and
+// feature extraction as prototype ingestion, timing every stage.
+func runBench(classifier *drone.Classifier, files []string) benchReport {
+	report := benchReport{Files: make([]fileTiming, 0, len(files))}
+	started := time.Now()
+	for _, path := range files {
+		timing := fileTiming{Path: path}
+		fileStarted := time.Now()
+
+		features, stages, err := drone.ExtractFeaturesFromPathTimed(path)
+		timing.Convert, timing.Preprocess, timing.Extract = stages.Convert, stages.Preprocess, stages.Extract
+		if err == nil {
+			predictStarted := time.Now()
+			_, err = classifier.Predict(features)
+			timing.Predict = time.Since(predictStarted)
+		}
+		timing.Total = time.Since(fileStarted)
+		if err != nil {
+			timing.Err = err
+			report.Failed++
+		}
+		report.Files = append(report.Files, timing)
+	}
+	report.Elapsed = time.Since(started)
+
+	classified := len(report.Files) - report.Failed
+	if classified > 0 && report.Elapsed > 0 {
+		report.Throughput = float64(classified) / report.Elapsed.Seconds()
+	}
+	for _, stage := range []struct {
+		name  string
+		value func(fileTiming) time.Duration
+	}{
+		{"convert", func(t fileTiming) time.Duration { return t.Convert }},
+		{"preprocess", func(t fileTiming) time.Duration { return t.Preprocess }},
+		{"extract", func(t fileTiming) time.Duration { return t.Extract }},
+		{"predict", func(t fileTiming) time.Duration { return t.Predict }},
+		{"total", func(t fileTiming) time.Duration { return t.Total }},
+	} {
+		var durations []time.Duration
+		for _, timing := range report.Files {
+			if timing.Err == nil {
+				durations = append(durations, stage.value(timing))
+			}
+		}
+		report.Stages = append(report.Stages, stagePercentiles{
+			Stage: stage.name,
+			P50:   percentile(durations, 50),
+			P90:   percentile(durations, 90),
+			P99:   percentile(durations, 99),
+		})
+	}
+	return report
+}
+
+// percentile returns the nearest-rank pth percentile of durations, or 0 when there are
+// none.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return sorted[rank-1]
+}
+
+func printBenchReport(w io.Writer, report benchReport) {
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	fmt.Fprintln(w, "BENCHMARK RESULTS")
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	fmt.Fprintf(w, "Files: %d classified, %d failed\n", len(report.Files)-report.Failed, report.Failed)
+	fmt.Fprintf(w, "Wall time: %.2f seconds\n", report.Elapsed.Seconds())
+	fmt.Fprintf(w, "Throughput: %.2f files/second\n", report.Throughput)
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%-12s %12s %12s %12s\n", "Stage", "p50 (ms)", "p90 (ms)", "p99 (ms)")
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+	for _, stage := range report.Stages {
+		fmt.Fprintf(w, "%-12s %12.2f %12.2f %12.2f\n", stage.Stage,
+			milliseconds(stage.P50), milliseconds(stage.P90), milliseconds(stage.P99))
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
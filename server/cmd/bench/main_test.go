@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"song-recognition/drone"
+	"song-recognition/wav"
+)
+
+// copyRunner stands in for FFmpeg when the input is already 16-bit mono 44.1 kHz PCM.
+type copyRunner struct{}
+
+func (copyRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (copyRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	var input string
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-i" {
+			input = args[i+1]
+		}
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	return nil, os.WriteFile(args[len(args)-1], data, 0644)
+}
+
+func writeTone(t *testing.T, path string, frequency float64) {
+	t.Helper()
+
+	const sampleRate = 44100
+	pcm := make([]byte, sampleRate*2)
+	for i := 0; i < sampleRate; i++ {
+		value := 0.5 * math.Sin(2*math.Pi*frequency*float64(i)/sampleRate)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(value*32767)))
+	}
+	if err := wav.WriteWavFile(path, pcm, sampleRate, 1, 16); err != nil {
+		t.Fatalf("failed to write tone: %v", err)
+	}
+}
+
+func TestRunBenchTimesEveryStageOfEachFile(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	dir := t.TempDir()
+	for name, frequency := range map[string]float64{"a.wav": 440, "b.wav": 880, "c.wav": 3000} {
+		writeTone(t, filepath.Join(dir, name), frequency)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.wav"), []byte("not audio"), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	proto, err := drone.BuildPrototypeFromPath(filepath.Join(dir, "a.wav"), "quad", "drone", "", "a.wav", nil)
+	if err != nil {
+		t.Fatalf("failed to build prototype: %v", err)
+	}
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	if err := drone.WritePrototypes(modelPath, []drone.Prototype{proto}); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	files, err := drone.IngestFiles(dir, drone.DefaultIngestExtensions)
+	if err != nil {
+		t.Fatalf("IngestFiles returned error: %v", err)
+	}
+	report := runBench(classifier, files)
+
+	if len(report.Files) != 4 || report.Failed != 1 {
+		t.Fatalf("expected 4 files with 1 failure, got %d with %d", len(report.Files), report.Failed)
+	}
+	for _, timing := range report.Files {
+		if filepath.Base(timing.Path) == "broken.wav" {
+			if timing.Err == nil {
+				t.Fatalf("expected broken.wav to fail")
+			}
+			continue
+		}
+		if timing.Err != nil {
+			t.Fatalf("%s: unexpected error %v", timing.Path, timing.Err)
+		}
+		for stage, d := range map[string]time.Duration{
+			"convert": timing.Convert, "preprocess": timing.Preprocess, "extract": timing.Extract, "predict": timing.Predict,
+		} {
+			if d <= 0 || d > timing.Total {
+				t.Fatalf("%s: expected a %s time within the total %v, got %v", timing.Path, stage, timing.Total, d)
+			}
+		}
+	}
+	if report.Throughput <= 0 {
+		t.Fatalf("expected a positive throughput, got %v", report.Throughput)
+	}
+
+	var out bytes.Buffer
+	printBenchReport(&out, report)
+	for _, want := range []string{"3 classified, 1 failed", "p50 (ms)", "p99 (ms)", "convert", "predict"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected the report to mention %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPercentileUsesNearestRank(t *testing.T) {
+	durations := make([]time.Duration, 10)
+	for i := range durations {
+		durations[i] = time.Duration(10-i) * time.Millisecond
+	}
+	for p, want := range map[float64]time.Duration{50: 5 * time.Millisecond, 90: 9 * time.Millisecond, 99: 10 * time.Millisecond} {
+		if got := percentile(durations, p); got != want {
+			t.Fatalf("p%v: expected %v, got %v", p, want, got)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Fatalf("expected 0 for no durations, got %v", got)
+	}
+}
@@ -5,15 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
-	"time"
 
 	"song-recognition/drone"
-	"song-recognition/wav"
 )
 
 // EvaluationConfig holds evaluation parameters
@@ -22,41 +18,11 @@ type EvaluationConfig struct {
 	TrainingDataDir string
 	K               int
 	ReportPath      string
+	ExportErrorsDir string
+	CVFolds         int
 	Verbose         bool
 }
 
-// ClassMetrics tracks per-class performance
-type ClassMetrics struct {
-	ClassName     string
-	TotalSamples  int
-	CorrectCount  int
-	Accuracy      float64
-	AvgConfidence float64
-	ConfidenceStd float64
-	Misclassified []MisclassificationInfo
-}
-
-// MisclassificationInfo stores details of incorrect predictions
-type MisclassificationInfo struct {
-	Filename       string
-	TrueLabel      string
-	PredictedLabel string
-	Confidence     float64
-}
-
-// EvaluationReport contains comprehensive evaluation results
-type EvaluationReport struct {
-	Timestamp       time.Time
-	ModelPath       string
-	TotalSamples    int
-	CorrectCount    int
-	OverallAccuracy float64
-	AvgConfidence   float64
-	ClassMetrics    []ClassMetrics
-	ConfusionMatrix map[string]map[string]int
-	ProcessingTime  time.Duration
-}
-
 func main() {
 	config := parseFlags()
 
@@ -67,6 +33,11 @@ func main() {
 	log.Printf("K neighbors: %d\n", config.K)
 	log.Println()
 
+	if config.CVFolds > 0 {
+		runCrossValidation(config)
+		return
+	}
+
 	// Load classifier
 	log.Println("Loading trained model...")
 	classifier, err := drone.NewClassifierFromFile(config.ModelPath, config.K)
@@ -79,19 +50,19 @@ func main() {
 		stats.PrototypeCount, stats.LabelCount)
 	log.Println()
 
-	// Discover evaluation data
-	log.Println("Discovering evaluation data...")
-	subdirs, err := discoverSubdirectories(config.TrainingDataDir)
-	if err != nil {
-		log.Fatalf("ERROR: Failed to read evaluation directory: %v", err)
-	}
-
-	log.Printf("Found %d classes to evaluate\n", len(subdirs))
-	log.Println()
-
 	// Evaluate each class
 	log.Println("Evaluating model performance...")
-	report := evaluateModel(classifier, subdirs, config)
+	report, err := drone.RunEvaluation(classifier, config.TrainingDataDir, config.K)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if config.Verbose {
+		for _, m := range report.ClassMetrics {
+			if m.ErrorCount > 0 {
+				log.Printf("  %s: %d recordings could not be classified\n", m.ClassName, m.ErrorCount)
+			}
+		}
+	}
 
 	// Print results
 	printEvaluationReport(report)
@@ -105,6 +76,16 @@ func main() {
 		}
 	}
 
+	// Copy misclassified recordings for review
+	if config.ExportErrorsDir != "" {
+		copied, err := drone.ExportMisclassified(report, config.ExportErrorsDir)
+		if err != nil {
+			log.Printf("WARNING: Failed to export misclassifications: %v\n", err)
+		} else {
+			log.Printf("Exported %d misclassified recordings to: %s\n", copied, config.ExportErrorsDir)
+		}
+	}
+
 	// Print final verdict
 	log.Println()
 	printVerdict(report)
@@ -121,6 +102,10 @@ func parseFlags() EvaluationConfig {
 		"Number of nearest neighbors")
 	flag.StringVar(&config.ReportPath, "report", "evaluation_report.json",
 		"Path to save evaluation report (empty to skip)")
+	flag.StringVar(&config.ExportErrorsDir, "export-errors", "",
+		"Directory to copy misclassified recordings into, one subfolder per true label (empty to skip)")
+	flag.IntVar(&config.CVFolds, "cv-folds", 0,
+		"Cross-validate the model's prototypes with this many folds instead of evaluating -train-dir (0 to skip)")
 	flag.BoolVar(&config.Verbose, "verbose", false,
 		"Enable verbose logging")
 
@@ -129,193 +114,50 @@ func parseFlags() EvaluationConfig {
 	return config
 }
 
-func discoverSubdirectories(rootDir string) ([]string, error) {
-	entries, err := os.ReadDir(rootDir)
+// runCrossValidation scores the model's own prototypes by k-fold cross-validation, so
+// no prototype is classified by a model that contains it.
+func runCrossValidation(config EvaluationConfig) {
+	data, err := os.ReadFile(config.ModelPath)
 	if err != nil {
-		return nil, err
+		log.Fatalf("ERROR: Failed to read model: %v", err)
 	}
-
-	var subdirs []string
-	for _, entry := range entries {
-		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
-		subdirs = append(subdirs, filepath.Join(rootDir, entry.Name()))
+	var prototypes []drone.Prototype
+	if err := json.Unmarshal(data, &prototypes); err != nil {
+		log.Fatalf("ERROR: Failed to parse model: %v", err)
 	}
-
-	return subdirs, nil
-}
-
-func evaluateModel(classifier *drone.Classifier, subdirs []string, config EvaluationConfig) EvaluationReport {
-	report := EvaluationReport{
-		Timestamp:       time.Now(),
-		ModelPath:       config.ModelPath,
-		ConfusionMatrix: make(map[string]map[string]int),
-	}
-
-	var allMetrics []ClassMetrics
-	totalCorrect := 0
-	totalSamples := 0
-	totalConfidence := 0.0
-
-	for _, subdir := range subdirs {
-		trueLabel := inferLabelFromDirectory(subdir)
-		metrics := evaluateClass(classifier, subdir, trueLabel, config, &report)
-
-		allMetrics = append(allMetrics, metrics)
-		totalCorrect += metrics.CorrectCount
-		totalSamples += metrics.TotalSamples
-		totalConfidence += metrics.AvgConfidence * float64(metrics.TotalSamples)
-	}
-
-	report.ClassMetrics = allMetrics
-	report.TotalSamples = totalSamples
-	report.CorrectCount = totalCorrect
-	report.OverallAccuracy = float64(totalCorrect) / float64(totalSamples) * 100
-	report.AvgConfidence = totalConfidence / float64(totalSamples)
-	report.ProcessingTime = time.Since(report.Timestamp)
-
-	return report
-}
-
-func evaluateClass(classifier *drone.Classifier, classDir string, trueLabel string,
-	config EvaluationConfig, report *EvaluationReport) ClassMetrics {
-
-	metrics := ClassMetrics{
-		ClassName: trueLabel,
+	if len(prototypes) < 2 {
+		log.Fatalf("ERROR: Cross-validation needs at least 2 prototypes, model has %d", len(prototypes))
 	}
 
-	files, err := collectAudioFiles(classDir)
-	if err != nil {
-		log.Printf("WARNING: Failed to read directory %s: %v\n", classDir, err)
-		return metrics
-	}
+	log.Printf("Cross-validating %d prototypes with %d folds...\n", len(prototypes), config.CVFolds)
+	report := drone.CrossValidate(prototypes, config.K, config.CVFolds)
 
-	if len(files) == 0 {
-		log.Printf("WARNING: No audio files in %s\n", classDir)
-		return metrics
+	log.Println()
+	log.Println("=" + strings.Repeat("=", 79))
+	log.Println("CROSS-VALIDATION RESULTS")
+	log.Println("=" + strings.Repeat("=", 79))
+	log.Printf("%-6s %8s %8s %10s\n", "Fold", "Samples", "Correct", "Accuracy")
+	log.Println(strings.Repeat("-", 80))
+	for _, fold := range report.Folds {
+		log.Printf("%-6d %8d %8d %9.1f%%\n", fold.Fold, fold.Samples, fold.Correct, fold.Accuracy)
 	}
+	log.Println(strings.Repeat("-", 80))
+	log.Printf("Mean Accuracy: %.2f%% (std %.2f%%)\n", report.MeanAccuracy, report.StdAccuracy)
 
-	var confidences []float64
-
-	for _, filePath := range files {
-		metrics.TotalSamples++
-
-		// Load and process audio
-		prediction, conf, err := classifyAudio(classifier, filePath)
-		if err != nil {
-			if config.Verbose {
-				log.Printf("  ERROR processing %s: %v\n", filepath.Base(filePath), err)
-			}
-			continue
-		}
-
-		confidences = append(confidences, conf)
-
-		// Update confusion matrix
-		if report.ConfusionMatrix[trueLabel] == nil {
-			report.ConfusionMatrix[trueLabel] = make(map[string]int)
+	if config.ReportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(config.ReportPath, data, 0644)
 		}
-		report.ConfusionMatrix[trueLabel][prediction]++
-
-		// Check if correct
-		if prediction == trueLabel {
-			metrics.CorrectCount++
+		if err != nil {
+			log.Printf("WARNING: Failed to save report: %v\n", err)
 		} else {
-			metrics.Misclassified = append(metrics.Misclassified, MisclassificationInfo{
-				Filename:       filepath.Base(filePath),
-				TrueLabel:      trueLabel,
-				PredictedLabel: prediction,
-				Confidence:     conf,
-			})
-		}
-	}
-
-	// Calculate statistics
-	if metrics.TotalSamples > 0 {
-		metrics.Accuracy = float64(metrics.CorrectCount) / float64(metrics.TotalSamples) * 100
-	}
-
-	if len(confidences) > 0 {
-		metrics.AvgConfidence = average(confidences)
-		metrics.ConfidenceStd = stddev(confidences, metrics.AvgConfidence)
-	}
-
-	return metrics
-}
-
-func classifyAudio(classifier *drone.Classifier, filePath string) (string, float64, error) {
-	// Convert to WAV if needed
-	wavPath, err := wav.ConvertToWAV(filePath, 1)
-	if err != nil {
-		return "", 0, err
-	}
-	defer func() {
-		if wavPath != filePath {
-			os.Remove(wavPath)
-		}
-	}()
-
-	// Read WAV
-	wavInfo, err := wav.ReadWavInfo(wavPath)
-	if err != nil {
-		return "", 0, err
-	}
-
-	// Extract samples
-	samples, err := wav.WavBytesToSamples(wavInfo.Data)
-	if err != nil {
-		return "", 0, err
-	}
-
-	// Preprocess
-	preprocessCfg := drone.DefaultPreprocessingConfig()
-	processed := drone.PreprocessAudio(samples, wavInfo.SampleRate, preprocessCfg)
-
-	// Extract features
-	features, err := drone.ExtractFeatureVector(processed, wavInfo.SampleRate)
-	if err != nil {
-		return "", 0, err
-	}
-
-	// Classify
-	predictions, err := classifier.Predict(features)
-	if err != nil || len(predictions) == 0 {
-		return "", 0, fmt.Errorf("classification failed")
-	}
-
-	return predictions[0].Label, predictions[0].Confidence, nil
-}
-
-func collectAudioFiles(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	var files []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		ext := strings.ToLower(filepath.Ext(entry.Name()))
-		if ext == ".wav" || ext == ".mp3" {
-			files = append(files, filepath.Join(dir, entry.Name()))
+			log.Printf("\nReport saved to: %s\n", config.ReportPath)
 		}
 	}
-
-	return files, nil
-}
-
-func inferLabelFromDirectory(dirPath string) string {
-	base := filepath.Base(dirPath)
-	label := strings.ToLower(base)
-	label = strings.ReplaceAll(label, "_", " ")
-	label = strings.ReplaceAll(label, "-", " ")
-	return strings.TrimSpace(label)
 }
 
-func printEvaluationReport(report EvaluationReport) {
+func printEvaluationReport(report drone.EvaluationReport) {
 	log.Println()
 	log.Println("=" + strings.Repeat("=", 79))
 	log.Println("EVALUATION RESULTS")
@@ -336,7 +178,7 @@ func printEvaluationReport(report EvaluationReport) {
 	log.Println(strings.Repeat("-", 80))
 
 	// Sort by accuracy for better readability
-	sortedMetrics := make([]ClassMetrics, len(report.ClassMetrics))
+	sortedMetrics := make([]drone.ClassMetrics, len(report.ClassMetrics))
 	copy(sortedMetrics, report.ClassMetrics)
 	sort.Slice(sortedMetrics, func(i, j int) bool {
 		return sortedMetrics[i].Accuracy > sortedMetrics[j].Accuracy
@@ -348,7 +190,7 @@ func printEvaluationReport(report EvaluationReport) {
 			status = "⚠"
 		}
 		log.Printf("%-20s %7.1f%% %9.1f%% %10d   %s\n",
-			m.ClassName, m.Accuracy, m.AvgConfidence*100, m.TotalSamples, status)
+			truncate(m.ClassName, 20), m.Accuracy, m.AvgConfidence*100, m.TotalSamples, status)
 	}
 	log.Println()
 
@@ -398,7 +240,7 @@ func printConfusionMatrix(matrix map[string]map[string]int) {
 	log.Println()
 }
 
-func printMisclassifications(metrics []ClassMetrics) {
+func printMisclassifications(metrics []drone.ClassMetrics) {
 	totalMisclassified := 0
 	for _, m := range metrics {
 		totalMisclassified += len(m.Misclassified)
@@ -425,7 +267,7 @@ func printMisclassifications(metrics []ClassMetrics) {
 	log.Println()
 }
 
-func printVerdict(report EvaluationReport) {
+func printVerdict(report drone.EvaluationReport) {
 	log.Println("=" + strings.Repeat("=", 79))
 	log.Println("VERDICT")
 	log.Println("=" + strings.Repeat("=", 79))
@@ -456,7 +298,7 @@ func printVerdict(report EvaluationReport) {
 	log.Println("=" + strings.Repeat("=", 79))
 }
 
-func saveReport(report EvaluationReport, path string) error {
+func saveReport(report drone.EvaluationReport, path string) error {
 	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
 		return err
@@ -464,32 +306,15 @@ func saveReport(report EvaluationReport, path string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-func average(values []float64) float64 {
-	if len(values) == 0 {
-		return 0
-	}
-	sum := 0.0
-	for _, v := range values {
-		sum += v
-	}
-	return sum / float64(len(values))
-}
-
-func stddev(values []float64, mean float64) float64 {
-	if len(values) == 0 {
-		return 0
-	}
-	variance := 0.0
-	for _, v := range values {
-		diff := v - mean
-		variance += diff * diff
-	}
-	return math.Sqrt(variance / float64(len(values)))
-}
-
+// truncate shortens s to maxLen runes, marking the cut with "..". It counts and cuts
+// runes rather than bytes so non-ASCII labels stay valid UTF-8 and line up in columns.
 func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	runes := []rune(s)
+	if len(runes) <= maxLen {
 		return s
 	}
-	return s[:maxLen-2] + ".."
+	if maxLen <= 2 {
+		return string(runes[:max(maxLen, 0)])
+	}
+	return string(runes[:maxLen-2]) + ".."
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKeepsMultiByteLabelsValid(t *testing.T) {
+	for _, test := range []struct {
+		label  string
+		maxLen int
+		want   string
+	}{
+		{"квадрокоптер", 6, "квад.."},
+		{"无人机-四旋翼", 6, "无人机-.."},
+		{"drone", 6, "drone"},
+		{"ドローン", 4, "ドローン"},
+		{"ドローン", 2, "ドロ"},
+	} {
+		got := truncate(test.label, test.maxLen)
+		if !utf8.ValidString(got) {
+			t.Fatalf("truncate(%q, %d) produced invalid UTF-8: %q", test.label, test.maxLen, got)
+		}
+		if got != test.want {
+			t.Fatalf("truncate(%q, %d) = %q, want %q", test.label, test.maxLen, got, test.want)
+		}
+		if n := utf8.RuneCountInString(got); n > test.maxLen {
+			t.Fatalf("truncate(%q, %d) kept %d runes", test.label, test.maxLen, n)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
 
@@ -165,6 +164,22 @@ func main() {
 		}
 	}
 
+	fmt.Println()
+	fmt.Printf("🧩 Features Driving the Match:\n")
+	explanation, err := classifier.Explain(features)
+	if err != nil {
+		fmt.Printf("   (unavailable: %v)\n", err)
+	} else {
+		fmt.Printf("   Distance to %s: %.4f\n", explanation.PrototypeID, explanation.Distance)
+		for i, contribution := range explanation.Contributions {
+			if i >= 5 {
+				break
+			}
+			fmt.Printf("   %d. %-28s %.6f (cumulative %.1f%%)\n",
+				i+1, contribution.Name, contribution.Contribution, contribution.CumulativePercent)
+		}
+	}
+
 	fmt.Println()
 	fmt.Printf("🧮 Understanding the Math:\n")
 	fmt.Printf("   1. Your test sample has 19 features\n")
@@ -224,16 +239,3 @@ func findProtoByID(prototypes []drone.Prototype, id string) drone.Prototype {
 	}
 	return drone.Prototype{ID: id, Label: "unknown", Source: "not found"}
 }
-
-func cosineSimilarity(a, b []float64) float64 {
-	var dotProduct, normA, normB float64
-	for i := 0; i < len(a) && i < len(b); i++ {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
-	}
-	if normA == 0 || normB == 0 {
-		return 0
-	}
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
-}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"path/filepath"
+
+	"song-recognition/drone"
+	"song-recognition/utils"
+)
+
+// Recompute prototype features with the current extraction code after it changes
+func main() {
+	modelPath := flag.String("model", utils.GetEnv("DRONE_MODEL_PATH", filepath.Join("drone", "prototypes.json")), "Model file to refresh in place")
+	flag.Parse()
+
+	log.Printf("Refreshing prototypes in %s\n", *modelPath)
+	refreshed, skipped, err := drone.RefreshModel(*modelPath)
+	if err != nil {
+		log.Fatalf("failed to refresh model: %v", err)
+	}
+
+	log.Printf("✓ Refreshed %d prototypes (%d skipped: source missing)", refreshed, skipped)
+	if skipped > 0 {
+		log.Println("Run cmd/check_prototype_sources to list the prototypes whose sources are missing")
+	}
+}
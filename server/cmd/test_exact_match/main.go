@@ -33,8 +33,9 @@ func main() {
 		fmt.Printf("%d. %s (label: %s) from: %s\n", i+1, proto.ID, proto.Label, proto.Source)
 	}
 
-	// Load classifier
-	classifier, err := drone.NewClassifierFromFile(modelPath, 3)
+	// Load classifier; DRONE_DISABLE_SCALING=true compares self-matching without the scaler
+	disableScaling := utils.GetEnv("DRONE_DISABLE_SCALING", "false") == "true"
+	classifier, err := drone.NewClassifierFromFileWithOptions(modelPath, 3, drone.LoadOptions{DisableScaling: disableScaling})
 	if err != nil {
 		log.Fatalf("Failed to load classifier: %v", err)
 	}
@@ -96,6 +97,10 @@ func main() {
 			continue
 		}
 
+		// Pinpoint the dimensions that drifted since the prototype was built
+		fmt.Println("  Largest feature changes since the prototype was built:")
+		drone.PrintFeatureDiff(drone.DiffFeatures(proto.Features, features), 5)
+
 		// Classify
 		predictions, err := classifier.Predict(features)
 		if err != nil {
@@ -153,6 +158,7 @@ func main() {
 	fmt.Println("2. Feature scaler transforms based on this tiny dataset")
 	fmt.Println("3. After z-score scaling, small sample variance causes distortion")
 	fmt.Println("4. Solution: Add 20-50 more prototypes OR disable feature scaling")
+	fmt.Println("   (rerun with DRONE_DISABLE_SCALING=true to compare)")
 }
 
 func findProtoByID(prototypes []drone.Prototype, id string) drone.Prototype {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -20,6 +21,12 @@ func main() {
 		log.Fatalf("Failed to load classifier: %v", err)
 	}
 
+	// Raw (unscaled) prototype features, for diffing against fresh extraction
+	prototypes, err := loadRawPrototypes(modelPath)
+	if err != nil {
+		log.Fatalf("Failed to read prototypes: %v", err)
+	}
+
 	// Get list of prototype sources
 	stats := classifier.Stats()
 	fmt.Printf("Loaded classifier with %d prototypes across %d labels\n\n", stats.PrototypeCount, stats.LabelCount)
@@ -72,6 +79,11 @@ func main() {
 			continue
 		}
 
+		if proto, ok := prototypeForSource(prototypes, testFile); ok {
+			fmt.Printf("  Largest feature changes since %s was built:\n", proto.ID)
+			drone.PrintFeatureDiff(drone.DiffFeatures(proto.Features, features), 5)
+		}
+
 		// Classify
 		predictions, err := classifier.Predict(features)
 		if err != nil {
@@ -112,3 +124,25 @@ func main() {
 	fmt.Println("2. High variance in features makes scaling unstable")
 	fmt.Println("3. Need more diverse training data to compute stable mean/stddev")
 }
+
+func loadRawPrototypes(path string) ([]drone.Prototype, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prototypes []drone.Prototype
+	if err := json.Unmarshal(data, &prototypes); err != nil {
+		return nil, fmt.Errorf("failed to parse prototypes: %w", err)
+	}
+	return prototypes, nil
+}
+
+// prototypeForSource finds the prototype built from the file with the same base name.
+func prototypeForSource(prototypes []drone.Prototype, path string) (drone.Prototype, bool) {
+	for _, proto := range prototypes {
+		if proto.Source != "" && filepath.Base(proto.Source) == filepath.Base(path) {
+			return proto, true
+		}
+	}
+	return drone.Prototype{}, false
+}
@@ -1,12 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
-	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,18 +15,10 @@ type Config struct {
 	TrainingDataDir string
 	OutputPath      string
 	Category        string
+	NoiseKeywords   string
 	Verbose         bool
 }
 
-// TrainingStats tracks training process statistics
-type TrainingStats struct {
-	TotalSamples     int
-	SuccessfulCount  int
-	FailedCount      int
-	LabelCounts      map[string]int
-	ProcessingTimeMs float64
-}
-
 func main() {
 	config := parseFlags()
 
@@ -41,50 +30,45 @@ func main() {
 
 	startTime := time.Now()
 
-	// Step 1: Discover training data structure
-	log.Println("Step 1: Discovering training data...")
-	subdirs, err := discoverSubdirectories(config.TrainingDataDir)
+	// Step 1: Build prototypes from the class folders
+	log.Println("Step 1: Building prototypes from audio files...")
+	prototypes, stats, err := drone.IngestDirectory(drone.IngestOptions{
+		Dir:           config.TrainingDataDir,
+		Category:      config.Category,
+		NoiseKeywords: strings.Split(config.NoiseKeywords, ","),
+		Progress: func(path string, proto drone.Prototype, err error) {
+			if err != nil {
+				log.Printf("  ERROR processing %s: %v\n", path, err)
+			} else if config.Verbose {
+				log.Printf("  %s -> %s (%s) ✓\n", path, proto.Label, proto.Category)
+			}
+		},
+	})
 	if err != nil {
 		log.Fatalf("ERROR: Failed to read training directory: %v", err)
 	}
 
-	if len(subdirs) == 0 {
-		log.Fatalf("ERROR: No subdirectories found in %s", config.TrainingDataDir)
-	}
-
-	log.Printf("Found %d classes:\n", len(subdirs))
-	for _, dir := range subdirs {
-		files, _ := collectAudioFiles(dir)
-		log.Printf("  - %s: %d samples\n", filepath.Base(dir), len(files))
-	}
-	log.Println()
-
-	// Step 2: Build prototypes
-	log.Println("Step 2: Building prototypes from audio files...")
-	prototypes, stats := buildPrototypes(subdirs, config)
-
 	if len(prototypes) == 0 {
 		log.Fatalf("ERROR: No prototypes were created")
 	}
 
-	log.Printf("Successfully created %d/%d prototypes\n",
-		stats.SuccessfulCount, stats.TotalSamples)
-	if stats.FailedCount > 0 {
-		log.Printf("WARNING: %d samples failed to process\n", stats.FailedCount)
+	log.Printf("Successfully created %d/%d prototypes\n", stats.Created, stats.Files)
+	if stats.Failed > 0 {
+		log.Printf("WARNING: %d samples failed to process\n", stats.Failed)
 	}
 	log.Println()
 
-	// Step 3: Save prototypes
-	log.Println("Step 3: Saving model to disk...")
-	if err := savePrototypes(prototypes, config.OutputPath); err != nil {
+	// Step 2: Save prototypes
+	log.Println("Step 2: Saving model to disk...")
+	if err := drone.WritePrototypes(config.OutputPath, prototypes); err != nil {
 		log.Fatalf("ERROR: Failed to save prototypes: %v", err)
 	}
 
 	log.Printf("Model saved to: %s\n", config.OutputPath)
 	log.Println()
 
-	// Step 4: Print summary
-	printTrainingSummary(prototypes, stats, startTime)
+	// Step 3: Print summary
+	printTrainingSummary(stats, startTime)
 }
 
 func parseFlags() Config {
@@ -96,6 +80,8 @@ func parseFlags() Config {
 		"Output path for trained model (prototypes JSON file)")
 	flag.StringVar(&config.Category, "category", "drone",
 		"Default category for samples (drone/noise)")
+	flag.StringVar(&config.NoiseKeywords, "noise-keywords", "",
+		"Comma-separated keywords marking extra noise labels, on top of drone.NoiseKeywords")
 	flag.BoolVar(&config.Verbose, "verbose", false,
 		"Enable verbose logging")
 
@@ -109,195 +95,33 @@ func parseFlags() Config {
 	return config
 }
 
-func discoverSubdirectories(rootDir string) ([]string, error) {
-	entries, err := os.ReadDir(rootDir)
-	if err != nil {
-		return nil, err
-	}
-
-	var subdirs []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		// Skip hidden directories
-		if strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
-		subdirs = append(subdirs, filepath.Join(rootDir, entry.Name()))
-	}
-
-	return subdirs, nil
-}
-
-func collectAudioFiles(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	var files []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		ext := strings.ToLower(filepath.Ext(entry.Name()))
-		if ext == ".wav" || ext == ".mp3" {
-			files = append(files, filepath.Join(dir, entry.Name()))
-		}
-	}
-
-	return files, nil
-}
-
-func buildPrototypes(subdirs []string, config Config) ([]drone.Prototype, TrainingStats) {
-	var allPrototypes []drone.Prototype
-	stats := TrainingStats{
-		LabelCounts: make(map[string]int),
-	}
-
-	for _, subdir := range subdirs {
-		label := inferLabelFromDirectory(subdir)
-		category := inferCategory(label, config.Category)
-
-		if config.Verbose {
-			log.Printf("Processing class: %s (category: %s)\n", label, category)
-		}
-
-		files, err := collectAudioFiles(subdir)
-		if err != nil {
-			log.Printf("  WARNING: Failed to read directory %s: %v\n", subdir, err)
-			continue
-		}
-
-		if len(files) == 0 {
-			log.Printf("  WARNING: No audio files in %s\n", subdir)
-			continue
-		}
-
-		// Process each audio file
-		for i, filePath := range files {
-			stats.TotalSamples++
-
-			if config.Verbose {
-				log.Printf("  [%d/%d] %s", i+1, len(files), filepath.Base(filePath))
-			}
-
-			proto, err := drone.BuildPrototypeFromPath(
-				filePath,
-				label,
-				category,
-				fmt.Sprintf("%s from %s", label, filepath.Base(filePath)),
-				filePath,
-				nil,
-			)
-
-			if err != nil {
-				log.Printf("  ERROR processing %s: %v\n", filepath.Base(filePath), err)
-				stats.FailedCount++
-				continue
-			}
-
-			allPrototypes = append(allPrototypes, proto)
-			stats.LabelCounts[label]++
-			stats.SuccessfulCount++
-
-			if config.Verbose {
-				log.Printf(" ✓\n")
-			}
-		}
-	}
-
-	return allPrototypes, stats
-}
-
-func inferLabelFromDirectory(dirPath string) string {
-	base := filepath.Base(dirPath)
-
-	// Clean up the name
-	label := strings.ToLower(base)
-	label = strings.ReplaceAll(label, "_", " ")
-	label = strings.ReplaceAll(label, "-", " ")
-	label = strings.TrimSpace(label)
-
-	return label
-}
-
-func inferCategory(label string, defaultCategory string) string {
-	labelLower := strings.ToLower(label)
-
-	// Auto-detect noise/non-drone samples
-	noiseKeywords := []string{"noise", "ambient", "silence", "background"}
-
-	for _, keyword := range noiseKeywords {
-		if strings.Contains(labelLower, keyword) {
-			return "noise"
-		}
-	}
-
-	return defaultCategory
-}
-
-func savePrototypes(prototypes []drone.Prototype, outputPath string) error {
-	// Ensure output directory exists
-	outDir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	// Marshal to JSON with indentation for readability
-	data, err := json.MarshalIndent(prototypes, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal prototypes: %w", err)
-	}
-
-	// Write atomically using temp file
-	tempPath := outputPath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, outputPath); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename temp file: %w", err)
-	}
-
-	return nil
-}
-
-func printTrainingSummary(prototypes []drone.Prototype, stats TrainingStats, startTime time.Time) {
+func printTrainingSummary(stats drone.IngestStats, startTime time.Time) {
 	elapsed := time.Since(startTime)
 
-	// Calculate category distribution
-	categoryCount := make(map[string]int)
-	for _, p := range prototypes {
-		categoryCount[p.Category]++
-	}
-
 	log.Println("=== Training Summary ===")
 	log.Println()
-	log.Printf("Total training samples: %d\n", stats.TotalSamples)
+	log.Printf("Total training samples: %d\n", stats.Files)
 	log.Printf("Successfully processed: %d (%.1f%%)\n",
-		stats.SuccessfulCount,
-		float64(stats.SuccessfulCount)/float64(stats.TotalSamples)*100)
-	log.Printf("Failed to process: %d\n", stats.FailedCount)
+		stats.Created,
+		float64(stats.Created)/float64(stats.Files)*100)
+	log.Printf("Failed to process: %d\n", stats.Failed)
 	log.Println()
 
 	log.Println("Class distribution:")
-	for label, count := range stats.LabelCounts {
+	for label, count := range stats.Labels {
 		log.Printf("  %-20s: %3d prototypes\n", label, count)
 	}
 	log.Println()
 
 	log.Println("Category distribution:")
-	for category, count := range categoryCount {
+	for category, count := range stats.Categories {
 		log.Printf("  %-20s: %3d prototypes\n", category, count)
 	}
 	log.Println()
 
 	log.Printf("Total training time: %.2f seconds\n", elapsed.Seconds())
 	log.Printf("Average time per sample: %.2f ms\n",
-		elapsed.Seconds()*1000/float64(stats.TotalSamples))
+		elapsed.Seconds()*1000/float64(stats.Files))
 	log.Println()
 	log.Println("✓ Training complete!")
 }
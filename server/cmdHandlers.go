@@ -3,23 +3,30 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"song-recognition/detections"
 	"song-recognition/drone"
 	"song-recognition/embedding"
+	"song-recognition/metrics"
 	"song-recognition/models"
 	"song-recognition/utils"
+	"song-recognition/wav"
 
 	socketio "github.com/googollee/go-socket.io"
 	"github.com/googollee/go-socket.io/engineio"
@@ -31,11 +38,13 @@ import (
 
 type apiError struct {
 	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
 }
 
 type prototypeUploadResponse struct {
-	Added []drone.Prototype `json:"added"`
-	Stats drone.ModelStats  `json:"stats"`
+	Added          []drone.Prototype `json:"added"`
+	Stats          drone.ModelStats  `json:"stats"`
+	PersistPending bool              `json:"persistPending,omitempty"` // model file write is deferred
 }
 
 const (
@@ -59,13 +68,130 @@ func writeJSONError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, apiError{Message: message})
 }
 
-func newPrototypeUploadHandler(classifier *drone.Classifier) http.HandlerFunc {
+// defaultMaxRequestBytes bounds recording uploads; 20 s of stereo 48 kHz audio is ~5 MB
+// once base64 encoded.
+const defaultMaxRequestBytes = 32 << 20
+
+// maxRequestBytes returns DRONE_MAX_REQUEST_BYTES, or defaultMaxRequestBytes when it is
+// unset or invalid.
+func maxRequestBytes() int64 {
+	maxBytes, err := strconv.ParseInt(utils.GetEnv("DRONE_MAX_REQUEST_BYTES", strconv.Itoa(defaultMaxRequestBytes)), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		return defaultMaxRequestBytes
+	}
+	return maxBytes
+}
+
+// decodeRecordData decodes a size-limited RecordData body. The returned error is safe to
+// show to clients and names what was wrong.
+func decodeRecordData(w http.ResponseWriter, r *http.Request, recData *models.RecordData) *drone.ClassifyError {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes()))
+	if strings.EqualFold(utils.GetEnv("DRONE_STRICT_JSON", "false"), "true") {
+		decoder.DisallowUnknownFields()
+	}
+
+	err := decoder.Decode(recData)
+	if err == nil {
+		return nil
+	}
+	invalid := func(message string) *drone.ClassifyError {
+		return drone.NewClassifyError(drone.CodeInvalidRequest, message, err)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return drone.NewClassifyError(drone.CodePayloadTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit), err)
+	case errors.As(err, &syntaxErr):
+		return invalid(fmt.Sprintf("malformed JSON at byte %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return invalid("malformed JSON: body ended unexpectedly")
+	case errors.Is(err, io.EOF):
+		return invalid("request body is empty")
+	case errors.As(err, &typeErr):
+		return invalid(fmt.Sprintf("invalid value for field %q: expected %s", typeErr.Field, typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return invalid(fmt.Sprintf("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field ")))
+	default:
+		return invalid("invalid request payload")
+	}
+}
+
+// verboseResponse reports whether classification responses carry per-window predictions
+// and the raw feature vector. ?verbose= overrides the DRONE_VERBOSE_RESPONSES default.
+func verboseResponse(r *http.Request) bool {
+	if value := r.URL.Query().Get("verbose"); value != "" {
+		if verbose, err := strconv.ParseBool(value); err == nil {
+			return verbose
+		}
+	}
+	return utils.GetEnv("DRONE_VERBOSE_RESPONSES", "true") == "true"
+}
+
+// fullWindowDetail reports whether verbose responses carry every label's prediction per
+// window rather than only the top label. ?windows=full or ?windows=compact overrides the
+// DRONE_WINDOW_DETAIL default.
+func fullWindowDetail(r *http.Request) bool {
+	if value := r.URL.Query().Get("windows"); value == "full" || value == "compact" {
+		return value == "full"
+	}
+	return utils.GetEnv("DRONE_WINDOW_DETAIL", "compact") == "full"
+}
+
+// preprocessingConfig returns the default preprocessing with any highpass, bandpass,
+// agc or noisereduction query parameter applied. Noise reduction estimates the noise
+// floor from sample amplitudes, so it is rejected when both filters that remove DC and
+// rumble are switched off.
+func preprocessingConfig(r *http.Request) (drone.PreprocessingConfig, error) {
+	config := drone.DefaultPreprocessingConfig()
+	query := r.URL.Query()
+	for _, toggle := range []struct {
+		name string
+		flag *bool
+	}{
+		{"highpass", &config.EnableHighPass},
+		{"bandpass", &config.EnableBandPass},
+		{"agc", &config.EnableAGC},
+		{"noisereduction", &config.EnableNoiseReduction},
+		{"robustsnr", &config.RobustSNR},
+	} {
+		value := query.Get(toggle.name)
+		if value == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s value %q: expected true or false", toggle.name, value)
+		}
+		*toggle.flag = enabled
+	}
+
+	if config.EnableNoiseReduction && !config.EnableHighPass && !config.EnableBandPass {
+		return config, errors.New("noisereduction requires highpass or bandpass")
+	}
+	return config, nil
+}
+
+// writeClassifyError responds with err as JSON under its code's HTTP status.
+func writeClassifyError(w http.ResponseWriter, err *drone.ClassifyError) {
+	writeJSON(w, err.HTTPStatus(), err)
+}
+
+// writeAudioToolingError reports missing FFmpeg as a server-side tooling problem
+// together with installation guidance, rather than as undecodable audio.
+func writeAudioToolingError(w http.ResponseWriter) {
+	writeClassifyError(w, drone.AsClassifyError(wav.ErrFFmpegUnavailable))
+}
+
+func newPrototypeUploadHandler(registry *modelRegistry) http.HandlerFunc {
 	logger := utils.GetLogger()
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
 
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Drone-Model")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -79,6 +205,18 @@ func newPrototypeUploadHandler(classifier *drone.Classifier) http.HandlerFunc {
 			return
 		}
 
+		if err := wav.CheckFFmpegAvailable(); err != nil {
+			logger.ErrorContext(ctx, "rejecting upload, audio tooling unavailable", slog.Any("error", err))
+			writeAudioToolingError(w)
+			return
+		}
+
+		classifier, modelName, err := registry.resolve(requestedModel(r))
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
 		if err := r.ParseMultipartForm(256 << 20); err != nil {
 			logger.ErrorContext(ctx, "failed to parse multipart form", slog.Any("error", err))
 			writeJSONError(w, http.StatusBadRequest, "invalid upload payload")
@@ -196,31 +334,105 @@ func newPrototypeUploadHandler(classifier *drone.Classifier) http.HandlerFunc {
 			added = append(added, stored)
 		}
 
-		// Persist prototypes to disk if any were successfully added
+		// Persist prototypes to disk if any were successfully added. With a persist delay
+		// the write is coalesced with other uploads and happens after the response.
+		var persistPending bool
 		if len(added) > 0 {
-			if err := classifier.SavePrototypesToFile(); err != nil {
+			pending, err := classifier.SchedulePersist()
+			if err != nil {
 				logger.ErrorContext(ctx, "failed to save prototypes to disk", slog.Any("error", err))
 				// Continue anyway - prototypes are in memory, just not persisted
+			} else if pending {
+				persistPending = true
+				logger.InfoContext(ctx, "scheduled prototype save", slog.Int("count", len(added)))
 			} else {
 				logger.InfoContext(ctx, "persisted prototypes to disk", slog.Int("count", len(added)))
 			}
 		}
+		if len(added) > 0 && modelName == defaultModelName {
+			registry.refreshDerivedThreshold()
+		}
 
 		stats := classifier.Stats()
 		writeJSON(w, http.StatusOK, prototypeUploadResponse{
-			Added: added,
-			Stats: stats,
+			Added:          added,
+			Stats:          stats,
+			PersistPending: persistPending,
+		})
+	}
+}
+
+type prototypeDeleteResponse struct {
+	Removed        string           `json:"removed"`
+	Stats          drone.ModelStats `json:"stats"`
+	PersistPending bool             `json:"persistPending,omitempty"` // model file write is deferred
+}
+
+// newPrototypeDeleteHandler removes a prototype, e.g. a bad upload, by ID and saves the
+// model.
+func newPrototypeDeleteHandler(registry *modelRegistry) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Drone-Model")
+		w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodDelete {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		classifier, modelName, err := registry.resolve(requestedModel(r))
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		id := r.PathValue("id")
+		removed, err := classifier.RemovePrototype(id)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !removed {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s: %s", drone.ErrPrototypeNotFound, id))
+			return
+		}
+
+		pending, err := classifier.SchedulePersist()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to save prototypes to disk", slog.Any("error", err))
+			// Continue anyway - the prototype is gone from memory, just not from the file
+		} else {
+			logger.InfoContext(ctx, "removed prototype", slog.String("id", id), slog.Bool("persistPending", pending))
+		}
+		if modelName == defaultModelName {
+			registry.refreshDerivedThreshold()
+		}
+
+		writeJSON(w, http.StatusOK, prototypeDeleteResponse{
+			Removed:        id,
+			Stats:          classifier.Stats(),
+			PersistPending: pending,
 		})
 	}
 }
 
-func newAudioClassificationHandler(classifier *drone.Classifier, templateMatcher *drone.TemplateMatcher, persistRecordings bool) http.HandlerFunc {
+func newAudioClassificationHandler(registry *modelRegistry, extractor drone.FeatureExtractor, templateMatcher *drone.TemplateMatcher, persistRecordings bool, noiseFloor *drone.NoiseFloorTracker, calibrations *drone.NoiseCalibrationStore) http.HandlerFunc {
 	logger := utils.GetLogger()
+	classify := newRecordingClassifier(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations)
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
 
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Drone-Model")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -234,10 +446,16 @@ func newAudioClassificationHandler(classifier *drone.Classifier, templateMatcher
 			return
 		}
 
+		if err := wav.CheckFFmpegAvailable(); err != nil {
+			logger.ErrorContext(ctx, "rejecting classification, audio tooling unavailable", slog.Any("error", err))
+			writeAudioToolingError(w)
+			return
+		}
+
 		var recData models.RecordData
-		if err := json.NewDecoder(r.Body).Decode(&recData); err != nil {
-			logger.ErrorContext(ctx, "failed to parse request body", slog.Any("error", err))
-			writeJSONError(w, http.StatusBadRequest, "invalid request payload")
+		if err := decodeRecordData(w, r, &recData); err != nil {
+			logger.ErrorContext(ctx, "failed to parse request body", slog.Any("error", err.Err))
+			writeClassifyError(w, err)
 			return
 		}
 
@@ -246,18 +464,130 @@ func newAudioClassificationHandler(classifier *drone.Classifier, templateMatcher
 
 		if recData.Audio == "" {
 			logger.ErrorContext(ctx, "no audio data received")
-			writeJSONError(w, http.StatusBadRequest, "no audio data received")
+			writeClassifyError(w, drone.NewClassifyError(drone.CodeInvalidRequest, `missing required field "audio"`, nil))
+			return
+		}
+
+		classify(w, r, recData)
+	}
+}
+
+// extractFeatures runs extractor on sample, falling back to the legacy features when it
+// fails (e.g. the PANNS service is down). It returns the extractor that produced the
+// features so callers know whether sliding-window analysis applies. modelDimension is
+// the feature dimension of the model the features are for (0 when empty), which the
+// fallback features must match. Errors are *drone.ClassifyError.
+func extractFeatures(ctx context.Context, logger *slog.Logger, extractor drone.FeatureExtractor, sample *drone.AudioSample, modelDimension int) ([]float64, drone.FeatureExtractor, error) {
+	if len(sample.Samples) == 0 {
+		return nil, nil, drone.NewClassifyError(drone.CodeAudioTooShort, "recording holds no audio samples", nil)
+	}
+
+	features, err := extractor.Extract(sample)
+	if err != nil {
+		if _, legacy := extractor.(*drone.LegacyExtractor); legacy {
+			return nil, nil, drone.NewClassifyError(drone.CodeFeatureExtraction, "unable to extract features", err)
+		}
+		switch {
+		case errors.Is(err, embedding.ErrCircuitOpen):
+			logger.WarnContext(ctx, "embedding service circuit open, falling back to legacy features",
+				slog.Any("error", err))
+		case errors.Is(err, embedding.ErrDimensionMismatch):
+			logger.WarnContext(ctx, "embedding has the wrong dimension, falling back to legacy features",
+				slog.Any("error", err))
+		default:
+			logger.WarnContext(ctx, "feature extraction failed, falling back to legacy features",
+				slog.Any("error", err))
+		}
+		cause := err
+		extractor = drone.NewLegacyExtractor()
+		if features, err = extractor.Extract(sample); err != nil {
+			return nil, nil, drone.NewClassifyError(drone.CodeFeatureExtraction, "unable to extract features", err)
+		}
+		// Legacy features cannot be compared with a model of embeddings
+		if modelDimension != 0 && len(features) != modelDimension {
+			return nil, nil, drone.NewClassifyError(drone.CodeEmbeddingUnavailable,
+				"embedding service unavailable and the model has no legacy features to fall back on", cause)
+		}
+	}
+
+	logger.InfoContext(ctx, "extracted feature vector",
+		slog.String("extractor", fmt.Sprintf("%T", extractor)),
+		slog.Int("dimension", len(features)),
+	)
+	return features, extractor, nil
+}
+
+// recordingClassifier runs the classification pipeline on a decoded recording and writes
+// the summary (or error) response.
+type recordingClassifier func(w http.ResponseWriter, r *http.Request, recData models.RecordData)
+
+func newRecordingClassifier(registry *modelRegistry, extractor drone.FeatureExtractor, templateMatcher *drone.TemplateMatcher, persistRecordings bool, noiseFloor *drone.NoiseFloorTracker, calibrations *drone.NoiseCalibrationStore) recordingClassifier {
+	classify := newRecordingPipeline(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations)
+	return func(w http.ResponseWriter, r *http.Request, recData models.RecordData) {
+		modelName := requestedModel(r)
+		if modelName == "" {
+			modelName = recData.Model
+		}
+
+		preprocessing, err := preprocessingConfig(r)
+		if err != nil {
+			writeClassifyError(w, drone.NewClassifyError(drone.CodeInvalidRequest, err.Error(), err))
+			return
+		}
+
+		summary, err := classify(r.Context(), recData, modelName, preprocessing)
+		switch {
+		case errors.Is(err, drone.ErrEmptyModel):
+			// The summary says which model is empty, so clients still get a result shape
+			writeJSON(w, drone.CodeModelEmpty.HTTPStatus(), summary)
+			return
+		case err != nil:
+			writeClassifyError(w, drone.AsClassifyError(err))
 			return
 		}
 
+		// Decisions used every label; clients may only want the strongest few
+		summary.Predictions = drone.TopPredictions(summary.Predictions, detectionSettingsFromEnv(registry).TopN)
+
+		if !verboseResponse(r) {
+			// Keep the payload small: consolidated predictions are all most clients need
+			summary.Windows = nil
+			summary.FeatureVector = nil
+		} else if !fullWindowDetail(r) {
+			summary.Windows = drone.CompactWindows(summary.Windows)
+		}
+
+		log.Printf("[HTTP] Returning classification with location: lat=%v, lng=%v\n", summary.Latitude, summary.Longitude)
+		writeJSON(w, http.StatusOK, summary)
+	}
+}
+
+// recordingPipeline classifies a decoded recording against the named model (empty for
+// the default) and returns the full summary, with every prediction; callers trim it to
+// DRONE_TOP_N for clients. It is shared by the HTTP, gRPC and socket transports; an
+// empty model yields drone.ErrEmptyModel alongside a summary saying so,
+// and other failures are *drone.ClassifyError or unexpected classifier errors.
+type recordingPipeline func(ctx context.Context, recData models.RecordData, modelName string, preprocessing drone.PreprocessingConfig) (drone.ClassificationSummary, error)
+
+func newRecordingPipeline(registry *modelRegistry, extractor drone.FeatureExtractor, templateMatcher *drone.TemplateMatcher, persistRecordings bool, noiseFloor *drone.NoiseFloorTracker, calibrations *drone.NoiseCalibrationStore) recordingPipeline {
+	logger := utils.GetLogger()
+	return func(ctx context.Context, recData models.RecordData, modelName string, preprocessing drone.PreprocessingConfig) (drone.ClassificationSummary, error) {
+		classifier, modelName, err := registry.resolve(modelName)
+		if err != nil {
+			return drone.ClassificationSummary{}, drone.NewClassifyError(drone.CodeModelNotFound, err.Error(), err)
+		}
+
 		started := time.Now()
 
-		audioSample, err := drone.PrepareAudioSample(recData, persistRecordings)
+		audioSample, err := drone.PrepareAudioSampleWithConfig(recData, persistRecordings, preprocessing)
 		if err != nil {
+			cause := err
 			err := xerrors.New(err)
 			logger.ErrorContext(ctx, "failed to prepare audio sample", slog.Any("error", err))
-			writeJSONError(w, http.StatusBadRequest, "unable to decode audio")
-			return
+			if errors.Is(cause, wav.ErrFFmpegUnavailable) {
+				return drone.ClassificationSummary{}, drone.AsClassifyError(cause)
+			}
+			return drone.ClassificationSummary{}, drone.NewClassifyError(drone.CodeAudioUndecodable, "unable to decode audio", cause)
 		}
 
 		logger.InfoContext(ctx, "prepared audio sample",
@@ -265,142 +595,333 @@ func newAudioClassificationHandler(classifier *drone.Classifier, templateMatcher
 			slog.Int("frameCount", len(audioSample.Samples)),
 			slog.Float64("duration", audioSample.Duration),
 			slog.Bool("persisted", audioSample.Persisted != ""),
+			slog.Bool("qualityUsable", audioSample.Quality.Usable),
+			slog.Any("preprocessing", preprocessing),
 		)
 
-		// Extract features - use PANNS if available and prototypes are PANNS-based
-		var features []float64
-		usePANNS := utils.GetEnv("USE_PANNS_EMBEDDINGS", "true") == "true"
-
-		if usePANNS && audioSample.Persisted != "" {
-			// Use PANNS embedding service
-			embeddingServiceURL := utils.GetEnv("EMBEDDING_SERVICE_URL", "http://localhost:5002")
-			pannsClient := embedding.NewPANNSClient(embeddingServiceURL)
-
-			// Call PANNS service to get embedding
-			embedding, err := pannsClient.EmbedFile(audioSample.Persisted)
-			if err != nil {
-				logger.WarnContext(ctx, "PANNS embedding failed, falling back to legacy features",
-					slog.Any("error", err))
-				// Fall back to old feature extraction
-				features, err = drone.ExtractFeatureVector(audioSample.Samples, audioSample.SampleRate)
-				if err != nil {
-					err := xerrors.New(err)
-					logger.ErrorContext(ctx, "failed to extract features", slog.Any("error", err))
-					writeJSONError(w, http.StatusInternalServerError, "unable to extract features")
-					return
-				}
-			} else {
-				features = embedding
-				logger.InfoContext(ctx, "extracted PANNS embedding",
-					slog.Int("dimension", len(features)),
-				)
-			}
-		} else {
-			// Use legacy feature extraction
-			features, err = drone.ExtractFeatureVector(audioSample.Samples, audioSample.SampleRate)
-			if err != nil {
-				err := xerrors.New(err)
-				logger.ErrorContext(ctx, "failed to extract features", slog.Any("error", err))
-				writeJSONError(w, http.StatusInternalServerError, "unable to extract features")
-				return
-			}
-			logger.InfoContext(ctx, "extracted legacy feature vector",
-				slog.Int("length", len(features)),
-			)
+		features, used, err := extractFeatures(ctx, logger, extractor, audioSample, classifier.FeatureDimension())
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to extract features", slog.Any("error", xerrors.New(err)))
+			return drone.ClassificationSummary{}, err
 		}
 
 		var predictions []drone.Prediction
 		var templatePredictions []drone.Prediction
 		var windowSummaries []drone.WindowPrediction
-
-		// Sliding windows are incompatible with PANNS embeddings (which are for entire files)
-		// Only use sliding windows for legacy feature extraction
-		useSliding := audioSample.Duration >= minSlidingAnalysisDurationSec && len(features) != 2048
-		if useSliding {
-			windowPredictions, windows, err := classifier.PredictWithSlidingWindows(
-				audioSample.Samples,
-				audioSample.SampleRate,
-				slidingWindowDurationSeconds,
-				slidingWindowOverlapSeconds,
-			)
-			if err != nil {
-				logger.WarnContext(ctx, "sliding window analysis failed, falling back to single-pass",
-					slog.Any("error", err),
+		var windowCount int
+		var windowed bool
+
+		settings := detectionSettingsFromEnv(registry)
+
+		// Scale and normalise once; the classifier and the templates both compare this vector
+		query := classifier.PrepareQuery(features)
+
+		// stageTwo is the full classification: sliding windows where they apply, the
+		// whole-clip prediction otherwise, then the templates
+		var templatesMerged bool
+		stageTwo := func(wholeClip []drone.Prediction) ([]drone.Prediction, error) {
+			var predictions []drone.Prediction
+
+			// Whole-file representations such as PANNS embeddings cannot be compared per window
+			useSliding := audioSample.Duration >= minSlidingAnalysisDurationSec && used.SupportsSlidingWindows()
+			if useSliding {
+				windowPredictions, windows, err := classifier.PredictWithSlidingWindows(
+					audioSample.Samples,
+					audioSample.SampleRate,
+					slidingWindowDurationSeconds,
+					slidingWindowOverlapSeconds,
 				)
-			} else {
-				if len(windowPredictions) > 0 {
-					predictions = windowPredictions
+				if err != nil {
+					logger.WarnContext(ctx, "sliding window analysis failed, falling back to single-pass",
+						slog.Any("error", err),
+					)
+				} else {
+					if len(windowPredictions) > 0 {
+						predictions = windowPredictions
+						windowed = true
+					}
+					windowSummaries = windows
+					windowCount = classifier.SlidingWindowCount(len(audioSample.Samples), audioSample.SampleRate, slidingWindowDurationSeconds, slidingWindowOverlapSeconds)
+					logger.InfoContext(ctx, "applied sliding window analysis",
+						slog.Int("windowCount", len(windowSummaries)),
+						slog.Int("totalWindows", windowCount),
+					)
 				}
-				windowSummaries = windows
-				logger.InfoContext(ctx, "applied sliding window analysis",
-					slog.Int("windowCount", len(windowSummaries)),
-				)
+			} else if !used.SupportsSlidingWindows() {
+				logger.InfoContext(ctx, "using whole-file features (skipping sliding windows)")
 			}
-		} else if len(features) == 2048 {
-			logger.InfoContext(ctx, "using PANNS whole-file embedding (skipping sliding windows)")
-		}
 
-		if len(predictions) == 0 {
-			predictions, err = classifier.Predict(features)
-			if err != nil {
-				err := xerrors.New(err)
-				logger.ErrorContext(ctx, "failed to run classifier", slog.Any("error", err))
-				writeJSONError(w, http.StatusInternalServerError, "classifier error")
-				return
+			if len(predictions) == 0 {
+				if wholeClip == nil {
+					var err error
+					if wholeClip, err = classifier.PredictPrepared(query); err != nil {
+						return nil, err
+					}
+				}
+				predictions = wholeClip
 			}
-		}
 
-		if templateMatcher != nil {
-			templatePredictions = templateMatcher.Predict(features)
-			if len(templatePredictions) > 0 {
-				predictions = drone.MergePredictions(predictions, templatePredictions)
+			if templateMatcher != nil {
+				// Templates are matched against the whole-file features; only merge them when the
+				// classifier predictions also cover the whole file
+				templatePredictions = templateMatcher.Predict(query)
+				predictions, templatesMerged = drone.CombineTemplatePredictions(predictions, windowed, templatePredictions)
 			}
+			return predictions, nil
 		}
 
-		latency := time.Since(started).Seconds() * 1000
-
-		// Get base threshold from environment or use default
-		baseThresholdStr := utils.GetEnv("DRONE_CONFIDENCE_THRESHOLD", "0.55")
-		baseThreshold, err := strconv.ParseFloat(baseThresholdStr, 64)
+		// In two-stage mode a whole-clip screen keeps clear noise away from stage two
+		var screened bool
+		if settings.TwoStage {
+			var result drone.TwoStageResult
+			result, err = classifier.DetectTwoStage(query, settings.TwoStageMinDroneConfidence, stageTwo)
+			predictions, screened = result.Predictions, result.Screened
+			if screened {
+				logger.InfoContext(ctx, "two-stage screen ruled out a drone",
+					slog.Float64("droneConfidence", result.StageOneDroneConfidence),
+				)
+			}
+		} else {
+			predictions, err = stageTwo(nil)
+		}
+		if errors.Is(err, drone.ErrEmptyModel) {
+			logger.ErrorContext(ctx, "classification requested against empty model", slog.String("model", modelName))
+			return drone.ClassificationSummary{
+				Predictions: []drone.Prediction{},
+				LatencyMs:   time.Since(started).Seconds() * 1000,
+				Latitude:    recData.Latitude,
+				Longitude:   recData.Longitude,
+				Model:       modelName,
+				ModelEmpty:  true,
+				Code:        drone.CodeModelEmpty,
+				Reason:      drone.ReasonEmptyModel,
+			}, err
+		}
 		if err != nil {
-			baseThreshold = 0.55 // Default
+			err := xerrors.New(err)
+			logger.ErrorContext(ctx, "failed to run classifier", slog.Any("error", err))
+			return drone.ClassificationSummary{}, err
 		}
 
-		// Use adaptive threshold based on SNR
-		adjustedThreshold := baseThreshold
-		if audioSample.SNRDb != 0.0 {
-			adjustedThreshold = drone.AdaptiveThreshold(baseThreshold, audioSample.SNRDb)
-		}
+		latency := time.Since(started).Seconds() * 1000
 
-		isDrone := drone.DetermineDroneLikelyWithSNR(predictions, baseThreshold, audioSample.SNRDb)
+		decision := decideDrone(classifier, settings, predictions, audioSample.SNRDb, audioSample.LevelDb,
+			recData.Latitude, recData.Longitude, noiseFloor, calibrations)
+		isDrone := decision.isDrone
+		if screened {
+			isDrone = false
+		}
 
-		log.Printf("[HTTP] Classification complete: isDrone=%v, predictions=%d, latency=%.2fms\n",
+		log.Printf("[Classify] Classification complete: isDrone=%v, predictions=%d, latency=%.2fms\n",
 			isDrone, len(predictions), latency)
 
+		droneConfidence, noiseConfidence := drone.CategoryConfidences(predictions)
+		droneConfidence = classifier.CalibrateDroneConfidence(droneConfidence)
 		summary := drone.ClassificationSummary{
-			Predictions:       predictions,
-			IsDrone:           isDrone,
-			LatencyMs:         latency,
-			FeatureVector:     features,
-			SNRDb:             audioSample.SNRDb,
-			AdjustedThreshold: adjustedThreshold,
-			Windows:           windowSummaries,
-			Latitude:          recData.Latitude,
-			Longitude:         recData.Longitude,
-			RecordingPath:     audioSample.Persisted,
-			TemplatePreds:     templatePredictions,
+			Predictions:        predictions,
+			IsDrone:            isDrone,
+			Ambiguous:          decision.ambiguous,
+			DroneConfidence:    droneConfidence,
+			NoiseConfidence:    noiseConfidence,
+			LowDataMode:        decision.lowDataMode,
+			LatencyMs:          latency,
+			FeatureVector:      features,
+			SNRDb:              audioSample.SNRDb,
+			AdjustedThreshold:  decision.adjustedThreshold,
+			CalibratedSNRDb:    decision.calibratedSNR,
+			Quality:            &audioSample.Quality,
+			AnalyzedSampleRate: audioSample.SampleRate,
+			AnalyzedChannels:   audioSample.Channels,
+			Windows:            windowSummaries,
+			WindowCount:        windowCount,
+			WindowsSubsampled:  windowCount > len(windowSummaries),
+			Latitude:           recData.Latitude,
+			Longitude:          recData.Longitude,
+			RecordingPath:      audioSample.Persisted,
+			RecordingHash:      audioSample.Hash,
+			TemplatePreds:      templatePredictions,
+			TemplatesMerged:    templatesMerged,
+			Screened:           screened,
+			Model:              modelName,
+			ModelFingerprint:   classifier.Fingerprint(),
 		}
 
 		if len(predictions) > 0 {
 			summary.PrimaryType = predictions[0].Type
 		}
+		summary.ExplainOutcome()
 
-		log.Printf("[HTTP] Returning classification with location: lat=%v, lng=%v\n", summary.Latitude, summary.Longitude)
-		writeJSON(w, http.StatusOK, summary)
+		recordClassificationMetrics(summary)
+		return summary, nil
+	}
+}
+
+// droneDecision is the outcome of the shared drone/no-drone rules for one prediction set.
+type droneDecision struct {
+	isDrone           bool
+	ambiguous         bool
+	adjustedThreshold float64
+	calibratedSNR     float64
+	lowDataMode       bool
+}
+
+// decideDrone applies the detection rules shared by every classification path: the
+// low-data threshold, location calibration, the adaptive SNR threshold, the learned
+// noise floor and ambiguity withholding. snrDb is the recording's own SNR estimate and
+// levelDb its signal level, used against a calibrated ambient baseline when one exists.
+// noiseFloor and calibrations may be nil.
+func decideDrone(classifier *drone.Classifier, settings detectionSettings, predictions []drone.Prediction, snrDb, levelDb float64, lat, lon *float64, noiseFloor *drone.NoiseFloorTracker, calibrations *drone.NoiseCalibrationStore) droneDecision {
+	// Confidences from a model with few prototypes are unreliable; demand more of them
+	baseThreshold, lowDataMode := drone.LowDataThreshold(settings.ConfidenceThreshold, classifier.Stats().PrototypeCount, settings.MinPrototypes)
+
+	// A calibrated ambient baseline for this location is a better noise reference
+	// than the start of the recording itself
+	thresholdSNR := snrDb
+	var calibratedSNR float64
+	if calibration, ok := calibrations.Lookup(drone.LocationKey(lat, lon)); ok {
+		calibratedSNR = calibration.SNRFor(levelDb)
+		thresholdSNR = calibratedSNR
+	}
+
+	// Use adaptive threshold based on SNR
+	adjustedThreshold := baseThreshold
+	if thresholdSNR != 0.0 {
+		adjustedThreshold = drone.AdaptiveThreshold(baseThreshold, thresholdSNR)
+	}
+
+	isDrone := drone.DetermineDroneLikelyWithSNR(predictions, baseThreshold, thresholdSNR, settings.MinSupport)
+	if noiseFloor != nil {
+		// Compare against the stricter of the instantaneous and the learned site SNR
+		noiseKey := noiseFloor.Key(lat, lon)
+		adjustedThreshold = noiseFloor.Threshold(noiseKey, baseThreshold, thresholdSNR)
+		isDrone = drone.DetermineDroneLikelyWithSNR(predictions, adjustedThreshold, 0.0, settings.MinSupport)
+		noiseFloor.Observe(noiseKey, snrDb, isDrone, time.Now())
+	}
+
+	// A near tie between the top two labels is reported, and optionally kept from raising an alarm
+	ambiguous := drone.IsAmbiguous(predictions, settings.MinConfidenceGap)
+	if ambiguous && isDrone && settings.AmbiguousWithhold {
+		isDrone = false
+	}
+
+	return droneDecision{
+		isDrone:           isDrone,
+		ambiguous:         ambiguous,
+		adjustedThreshold: adjustedThreshold,
+		calibratedSNR:     calibratedSNR,
+		lowDataMode:       lowDataMode,
+	}
+}
+
+// recordClassificationMetrics counts a finished classification for /metrics.
+func recordClassificationMetrics(summary drone.ClassificationSummary) {
+	var topLabel string
+	if len(summary.Predictions) > 0 {
+		topLabel = summary.Predictions[0].Label
+	}
+	metrics.ObserveClassification(summary.IsDrone, topLabel, time.Duration(summary.LatencyMs*float64(time.Millisecond)))
+}
+
+type urlClassificationRequest struct {
+	URL       string   `json:"url"`
+	Latitude  *float64 `json:"lat,omitempty"`
+	Longitude *float64 `json:"lon,omitempty"`
+	Model     string   `json:"model,omitempty"`
+}
+
+// maxURLRequestBytes bounds the JSON body of a URL classification request.
+const maxURLRequestBytes = 64 << 10
+
+// newAudioURLClassificationHandler downloads audio from an allow-listed URL and runs it
+// through the same pipeline as uploaded recordings.
+func newAudioURLClassificationHandler(registry *modelRegistry, extractor drone.FeatureExtractor, templateMatcher *drone.TemplateMatcher, persistRecordings bool, noiseFloor *drone.NoiseFloorTracker, calibrations *drone.NoiseCalibrationStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	classify := newRecordingClassifier(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations)
+	fetcher := newAudioFetcherFromEnv()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Drone-Model")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		if err := wav.CheckFFmpegAvailable(); err != nil {
+			logger.ErrorContext(ctx, "rejecting URL classification, audio tooling unavailable", slog.Any("error", err))
+			writeAudioToolingError(w)
+			return
+		}
+
+		var req urlClassificationRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxURLRequestBytes)).Decode(&req); err != nil {
+			writeClassifyError(w, drone.NewClassifyError(drone.CodeInvalidRequest, "invalid request payload", err))
+			return
+		}
+		if req.URL == "" {
+			writeClassifyError(w, drone.NewClassifyError(drone.CodeInvalidRequest, `missing required field "url"`, nil))
+			return
+		}
+
+		downloaded, err := fetcher.fetch(ctx, req.URL, "tmp")
+		if err != nil {
+			logger.WarnContext(ctx, "failed to fetch audio URL", slog.String("url", req.URL), slog.Any("error", err))
+			code := drone.CodeFetchFailed
+			switch {
+			case errors.Is(err, errURLNotAllowed):
+				code = drone.CodeURLNotAllowed
+			case errors.Is(err, errURLTooLarge):
+				code = drone.CodePayloadTooLarge
+			}
+			writeClassifyError(w, drone.NewClassifyError(code, err.Error(), err))
+			return
+		}
+		defer os.Remove(downloaded)
+
+		converted, err := wav.ConvertToWAV(downloaded, 1)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to convert downloaded audio", slog.Any("error", err))
+			if errors.Is(err, wav.ErrFFmpegUnavailable) {
+				writeAudioToolingError(w)
+				return
+			}
+			writeClassifyError(w, drone.NewClassifyError(drone.CodeAudioUndecodable, "unable to decode audio", err))
+			return
+		}
+		defer os.Remove(converted)
+
+		wavInfo, err := wav.ReadWavInfo(converted)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to read downloaded audio", slog.Any("error", err))
+			writeClassifyError(w, drone.NewClassifyError(drone.CodeAudioUndecodable, "unable to decode audio", err))
+			return
+		}
+
+		log.Printf("[HTTP] URL classification request: url=%s, duration=%.2f, lat=%v, lng=%v\n",
+			req.URL, wavInfo.Duration, req.Latitude, req.Longitude)
+
+		classify(w, r, models.RecordData{
+			Audio:      base64.StdEncoding.EncodeToString(wavInfo.Data),
+			Duration:   wavInfo.Duration,
+			Channels:   wavInfo.Channels,
+			SampleRate: wavInfo.SampleRate,
+			SampleSize: wavInfo.BitsPerSample,
+			Latitude:   req.Latitude,
+			Longitude:  req.Longitude,
+			Model:      req.Model,
+		})
 	}
 }
 
-func newDetectionsHandler() http.HandlerFunc {
+func newDetectionsHandler(store detections.DetectionStore) http.HandlerFunc {
 	logger := utils.GetLogger()
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
@@ -420,7 +941,7 @@ func newDetectionsHandler() http.HandlerFunc {
 			return
 		}
 
-		detectionsList, err := detections.LoadDetections()
+		detectionsList, err := store.GetAllDetections()
 		if err != nil {
 			logger.ErrorContext(ctx, "failed to load detections", slog.Any("error", err))
 			writeJSONError(w, http.StatusInternalServerError, "failed to load detections")
@@ -431,35 +952,704 @@ func newDetectionsHandler() http.HandlerFunc {
 	}
 }
 
-func serve(protocol, port string) {
-	protocol = strings.ToLower(protocol)
-	var allowOriginFunc = func(r *http.Request) bool {
-		return true
-	}
+// seriesBucketWidths maps the bucket query values of /api/detections/series to widths.
+var seriesBucketWidths = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
 
-	modelPath := utils.GetEnv("DRONE_MODEL_PATH", filepath.Join("drone", "prototypes.json"))
-	neighborCountStr := utils.GetEnv("DRONE_MODEL_K", "5")
-	k, err := strconv.Atoi(neighborCountStr)
-	if err != nil {
-		log.Fatalf("invalid DRONE_MODEL_K value '%s': %v", neighborCountStr, err)
-	}
+// newDetectionSeriesHandler returns the detections within radius km (default 1) of
+// lat/lon as a time series of per-bucket counts and mean confidence, for watching a
+// fixed sensor. bucket is minute, hour (the default) or day.
+func newDetectionSeriesHandler(store detections.DetectionStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 
-	// Load classifier first to check prototype count
-	classifier, err := drone.NewClassifierFromFile(modelPath, k)
-	if err != nil {
-		log.Fatalf("failed to load drone classifier: %v", err)
-	}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 
-	// Adaptive K based on prototype count (if few prototypes, use smaller K)
-	stats := classifier.Stats()
-	prototypeCount := stats.PrototypeCount
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 
-	// If we have fewer prototypes than K, adjust K
-	if prototypeCount > 0 && k > prototypeCount {
-		k = prototypeCount
-		log.Printf("Adjusted K to %d (prototype count: %d)", k, prototypeCount)
-		// Reload with adjusted K
-		classifier, err = drone.NewClassifierFromFile(modelPath, k)
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		query := r.URL.Query()
+		lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+		lon, lonErr := strconv.ParseFloat(query.Get("lon"), 64)
+		if latErr != nil || lonErr != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			writeJSONError(w, http.StatusBadRequest, "lat and lon are required coordinates")
+			return
+		}
+		radius := 1.0
+		if value := query.Get("radius"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid radius %q: expected kilometres above zero", value))
+				return
+			}
+			radius = parsed
+		}
+		bucketName := query.Get("bucket")
+		if bucketName == "" {
+			bucketName = "hour"
+		}
+		bucket, ok := seriesBucketWidths[bucketName]
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid bucket %q: expected minute, hour or day", bucketName))
+			return
+		}
+
+		detectionsList, err := store.GetAllDetections()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to load detections", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to load detections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, detections.ConfidenceSeries(detectionsList, lat, lon, radius, bucket))
+	}
+}
+
+// parseRadiusKm parses a radius such as "0.5km", "500m" or "0.5" (kilometres).
+func parseRadiusKm(value string) (float64, error) {
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(value, "km"):
+		value = strings.TrimSuffix(value, "km")
+	case strings.HasSuffix(value, "m"):
+		value = strings.TrimSuffix(value, "m")
+		scale = 0.001
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed <= 0 || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("expected a distance above zero such as 0.5km or 500m")
+	}
+	return parsed * scale, nil
+}
+
+// newDetectionClustersHandler groups the stored detections within radius (default 1km)
+// of each other into clusters with a centroid and count, so a map can draw one marker
+// per cluster.
+func newDetectionClustersHandler(store detections.DetectionStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		radius := 1.0
+		if value := r.URL.Query().Get("radius"); value != "" {
+			parsed, err := parseRadiusKm(value)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid radius %q: %v", value, err))
+				return
+			}
+			radius = parsed
+		}
+
+		detectionsList, err := store.GetAllDetections()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to load detections", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to load detections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, detections.Cluster(detectionsList, radius))
+	}
+}
+
+// newDetectionTrackHandler fits a heading and speed to the drone detections within
+// window (default 10m) of the latest one. 404 means there are too few to fit a track.
+func newDetectionTrackHandler(store detections.DetectionStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		window := detections.DefaultTrackWindow
+		if value := r.URL.Query().Get("window"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid window %q: expected a duration above zero such as 10m", value))
+				return
+			}
+			window = parsed
+		}
+
+		detectionsList, err := store.GetAllDetections()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to load detections", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to load detections")
+			return
+		}
+
+		track, err := detections.EstimateTrackWithin(detectionsList, window)
+		if errors.Is(err, detections.ErrTrackTooShort) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to estimate track", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to estimate track")
+			return
+		}
+		writeJSON(w, http.StatusOK, track)
+	}
+}
+
+// defaultBoundingBoxLimit caps /api/detections/bbox when no limit is given.
+const defaultBoundingBoxLimit = 1000
+
+// newDetectionBoundingBoxHandler returns the detections inside a map viewport, newest
+// first. A box whose minLon is greater than its maxLon crosses the antimeridian and
+// covers minLon..180 and -180..maxLon. The SQLite store answers with an indexed range
+// query; the JSON store filters the file in memory.
+func newDetectionBoundingBoxHandler(store detections.DetectionStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		query := r.URL.Query()
+		var box models.BoundingBox
+		for _, bound := range []struct {
+			name  string
+			value *float64
+			max   float64
+		}{
+			{"minLat", &box.MinLat, 90},
+			{"minLon", &box.MinLon, 180},
+			{"maxLat", &box.MaxLat, 90},
+			{"maxLon", &box.MaxLon, 180},
+		} {
+			parsed, err := strconv.ParseFloat(query.Get(bound.name), 64)
+			if err != nil || math.Abs(parsed) > bound.max {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s is required and must be within ±%g", bound.name, bound.max))
+				return
+			}
+			*bound.value = parsed
+		}
+		if box.MinLat > box.MaxLat {
+			writeJSONError(w, http.StatusBadRequest, "minLat must not be greater than maxLat")
+			return
+		}
+		limit := defaultBoundingBoxLimit
+		if value := query.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q: expected a positive integer", value))
+				return
+			}
+			limit = parsed
+		}
+
+		detectionsList, err := store.GetDetectionsInBox(box, limit)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to load detections", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to load detections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, detectionsList)
+	}
+}
+
+type detectionFeedbackRequest struct {
+	CorrectLabel string `json:"correctLabel"`
+	IsDrone      *bool  `json:"isDrone"`
+}
+
+// newDetectionFeedbackHandler records an operator's correction of a stored detection. When
+// a corrected label is given and the detection's recording is still on disk, a prototype
+// built from it is queued in DRONE_CANDIDATES_PATH for review rather than added to a model.
+func newDetectionFeedbackHandler(store detections.DetectionStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	candidatesPath := utils.GetEnv("DRONE_CANDIDATES_PATH", filepath.Join("drone", "candidates.json"))
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid detection id")
+			return
+		}
+
+		var req detectionFeedbackRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid request payload")
+			return
+		}
+		req.CorrectLabel = drone.NormalizeLabel(req.CorrectLabel)
+		if req.CorrectLabel == "" && req.IsDrone == nil {
+			writeJSONError(w, http.StatusBadRequest, `feedback needs "correctLabel" or "isDrone"`)
+			return
+		}
+
+		detection, err := store.GetDetection(id)
+		if errors.Is(err, detections.ErrDetectionNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to load detection", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to load detection")
+			return
+		}
+
+		feedback := models.DetectionFeedback{CorrectLabel: req.CorrectLabel, IsDrone: req.IsDrone}
+		if req.CorrectLabel != "" && detection.RecordingPath != "" {
+			candidate, err := queuePrototypeCandidate(candidatesPath, detection, req)
+			if err != nil {
+				logger.WarnContext(ctx, "unable to queue prototype candidate", slog.Int64("detection", id), slog.Any("error", err))
+			} else {
+				feedback.CandidateID = candidate.ID
+			}
+		}
+
+		detection, err = store.RecordFeedback(id, feedback)
+		if errors.Is(err, detections.ErrDetectionNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to record detection feedback", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, "failed to record feedback")
+			return
+		}
+
+		log.Printf("[HTTP] Feedback recorded for detection %d: label=%q isDrone=%v\n", id, req.CorrectLabel, req.IsDrone)
+		writeJSON(w, http.StatusOK, detection)
+	}
+}
+
+var candidatesMu sync.Mutex
+
+// queuePrototypeCandidate builds a prototype from a detection's recording under the
+// corrected label and appends it to the review file at path.
+func queuePrototypeCandidate(path string, detection models.Detection, req detectionFeedbackRequest) (drone.Prototype, error) {
+	if _, err := os.Stat(detection.RecordingPath); err != nil {
+		return drone.Prototype{}, fmt.Errorf("recording unavailable: %w", err)
+	}
+
+	category := ""
+	if req.IsDrone != nil && !*req.IsDrone {
+		category = "noise"
+	}
+	metadata := map[string]string{
+		"detection_id":   strconv.FormatInt(detection.ID, 10),
+		"original_label": detection.PrimaryLabel,
+	}
+	if detection.RecordingHash != "" {
+		metadata["recording_hash"] = detection.RecordingHash
+	}
+	candidate, err := drone.BuildPrototypeFromPath(detection.RecordingPath, req.CorrectLabel, category,
+		"operator feedback", detection.RecordingPath, metadata)
+	if err != nil {
+		return drone.Prototype{}, err
+	}
+
+	candidatesMu.Lock()
+	defer candidatesMu.Unlock()
+
+	var candidates []drone.Prototype
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &candidates); err != nil {
+			return drone.Prototype{}, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return drone.Prototype{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	candidates = append(candidates, candidate)
+
+	data, err := json.MarshalIndent(candidates, "", "  ")
+	if err != nil {
+		return drone.Prototype{}, fmt.Errorf("failed to encode candidates: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := utils.CreateFolder(dir); err != nil {
+			return drone.Prototype{}, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return drone.Prototype{}, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return candidate, nil
+}
+
+// minCalibrationDurationSec is the shortest ambient recording accepted for calibration.
+const minCalibrationDurationSec = 1.0
+
+// newCalibrationHandler records a short ambient recording as the noise-floor baseline for
+// its location. Later classifications at that location measure their SNR against it.
+func newCalibrationHandler(calibrations *drone.NoiseCalibrationStore) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		if err := wav.CheckFFmpegAvailable(); err != nil {
+			logger.ErrorContext(ctx, "rejecting calibration, audio tooling unavailable", slog.Any("error", err))
+			writeAudioToolingError(w)
+			return
+		}
+
+		var recData models.RecordData
+		if err := decodeRecordData(w, r, &recData); err != nil {
+			logger.ErrorContext(ctx, "failed to parse calibration body", slog.Any("error", err.Err))
+			writeClassifyError(w, err)
+			return
+		}
+		if recData.Audio == "" {
+			writeJSONError(w, http.StatusBadRequest, `missing required field "audio"`)
+			return
+		}
+		if recData.Latitude == nil || recData.Longitude == nil {
+			writeJSONError(w, http.StatusBadRequest, "calibration requires latitude and longitude")
+			return
+		}
+
+		audioSample, err := drone.PrepareAudioSample(recData, false)
+		if err != nil {
+			toolingMissing := errors.Is(err, wav.ErrFFmpegUnavailable)
+			err := xerrors.New(err)
+			logger.ErrorContext(ctx, "failed to prepare ambient sample", slog.Any("error", err))
+			if toolingMissing {
+				writeAudioToolingError(w)
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "unable to decode audio")
+			return
+		}
+		if audioSample.Duration < minCalibrationDurationSec {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("ambient recording must be at least %.0f second(s)", minCalibrationDurationSec))
+			return
+		}
+
+		key := drone.LocationKey(recData.Latitude, recData.Longitude)
+		calibration := calibrations.Calibrate(key, audioSample, time.Now())
+		log.Printf("[HTTP] Calibrated noise floor for %s: level=%.1f dBFS over %.1fs\n",
+			key, calibration.NoiseLevelDb, calibration.DurationSeconds)
+
+		writeJSON(w, http.StatusOK, calibration)
+	}
+}
+
+func newModelDiagnosticsHandler(registry *modelRegistry, extractor drone.FeatureExtractor) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Drone-Model")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		classifier, modelName, err := registry.resolve(requestedModel(r))
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		// PANNS models must be re-embedded through the service; legacy models use local extraction
+		extract := drone.FeatureExtractorFunc(drone.ExtractFeaturesFromPath)
+		if panns, ok := extractor.(*drone.PANNSExtractor); ok && classifier.FeatureDimension() == panns.Dimension() {
+			extract = panns.ExtractFile
+		}
+
+		report := classifier.RunDiagnostics(extract)
+		logger.InfoContext(ctx, "model diagnostics complete",
+			slog.String("model", modelName),
+			slog.Int("checked", report.Checked),
+			slog.Int("skipped", report.Skipped),
+			slog.Int("selfMatched", report.SelfMatched),
+			slog.Bool("deterministic", report.Deterministic),
+		)
+
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// newPrototypeSelfCheckHandler classifies a stored prototype against its own model so a
+// fresh upload can be checked without re-recording it.
+func newPrototypeSelfCheckHandler(registry *modelRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Drone-Model")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		classifier, _, err := registry.resolve(requestedModel(r))
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		result, err := classifier.SelfCheck(r.PathValue("id"))
+		if errors.Is(err, drone.ErrPrototypeNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+type modelReloadResponse struct {
+	Model          string `json:"model"`
+	PrototypeCount int    `json:"prototypeCount"`
+	TemplateCount  int    `json:"templateCount"`
+}
+
+// modelReloader reloads the default model and, when templatePath is set, the template
+// bank from disk without restarting the server. Both files are parsed before anything
+// is swapped, so a bad file leaves the running model and templates in place.
+type modelReloader struct {
+	registry          *modelRegistry
+	loadModel         func() (*drone.Classifier, error)
+	templateMatcher   *drone.TemplateMatcher
+	templatePath      string
+	templateThreshold float64
+}
+
+func (mr *modelReloader) reload(ctx context.Context) (modelReloadResponse, error) {
+	logger := utils.GetLogger()
+
+	// Write out uploads still waiting on the persist debounce so the reload sees them
+	if current := mr.registry.defaultClassifier(); current != nil {
+		if err := current.FlushPersist(); err != nil {
+			return modelReloadResponse{}, fmt.Errorf("failed to save pending prototypes: %w", err)
+		}
+	}
+
+	classifier, err := mr.loadModel()
+	if err != nil {
+		return modelReloadResponse{}, fmt.Errorf("failed to reload model: %w", err)
+	}
+
+	if mr.templateMatcher != nil && mr.templatePath != "" {
+		if err := mr.templateMatcher.ReloadFromFile(mr.templatePath, mr.templateThreshold); err != nil {
+			return modelReloadResponse{}, fmt.Errorf("failed to reload templates: %w", err)
+		}
+	}
+
+	mr.registry.register(defaultModelName, classifier)
+	mr.registry.refreshDerivedThreshold()
+
+	response := modelReloadResponse{
+		Model:          defaultModelName,
+		PrototypeCount: classifier.Stats().PrototypeCount,
+		TemplateCount:  mr.templateMatcher.TemplateCount(),
+	}
+	logger.InfoContext(ctx, "model reloaded",
+		slog.Int("prototypes", response.PrototypeCount),
+		slog.Int("templates", response.TemplateCount),
+	)
+	return response, nil
+}
+
+func newModelReloadHandler(reloader *modelReloader) http.HandlerFunc {
+	logger := utils.GetLogger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		response, err := reloader.reload(ctx)
+		if err != nil {
+			logger.ErrorContext(ctx, "model reload failed", slog.Any("error", err))
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+type readinessCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type readinessResponse struct {
+	Ready  bool                      `json:"ready"`
+	Checks map[string]readinessCheck `json:"checks"`
+}
+
+func newReadinessHandler(registry *modelRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		checks := map[string]readinessCheck{}
+
+		ffmpegCheck := readinessCheck{OK: true}
+		if err := wav.CheckFFmpegAvailable(); err != nil {
+			ffmpegCheck = readinessCheck{OK: false, Detail: err.Error()}
+		}
+		checks["ffmpeg"] = ffmpegCheck
+
+		modelCheck := readinessCheck{OK: true}
+		if classifier := registry.defaultClassifier(); classifier == nil || classifier.FeatureDimension() == 0 {
+			modelCheck = readinessCheck{OK: false, Detail: drone.ErrEmptyModel.Error()}
+		}
+		checks["model"] = modelCheck
+
+		response := readinessResponse{Ready: true, Checks: checks}
+		for _, check := range checks {
+			if !check.OK {
+				response.Ready = false
+			}
+		}
+
+		status := http.StatusOK
+		if !response.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	}
+}
+
+func serve(protocol, port, grpcPort string) {
+	protocol = strings.ToLower(protocol)
+	var allowOriginFunc = func(r *http.Request) bool {
+		return true
+	}
+
+	modelPath := utils.GetEnv("DRONE_MODEL_PATH", filepath.Join("drone", "prototypes.json"))
+	neighborCountStr := utils.GetEnv("DRONE_MODEL_K", "5")
+	k, err := strconv.Atoi(neighborCountStr)
+	if err != nil {
+		log.Fatalf("invalid DRONE_MODEL_K value '%s': %v", neighborCountStr, err)
+	}
+
+	// Load classifier first to check prototype count
+	classifier, err := drone.NewClassifierFromFile(modelPath, k)
+	if err != nil {
+		log.Fatalf("failed to load drone classifier: %v", err)
+	}
+
+	// Adaptive K based on prototype count (if few prototypes, use smaller K)
+	stats := classifier.Stats()
+	prototypeCount := stats.PrototypeCount
+
+	// If we have fewer prototypes than K, adjust K
+	if prototypeCount > 0 && k > prototypeCount {
+		k = prototypeCount
+		log.Printf("Adjusted K to %d (prototype count: %d)", k, prototypeCount)
+		// Reload with adjusted K
+		classifier, err = drone.NewClassifierFromFile(modelPath, k)
 		if err != nil {
 			log.Fatalf("failed to reload classifier with adjusted K: %v", err)
 		}
@@ -474,6 +1664,151 @@ func serve(protocol, port string) {
 		}
 	}
 
+	registry := newModelRegistry(classifier)
+	if modelDir := utils.GetEnv("DRONE_MODEL_DIR", ""); modelDir != "" {
+		if err := registry.loadModelDir(modelDir, k); err != nil {
+			log.Fatalf("failed to load site models from %s: %v", modelDir, err)
+		}
+		log.Printf("Serving models: %s\n", strings.Join(registry.names(), ", "))
+	}
+	halfLife, err := time.ParseDuration(utils.GetEnv("DRONE_RECENCY_HALF_LIFE", "0"))
+	if err != nil {
+		log.Fatalf("invalid DRONE_RECENCY_HALF_LIFE value: %v", err)
+	}
+	if halfLife > 0 {
+		log.Printf("Recency decay enabled (half-life=%s)\n", halfLife)
+	}
+
+	persistDelay, err := time.ParseDuration(utils.GetEnv("DRONE_PERSIST_DEBOUNCE", "2s"))
+	if err != nil {
+		log.Fatalf("invalid DRONE_PERSIST_DEBOUNCE value: %v", err)
+	}
+
+	maxWindows, err := strconv.Atoi(utils.GetEnv("DRONE_MAX_WINDOWS", "120"))
+	if err != nil || maxWindows < 0 {
+		log.Fatalf("invalid DRONE_MAX_WINDOWS value: %q", utils.GetEnv("DRONE_MAX_WINDOWS", "120"))
+	}
+
+	metric, err := drone.ParseDistanceMetric(utils.GetEnv("DRONE_DISTANCE_METRIC", ""))
+	if err != nil {
+		log.Fatalf("invalid DRONE_DISTANCE_METRIC value: %v", err)
+	}
+	harmonicPenalty, err := strconv.ParseFloat(utils.GetEnv("DRONE_HARMONIC_MISMATCH_PENALTY", "0"), 64)
+	if err != nil || harmonicPenalty < 0 {
+		log.Fatalf("invalid DRONE_HARMONIC_MISMATCH_PENALTY value: %q", utils.GetEnv("DRONE_HARMONIC_MISMATCH_PENALTY", "0"))
+	}
+	maxAcceptDistance, err := strconv.ParseFloat(utils.GetEnv("DRONE_MAX_ACCEPT_DISTANCE", "0"), 64)
+	if err != nil || maxAcceptDistance < 0 {
+		log.Fatalf("invalid DRONE_MAX_ACCEPT_DISTANCE value: %q", utils.GetEnv("DRONE_MAX_ACCEPT_DISTANCE", "0"))
+	}
+
+	confidenceStrategy, err := drone.ParseConfidenceStrategy(utils.GetEnv("DRONE_CONFIDENCE_STRATEGY", ""))
+	if err != nil {
+		log.Fatalf("invalid DRONE_CONFIDENCE_STRATEGY value: %v", err)
+	}
+	softmaxTemperature, err := strconv.ParseFloat(utils.GetEnv("DRONE_SOFTMAX_TEMPERATURE", "0.1"), 64)
+	if err != nil || softmaxTemperature <= 0 {
+		log.Fatalf("invalid DRONE_SOFTMAX_TEMPERATURE value: %q", utils.GetEnv("DRONE_SOFTMAX_TEMPERATURE", "0.1"))
+	}
+
+	minWindowSeconds, err := strconv.ParseFloat(utils.GetEnv("DRONE_MIN_WINDOW_SECONDS", "0.1"), 64)
+	if err != nil || minWindowSeconds <= 0 {
+		log.Fatalf("invalid DRONE_MIN_WINDOW_SECONDS value: %q", utils.GetEnv("DRONE_MIN_WINDOW_SECONDS", "0.1"))
+	}
+
+	balancedVoting := utils.GetEnv("DRONE_BALANCED_VOTING", "false") == "true"
+
+	metadataMerge, err := drone.ParseMetadataMergeStrategy(utils.GetEnv("DRONE_METADATA_MERGE", ""))
+	if err != nil {
+		log.Fatalf("invalid DRONE_METADATA_MERGE value: %v", err)
+	}
+
+	rankingBlend, err := drone.ParseRankingBlend(utils.GetEnv("DRONE_RANKING_BLEND", ""))
+	if err != nil {
+		log.Fatalf("invalid DRONE_RANKING_BLEND value: %v", err)
+	}
+
+	// applyModelSettings configures a model with the startup settings. Every served model
+	// and every hot reload goes through it, so an option cannot be dropped on reload.
+	applyModelSettings := func(model *drone.Classifier) {
+		model.SetRecencyHalfLife(halfLife)
+		model.SetMaxWindows(maxWindows)
+		model.SetMinWindowSeconds(minWindowSeconds)
+		model.SetDistanceMetric(metric)
+		model.SetHarmonicMismatchPenalty(harmonicPenalty)
+		model.SetMaxAcceptDistance(maxAcceptDistance)
+		model.SetConfidenceStrategy(confidenceStrategy, softmaxTemperature)
+		model.SetBalancedVoting(balancedVoting)
+		model.SetMetadataMergeStrategy(metadataMerge)
+		model.SetRankingBlend(rankingBlend)
+		model.SetPersistDelay(persistDelay)
+	}
+
+	// loadDefaultModel re-reads DRONE_MODEL_PATH with the startup settings for hot reloads
+	loadDefaultModel := func() (*drone.Classifier, error) {
+		model, err := drone.NewClassifierFromFile(modelPath, k)
+		if err != nil {
+			return nil, err
+		}
+		applyModelSettings(model)
+		return model, nil
+	}
+
+	for _, name := range registry.names() {
+		model, _ := registry.lookup(name)
+		applyModelSettings(model)
+		if model.FeatureDimension() == 0 {
+			log.Printf("WARNING: model %q has no prototypes; every classification against it will report modelEmpty until prototypes are uploaded\n", name)
+		}
+	}
+
+	// Derive the confidence threshold from the default model unless one is set explicitly.
+	// The registry keeps it current as the model is reloaded or its prototypes change.
+	if targetFPR := utils.GetEnv("DRONE_THRESHOLD_TARGET_FPR", ""); targetFPR != "" && os.Getenv("DRONE_CONFIDENCE_THRESHOLD") == "" {
+		target, err := strconv.ParseFloat(targetFPR, 64)
+		if err != nil {
+			log.Fatalf("invalid DRONE_THRESHOLD_TARGET_FPR value: %v", err)
+		}
+		registry.setThresholdTarget(target)
+	}
+
+	// Per-label thresholds are stored in the model metadata, so learning them saves the model
+	if targetFPR := utils.GetEnv("DRONE_LABEL_THRESHOLD_TARGET_FPR", ""); targetFPR != "" {
+		target, err := strconv.ParseFloat(targetFPR, 64)
+		if err != nil {
+			log.Fatalf("invalid DRONE_LABEL_THRESHOLD_TARGET_FPR value: %v", err)
+		}
+		model := registry.defaultClassifier()
+		thresholds := model.LearnPerLabelThresholds(target)
+		if thresholds == nil {
+			log.Printf("WARNING: unable to learn per-label thresholds (target FPR %.2f); the model needs noise prototypes\n", target)
+		} else {
+			for label, threshold := range thresholds {
+				log.Printf("Learned confidence threshold for %q: %.4f (target FPR %.2f)\n", label, threshold, target)
+			}
+			if _, err := model.SchedulePersist(); err != nil {
+				log.Printf("WARNING: failed to save learned thresholds: %v\n", err)
+			}
+		}
+	}
+
+	// The Platt calibration is also stored in the model metadata, so fitting it saves the model
+	if utils.GetEnv("DRONE_PLATT_CALIBRATION", "false") == "true" {
+		model := registry.defaultClassifier()
+		calibration, err := model.LearnPlattCalibration()
+		if err != nil {
+			log.Printf("WARNING: unable to fit drone confidence calibration: %v\n", err)
+		} else {
+			log.Printf("Fitted drone confidence calibration: A=%.4f B=%.4f\n", calibration.A, calibration.B)
+			if _, err := model.SchedulePersist(); err != nil {
+				log.Printf("WARNING: failed to save confidence calibration: %v\n", err)
+			}
+		}
+	}
+
+	extractor := drone.NewFeatureExtractorFromEnv()
+	log.Printf("Feature extractor: %T (%d dims)\n", extractor, extractor.Dimension())
+
 	templatePath := utils.GetEnv("DRONE_TEMPLATE_PATH", "")
 	if templatePath == "" {
 		defaultTemplatePath := filepath.Join("drone", "templates.json")
@@ -492,14 +1827,54 @@ func serve(protocol, port string) {
 	if templatePath != "" {
 		if matcher, tmErr := drone.NewTemplateMatcherFromFile(templatePath, templateThreshold); tmErr != nil {
 			log.Printf("Failed to load template matcher (%s): %v\n", templatePath, tmErr)
+			// Keep an empty matcher so /api/model/reload can pick up a fixed file
+			templateMatcher = &drone.TemplateMatcher{}
 		} else {
 			log.Printf("Loaded %d templates from %s (threshold=%.2f)\n", matcher.TemplateCount(), templatePath, templateThreshold)
 			templateMatcher = matcher
 		}
 	}
 
+	detectionStore, err := newDetectionStoreFromEnv()
+	if err != nil {
+		log.Printf("%v, using the detections JSON file instead\n", err)
+		detectionStore = detections.JSONStore{}
+	}
+
 	persistRecordings := strings.EqualFold(utils.GetEnv("DRONE_PERSIST_RECORDINGS", "true"), "true")
-	controller := newSocketController(classifier, templateMatcher, persistRecordings)
+	verifyRecordingLinks(detectionStore, utils.GetEnv("DRONE_RECORDING_DIR", "frontendrecording"),
+		strings.EqualFold(utils.GetEnv("DRONE_PRUNE_ORPHANED_RECORDINGS", "false"), "true"))
+
+	var noiseFloor *drone.NoiseFloorTracker
+	if strings.EqualFold(utils.GetEnv("DRONE_LEARNED_NOISE_FLOOR", "false"), "true") {
+		alpha, err := strconv.ParseFloat(utils.GetEnv("DRONE_NOISE_FLOOR_ALPHA", "0.1"), 64)
+		if err != nil {
+			alpha = 0.1
+		}
+		cooldown, err := time.ParseDuration(utils.GetEnv("DRONE_NOISE_FLOOR_COOLDOWN", "2m"))
+		if err != nil {
+			cooldown = 2 * time.Minute
+		}
+		perLocation := !strings.EqualFold(utils.GetEnv("DRONE_NOISE_FLOOR_SCOPE", "location"), "global")
+		noiseFloor = drone.NewNoiseFloorTracker(alpha, cooldown, perLocation)
+		log.Printf("Learned noise floor enabled (alpha=%.2f, cooldown=%s, perLocation=%v)\n", alpha, cooldown, perLocation)
+	}
+
+	calibrations := drone.NewNoiseCalibrationStore()
+
+	reloader := &modelReloader{
+		registry:          registry,
+		loadModel:         loadDefaultModel,
+		templateMatcher:   templateMatcher,
+		templatePath:      templatePath,
+		templateThreshold: templateThreshold,
+	}
+	if watcher := newModelWatcherFromEnv(modelPath, reloader); watcher != nil {
+		log.Printf("Watching %s for changes (debounce=%s)\n", modelPath, watcher.debounce)
+		go watcher.run(context.Background())
+	}
+
+	controller := newSocketController(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations, detectionStore)
 
 	server := socketio.NewServer(&engineio.Options{
 		PingTimeout:  60 * time.Second,
@@ -546,12 +1921,24 @@ func serve(protocol, port string) {
 		}()
 	})
 
+	// Stream chunks are handled in order on the socket's event loop, so windows are emitted in sequence
+	server.OnEvent("/", "streamAudio", func(socket socketio.Conn, msg string) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic in handleStreamAudio for socket %s: %v\n", socket.ID(), r)
+				socket.Emit("analysisError", map[string]string{"message": "internal server error during processing"})
+			}
+		}()
+		controller.handleStreamAudio(socket, msg)
+	})
+
 	server.OnError("/", func(s socketio.Conn, e error) {
 		log.Println("meet error:", e)
 	})
 
 	server.OnDisconnect("/", func(s socketio.Conn, reason string) {
 		log.Printf("Socket disconnected - ID: %s, Reason: %s\n", s.ID(), reason)
+		controller.handleDisconnect(s.ID())
 	})
 
 	go func() {
@@ -563,19 +1950,62 @@ func serve(protocol, port string) {
 
 	serveHTTPS := protocol == "https"
 
-	uploadHandler := newPrototypeUploadHandler(classifier)
-	classificationHandler := newAudioClassificationHandler(classifier, templateMatcher, persistRecordings)
-	detectionsHandler := newDetectionsHandler()
+	uploadHandler := newPrototypeUploadHandler(registry)
+	classificationHandler := newAudioClassificationHandler(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations)
+	detectionsHandler := newDetectionsHandler(detectionStore)
+	diagnosticsHandler := newModelDiagnosticsHandler(registry, extractor)
 	mux := http.NewServeMux()
 	mux.Handle("/socket.io/", server)
 	mux.HandleFunc("/api/prototypes/upload", uploadHandler)
+	mux.HandleFunc("/api/prototypes/{id}", newPrototypeDeleteHandler(registry))
 	mux.HandleFunc("/api/audio/classify", classificationHandler)
+	mux.HandleFunc("/api/audio/classify/url", newAudioURLClassificationHandler(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations))
 	mux.HandleFunc("/api/detections", detectionsHandler)
+	mux.HandleFunc("/api/detections/series", newDetectionSeriesHandler(detectionStore))
+	mux.HandleFunc("/api/detections/bbox", newDetectionBoundingBoxHandler(detectionStore))
+	mux.HandleFunc("/api/detections/clusters", newDetectionClustersHandler(detectionStore))
+	mux.HandleFunc("/api/detections/track", newDetectionTrackHandler(detectionStore))
+	mux.HandleFunc("/api/detections/{id}/feedback", newDetectionFeedbackHandler(detectionStore))
+	mux.HandleFunc("/api/calibrate", newCalibrationHandler(calibrations))
+	mux.HandleFunc("/api/model/diagnostics", diagnosticsHandler)
+	mux.HandleFunc("/api/model/prototypes/{id}/selfcheck", newPrototypeSelfCheckHandler(registry))
+	mux.HandleFunc("/api/model/reload", newModelReloadHandler(reloader))
+	mux.HandleFunc("/api/config", newConfigHandler(registry, extractor, templateMatcher, templatePath, detectionStore))
+	mux.HandleFunc("/readyz", newReadinessHandler(registry))
+	mux.Handle("/metrics", metrics.Handler())
 	mux.Handle("/", http.FileServer(http.Dir("static")))
 
+	if grpcPort != "" {
+		serveGRPC(grpcPort, registry, newRecordingPipeline(registry, extractor, templateMatcher, persistRecordings, noiseFloor, calibrations))
+	}
+
 	serveHTTP(server, serveHTTPS, port, mux)
 }
 
+// verifyRecordingLinks logs stored detections whose recording file is gone and, when
+// prune is set, clears those references so the store matches the disk.
+func verifyRecordingLinks(store detections.DetectionStore, recordingDir string, prune bool) {
+	missing, err := detections.VerifyRecordings(store, recordingDir)
+	if err != nil {
+		log.Printf("WARNING: failed to verify detection recordings: %v\n", err)
+		return
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	log.Printf("WARNING: %d detections reference recordings missing from disk (ids %v)\n", len(missing), missing)
+	if !prune {
+		return
+	}
+	pruned, err := store.PruneRecordings(missing)
+	if err != nil {
+		log.Printf("WARNING: failed to prune orphaned recording references: %v\n", err)
+		return
+	}
+	log.Printf("Cleared %d orphaned recording references\n", pruned)
+}
+
 func serveHTTP(socketServer *socketio.Server, serveHTTPS bool, port string, handler http.Handler) {
 	if handler == nil {
 		handler = socketServer
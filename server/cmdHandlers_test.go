@@ -0,0 +1,1802 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"song-recognition/detections"
+	"song-recognition/drone"
+	"song-recognition/grpcserver"
+	"song-recognition/grpcserver/classifierpb"
+	"song-recognition/metrics"
+	"song-recognition/models"
+	"song-recognition/wav"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestModelDiagnosticsHandlerReportsSelfMatch(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "alpha_01.wav")
+	writeTestTone(t, source, 440, 1.0)
+
+	features, err := drone.ExtractFeaturesFromPath(source)
+	if err != nil {
+		t.Fatalf("failed to extract features: %v", err)
+	}
+	alpha := make([]float64, 2048)
+	copy(alpha, features)
+	beta := make([]float64, 2048)
+	for i := range beta {
+		beta[i] = float64(i%7) - 3
+	}
+
+	modelPath := filepath.Join(dir, "model.json")
+	data, err := json.Marshal([]drone.Prototype{
+		{ID: "alpha_1", Label: "alpha", Category: "drone", Source: source, Features: alpha},
+		{ID: "beta_1", Label: "beta", Category: "drone", Source: filepath.Join(dir, "missing.wav"), Features: beta},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	handler := newModelDiagnosticsHandler(newModelRegistry(classifier), drone.NewLegacyExtractor())
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/model/diagnostics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report drone.DiagnosticsReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+
+	if report.Checked != 1 || report.Skipped != 1 {
+		t.Fatalf("expected 1 checked and 1 skipped prototype, got %d checked, %d skipped", report.Checked, report.Skipped)
+	}
+	if !report.Healthy {
+		t.Fatalf("expected healthy report, got %+v", report)
+	}
+
+	results := map[string]drone.PrototypeDiagnostic{}
+	for _, result := range report.Results {
+		results[result.ID] = result
+	}
+	if got := results["alpha_1"]; got.Status != drone.DiagnosticOK || got.PredictedLabel != "alpha" || !got.SelfNearest || !got.Deterministic {
+		t.Fatalf("expected alpha_1 to self-match deterministically, got %+v", got)
+	}
+	if got := results["beta_1"]; got.Status != drone.DiagnosticMissingSource {
+		t.Fatalf("expected beta_1 to be skipped as missing, got %+v", got)
+	}
+}
+
+func TestModelDiagnosticsHandlerEmbedsThroughConfiguredExtractor(t *testing.T) {
+	// The environment points elsewhere, so only the injected extractor reaches the service
+	t.Setenv("EMBEDDING_SERVICE_URL", "http://127.0.0.1:1")
+
+	embedding := make([]float64, 2048)
+	for i := range embedding {
+		embedding[i] = float64(i%5) + 1
+	}
+	var requests atomic.Int32
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"embedding": embedding, "dimension": len(embedding)})
+	}))
+	defer service.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "quad_01.wav")
+	writeTestTone(t, source, 440, 1.0)
+	other := make([]float64, 2048)
+	for i := range other {
+		other[i] = float64(i%7) - 3
+	}
+	modelPath := filepath.Join(dir, "model.json")
+	data, err := json.Marshal([]drone.Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Source: source, Features: embedding},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: other},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	handler := newModelDiagnosticsHandler(newModelRegistry(classifier), drone.NewPANNSExtractor(service.URL))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/model/diagnostics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report drone.DiagnosticsReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if requests.Load() == 0 || report.Checked != 1 || !report.Healthy {
+		t.Fatalf("expected quad_1 re-embedded through the injected extractor, got %d requests and %+v", requests.Load(), report)
+	}
+}
+
+func TestPrototypeSelfCheckIdentifiesUploadedPrototype(t *testing.T) {
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	for i, label := range []string{"quad", "wind"} {
+		features := make([]float64, 2048)
+		features[i] = 1
+		if _, err := classifier.AddPrototype(drone.Prototype{ID: label + "_7", Label: label, Features: features}); err != nil {
+			t.Fatalf("AddPrototype returned error: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/model/prototypes/{id}/selfcheck", newPrototypeSelfCheckHandler(newModelRegistry(classifier)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/model/prototypes/quad_7/selfcheck", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result drone.SelfCheckResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode self-check: %v", err)
+	}
+	if result.PredictedLabel != "quad" || !result.SelfIdentified || !result.SelfNearest || result.Confidence <= 0.5 {
+		t.Fatalf("expected quad_7 to identify as itself, got %+v", result)
+	}
+	// quad_7 is the model's only quad, so without it the rest of the model cannot name it
+	if result.HoldoutLabel == "" || result.HoldoutLabel == "quad" || result.HoldoutIdentified {
+		t.Fatalf("expected the holdout check to miss the only quad prototype, got %+v", result)
+	}
+
+	missing := httptest.NewRecorder()
+	mux.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/api/model/prototypes/nope/selfcheck", nil))
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown prototype, got %d", missing.Code)
+	}
+}
+
+func TestModelReloadHandlerSwapsModelAndTemplates(t *testing.T) {
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "model.json")
+	templatePath := filepath.Join(dir, "templates.json")
+	writeTestModel(t, modelPath, "alpha")
+	writeTestTemplates(t, templatePath, "alpha")
+
+	loadModel := func() (*drone.Classifier, error) { return drone.NewClassifierFromFile(modelPath, 1) }
+	classifier, err := loadModel()
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	matcher, err := drone.NewTemplateMatcherFromFile(templatePath, 0)
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	registry := newModelRegistry(classifier)
+	handler := newModelReloadHandler(&modelReloader{
+		registry:        registry,
+		loadModel:       loadModel,
+		templateMatcher: matcher,
+		templatePath:    templatePath,
+	})
+
+	writeTestModel(t, modelPath, "alpha", "beta", "gamma")
+	writeTestTemplates(t, templatePath, "alpha", "beta")
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/model/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response modelReloadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.PrototypeCount != 3 || response.TemplateCount != 2 {
+		t.Fatalf("expected 3 prototypes and 2 templates, got %+v", response)
+	}
+	if got := registry.defaultClassifier().Stats().PrototypeCount; got != 3 {
+		t.Fatalf("expected the registry to serve the reloaded model, got %d prototypes", got)
+	}
+
+	// A broken template file must leave the running model and templates untouched
+	writeTestModel(t, modelPath, "alpha")
+	if err := os.WriteFile(templatePath, []byte("not json"), 0644); err != nil {
+		t.Fatalf("failed to corrupt templates: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/model/reload", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 for a broken template file, got %d", rec.Code)
+	}
+	if registry.defaultClassifier().Stats().PrototypeCount != 3 || matcher.TemplateCount() != 2 {
+		t.Fatalf("expected a failed reload to keep the previous model and templates")
+	}
+}
+
+func writeTestTemplates(t *testing.T, path string, labels ...string) {
+	t.Helper()
+
+	templates := make([]drone.Template, 0, len(labels))
+	for i, label := range labels {
+		features := make([]float64, 2048)
+		features[i] = 1
+		templates = append(templates, drone.Template{Label: label, Source: label + ".wav", Features: features})
+	}
+	if err := drone.SaveTemplates(path, templates); err != nil {
+		t.Fatalf("failed to write templates: %v", err)
+	}
+}
+
+func TestClassificationHandlerReportsMissingFFmpeg(t *testing.T) {
+	t.Cleanup(wav.SetRunner(missingFFmpegRunner{}))
+
+	registry := newModelRegistry(nil)
+	handler := newAudioClassificationHandler(registry, drone.NewLegacyExtractor(), nil, false, nil, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(newTestRecording(t, 0.5))))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	if body.Message != wav.ErrFFmpegUnavailable.Error() {
+		t.Fatalf("expected audio tooling error, got %q", body.Message)
+	}
+	if !strings.Contains(body.Detail, "install FFmpeg") {
+		t.Fatalf("expected remediation guidance, got %q", body.Detail)
+	}
+
+	readyz := httptest.NewRecorder()
+	newReadinessHandler(registry)(readyz, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if readyz.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz to report 503, got %d", readyz.Code)
+	}
+	var readiness readinessResponse
+	if err := json.Unmarshal(readyz.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("failed to decode readiness: %v", err)
+	}
+	if readiness.Ready || readiness.Checks["ffmpeg"].OK {
+		t.Fatalf("expected ffmpeg check to fail, got %+v", readiness)
+	}
+}
+
+func TestClassificationHandlerVerboseOption(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha", "beta")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil)
+	body := newTestRecording(t, 5.0)
+
+	for query, wantDetail := range map[string]bool{"?verbose=true": true, "?verbose=false": false} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify"+query, bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", query, err)
+		}
+		if _, ok := fields["predictions"]; !ok {
+			t.Fatalf("%s: expected consolidated predictions in response", query)
+		}
+		for _, key := range []string{"windows", "featureVector"} {
+			if _, ok := fields[key]; ok != wantDetail {
+				t.Fatalf("%s: expected %s present=%v, got %v", query, key, wantDetail, ok)
+			}
+		}
+	}
+}
+
+func TestClassificationHandlerCompactsWindowsByDefault(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha", "beta", "gamma")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil)
+	body := newTestRecording(t, 12.0)
+	classify := func(query string) (drone.ClassificationSummary, int) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify?verbose=true"+query, bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var summary drone.ClassificationSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("%q: failed to decode summary: %v", query, err)
+		}
+		if len(summary.Windows) < 5 {
+			t.Fatalf("%q: expected a multi-window clip, got %d windows", query, len(summary.Windows))
+		}
+		return summary, rec.Body.Len()
+	}
+
+	compact, compactSize := classify("")
+	full, fullSize := classify("&windows=full")
+	for i, window := range compact.Windows {
+		if len(window.Predictions) != 0 {
+			t.Fatalf("expected compact windows by default, window %d has %d predictions", i, len(window.Predictions))
+		}
+		top := full.Windows[i].Predictions[0]
+		if window.TopLabel != top.Label || window.TopConfidence != top.Confidence {
+			t.Fatalf("window %d: expected top %s %.3f, got %s %.3f", i, top.Label, top.Confidence, window.TopLabel, window.TopConfidence)
+		}
+	}
+	// The feature vector is the same in both, so the windows account for the difference
+	if compactSize*2 > fullSize {
+		t.Fatalf("expected the compact response to be well under half the full size, got %d vs %d bytes", compactSize, fullSize)
+	}
+}
+
+// fakeExtractor returns a fixed vector, or err when set, and records the samples it
+// was given.
+type fakeExtractor struct {
+	features []float64
+	err      error
+	calls    int
+	rate     int
+}
+
+func (f *fakeExtractor) Extract(sample *drone.AudioSample) ([]float64, error) {
+	f.calls++
+	f.rate = sample.SampleRate
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.features, nil
+}
+
+func (f *fakeExtractor) Dimension() int { return len(f.features) }
+
+func (f *fakeExtractor) SupportsSlidingWindows() bool { return false }
+
+func TestClassificationHandlerUsesInjectedExtractor(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+
+	alpha, beta := make([]float64, 2048), make([]float64, 2048)
+	alpha[0], beta[1] = 1, 1
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	data, err := json.Marshal([]drone.Prototype{
+		{ID: "alpha_1", Label: "alpha", Category: "drone", Features: alpha},
+		{ID: "beta_1", Label: "beta", Category: "drone", Features: beta},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	features := append([]float64(nil), beta...)
+	extractor := &fakeExtractor{features: features}
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), extractor, nil, false, nil, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify?verbose=true", bytes.NewReader(newTestRecording(t, 5.0))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var summary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if extractor.calls != 1 || extractor.rate != testSampleRate {
+		t.Fatalf("expected one extraction at %d Hz, got %d calls at %d Hz", testSampleRate, extractor.calls, extractor.rate)
+	}
+	if len(summary.Predictions) == 0 || summary.Predictions[0].Label != "beta" {
+		t.Fatalf("expected beta from the injected features, got %+v", summary.Predictions)
+	}
+	// A whole-file extractor must not be mixed with per-window legacy analysis
+	if len(summary.Windows) != 0 || summary.WindowCount != 0 {
+		t.Fatalf("expected no sliding windows for a whole-file extractor, got %d", len(summary.Windows))
+	}
+}
+
+func TestClassificationPreprocessingOverrides(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil)
+
+	classify := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify?verbose=true"+query, bytes.NewReader(newTestRecording(t, 2.0))))
+		return rec
+	}
+	featuresOf := func(rec *httptest.ResponseRecorder) []float64 {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var summary drone.ClassificationSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(summary.FeatureVector) == 0 {
+			t.Fatalf("expected a feature vector in the verbose response")
+		}
+		return summary.FeatureVector
+	}
+
+	withAGC := featuresOf(classify(""))
+	withoutAGC := featuresOf(classify("&agc=false"))
+	if slices.Equal(withAGC, withoutAGC) {
+		t.Fatalf("expected agc=false to change the feature vector")
+	}
+	if again := featuresOf(classify("&agc=true")); !slices.Equal(again, withAGC) {
+		t.Fatalf("expected agc=true to match the default preprocessing")
+	}
+
+	for _, query := range []string{"&agc=maybe", "&highpass=false&bandpass=false&noisereduction=true"} {
+		if rec := classify(query); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestClassificationSummarySplitsDroneAndNoiseConfidence(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+
+	quad, wind, gust := make([]float64, 2048), make([]float64, 2048), make([]float64, 2048)
+	quad[0], wind[1], gust[1], gust[2] = 1, 1, 1, 0.2
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	data, err := json.Marshal([]drone.Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: quad},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: wind},
+		{ID: "gust_1", Label: "gust", Category: "noise", Features: gust},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	// Closest to the drone, with both noise labels among the neighbours
+	features := make([]float64, 2048)
+	features[0], features[1], features[2] = 1, 0.6, 0.1
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), &fakeExtractor{features: features}, nil, false, nil, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(newTestRecording(t, 1.0))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var summary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var wantDrone, wantNoise float64
+	for _, pred := range summary.Predictions {
+		if pred.Category == "noise" {
+			wantNoise += pred.Confidence
+		} else {
+			wantDrone += pred.Confidence
+		}
+	}
+	if len(summary.Predictions) != 3 || wantNoise == 0 || summary.Predictions[0].Label != "quad" {
+		t.Fatalf("expected quad ahead of two noise labels, got %+v", summary.Predictions)
+	}
+	if math.Abs(summary.DroneConfidence-wantDrone) > 1e-9 || math.Abs(summary.NoiseConfidence-wantNoise) > 1e-9 {
+		t.Fatalf("expected drone %.3f and noise %.3f, got %.3f and %.3f",
+			wantDrone, wantNoise, summary.DroneConfidence, summary.NoiseConfidence)
+	}
+	if math.Abs(summary.DroneConfidence+summary.NoiseConfidence-1) > 1e-9 {
+		t.Fatalf("expected the split to cover all confidence, got %.3f + %.3f", summary.DroneConfidence, summary.NoiseConfidence)
+	}
+}
+
+func TestClassificationHandlerExplainsNegativeResults(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("DRONE_MIN_PROTOTYPES", "0")
+
+	quad, wind := make([]float64, 2048), make([]float64, 2048)
+	quad[0], wind[1] = 1, 1
+	loadModel := func(prototypes []drone.Prototype) *drone.Classifier {
+		t.Helper()
+		modelPath := filepath.Join(t.TempDir(), "model.json")
+		data, err := json.Marshal(prototypes)
+		if err != nil {
+			t.Fatalf("failed to marshal model: %v", err)
+		}
+		if err := os.WriteFile(modelPath, data, 0644); err != nil {
+			t.Fatalf("failed to write model: %v", err)
+		}
+		classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+		if err != nil {
+			t.Fatalf("failed to load model: %v", err)
+		}
+		return classifier
+	}
+	trained := loadModel([]drone.Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: quad},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: wind},
+	})
+
+	for _, tc := range []struct {
+		name         string
+		classifier   *drone.Classifier
+		features     []float64
+		recording    []byte
+		wantStatus   int
+		wantDrone    bool
+		wantAnalyzed bool
+		wantReason   string
+	}{
+		{"drone", trained, quad, newTestRecording(t, 1.0), http.StatusOK, true, true, ""},
+		{"low confidence", trained, wind, newTestRecording(t, 1.0), http.StatusOK, false, true, drone.ReasonLowConfidence},
+		{"too short", trained, wind, newTestRecording(t, 0.5), http.StatusOK, false, false, drone.ReasonTooShort},
+		{"no signal", trained, wind, newLocatedRecording(t, testTonePCMAt(440, 0, 1.0), 1.0, nil, nil), http.StatusOK, false, false, drone.ReasonNoSignal},
+		{"empty model", loadModel([]drone.Prototype{}), wind, newTestRecording(t, 1.0), http.StatusServiceUnavailable, false, false, drone.ReasonEmptyModel},
+	} {
+		handler := newAudioClassificationHandler(newModelRegistry(tc.classifier), &fakeExtractor{features: tc.features}, nil, false, nil, nil)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(tc.recording)))
+		if rec.Code != tc.wantStatus {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.wantStatus, rec.Code, rec.Body.String())
+		}
+		var summary drone.ClassificationSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tc.name, err)
+		}
+		if summary.IsDrone != tc.wantDrone || summary.Analyzed != tc.wantAnalyzed || summary.Reason != tc.wantReason {
+			t.Fatalf("%s: expected isDrone=%v analyzed=%v reason=%q, got isDrone=%v analyzed=%v reason=%q", tc.name,
+				tc.wantDrone, tc.wantAnalyzed, tc.wantReason, summary.IsDrone, summary.Analyzed, summary.Reason)
+		}
+	}
+}
+
+func TestClassificationHandlerReturnsTopNPredictions(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+
+	quad, wind, gust := make([]float64, 2048), make([]float64, 2048), make([]float64, 2048)
+	quad[0], wind[1], gust[1], gust[2] = 1, 1, 1, 0.2
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	data, err := json.Marshal([]drone.Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: quad},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: wind},
+		{ID: "gust_1", Label: "gust", Category: "noise", Features: gust},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	features := make([]float64, 2048)
+	features[0], features[1], features[2] = 1, 0.6, 0.1
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), &fakeExtractor{features: features}, nil, false, nil, nil)
+
+	for topN, want := range map[string]int{"0": 3, "2": 2, "1": 1} {
+		t.Setenv("DRONE_TOP_N", topN)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(newTestRecording(t, 1.0))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("DRONE_TOP_N=%s: expected 200, got %d: %s", topN, rec.Code, rec.Body.String())
+		}
+		var summary drone.ClassificationSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("DRONE_TOP_N=%s: failed to decode response: %v", topN, err)
+		}
+
+		if len(summary.Predictions) != want || summary.Predictions[0].Label != "quad" {
+			t.Fatalf("DRONE_TOP_N=%s: expected the top %d predictions led by quad, got %+v", topN, want, summary.Predictions)
+		}
+		// The drone/noise split is still computed over every label
+		if math.Abs(summary.DroneConfidence+summary.NoiseConfidence-1) > 1e-9 {
+			t.Fatalf("DRONE_TOP_N=%s: expected the split to cover all confidence, got %.3f + %.3f",
+				topN, summary.DroneConfidence, summary.NoiseConfidence)
+		}
+	}
+}
+
+func TestPrototypeDeleteHandlerRemovesPrototype(t *testing.T) {
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	features := make([]float64, 2048)
+	features[0] = 1
+	if _, err := classifier.AddPrototype(drone.Prototype{ID: "bad_1", Label: "quad", Features: features}); err != nil {
+		t.Fatalf("AddPrototype returned error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/prototypes/upload", newPrototypeUploadHandler(newModelRegistry(classifier)))
+	mux.HandleFunc("/api/prototypes/{id}", newPrototypeDeleteHandler(newModelRegistry(classifier)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/prototypes/bad_1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response prototypeDeleteResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Removed != "bad_1" || response.Stats.PrototypeCount != 1 || classifier.Stats().PrototypeCount != 1 {
+		t.Fatalf("expected bad_1 removed leaving 1 prototype, got %+v", response)
+	}
+
+	// The removal is saved, so a reload does not bring the prototype back
+	reloaded, err := drone.NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("failed to reload model: %v", err)
+	}
+	if count := reloaded.Stats().PrototypeCount; count != 1 {
+		t.Fatalf("expected the saved model to hold 1 prototype, got %d", count)
+	}
+
+	missing := httptest.NewRecorder()
+	mux.ServeHTTP(missing, httptest.NewRequest(http.MethodDelete, "/api/prototypes/bad_1", nil))
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown prototype, got %d", missing.Code)
+	}
+
+	wrongMethod := httptest.NewRecorder()
+	mux.ServeHTTP(wrongMethod, httptest.NewRequest(http.MethodGet, "/api/prototypes/alpha_1", nil))
+	if wrongMethod.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", wrongMethod.Code)
+	}
+}
+
+func TestMetricsCountClassifications(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+
+	quad, wind := make([]float64, 2048), make([]float64, 2048)
+	quad[0], wind[1] = 1, 1
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	if err := drone.WritePrototypes(modelPath, []drone.Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: quad},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: wind},
+	}); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), &fakeExtractor{features: quad}, nil, false, nil, nil)
+
+	before := scrapeMetrics(t)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(newTestRecording(t, 1.0))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var summary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	after := scrapeMetrics(t)
+
+	outcome := fmt.Sprintf(`classifications_total{is_drone="%t"}`, summary.IsDrone)
+	for series, want := range map[string]float64{
+		outcome:                                            1,
+		`predictions_by_label{label="quad"}`:               1,
+		`classification_latency_seconds_count`:             1,
+		`classification_latency_seconds_bucket{le="+Inf"}`: 1,
+	} {
+		if got := after[series] - before[series]; got != want {
+			t.Fatalf("expected %s to increase by %v, got %v", series, want, got)
+		}
+	}
+}
+
+// scrapeMetrics fetches /metrics and returns each series' value by name and labels.
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected a text/plain 200, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	values := make(map[string]float64)
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		series, value, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Fatalf("malformed metrics line %q", line)
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("malformed value in %q: %v", line, err)
+		}
+		values[series] = parsed
+	}
+	return values
+}
+
+func TestGRPCClassifyMatchesHTTPLabel(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	dir := t.TempDir()
+	var prototypes []drone.Prototype
+	for label, frequency := range map[string]float64{"alpha": 440, "beta": 2000} {
+		source := filepath.Join(dir, label+".wav")
+		writeTestTone(t, source, frequency, 1.0)
+		features, err := drone.ExtractFeaturesFromPath(source)
+		if err != nil {
+			t.Fatalf("failed to extract %s features: %v", label, err)
+		}
+		prototypes = append(prototypes, drone.Prototype{ID: label + "_1", Label: label, Category: "drone", Features: features})
+	}
+	modelPath := filepath.Join(dir, "model.json")
+	if err := drone.WritePrototypes(modelPath, prototypes); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	registry := newModelRegistry(classifier)
+	extractor := drone.NewLegacyExtractor()
+
+	// The recording is the same WAV for both transports
+	recordingPath := filepath.Join(dir, "recording.wav")
+	writeTestTone(t, recordingPath, 440, 1.0)
+	recording, err := wav.ReadWavInfo(recordingPath)
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+
+	body, err := json.Marshal(models.RecordData{
+		Audio:      base64.StdEncoding.EncodeToString(recording.Data),
+		Duration:   recording.Duration,
+		Channels:   recording.Channels,
+		SampleRate: recording.SampleRate,
+		SampleSize: recording.BitsPerSample,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal recording: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	newAudioClassificationHandler(registry, extractor, nil, false, nil, nil)(
+		rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var httpSummary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &httpSummary); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	pipeline := newRecordingPipeline(registry, extractor, nil, false, nil, nil)
+	go grpcserver.Serve(listener, newGRPCClassifier(registry, pipeline), 0)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial gRPC server: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := classifierpb.NewDroneClassifierClient(conn).Classify(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	const chunkBytes = 8192
+	for offset := 0; offset < len(recording.Data); offset += chunkBytes {
+		chunk := &classifierpb.AudioChunk{Audio: recording.Data[offset:min(offset+chunkBytes, len(recording.Data))]}
+		if offset == 0 {
+			chunk.SampleRate = int32(recording.SampleRate)
+			chunk.Channels = int32(recording.Channels)
+			chunk.SampleSize = int32(recording.BitsPerSample)
+		}
+		if err := stream.Send(chunk); err != nil {
+			t.Fatalf("failed to send chunk at %d: %v", offset, err)
+		}
+	}
+	grpcSummary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("gRPC classification failed: %v", err)
+	}
+
+	if len(httpSummary.Predictions) == 0 || httpSummary.Predictions[0].Label != "alpha" {
+		t.Fatalf("expected HTTP to classify the 440 Hz tone as alpha, got %+v", httpSummary.Predictions)
+	}
+	if len(grpcSummary.Predictions) == 0 || grpcSummary.Predictions[0].Label != httpSummary.Predictions[0].Label {
+		t.Fatalf("expected gRPC label %q, got %+v", httpSummary.Predictions[0].Label, grpcSummary.Predictions)
+	}
+	if grpcSummary.RecordingHash != httpSummary.RecordingHash {
+		t.Fatalf("expected both transports to analyse the same recording, got hashes %s and %s",
+			grpcSummary.RecordingHash, httpSummary.RecordingHash)
+	}
+}
+
+func TestClassificationSummaryReportsAnalyzedFormat(t *testing.T) {
+	t.Cleanup(wav.SetRunner(resamplingRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	// 22.05 kHz stereo capture; the server should analyse 44.1 kHz mono
+	const clientRate, seconds = 22050, 1.0
+	frames := int(clientRate * seconds)
+	pcm := make([]byte, frames*4)
+	for i := 0; i < frames; i++ {
+		value := uint16(int16(0.5 * 32767 * math.Sin(2*math.Pi*440*float64(i)/clientRate)))
+		binary.LittleEndian.PutUint16(pcm[i*4:], value)
+		binary.LittleEndian.PutUint16(pcm[i*4+2:], value)
+	}
+	body, err := json.Marshal(models.RecordData{
+		Audio:      base64.StdEncoding.EncodeToString(pcm),
+		Duration:   seconds,
+		Channels:   2,
+		SampleRate: clientRate,
+		SampleSize: 16,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal recording: %v", err)
+	}
+
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var summary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if summary.AnalyzedSampleRate != 44100 || summary.AnalyzedChannels != 1 {
+		t.Fatalf("expected 44100 Hz mono analysis, got %d Hz / %d channels",
+			summary.AnalyzedSampleRate, summary.AnalyzedChannels)
+	}
+}
+
+func TestURLClassificationHandlerFetchesAllowedHost(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+	t.Setenv("DRONE_URL_ALLOWED_HOSTS", "127.0.0.1")
+	t.Setenv("DRONE_URL_ALLOWED_SCHEMES", "http")
+
+	files := t.TempDir()
+	writeTestTone(t, filepath.Join(files, "capture.wav"), 440, 1.0)
+	server := httptest.NewServer(http.FileServer(http.Dir(files)))
+	defer server.Close()
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	handler := newAudioURLClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil)
+
+	body := `{"url": "` + server.URL + `/capture.wav", "lat": 51.5, "lon": -0.12}`
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify/url", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var summary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if len(summary.Predictions) == 0 {
+		t.Fatalf("expected predictions for downloaded audio")
+	}
+	if summary.Latitude == nil || *summary.Latitude != 51.5 || summary.Longitude == nil || *summary.Longitude != -0.12 {
+		t.Fatalf("expected request location in summary, got %v/%v", summary.Latitude, summary.Longitude)
+	}
+}
+
+func TestURLClassificationHandlerRejectsDisallowedHost(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Setenv("DRONE_URL_ALLOWED_HOSTS", "audio.example.com")
+	t.Setenv("DRONE_URL_ALLOWED_SCHEMES", "http,https")
+
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	handler := newAudioURLClassificationHandler(newModelRegistry(nil), drone.NewLegacyExtractor(), nil, false, nil, nil)
+	for _, target := range []string{server.URL + "/capture.wav", "file:///etc/passwd"} {
+		rec := httptest.NewRecorder()
+		body := `{"url": "` + target + `"}`
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify/url", strings.NewReader(body)))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+	}
+	if hits != 0 {
+		t.Fatalf("expected disallowed host never to be contacted, got %d requests", hits)
+	}
+}
+
+func TestClassificationHandlerFlagsAmbiguousPrediction(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+	t.Setenv("DRONE_MIN_CONFIDENCE_GAP", "0.1")
+
+	// Both prototypes point the same way, so the two labels tie exactly
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha", "beta")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	handler := newAudioClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(newTestRecording(t, 1.0))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var summary drone.ClassificationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if len(summary.Predictions) != 2 {
+		t.Fatalf("expected two tied labels, got %d", len(summary.Predictions))
+	}
+	if !summary.Ambiguous {
+		t.Fatalf("expected ambiguous flag for %.3f vs %.3f", summary.Predictions[0].Confidence, summary.Predictions[1].Confidence)
+	}
+}
+
+func TestDetectionFeedbackIsPersisted(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+	t.Setenv("DRONE_CANDIDATES_PATH", "candidates.json")
+
+	writeTestTone(t, "rec_1rfm.wav", 440, 1.0)
+	detection := &models.Detection{
+		ID:            42,
+		PrimaryLabel:  "quad",
+		IsDrone:       true,
+		Predictions:   json.RawMessage(`[]`),
+		RecordingPath: "rec_1rfm.wav",
+	}
+	if err := detections.SaveDetection(detection); err != nil {
+		t.Fatalf("failed to save detection: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/detections/{id}/feedback", newDetectionFeedbackHandler(detections.JSONStore{}))
+
+	rec := httptest.NewRecorder()
+	body := `{"correctLabel": "Wind_Gust", "isDrone": false}`
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/detections/42/feedback", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	stored, err := detections.LoadDetections()
+	if err != nil {
+		t.Fatalf("failed to load detections: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Feedback == nil {
+		t.Fatalf("expected feedback on the stored detection, got %+v", stored)
+	}
+	feedback := stored[0].Feedback
+	if feedback.CorrectLabel != "wind gust" || feedback.IsDrone == nil || *feedback.IsDrone {
+		t.Fatalf("unexpected feedback: %+v", feedback)
+	}
+	if feedback.SubmittedAt.IsZero() || feedback.CandidateID == "" {
+		t.Fatalf("expected timestamp and prototype candidate, got %+v", feedback)
+	}
+
+	data, err := os.ReadFile("candidates.json")
+	if err != nil {
+		t.Fatalf("failed to read candidates: %v", err)
+	}
+	var candidates []drone.Prototype
+	if err := json.Unmarshal(data, &candidates); err != nil {
+		t.Fatalf("failed to decode candidates: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].ID != feedback.CandidateID || candidates[0].Label != "wind gust" || candidates[0].Category != "noise" {
+		t.Fatalf("unexpected candidates: %+v", candidates)
+	}
+
+	missing := httptest.NewRecorder()
+	mux.ServeHTTP(missing, httptest.NewRequest(http.MethodPost, "/api/detections/7/feedback", strings.NewReader(body)))
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown detection, got %d", missing.Code)
+	}
+}
+
+func TestCalibrationInfluencesAdjustedThreshold(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+	t.Setenv("DRONE_CONFIDENCE_THRESHOLD", "0.55")
+	t.Setenv("DRONE_MIN_PROTOTYPES", "0") // keep the single-prototype model out of low-data mode
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	calibrations := drone.NewNoiseCalibrationStore()
+	calibrate := newCalibrationHandler(calibrations)
+	classify := newAudioClassificationHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, calibrations)
+
+	lat, lng := 51.5, -0.12
+	otherLat := 48.85
+
+	// Ambient is 40 dB quieter than the tone classified afterwards
+	rec := httptest.NewRecorder()
+	calibrate(rec, httptest.NewRequest(http.MethodPost, "/api/calibrate",
+		bytes.NewReader(newLocatedRecording(t, testTonePCMAt(440, 0.005, 2.0), 2.0, &lat, &lng))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected calibration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var calibration drone.NoiseCalibration
+	if err := json.Unmarshal(rec.Body.Bytes(), &calibration); err != nil {
+		t.Fatalf("failed to decode calibration: %v", err)
+	}
+	if calibration.Key != drone.LocationKey(&lat, &lng) {
+		t.Fatalf("expected calibration keyed by location, got %q", calibration.Key)
+	}
+
+	classifyAt := func(latitude, longitude *float64) drone.ClassificationSummary {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		classify(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify",
+			bytes.NewReader(newLocatedRecording(t, testTonePCM(440, 1.0), 1.0, latitude, longitude))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected classification to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var summary drone.ClassificationSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("failed to decode summary: %v", err)
+		}
+		return summary
+	}
+
+	calibrated := classifyAt(&lat, &lng)
+	uncalibrated := classifyAt(&otherLat, &lng)
+
+	if math.Abs(calibrated.CalibratedSNRDb-40) > 1 {
+		t.Fatalf("expected ~40 dB SNR against the ambient baseline, got %.1f", calibrated.CalibratedSNRDb)
+	}
+	if uncalibrated.CalibratedSNRDb != 0 {
+		t.Fatalf("expected no calibration at an uncalibrated location, got %.1f", uncalibrated.CalibratedSNRDb)
+	}
+	if want := drone.AdaptiveThreshold(0.55, calibrated.CalibratedSNRDb); calibrated.AdjustedThreshold != want {
+		t.Fatalf("expected calibrated threshold %.2f, got %.2f", want, calibrated.AdjustedThreshold)
+	}
+	if calibrated.AdjustedThreshold >= uncalibrated.AdjustedThreshold {
+		t.Fatalf("expected the quiet baseline to lower the threshold below %.2f, got %.2f",
+			uncalibrated.AdjustedThreshold, calibrated.AdjustedThreshold)
+	}
+}
+
+func TestClassificationHandlerReportsDecodeErrors(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Setenv("DRONE_MAX_REQUEST_BYTES", "1024")
+
+	handler := newAudioClassificationHandler(newModelRegistry(nil), drone.NewLegacyExtractor(), nil, false, nil, nil)
+	oversized := `{"audio":"` + strings.Repeat("A", 2048) + `"}`
+
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPrefix string
+	}{
+		{"oversized", oversized, http.StatusRequestEntityTooLarge, "request body exceeds 1024 bytes"},
+		{"malformed", `{"audio": "AAAA",`, http.StatusBadRequest, "malformed JSON"},
+		{"missing audio", `{"sampleRate": 44100, "channels": 1}`, http.StatusBadRequest, `missing required field "audio"`},
+	}
+
+	seen := make(map[string]string)
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/audio/classify", strings.NewReader(tc.body)))
+
+		if rec.Code != tc.wantStatus {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.wantStatus, rec.Code, rec.Body.String())
+		}
+		var body apiError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode error: %v", tc.name, err)
+		}
+		if !strings.HasPrefix(body.Message, tc.wantPrefix) {
+			t.Fatalf("%s: expected message starting %q, got %q", tc.name, tc.wantPrefix, body.Message)
+		}
+		if other, ok := seen[body.Message]; ok {
+			t.Fatalf("%s and %s produced the same message %q", other, tc.name, body.Message)
+		}
+		seen[body.Message] = tc.name
+	}
+}
+
+func TestClassificationHandlerReportsErrorCodes(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "quad")
+	trained, err := drone.NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	emptyPath := filepath.Join(t.TempDir(), "empty.json")
+	writeTestModel(t, emptyPath)
+	empty, err := drone.NewClassifierFromFile(emptyPath, 1)
+	if err != nil {
+		t.Fatalf("failed to load empty model: %v", err)
+	}
+
+	legacy := drone.NewLegacyExtractor()
+	embeddingDown := &fakeExtractor{err: errors.New("embedding service unreachable")}
+	recording := newTestRecording(t, 1.0)
+	noSamples, err := json.Marshal(models.RecordData{Audio: "\n", Channels: 1, SampleRate: testSampleRate, SampleSize: 16})
+	if err != nil {
+		t.Fatalf("failed to marshal recording: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		classifier *drone.Classifier
+		extractor  drone.FeatureExtractor
+		target     string
+		body       []byte
+		wantStatus int
+		wantCode   drone.ErrorCode
+	}{
+		{"malformed", trained, legacy, "/api/audio/classify", []byte(`{"audio":`), http.StatusBadRequest, drone.CodeInvalidRequest},
+		{"missing audio", trained, legacy, "/api/audio/classify", []byte(`{"sampleRate": 44100}`), http.StatusBadRequest, drone.CodeInvalidRequest},
+		{"bad preprocessing", trained, legacy, "/api/audio/classify?highpass=maybe", recording, http.StatusBadRequest, drone.CodeInvalidRequest},
+		{"unknown model", trained, legacy, "/api/audio/classify?model=missing", recording, http.StatusNotFound, drone.CodeModelNotFound},
+		{"undecodable", trained, legacy, "/api/audio/classify", []byte(`{"audio":"not base64!"}`), http.StatusBadRequest, drone.CodeAudioUndecodable},
+		{"no samples", trained, legacy, "/api/audio/classify", noSamples, http.StatusUnprocessableEntity, drone.CodeAudioTooShort},
+		{"empty model", empty, legacy, "/api/audio/classify", recording, http.StatusServiceUnavailable, drone.CodeModelEmpty},
+		{"embedding unavailable", trained, embeddingDown, "/api/audio/classify", recording, http.StatusServiceUnavailable, drone.CodeEmbeddingUnavailable},
+	} {
+		handler := newAudioClassificationHandler(newModelRegistry(tc.classifier), tc.extractor, nil, false, nil, nil)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, tc.target, bytes.NewReader(tc.body)))
+
+		if rec.Code != tc.wantStatus {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.wantStatus, rec.Code, rec.Body.String())
+		}
+		var body drone.ClassifyError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode error: %v", tc.name, err)
+		}
+		if body.Code != tc.wantCode {
+			t.Fatalf("%s: expected code %s, got %q: %s", tc.name, tc.wantCode, body.Code, rec.Body.String())
+		}
+		if body.Code.HTTPStatus() != rec.Code {
+			t.Fatalf("%s: code %s maps to %d but the response was %d", tc.name, body.Code, body.Code.HTTPStatus(), rec.Code)
+		}
+	}
+}
+
+// passthroughRunner stands in for FFmpeg when the test input is already
+// 16-bit mono 44.1 kHz PCM: "conversion" copies the input to the output path.
+type passthroughRunner struct{}
+
+func (passthroughRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (passthroughRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	var input string
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-i" {
+			input = args[i+1]
+		}
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	return nil, os.WriteFile(args[len(args)-1], data, 0644)
+}
+
+// resamplingRunner stands in for FFmpeg's -ar/-ac conversion of 16-bit PCM WAV input,
+// downmixing by averaging channels and resampling by nearest sample.
+type resamplingRunner struct{}
+
+func (resamplingRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (resamplingRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	var input string
+	rate, channels := 0, 0
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-i":
+			input = args[i+1]
+		case "-ar":
+			rate, _ = strconv.Atoi(args[i+1])
+		case "-ac":
+			channels, _ = strconv.Atoi(args[i+1])
+		}
+	}
+	info, err := wav.ReadWavInfo(input)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := len(info.Data) / (2 * info.Channels)
+	outFrames := frames * rate / info.SampleRate
+	out := make([]byte, outFrames*channels*2)
+	for i := 0; i < outFrames; i++ {
+		frame := i * info.SampleRate / rate
+		var sum int
+		for c := 0; c < info.Channels; c++ {
+			sum += int(int16(binary.LittleEndian.Uint16(info.Data[(frame*info.Channels+c)*2:])))
+		}
+		for c := 0; c < channels; c++ {
+			binary.LittleEndian.PutUint16(out[(i*channels+c)*2:], uint16(int16(sum/info.Channels)))
+		}
+	}
+	return nil, wav.WriteWavFile(args[len(args)-1], out, rate, channels, 16)
+}
+
+// missingFFmpegRunner simulates a host without FFmpeg installed.
+type missingFFmpegRunner struct{}
+
+func (missingFFmpegRunner) LookPath(file string) (string, error) {
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+func (missingFFmpegRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// writeTestTone writes a 16-bit mono WAV file containing a sine tone.
+func writeTestTone(t *testing.T, path string, frequency float64, seconds float64) {
+	t.Helper()
+
+	if err := wav.WriteWavFile(path, testTonePCM(frequency, seconds), testSampleRate, 1, 16); err != nil {
+		t.Fatalf("failed to write test tone: %v", err)
+	}
+}
+
+const testSampleRate = 44100
+
+// testTonePCM renders a half-scale sine tone as 16-bit little-endian mono PCM.
+func testTonePCM(frequency float64, seconds float64) []byte {
+	return testTonePCMAt(frequency, 0.5, seconds)
+}
+
+// testTonePCMAt renders a sine tone with the given peak amplitude (0-1).
+func testTonePCMAt(frequency float64, amplitude float64, seconds float64) []byte {
+	count := int(seconds * testSampleRate)
+	pcm := make([]byte, count*2)
+	for i := 0; i < count; i++ {
+		value := amplitude * math.Sin(2*math.Pi*frequency*float64(i)/testSampleRate)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(value*32767)))
+	}
+	return pcm
+}
+
+func TestDetectionSeriesBucketsNearbyDetections(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	lat, lon := 51.5, -0.12
+	farLat := 51.6 // ~11 km north
+	base := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	for i, seed := range []struct {
+		offset     time.Duration
+		latitude   *float64
+		isDrone    bool
+		confidence float64
+	}{
+		{5 * time.Minute, &lat, true, 0.8},
+		{40 * time.Minute, &lat, false, 0.4},
+		{59 * time.Minute, &lat, true, 0.9},
+		{65 * time.Minute, &lat, true, 0.6},
+		{3 * time.Hour, &lat, false, 0.3},
+		{10 * time.Minute, &farLat, true, 0.99}, // outside the radius
+		{20 * time.Minute, nil, true, 0.99},     // no location
+	} {
+		detection := &models.Detection{
+			ID:          int64(i + 1),
+			Timestamp:   base.Add(seed.offset),
+			Latitude:    seed.latitude,
+			Longitude:   &lon,
+			IsDrone:     seed.isDrone,
+			Confidence:  seed.confidence,
+			Predictions: json.RawMessage(`[]`),
+		}
+		if err := detections.SaveDetection(detection); err != nil {
+			t.Fatalf("failed to save detection: %v", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	newDetectionSeriesHandler(detections.JSONStore{})(rec, httptest.NewRequest(http.MethodGet,
+		"/api/detections/series?lat=51.5&lon=-0.12&radius=2&bucket=hour", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var series []detections.SeriesBucket
+	if err := json.Unmarshal(rec.Body.Bytes(), &series); err != nil {
+		t.Fatalf("failed to decode series: %v", err)
+	}
+
+	want := []detections.SeriesBucket{
+		{Start: base, Count: 3, DroneCount: 2, MeanConfidence: 0.7},
+		{Start: base.Add(time.Hour), Count: 1, DroneCount: 1, MeanConfidence: 0.6},
+		{Start: base.Add(3 * time.Hour), Count: 1, DroneCount: 0, MeanConfidence: 0.3},
+	}
+	if len(series) != len(want) {
+		t.Fatalf("expected %d buckets, got %+v", len(want), series)
+	}
+	for i := range want {
+		got := series[i]
+		if !got.Start.Equal(want[i].Start) || got.Count != want[i].Count || got.DroneCount != want[i].DroneCount ||
+			math.Abs(got.MeanConfidence-want[i].MeanConfidence) > 1e-9 {
+			t.Fatalf("bucket %d: expected %+v, got %+v", i, want[i], got)
+		}
+	}
+
+	bad := httptest.NewRecorder()
+	newDetectionSeriesHandler(detections.JSONStore{})(bad, httptest.NewRequest(http.MethodGet,
+		"/api/detections/series?lat=51.5&lon=-0.12&bucket=week", nil))
+	if bad.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown bucket, got %d", bad.Code)
+	}
+}
+
+func TestDetectionBoundingBoxHandlerFiltersToBox(t *testing.T) {
+	// IDs follow save order in both stores, so the expectations are shared
+	for name, dbPath := range map[string]string{"json": "", "sqlite": "detections.sqlite3"} {
+		t.Run(name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("DRONE_DB_PATH", dbPath)
+			store, err := newDetectionStoreFromEnv()
+			if err != nil {
+				t.Fatalf("newDetectionStoreFromEnv returned error: %v", err)
+			}
+
+			base := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+			for i, point := range []struct {
+				lat, lon float64
+			}{
+				{51.5, -0.12},   // London, inside
+				{48.86, 2.35},   // Paris, inside
+				{40.71, -74.0},  // New York, outside
+				{-17.7, 178.0},  // Fiji, west of the antimeridian
+				{-13.8, -172.1}, // Samoa, east of the antimeridian
+			} {
+				lat, lon := point.lat, point.lon
+				detection := &models.Detection{
+					ID:          int64(i + 1),
+					Timestamp:   base.Add(time.Duration(i) * time.Minute),
+					Latitude:    &lat,
+					Longitude:   &lon,
+					Predictions: json.RawMessage(`[]`),
+				}
+				if err := store.StoreDetection(detection); err != nil {
+					t.Fatalf("failed to save detection: %v", err)
+				}
+			}
+
+			ids := func(target string) []int64 {
+				t.Helper()
+				rec := httptest.NewRecorder()
+				newDetectionBoundingBoxHandler(store)(rec, httptest.NewRequest(http.MethodGet, target, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected 200 for %s, got %d: %s", target, rec.Code, rec.Body.String())
+				}
+				var found []models.Detection
+				if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+					t.Fatalf("failed to decode detections: %v", err)
+				}
+				var ids []int64
+				for _, detection := range found {
+					ids = append(ids, detection.ID)
+				}
+				return ids
+			}
+
+			if got := ids("/api/detections/bbox?minLat=45&minLon=-5&maxLat=55&maxLon=5"); !slices.Equal(got, []int64{2, 1}) {
+				t.Fatalf("expected Paris then London, got %v", got)
+			}
+			if got := ids("/api/detections/bbox?minLat=45&minLon=-5&maxLat=55&maxLon=5&limit=1"); !slices.Equal(got, []int64{2}) {
+				t.Fatalf("expected the limit to keep the newest, got %v", got)
+			}
+			if got := ids("/api/detections/bbox?minLat=-20&minLon=170&maxLat=-10&maxLon=-170"); !slices.Equal(got, []int64{5, 4}) {
+				t.Fatalf("expected both sides of the antimeridian, got %v", got)
+			}
+
+			for _, target := range []string{
+				"/api/detections/bbox?minLat=45&minLon=-5&maxLat=55",
+				"/api/detections/bbox?minLat=55&minLon=-5&maxLat=45&maxLon=5",
+				"/api/detections/bbox?minLat=45&minLon=-5&maxLat=55&maxLon=190",
+				"/api/detections/bbox?minLat=45&minLon=-5&maxLat=55&maxLon=5&limit=0",
+			} {
+				bad := httptest.NewRecorder()
+				newDetectionBoundingBoxHandler(store)(bad, httptest.NewRequest(http.MethodGet, target, nil))
+				if bad.Code != http.StatusBadRequest {
+					t.Fatalf("expected 400 for %s, got %d", target, bad.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectionClustersHandlerGroupsByRadius(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for i, point := range []struct {
+		lat, lon float64
+	}{
+		{51.5, -0.12},
+		{51.503, -0.12}, // ~330 m north
+		{48.86, 2.35},
+	} {
+		lat, lon := point.lat, point.lon
+		detection := &models.Detection{ID: int64(i + 1), Latitude: &lat, Longitude: &lon, Predictions: json.RawMessage(`[]`)}
+		if err := detections.SaveDetection(detection); err != nil {
+			t.Fatalf("failed to save detection: %v", err)
+		}
+	}
+
+	counts := func(target string) []int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newDetectionClustersHandler(detections.JSONStore{})(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+		var clusters []detections.DetectionCluster
+		if err := json.Unmarshal(rec.Body.Bytes(), &clusters); err != nil {
+			t.Fatalf("failed to decode clusters: %v", err)
+		}
+		var counts []int
+		for _, cluster := range clusters {
+			counts = append(counts, cluster.Count)
+		}
+		return counts
+	}
+
+	if got := counts("/api/detections/clusters?radius=0.5km"); !slices.Equal(got, []int{2, 1}) {
+		t.Fatalf("expected London merged within 0.5km, got %v", got)
+	}
+	if got := counts("/api/detections/clusters?radius=200m"); !slices.Equal(got, []int{1, 1, 1}) {
+		t.Fatalf("expected no merges within 200m, got %v", got)
+	}
+
+	bad := httptest.NewRecorder()
+	newDetectionClustersHandler(detections.JSONStore{})(bad, httptest.NewRequest(http.MethodGet, "/api/detections/clusters?radius=-1km", nil))
+	if bad.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative radius, got %d", bad.Code)
+	}
+}
+
+func TestDetectionTrackHandlerFitsRecentDrones(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	track := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newDetectionTrackHandler(detections.JSONStore{})(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	if rec := track("/api/detections/track"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without detections, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	base := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	lon := -0.12
+	for i, lat := range []float64{51.500, 51.501, 51.502} { // due north, 10 s apart
+		detection := &models.Detection{
+			ID:          int64(i + 1),
+			Timestamp:   base.Add(time.Duration(i) * 10 * time.Second),
+			Latitude:    &lat,
+			Longitude:   &lon,
+			IsDrone:     true,
+			Predictions: json.RawMessage(`[]`),
+		}
+		if err := detections.SaveDetection(detection); err != nil {
+			t.Fatalf("failed to save detection: %v", err)
+		}
+	}
+
+	rec := track("/api/detections/track?window=1m")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got detections.Track
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode track: %v", err)
+	}
+	if bearing := math.Min(got.BearingDeg, 360-got.BearingDeg); bearing > 2 || got.Points != 3 {
+		t.Fatalf("expected a northward track over 3 points, got %+v", got)
+	}
+	if rec := track("/api/detections/track?window=5s"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with one detection in the window, got %d", rec.Code)
+	}
+	if rec := track("/api/detections/track?window=soon"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid window, got %d", rec.Code)
+	}
+}
+
+func TestConfigHandlerReportsEffectiveConfiguration(t *testing.T) {
+	t.Setenv("DRONE_CONFIDENCE_THRESHOLD", "0.7")
+	t.Setenv("DRONE_TOP_N", "3")
+	t.Setenv("DRONE_SPECTRAL_WHITENING", "true")
+	t.Setenv("DB_TYPE", "mongo")
+	t.Setenv("DB_USER", "detector")
+	t.Setenv("DB_PASS", "hunter2")
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha", "beta")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	classifier.SetDistanceMetric(drone.MetricEuclidean)
+
+	t.Setenv("DRONE_DB_PATH", filepath.Join(t.TempDir(), "detections.sqlite3"))
+	store, err := newDetectionStoreFromEnv()
+	if err != nil {
+		t.Fatalf("newDetectionStoreFromEnv returned error: %v", err)
+	}
+
+	handler := newConfigHandler(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, "", store)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") {
+		t.Fatal("expected the database password to be redacted")
+	}
+
+	var config effectiveConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	// Set values
+	if config.Detection.ConfidenceThreshold != 0.7 || config.Detection.TopN != 3 {
+		t.Fatalf("expected the threshold and top N from the environment, got %+v", config.Detection)
+	}
+	if !config.Features.EnableWhitening {
+		t.Fatal("expected spectral whitening from the environment")
+	}
+	if config.Database.Type != "mongo" || config.Database.User != "detector" || config.Database.Password != redacted {
+		t.Fatalf("expected mongo settings with a redacted password, got %+v", config.Database)
+	}
+	if config.Database.DetectionStore != "sqlite" || config.Database.DetectionDBPath != os.Getenv("DRONE_DB_PATH") {
+		t.Fatalf("expected the SQLite detection store and its path, got %+v", config.Database)
+	}
+	model, ok := config.Models[defaultModelName]
+	if !ok || model.K != 2 || model.DistanceMetric != drone.MetricEuclidean {
+		t.Fatalf("expected the default model's k and metric, got %+v", config.Models)
+	}
+
+	// Defaults
+	if config.Detection.MinSupport != 1 || config.Detection.MinPrototypes != 10 || config.Detection.TwoStage {
+		t.Fatalf("expected default decision settings, got %+v", config.Detection)
+	}
+	if model.ConfidenceStrategy != drone.ConfidenceWeightShare || model.MinWindowSeconds != drone.DefaultMinWindowSeconds {
+		t.Fatalf("expected default confidence strategy and window length, got %+v", model)
+	}
+	if config.Extractor.PANNS || config.Windows.DurationSeconds != slidingWindowDurationSeconds {
+		t.Fatalf("expected legacy extraction with the default windows, got %+v and %+v", config.Extractor, config.Windows)
+	}
+	if config.Preprocessing != drone.DefaultPreprocessingConfig() {
+		t.Fatalf("expected the default preprocessing, got %+v", config.Preprocessing)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestDetectionStoresWriteTheSameRecords(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	lat, lng := 51.5, -0.12
+	detection := func() *models.Detection {
+		return &models.Detection{
+			Timestamp:        time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC),
+			Latitude:         &lat,
+			Longitude:        &lng,
+			IsDrone:          true,
+			PrimaryType:      "drone",
+			PrimaryLabel:     "quad",
+			PrimaryCategory:  "multirotor",
+			Confidence:       0.82,
+			SNRDb:            14.5,
+			LatencyMs:        120,
+			Predictions:      json.RawMessage(`[{"label":"quad","confidence":0.82}]`),
+			Metadata:         map[string]interface{}{"source": "socket"},
+			CountryOfOrigin:  "CN",
+			RecordingPath:    "frontendrecording/rec_1rfm.wav",
+			RecordingHash:    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			ModelFingerprint: "3f2a9c0d1e7b4a65",
+			Timeline:         json.RawMessage(`[{"index":0,"start":0,"end":3,"topLabel":"quad","topConfidence":0.82}]`),
+		}
+	}
+
+	// The ID is store-specific, so records are compared without it
+	readBack := func(store detections.DetectionStore) models.Detection {
+		t.Helper()
+		stored := detection()
+		if err := store.StoreDetection(stored); err != nil {
+			t.Fatalf("%T: StoreDetection returned error: %v", store, err)
+		}
+		all, err := store.GetAllDetections()
+		if err != nil {
+			t.Fatalf("%T: GetAllDetections returned error: %v", store, err)
+		}
+		if len(all) != 1 || stored.ID == 0 || all[0].ID != stored.ID {
+			t.Fatalf("%T: expected the stored detection with ID %d back, got %+v", store, stored.ID, all)
+		}
+		all[0].ID = 0
+		all[0].Timestamp = all[0].Timestamp.UTC()
+		return all[0]
+	}
+
+	t.Setenv("DRONE_DB_PATH", "")
+	jsonStore, err := newDetectionStoreFromEnv()
+	if err != nil {
+		t.Fatalf("newDetectionStoreFromEnv returned error: %v", err)
+	}
+	t.Setenv("DRONE_DB_PATH", filepath.Join(t.TempDir(), "detections.sqlite3"))
+	sqliteStore, err := newDetectionStoreFromEnv()
+	if err != nil {
+		t.Fatalf("newDetectionStoreFromEnv returned error: %v", err)
+	}
+	if _, ok := sqliteStore.(detections.JSONStore); ok {
+		t.Fatal("expected DRONE_DB_PATH to select the SQLite store")
+	}
+
+	fromJSON, _ := json.Marshal(readBack(jsonStore))
+	fromSQLite, _ := json.Marshal(readBack(sqliteStore))
+	if !bytes.Equal(fromJSON, fromSQLite) {
+		t.Fatalf("expected the stores to write the same record\n json:   %s\n sqlite: %s", fromJSON, fromSQLite)
+	}
+}
+
+func TestDetectionHandlersReadTheConfiguredStore(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("DRONE_DB_PATH", filepath.Join(t.TempDir(), "detections.sqlite3"))
+	store, err := newDetectionStoreFromEnv()
+	if err != nil {
+		t.Fatalf("newDetectionStoreFromEnv returned error: %v", err)
+	}
+	stored := &models.Detection{PrimaryLabel: "quad", IsDrone: true, Predictions: json.RawMessage(`[]`)}
+	if err := store.StoreDetection(stored); err != nil {
+		t.Fatalf("StoreDetection returned error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	newDetectionsHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/api/detections", nil))
+	var listed []models.Detection
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].ID != stored.ID {
+		t.Fatalf("expected the SQLite detection from /api/detections, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/detections/{id}/feedback", newDetectionFeedbackHandler(store))
+	rec = httptest.NewRecorder()
+	target := fmt.Sprintf("/api/detections/%d/feedback", stored.ID)
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"isDrone": false}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for feedback on a SQLite detection, got %d: %s", rec.Code, rec.Body.String())
+	}
+	updated, err := store.GetDetection(stored.ID)
+	if err != nil || updated.Feedback == nil || updated.Feedback.IsDrone == nil || *updated.Feedback.IsDrone {
+		t.Fatalf("expected the feedback in the database, got %+v (%v)", updated.Feedback, err)
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"math"
 	"path/filepath"
+	"song-recognition/detections"
 	"song-recognition/models"
 	"song-recognition/utils"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver registration
 )
@@ -89,7 +91,13 @@ func createTables(db *sql.DB) error {
         snr_db REAL,
         latency_ms REAL NOT NULL DEFAULT 0,
         predictions TEXT NOT NULL,
-        metadata TEXT
+        metadata TEXT,
+        recording_path TEXT,
+        recording_hash TEXT,
+        model_fingerprint TEXT,
+        country_of_origin TEXT,
+        timeline TEXT,
+        feedback TEXT
     );
     CREATE INDEX IF NOT EXISTS idx_detections_timestamp ON detections(timestamp);
     CREATE INDEX IF NOT EXISTS idx_detections_location ON detections(latitude, longitude);
@@ -110,6 +118,42 @@ func createTables(db *sql.DB) error {
 		return fmt.Errorf("error creating detections table: %s", err)
 	}
 
+	return addMissingDetectionColumns(db)
+}
+
+// addMissingDetectionColumns upgrades detections tables created before the recording,
+// model fingerprint, country of origin, timeline and feedback columns existed.
+func addMissingDetectionColumns(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(detections)")
+	if err != nil {
+		return fmt.Errorf("error reading detections schema: %s", err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading detections schema: %s", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, column := range []string{"recording_path", "recording_hash", "model_fingerprint", "country_of_origin", "timeline", "feedback"} {
+		if existing[column] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE detections ADD COLUMN %s TEXT", column)); err != nil {
+			return fmt.Errorf("error adding detections.%s: %s", column, err)
+		}
+	}
 	return nil
 }
 
@@ -262,8 +306,14 @@ func (db *SQLiteClient) DeleteCollection(collectionName string) error {
 	return nil
 }
 
-// StoreDetection stores a detection in the database
+// StoreDetection stores a detection in the database. Like the JSON store it fills in a
+// missing timestamp and sets the detection's ID, here to the new row's ID.
+// Timestamps are written in UTC so their text sorts and compares chronologically.
 func (db *SQLiteClient) StoreDetection(detection *models.Detection) error {
+	if detection.Timestamp.IsZero() {
+		detection.Timestamp = time.Now()
+	}
+
 	predictionsJSON, err := json.Marshal(detection.Predictions)
 	if err != nil {
 		return fmt.Errorf("error marshaling predictions: %s", err)
@@ -279,18 +329,30 @@ func (db *SQLiteClient) StoreDetection(detection *models.Detection) error {
 		metadataJSON = &metadataStr
 	}
 
+	var timelineJSON *string
+	if len(detection.Timeline) > 0 {
+		timelineStr := string(detection.Timeline)
+		timelineJSON = &timelineStr
+	}
+
+	feedbackJSON, err := marshalFeedback(detection.Feedback)
+	if err != nil {
+		return err
+	}
+
 	isDroneInt := 0
 	if detection.IsDrone {
 		isDroneInt = 1
 	}
 
-	_, err = db.db.Exec(`
+	result, err := db.db.Exec(`
 		INSERT INTO detections (
 			timestamp, latitude, longitude, is_drone, primary_type, 
 			primary_label, primary_category, confidence, snr_db, 
-			latency_ms, predictions, metadata
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		detection.Timestamp,
+			latency_ms, predictions, metadata, recording_path, recording_hash,
+			model_fingerprint, country_of_origin, timeline, feedback
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		detection.Timestamp.UTC(),
 		detection.Latitude,
 		detection.Longitude,
 		isDroneInt,
@@ -302,10 +364,21 @@ func (db *SQLiteClient) StoreDetection(detection *models.Detection) error {
 		detection.LatencyMs,
 		string(predictionsJSON),
 		metadataJSON,
+		detection.RecordingPath,
+		detection.RecordingHash,
+		detection.ModelFingerprint,
+		detection.CountryOfOrigin,
+		timelineJSON,
+		feedbackJSON,
 	)
 	if err != nil {
 		return fmt.Errorf("error storing detection: %s", err)
 	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error reading detection ID: %s", err)
+	}
+	detection.ID = id
 	return nil
 }
 
@@ -314,7 +387,8 @@ func (db *SQLiteClient) GetAllDetections() ([]models.Detection, error) {
 	rows, err := db.db.Query(`
 		SELECT id, timestamp, latitude, longitude, is_drone, primary_type,
 		       primary_label, primary_category, confidence, snr_db, latency_ms,
-		       predictions, metadata
+		       predictions, metadata, recording_path, recording_hash, model_fingerprint,
+		       country_of_origin, timeline, feedback
 		FROM detections
 		ORDER BY timestamp DESC
 	`)
@@ -323,46 +397,77 @@ func (db *SQLiteClient) GetAllDetections() ([]models.Detection, error) {
 	}
 	defer rows.Close()
 
-	var detections []models.Detection
-	for rows.Next() {
-		var d models.Detection
-		var isDroneInt int
-		var predictionsJSON string
-		var metadataJSON *string
-
-		err := rows.Scan(
-			&d.ID,
-			&d.Timestamp,
-			&d.Latitude,
-			&d.Longitude,
-			&isDroneInt,
-			&d.PrimaryType,
-			&d.PrimaryLabel,
-			&d.PrimaryCategory,
-			&d.Confidence,
-			&d.SNRDb,
-			&d.LatencyMs,
-			&predictionsJSON,
-			&metadataJSON,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning detection: %s", err)
-		}
+	return scanDetections(rows)
+}
 
-		d.IsDrone = isDroneInt == 1
-		d.Predictions = json.RawMessage(predictionsJSON)
+// GetDetection retrieves the detection with the given ID, or detections.ErrDetectionNotFound.
+func (db *SQLiteClient) GetDetection(id int64) (models.Detection, error) {
+	rows, err := db.db.Query(`
+		SELECT id, timestamp, latitude, longitude, is_drone, primary_type,
+		       primary_label, primary_category, confidence, snr_db, latency_ms,
+		       predictions, metadata, recording_path, recording_hash, model_fingerprint,
+		       country_of_origin, timeline, feedback
+		FROM detections
+		WHERE id = ?
+	`, id)
+	if err != nil {
+		return models.Detection{}, fmt.Errorf("error querying detection: %s", err)
+	}
+	defer rows.Close()
 
-		if metadataJSON != nil {
-			err = json.Unmarshal([]byte(*metadataJSON), &d.Metadata)
-			if err != nil {
-				return nil, fmt.Errorf("error unmarshaling metadata: %s", err)
-			}
-		}
+	found, err := scanDetections(rows)
+	if err != nil {
+		return models.Detection{}, err
+	}
+	if len(found) == 0 {
+		return models.Detection{}, fmt.Errorf("%w: %d", detections.ErrDetectionNotFound, id)
+	}
+	return found[0], nil
+}
 
-		detections = append(detections, d)
+// RecordFeedback attaches operator feedback to a stored detection and returns the
+// updated detection. Like the JSON store it fills in a missing submission time.
+func (db *SQLiteClient) RecordFeedback(id int64, feedback models.DetectionFeedback) (models.Detection, error) {
+	if feedback.SubmittedAt.IsZero() {
+		feedback.SubmittedAt = time.Now()
+	}
+	feedbackJSON, err := marshalFeedback(&feedback)
+	if err != nil {
+		return models.Detection{}, err
+	}
+	result, err := db.db.Exec("UPDATE detections SET feedback = ? WHERE id = ?", feedbackJSON, id)
+	if err != nil {
+		return models.Detection{}, fmt.Errorf("error recording feedback: %s", err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return models.Detection{}, fmt.Errorf("%w: %d", detections.ErrDetectionNotFound, id)
 	}
+	return db.GetDetection(id)
+}
 
-	return detections, nil
+// PruneRecordings clears the recording path and hash of the given detections, leaving
+// the detections themselves in place. It returns how many detections were changed.
+func (db *SQLiteClient) PruneRecordings(ids []int64) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	result, err := db.db.Exec(`
+		UPDATE detections SET recording_path = NULL, recording_hash = NULL
+		WHERE recording_path IS NOT NULL AND recording_path != '' AND id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error pruning recording references: %s", err)
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error reading pruned count: %s", err)
+	}
+	return int(pruned), nil
 }
 
 // GetDetectionsByLocation retrieves detections within a radius of a location
@@ -372,7 +477,8 @@ func (db *SQLiteClient) GetDetectionsByLocation(lat, lng float64, radiusKm float
 	rows, err := db.db.Query(`
 		SELECT id, timestamp, latitude, longitude, is_drone, primary_type,
 		       primary_label, primary_category, confidence, snr_db, latency_ms,
-		       predictions, metadata
+		       predictions, metadata, recording_path, recording_hash, model_fingerprint,
+		       country_of_origin, timeline, feedback
 		FROM detections
 		WHERE latitude IS NOT NULL AND longitude IS NOT NULL
 		  AND ABS(latitude - ?) < ? AND ABS(longitude - ?) < ?
@@ -383,12 +489,113 @@ func (db *SQLiteClient) GetDetectionsByLocation(lat, lng float64, radiusKm float
 	}
 	defer rows.Close()
 
-	var detections []models.Detection
+	return scanDetections(rows)
+}
+
+// GetDetectionsInBox retrieves the detections inside box, newest first, at most limit of
+// them (0 means no limit). The latitude and longitude ranges are plain BETWEEN clauses so
+// SQLite can use idx_detections_location; a box crossing the antimeridian matches either
+// side of it.
+func (db *SQLiteClient) GetDetectionsInBox(box models.BoundingBox, limit int) ([]models.Detection, error) {
+	lonClause := "longitude BETWEEN ? AND ?"
+	if box.CrossesAntimeridian() {
+		lonClause = "(longitude >= ? OR longitude <= ?)"
+	}
+	if limit <= 0 {
+		limit = -1 // SQLite treats a negative LIMIT as none
+	}
+	rows, err := db.db.Query(`
+		SELECT id, timestamp, latitude, longitude, is_drone, primary_type,
+		       primary_label, primary_category, confidence, snr_db, latency_ms,
+		       predictions, metadata, recording_path, recording_hash, model_fingerprint,
+		       country_of_origin, timeline, feedback
+		FROM detections
+		WHERE latitude BETWEEN ? AND ?
+		  AND `+lonClause+`
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, box.MinLat, box.MaxLat, box.MinLon, box.MaxLon, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying detections in box: %s", err)
+	}
+	defer rows.Close()
+
+	return scanDetections(rows)
+}
+
+// CountByLabel returns the number of detections per primary label. Detections without
+// a label are not counted.
+func (db *SQLiteClient) CountByLabel() (map[string]int, error) {
+	rows, err := db.db.Query(`
+		SELECT primary_label, COUNT(*)
+		FROM detections
+		WHERE primary_label IS NOT NULL AND primary_label != ''
+		GROUP BY primary_label
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting detections by label: %s", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var label string
+		var count int
+		if err := rows.Scan(&label, &count); err != nil {
+			return nil, fmt.Errorf("error scanning label count: %s", err)
+		}
+		counts[label] = count
+	}
+	return counts, rows.Err()
+}
+
+// CountDroneVsNoise returns how many detections were and were not classified as drones.
+func (db *SQLiteClient) CountDroneVsNoise() (drones int, noise int, err error) {
+	err = db.db.QueryRow(`
+		SELECT COALESCE(SUM(is_drone = 1), 0), COALESCE(SUM(is_drone != 1), 0)
+		FROM detections
+	`).Scan(&drones, &noise)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error counting drone detections: %s", err)
+	}
+	return drones, noise, nil
+}
+
+// CountSince returns the number of detections at or after since. since is bound in the
+// UTC text form StoreDetection writes, so the comparison can use idx_detections_timestamp.
+func (db *SQLiteClient) CountSince(since time.Time) (int, error) {
+	var count int
+	err := db.db.QueryRow(`
+		SELECT COUNT(*) FROM detections WHERE timestamp >= ?
+	`, since.UTC()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting recent detections: %s", err)
+	}
+	return count, nil
+}
+
+// marshalFeedback encodes feedback for the feedback column, or nil when there is none.
+func marshalFeedback(feedback *models.DetectionFeedback) (*string, error) {
+	if feedback == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(feedback)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling feedback: %s", err)
+	}
+	feedbackStr := string(data)
+	return &feedbackStr, nil
+}
+
+// scanDetections reads rows selected with the full detections column list.
+func scanDetections(rows *sql.Rows) ([]models.Detection, error) {
+	detections := []models.Detection{}
 	for rows.Next() {
 		var d models.Detection
 		var isDroneInt int
 		var predictionsJSON string
 		var metadataJSON *string
+		var recordingPath, recordingHash, modelFingerprint, countryOfOrigin, timeline, feedback sql.NullString
 
 		err := rows.Scan(
 			&d.ID,
@@ -404,6 +611,12 @@ func (db *SQLiteClient) GetDetectionsByLocation(lat, lng float64, radiusKm float
 			&d.LatencyMs,
 			&predictionsJSON,
 			&metadataJSON,
+			&recordingPath,
+			&recordingHash,
+			&modelFingerprint,
+			&countryOfOrigin,
+			&timeline,
+			&feedback,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning detection: %s", err)
@@ -411,6 +624,19 @@ func (db *SQLiteClient) GetDetectionsByLocation(lat, lng float64, radiusKm float
 
 		d.IsDrone = isDroneInt == 1
 		d.Predictions = json.RawMessage(predictionsJSON)
+		d.RecordingPath = recordingPath.String
+		d.RecordingHash = recordingHash.String
+		d.ModelFingerprint = modelFingerprint.String
+		d.CountryOfOrigin = countryOfOrigin.String
+		if timeline.Valid {
+			d.Timeline = json.RawMessage(timeline.String)
+		}
+		if feedback.Valid {
+			d.Feedback = &models.DetectionFeedback{}
+			if err := json.Unmarshal([]byte(feedback.String), d.Feedback); err != nil {
+				return nil, fmt.Errorf("error unmarshaling feedback: %s", err)
+			}
+		}
 
 		if metadataJSON != nil {
 			err = json.Unmarshal([]byte(*metadataJSON), &d.Metadata)
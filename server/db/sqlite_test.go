@@ -0,0 +1,303 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"song-recognition/detections"
+	"song-recognition/models"
+)
+
+func TestStoreDetectionRoundTripsRecording(t *testing.T) {
+	client, err := NewSQLiteClient(filepath.Join(t.TempDir(), "detections.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewSQLiteClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	lat, lng := 51.5, -0.12
+	stored := &models.Detection{
+		Timestamp:        time.Now().UTC().Truncate(time.Second),
+		Latitude:         &lat,
+		Longitude:        &lng,
+		IsDrone:          true,
+		PrimaryLabel:     "quad",
+		Confidence:       0.8,
+		Predictions:      json.RawMessage(`[]`),
+		RecordingPath:    "frontendrecording/rec_1rfm.wav",
+		RecordingHash:    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		ModelFingerprint: "3f2a9c0d1e7b4a65",
+		CountryOfOrigin:  "CN",
+	}
+	if err := client.StoreDetection(stored); err != nil {
+		t.Fatalf("StoreDetection returned error: %v", err)
+	}
+	if stored.ID == 0 {
+		t.Fatal("expected StoreDetection to set the detection ID")
+	}
+
+	all, err := client.GetAllDetections()
+	if err != nil {
+		t.Fatalf("GetAllDetections returned error: %v", err)
+	}
+	nearby, err := client.GetDetectionsByLocation(lat, lng, 1)
+	if err != nil {
+		t.Fatalf("GetDetectionsByLocation returned error: %v", err)
+	}
+	for name, got := range map[string][]models.Detection{"all": all, "nearby": nearby} {
+		if len(got) != 1 {
+			t.Fatalf("%s: expected 1 detection, got %d", name, len(got))
+		}
+		if got[0].RecordingPath != stored.RecordingPath || got[0].RecordingHash != stored.RecordingHash {
+			t.Fatalf("%s: expected recording %q/%q, got %q/%q", name,
+				stored.RecordingPath, stored.RecordingHash, got[0].RecordingPath, got[0].RecordingHash)
+		}
+		if got[0].ModelFingerprint != stored.ModelFingerprint {
+			t.Fatalf("%s: expected model fingerprint %q, got %q", name, stored.ModelFingerprint, got[0].ModelFingerprint)
+		}
+		if got[0].ID != stored.ID || got[0].CountryOfOrigin != stored.CountryOfOrigin {
+			t.Fatalf("%s: expected ID %d from %q, got %d from %q", name,
+				stored.ID, stored.CountryOfOrigin, got[0].ID, got[0].CountryOfOrigin)
+		}
+	}
+}
+
+func TestGetDetectionsInBoxQueriesRange(t *testing.T) {
+	client, err := NewSQLiteClient(filepath.Join(t.TempDir(), "detections.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewSQLiteClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	base := time.Now().UTC().Truncate(time.Second)
+	for i, point := range []struct {
+		label    string
+		lat, lon float64
+	}{
+		{"london", 51.5, -0.12},
+		{"paris", 48.86, 2.35},
+		{"fiji", -17.7, 178.0},
+		{"samoa", -13.8, -172.1},
+	} {
+		lat, lon := point.lat, point.lon
+		if err := client.StoreDetection(&models.Detection{
+			Timestamp:    base.Add(time.Duration(i) * time.Minute),
+			Latitude:     &lat,
+			Longitude:    &lon,
+			PrimaryLabel: point.label,
+			Predictions:  json.RawMessage(`[]`),
+		}); err != nil {
+			t.Fatalf("StoreDetection returned error: %v", err)
+		}
+	}
+
+	labels := func(box models.BoundingBox, limit int) []string {
+		t.Helper()
+		found, err := client.GetDetectionsInBox(box, limit)
+		if err != nil {
+			t.Fatalf("GetDetectionsInBox returned error: %v", err)
+		}
+		var names []string
+		for _, detection := range found {
+			names = append(names, detection.PrimaryLabel)
+		}
+		return names
+	}
+
+	europe := models.BoundingBox{MinLat: 45, MinLon: -5, MaxLat: 55, MaxLon: 5}
+	if got := labels(europe, 0); len(got) != 2 || got[0] != "paris" || got[1] != "london" {
+		t.Fatalf("expected paris then london, got %v", got)
+	}
+	if got := labels(europe, 1); len(got) != 1 || got[0] != "paris" {
+		t.Fatalf("expected the limit to keep the newest, got %v", got)
+	}
+	pacific := models.BoundingBox{MinLat: -20, MinLon: 170, MaxLat: -10, MaxLon: -170}
+	if got := labels(pacific, 0); len(got) != 2 || got[0] != "samoa" || got[1] != "fiji" {
+		t.Fatalf("expected both sides of the antimeridian, got %v", got)
+	}
+}
+
+func TestNewSQLiteClientUpgradesLegacyDetectionsTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.sqlite3")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = legacy.Exec(`CREATE TABLE detections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		latitude REAL, longitude REAL,
+		is_drone INTEGER NOT NULL DEFAULT 0,
+		primary_type TEXT, primary_label TEXT, primary_category TEXT,
+		confidence REAL NOT NULL DEFAULT 0, snr_db REAL,
+		latency_ms REAL NOT NULL DEFAULT 0,
+		predictions TEXT NOT NULL, metadata TEXT
+	);
+	INSERT INTO detections (predictions, primary_type, primary_label, primary_category, snr_db) VALUES ('[]', '', '', '', 0);`)
+	legacy.Close()
+	if err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+
+	client, err := NewSQLiteClient(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	detections, err := client.GetAllDetections()
+	if err != nil {
+		t.Fatalf("GetAllDetections returned error: %v", err)
+	}
+	if len(detections) != 1 || detections[0].RecordingPath != "" || detections[0].RecordingHash != "" {
+		t.Fatalf("expected the legacy row with empty recording fields, got %+v", detections)
+	}
+}
+
+func TestDetectionAggregatesMatchManualTally(t *testing.T) {
+	client, err := NewSQLiteClient(filepath.Join(t.TempDir(), "detections.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewSQLiteClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	now := time.Now()
+	labels := []string{"quad", "wind", "quad", "", "hexa", "quad", "wind"}
+	wantLabels := make(map[string]int)
+	wantDrones, wantNoise, wantRecent := 0, 0, 0
+	for i, label := range labels {
+		detection := &models.Detection{
+			Timestamp:    now.Add(-time.Duration(i) * time.Hour),
+			IsDrone:      label == "quad" || label == "hexa",
+			PrimaryLabel: label,
+			Predictions:  json.RawMessage(`[]`),
+		}
+		if err := client.StoreDetection(detection); err != nil {
+			t.Fatalf("StoreDetection returned error: %v", err)
+		}
+		if label != "" {
+			wantLabels[label]++
+		}
+		if detection.IsDrone {
+			wantDrones++
+		} else {
+			wantNoise++
+		}
+		if i <= 3 {
+			wantRecent++
+		}
+	}
+
+	byLabel, err := client.CountByLabel()
+	if err != nil {
+		t.Fatalf("CountByLabel returned error: %v", err)
+	}
+	if len(byLabel) != len(wantLabels) {
+		t.Fatalf("expected counts %v, got %v", wantLabels, byLabel)
+	}
+	for label, want := range wantLabels {
+		if byLabel[label] != want {
+			t.Fatalf("expected counts %v, got %v", wantLabels, byLabel)
+		}
+	}
+
+	drones, noise, err := client.CountDroneVsNoise()
+	if err != nil {
+		t.Fatalf("CountDroneVsNoise returned error: %v", err)
+	}
+	if drones != wantDrones || noise != wantNoise {
+		t.Fatalf("expected %d drones and %d noise, got %d and %d", wantDrones, wantNoise, drones, noise)
+	}
+
+	recent, err := client.CountSince(now.Add(-3*time.Hour - time.Minute))
+	if err != nil {
+		t.Fatalf("CountSince returned error: %v", err)
+	}
+	if recent != wantRecent {
+		t.Fatalf("expected %d detections in the last 3 hours, got %d", wantRecent, recent)
+	}
+}
+
+func TestStoreDetectionKeepsTimeline(t *testing.T) {
+	client, err := NewSQLiteClient(filepath.Join(t.TempDir(), "detections.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewSQLiteClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	timeline := json.RawMessage(`[{"index":0,"start":0,"end":3,"topLabel":"quad","topConfidence":0.91},` +
+		`{"index":1,"start":1.5,"end":4.5,"topLabel":"wind","topConfidence":0.64}]`)
+	withTimeline := &models.Detection{PrimaryLabel: "quad", Predictions: json.RawMessage(`[]`), Timeline: timeline}
+	without := &models.Detection{PrimaryLabel: "wind", Predictions: json.RawMessage(`[]`)}
+	for _, detection := range []*models.Detection{withTimeline, without} {
+		if err := client.StoreDetection(detection); err != nil {
+			t.Fatalf("StoreDetection returned error: %v", err)
+		}
+	}
+
+	all, err := client.GetAllDetections()
+	if err != nil {
+		t.Fatalf("GetAllDetections returned error: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 detections, got %d", len(all))
+	}
+	for _, got := range all {
+		switch got.ID {
+		case withTimeline.ID:
+			if string(got.Timeline) != string(timeline) {
+				t.Fatalf("expected timeline %s, got %s", timeline, got.Timeline)
+			}
+		case without.ID:
+			if got.Timeline != nil {
+				t.Fatalf("expected no timeline, got %s", got.Timeline)
+			}
+		}
+	}
+}
+
+func TestRecordFeedbackAndPruneRecordings(t *testing.T) {
+	client, err := NewSQLiteClient(filepath.Join(t.TempDir(), "detections.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewSQLiteClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	stored := &models.Detection{
+		PrimaryLabel:  "quad",
+		Predictions:   json.RawMessage(`[]`),
+		RecordingPath: "frontendrecording/rec_1rfm.wav",
+		RecordingHash: "aa",
+	}
+	if err := client.StoreDetection(stored); err != nil {
+		t.Fatalf("StoreDetection returned error: %v", err)
+	}
+
+	isDrone := false
+	updated, err := client.RecordFeedback(stored.ID, models.DetectionFeedback{CorrectLabel: "wind gust", IsDrone: &isDrone})
+	if err != nil {
+		t.Fatalf("RecordFeedback returned error: %v", err)
+	}
+	if updated.Feedback == nil || updated.Feedback.CorrectLabel != "wind gust" || updated.Feedback.SubmittedAt.IsZero() {
+		t.Fatalf("expected stamped feedback on the detection, got %+v", updated.Feedback)
+	}
+	if _, err := client.RecordFeedback(stored.ID+1, models.DetectionFeedback{CorrectLabel: "quad"}); !errors.Is(err, detections.ErrDetectionNotFound) {
+		t.Fatalf("expected ErrDetectionNotFound for an unknown ID, got %v", err)
+	}
+
+	pruned, err := client.PruneRecordings([]int64{stored.ID, stored.ID + 1})
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected 1 detection pruned, got %d (%v)", pruned, err)
+	}
+	got, err := client.GetDetection(stored.ID)
+	if err != nil {
+		t.Fatalf("GetDetection returned error: %v", err)
+	}
+	if got.RecordingPath != "" || got.RecordingHash != "" || got.Feedback == nil {
+		t.Fatalf("expected cleared recording and kept feedback, got %+v", got)
+	}
+}
@@ -0,0 +1,27 @@
+package detections
+
+import (
+	"sort"
+
+	"song-recognition/models"
+)
+
+// InBoundingBox returns the detections inside box, newest first, keeping at most limit of
+// them (0 keeps all). Detections without a location are skipped.
+func InBoundingBox(detections []models.Detection, box models.BoundingBox, limit int) []models.Detection {
+	inside := []models.Detection{}
+	for _, detection := range detections {
+		if detection.Latitude == nil || detection.Longitude == nil {
+			continue
+		}
+		if box.Contains(*detection.Latitude, *detection.Longitude) {
+			inside = append(inside, detection)
+		}
+	}
+
+	sort.SliceStable(inside, func(i, j int) bool { return inside[i].Timestamp.After(inside[j].Timestamp) })
+	if limit > 0 && len(inside) > limit {
+		inside = inside[:limit]
+	}
+	return inside
+}
@@ -0,0 +1,85 @@
+package detections
+
+import (
+	"math"
+	"sort"
+
+	"song-recognition/models"
+)
+
+// DetectionCluster is a group of nearby detections, placed at their centroid.
+type DetectionCluster struct {
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Count        int     `json:"count"`
+	DroneCount   int     `json:"droneCount"`
+	DetectionIDs []int64 `json:"detectionIds"`
+}
+
+// Cluster groups the detections into clusters, largest first. Like DBSCAN with a
+// minimum of one point, two detections within radiusKm of each other (by HaversineKm)
+// share a cluster, so a cluster can grow along a chain of close detections. Detections
+// without a location are skipped.
+func Cluster(detections []models.Detection, radiusKm float64) []DetectionCluster {
+	located := make([]models.Detection, 0, len(detections))
+	for _, detection := range detections {
+		if detection.Latitude != nil && detection.Longitude != nil {
+			located = append(located, detection)
+		}
+	}
+
+	assigned := make([]bool, len(located))
+	clusters := []DetectionCluster{}
+	for seed := range located {
+		if assigned[seed] {
+			continue
+		}
+		assigned[seed] = true
+		members := []int{seed}
+		for next := 0; next < len(members); next++ {
+			current := located[members[next]]
+			for candidate := range located {
+				if assigned[candidate] {
+					continue
+				}
+				other := located[candidate]
+				if HaversineKm(*current.Latitude, *current.Longitude, *other.Latitude, *other.Longitude) <= radiusKm {
+					assigned[candidate] = true
+					members = append(members, candidate)
+				}
+			}
+		}
+		clusters = append(clusters, summariseCluster(located, members))
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Count > clusters[j].Count })
+	return clusters
+}
+
+// summariseCluster returns the centroid and counts of the located detections at members.
+// Longitudes are averaged as offsets from the first member's, so a cluster straddling
+// the antimeridian is centred on it rather than on the prime meridian.
+func summariseCluster(located []models.Detection, members []int) DetectionCluster {
+	cluster := DetectionCluster{Count: len(members), DetectionIDs: make([]int64, 0, len(members))}
+	origin := *located[members[0]].Longitude
+	var latSum, lonOffsetSum float64
+	for _, index := range members {
+		detection := located[index]
+		latSum += *detection.Latitude
+		offset := *detection.Longitude - origin
+		if offset > 180 {
+			offset -= 360
+		} else if offset < -180 {
+			offset += 360
+		}
+		lonOffsetSum += offset
+		if detection.IsDrone {
+			cluster.DroneCount++
+		}
+		cluster.DetectionIDs = append(cluster.DetectionIDs, detection.ID)
+	}
+
+	cluster.Latitude = latSum / float64(len(members))
+	cluster.Longitude = math.Remainder(origin+lonOffsetSum/float64(len(members)), 360)
+	return cluster
+}
@@ -0,0 +1,48 @@
+package detections
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"song-recognition/models"
+)
+
+func TestClusterGroupsNearbyDetections(t *testing.T) {
+	located := func(id int64, lat, lon float64, isDrone bool) models.Detection {
+		return models.Detection{ID: id, Latitude: &lat, Longitude: &lon, IsDrone: isDrone}
+	}
+	detections := []models.Detection{
+		located(1, 51.5000, -0.1200, true),
+		located(2, 48.8600, 2.3500, false), // Paris, far from the others
+		located(3, 51.5020, -0.1200, true), // ~220 m north of the first
+		{ID: 4},                            // no location
+	}
+
+	clusters := Cluster(detections, 0.5)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", clusters)
+	}
+
+	london := clusters[0]
+	if london.Count != 2 || london.DroneCount != 2 || !slices.Equal(london.DetectionIDs, []int64{1, 3}) {
+		t.Fatalf("expected the two London detections first, got %+v", london)
+	}
+	if math.Abs(london.Latitude-51.501) > 1e-9 || math.Abs(london.Longitude+0.12) > 1e-9 {
+		t.Fatalf("expected the centroid at 51.501,-0.12, got %v,%v", london.Latitude, london.Longitude)
+	}
+	if paris := clusters[1]; paris.Count != 1 || !slices.Equal(paris.DetectionIDs, []int64{2}) {
+		t.Fatalf("expected Paris on its own, got %+v", paris)
+	}
+}
+
+func TestClusterCentresOnTheAntimeridian(t *testing.T) {
+	lat, west, east := -17.0, 179.999, -179.999
+	clusters := Cluster([]models.Detection{
+		{ID: 1, Latitude: &lat, Longitude: &west},
+		{ID: 2, Latitude: &lat, Longitude: &east},
+	}, 1)
+	if len(clusters) != 1 || math.Abs(math.Abs(clusters[0].Longitude)-180) > 1e-9 {
+		t.Fatalf("expected one cluster centred on the antimeridian, got %+v", clusters)
+	}
+}
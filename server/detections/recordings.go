@@ -0,0 +1,66 @@
+package detections
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// VerifyRecordings returns the IDs of stored detections whose recordingPath no longer
+// points at a file. A recording still counts as present when a file of the same name
+// exists in recordingDir, so moving the recording directory does not orphan detections.
+func VerifyRecordings(store DetectionStore, recordingDir string) (missing []int64, err error) {
+	detections, err := store.GetAllDetections()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, detection := range detections {
+		if detection.RecordingPath == "" || recordingExists(detection.RecordingPath, recordingDir) {
+			continue
+		}
+		missing = append(missing, detection.ID)
+	}
+	return missing, nil
+}
+
+func recordingExists(path, recordingDir string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	if recordingDir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(recordingDir, filepath.Base(path)))
+	return err == nil
+}
+
+// PruneRecordings clears the recording path and hash of the given detections, leaving
+// the detections themselves in place. It returns how many detections were changed.
+func PruneRecordings(ids []int64) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	detections, err := loadDetectionsInternal()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for i := range detections {
+		if detections[i].RecordingPath == "" || !slices.Contains(ids, detections[i].ID) {
+			continue
+		}
+		detections[i].RecordingPath = ""
+		detections[i].RecordingHash = ""
+		pruned++
+	}
+	if pruned == 0 {
+		return 0, nil
+	}
+	return pruned, writeDetectionsInternal(detections)
+}
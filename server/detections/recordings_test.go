@@ -0,0 +1,58 @@
+package detections
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"song-recognition/models"
+)
+
+func TestVerifyRecordingsReportsMissingFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	recordingDir := "frontendrecording"
+	if err := os.MkdirAll(recordingDir, 0755); err != nil {
+		t.Fatalf("failed to create recording dir: %v", err)
+	}
+	present := filepath.Join(recordingDir, "rec_1rfm.wav")
+	if err := os.WriteFile(present, []byte("RIFF"), 0644); err != nil {
+		t.Fatalf("failed to write recording: %v", err)
+	}
+
+	for _, detection := range []*models.Detection{
+		{ID: 1, RecordingPath: present, RecordingHash: "aa"},
+		{ID: 2, RecordingPath: filepath.Join(recordingDir, "rec_2rfm.wav"), RecordingHash: "bb"},
+		{ID: 3},
+	} {
+		detection.Predictions = json.RawMessage(`[]`)
+		if err := SaveDetection(detection); err != nil {
+			t.Fatalf("SaveDetection returned error: %v", err)
+		}
+	}
+
+	missing, err := VerifyRecordings(JSONStore{}, recordingDir)
+	if err != nil {
+		t.Fatalf("VerifyRecordings returned error: %v", err)
+	}
+	if !slices.Equal(missing, []int64{2}) {
+		t.Fatalf("expected only detection 2 to be reported missing, got %v", missing)
+	}
+
+	pruned, err := PruneRecordings(missing)
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected 1 detection pruned, got %d (%v)", pruned, err)
+	}
+	detection, err := GetDetection(2)
+	if err != nil {
+		t.Fatalf("GetDetection returned error: %v", err)
+	}
+	if detection.RecordingPath != "" || detection.RecordingHash != "" {
+		t.Fatalf("expected the orphaned reference to be cleared, got %q/%q", detection.RecordingPath, detection.RecordingHash)
+	}
+	if missing, _ := VerifyRecordings(JSONStore{}, recordingDir); len(missing) != 0 {
+		t.Fatalf("expected no missing recordings after pruning, got %v", missing)
+	}
+}
@@ -0,0 +1,67 @@
+package detections
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"song-recognition/models"
+)
+
+const earthRadiusKm = 6371.0
+
+// SeriesBucket summarises the detections near a location within one time bucket.
+type SeriesBucket struct {
+	Start          time.Time `json:"start"`
+	Count          int       `json:"count"`
+	DroneCount     int       `json:"droneCount"`
+	MeanConfidence float64   `json:"meanConfidence"`
+}
+
+// HaversineKm returns the great-circle distance between two coordinates in kilometres.
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ConfidenceSeries groups the detections within radiusKm of lat/lon into UTC-aligned
+// buckets of the given width and returns the non-empty buckets in time order.
+// Detections without a location are skipped.
+func ConfidenceSeries(detections []models.Detection, lat, lon, radiusKm float64, bucket time.Duration) []SeriesBucket {
+	byStart := make(map[time.Time]*SeriesBucket)
+	for _, detection := range detections {
+		if detection.Latitude == nil || detection.Longitude == nil {
+			continue
+		}
+		if HaversineKm(lat, lon, *detection.Latitude, *detection.Longitude) > radiusKm {
+			continue
+		}
+
+		start := detection.Timestamp.UTC().Truncate(bucket)
+		entry, ok := byStart[start]
+		if !ok {
+			entry = &SeriesBucket{Start: start}
+			byStart[start] = entry
+		}
+		entry.Count++
+		if detection.IsDrone {
+			entry.DroneCount++
+		}
+		// Accumulate the sum here; it becomes the mean below
+		entry.MeanConfidence += detection.Confidence
+	}
+
+	series := make([]SeriesBucket, 0, len(byStart))
+	for _, entry := range byStart {
+		entry.MeanConfidence /= float64(entry.Count)
+		series = append(series, *entry)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Start.Before(series[j].Start)
+	})
+	return series
+}
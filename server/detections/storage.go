@@ -2,6 +2,7 @@ package detections
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,10 +17,13 @@ var (
 	mu             sync.RWMutex
 )
 
+// ErrDetectionNotFound is returned when no stored detection has the requested ID.
+var ErrDetectionNotFound = errors.New("detection not found")
+
 // loadDetectionsInternal loads all detections from the JSON file (without lock)
 func loadDetectionsInternal() ([]models.Detection, error) {
 	filePath := filepath.Join("server", detectionsFile)
-	
+
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		// Return empty slice if file doesn't exist
@@ -72,6 +76,52 @@ func SaveDetection(detection *models.Detection) error {
 	// Append new detection
 	detections = append(detections, *detection)
 
+	return writeDetectionsInternal(detections)
+}
+
+// GetDetection returns the stored detection with the given ID
+func GetDetection(id int64) (models.Detection, error) {
+	detections, err := LoadDetections()
+	if err != nil {
+		return models.Detection{}, err
+	}
+	for _, detection := range detections {
+		if detection.ID == id {
+			return detection, nil
+		}
+	}
+	return models.Detection{}, fmt.Errorf("%w: %d", ErrDetectionNotFound, id)
+}
+
+// RecordFeedback attaches operator feedback to a stored detection and returns the
+// updated detection.
+func RecordFeedback(id int64, feedback models.DetectionFeedback) (models.Detection, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	detections, err := loadDetectionsInternal()
+	if err != nil {
+		return models.Detection{}, err
+	}
+
+	for i := range detections {
+		if detections[i].ID != id {
+			continue
+		}
+		if feedback.SubmittedAt.IsZero() {
+			feedback.SubmittedAt = time.Now()
+		}
+		detections[i].Feedback = &feedback
+		if err := writeDetectionsInternal(detections); err != nil {
+			return models.Detection{}, err
+		}
+		return detections[i], nil
+	}
+	return models.Detection{}, fmt.Errorf("%w: %d", ErrDetectionNotFound, id)
+}
+
+// writeDetectionsInternal replaces the JSON file contents (caller holds the write lock)
+func writeDetectionsInternal(detections []models.Detection) error {
 	// Ensure directory exists
 	filePath := filepath.Join("server", detectionsFile)
 	dir := filepath.Dir(filePath)
@@ -99,3 +149,49 @@ func GetAllDetections() ([]models.Detection, error) {
 	return LoadDetections()
 }
 
+// CountByLabel returns the number of detections per primary label. Detections without
+// a label are not counted.
+func CountByLabel() (map[string]int, error) {
+	detections, err := LoadDetections()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, detection := range detections {
+		if detection.PrimaryLabel != "" {
+			counts[detection.PrimaryLabel]++
+		}
+	}
+	return counts, nil
+}
+
+// CountDroneVsNoise returns how many detections were and were not classified as drones.
+func CountDroneVsNoise() (drones int, noise int, err error) {
+	detections, err := LoadDetections()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, detection := range detections {
+		if detection.IsDrone {
+			drones++
+		} else {
+			noise++
+		}
+	}
+	return drones, noise, nil
+}
+
+// CountSince returns the number of detections at or after since.
+func CountSince(since time.Time) (int, error) {
+	detections, err := LoadDetections()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, detection := range detections {
+		if !detection.Timestamp.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,52 @@
+package detections
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"song-recognition/models"
+)
+
+func TestAggregatesMatchManualTally(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	now := time.Now()
+	labels := []string{"quad", "wind", "quad", "", "hexa"}
+	for i, label := range labels {
+		detection := &models.Detection{
+			ID:           int64(i + 1),
+			Timestamp:    now.Add(-time.Duration(i) * time.Hour),
+			IsDrone:      label == "quad" || label == "hexa",
+			PrimaryLabel: label,
+			Predictions:  json.RawMessage(`[]`),
+		}
+		if err := SaveDetection(detection); err != nil {
+			t.Fatalf("SaveDetection returned error: %v", err)
+		}
+	}
+
+	byLabel, err := CountByLabel()
+	if err != nil {
+		t.Fatalf("CountByLabel returned error: %v", err)
+	}
+	if len(byLabel) != 3 || byLabel["quad"] != 2 || byLabel["wind"] != 1 || byLabel["hexa"] != 1 {
+		t.Fatalf("unexpected label counts %v", byLabel)
+	}
+
+	drones, noise, err := CountDroneVsNoise()
+	if err != nil {
+		t.Fatalf("CountDroneVsNoise returned error: %v", err)
+	}
+	if drones != 3 || noise != 2 {
+		t.Fatalf("expected 3 drones and 2 noise, got %d and %d", drones, noise)
+	}
+
+	recent, err := CountSince(now.Add(-90 * time.Minute))
+	if err != nil {
+		t.Fatalf("CountSince returned error: %v", err)
+	}
+	if recent != 2 {
+		t.Fatalf("expected 2 detections in the last 90 minutes, got %d", recent)
+	}
+}
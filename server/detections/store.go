@@ -0,0 +1,53 @@
+package detections
+
+import "song-recognition/models"
+
+// DetectionStore persists classified detections. The JSON file store and
+// db.SQLiteClient both implement it and write the same records: each sets the
+// detection's ID and fills in a missing timestamp. Lookups of an unknown ID fail
+// with ErrDetectionNotFound.
+type DetectionStore interface {
+	StoreDetection(detection *models.Detection) error
+	GetAllDetections() ([]models.Detection, error)
+	GetDetection(id int64) (models.Detection, error)
+	GetDetectionsInBox(box models.BoundingBox, limit int) ([]models.Detection, error)
+	RecordFeedback(id int64, feedback models.DetectionFeedback) (models.Detection, error)
+	PruneRecordings(ids []int64) (int, error)
+}
+
+// JSONStore is the DetectionStore backed by the detections JSON file.
+type JSONStore struct{}
+
+// StoreDetection appends detection to the JSON file.
+func (JSONStore) StoreDetection(detection *models.Detection) error {
+	return SaveDetection(detection)
+}
+
+// GetAllDetections returns every detection in the JSON file.
+func (JSONStore) GetAllDetections() ([]models.Detection, error) {
+	return GetAllDetections()
+}
+
+// GetDetection returns the detection with the given ID from the JSON file.
+func (JSONStore) GetDetection(id int64) (models.Detection, error) {
+	return GetDetection(id)
+}
+
+// GetDetectionsInBox filters the JSON file to box in memory with InBoundingBox.
+func (JSONStore) GetDetectionsInBox(box models.BoundingBox, limit int) ([]models.Detection, error) {
+	detections, err := LoadDetections()
+	if err != nil {
+		return nil, err
+	}
+	return InBoundingBox(detections, box, limit), nil
+}
+
+// RecordFeedback attaches feedback to a detection in the JSON file.
+func (JSONStore) RecordFeedback(id int64, feedback models.DetectionFeedback) (models.Detection, error) {
+	return RecordFeedback(id, feedback)
+}
+
+// PruneRecordings clears the recording references of the given detections in the JSON file.
+func (JSONStore) PruneRecordings(ids []int64) (int, error) {
+	return PruneRecordings(ids)
+}
@@ -0,0 +1,106 @@
+package detections
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"song-recognition/models"
+)
+
+// DefaultTrackWindow is how far back from the latest drone detection EstimateTrack looks.
+const DefaultTrackWindow = 10 * time.Minute
+
+// ErrTrackTooShort is returned when too few drone detections remain to fit a track.
+var ErrTrackTooShort = errors.New("a track needs at least two located drone detections at different times")
+
+// Track is the straight-line course fitted to a sequence of drone detections.
+type Track struct {
+	BearingDeg float64   `json:"bearingDeg"` // Heading clockwise from true north, in [0, 360)
+	SpeedMps   float64   `json:"speedMps"`
+	Points     int       `json:"points"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Latitude   float64   `json:"latitude"` // Fitted position at End
+	Longitude  float64   `json:"longitude"`
+}
+
+// EstimateTrack fits a track to the drone detections within DefaultTrackWindow of the
+// latest one. See EstimateTrackWithin.
+func EstimateTrack(detections []models.Detection) (Track, error) {
+	return EstimateTrackWithin(detections, DefaultTrackWindow)
+}
+
+// EstimateTrackWithin fits a constant-velocity track to the located drone detections no
+// more than window before the latest of them. Positions are projected onto a local
+// east/north plane around the first detection and each axis is fitted against time by
+// least squares, which is accurate for the few kilometres a drone covers in minutes.
+func EstimateTrackWithin(detections []models.Detection, window time.Duration) (Track, error) {
+	points := make([]models.Detection, 0, len(detections))
+	for _, detection := range detections {
+		if detection.IsDrone && detection.Latitude != nil && detection.Longitude != nil {
+			points = append(points, detection)
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	if len(points) > 0 && window > 0 {
+		cutoff := points[len(points)-1].Timestamp.Add(-window)
+		first := sort.Search(len(points), func(i int) bool { return !points[i].Timestamp.Before(cutoff) })
+		points = points[first:]
+	}
+	if len(points) < 2 {
+		return Track{}, fmt.Errorf("%w: found %d", ErrTrackTooShort, len(points))
+	}
+
+	originLat, originLon := *points[0].Latitude, *points[0].Longitude
+	metresPerDegLat := earthRadiusKm * 1000 * math.Pi / 180
+	metresPerDegLon := metresPerDegLat * math.Cos(originLat*math.Pi/180)
+	start := points[0].Timestamp
+
+	var sumT, sumE, sumN float64
+	ts, es, ns := make([]float64, len(points)), make([]float64, len(points)), make([]float64, len(points))
+	for i, point := range points {
+		dLon := *point.Longitude - originLon
+		if dLon > 180 {
+			dLon -= 360
+		} else if dLon < -180 {
+			dLon += 360
+		}
+		ts[i] = point.Timestamp.Sub(start).Seconds()
+		es[i] = dLon * metresPerDegLon
+		ns[i] = (*point.Latitude - originLat) * metresPerDegLat
+		sumT += ts[i]
+		sumE += es[i]
+		sumN += ns[i]
+	}
+	count := float64(len(points))
+	meanT, meanE, meanN := sumT/count, sumE/count, sumN/count
+
+	var varT, covE, covN float64
+	for i := range ts {
+		dt := ts[i] - meanT
+		varT += dt * dt
+		covE += dt * (es[i] - meanE)
+		covN += dt * (ns[i] - meanN)
+	}
+	if varT == 0 {
+		return Track{}, fmt.Errorf("%w: all %d share one timestamp", ErrTrackTooShort, len(points))
+	}
+	velocityE, velocityN := covE/varT, covN/varT
+
+	bearing := math.Mod(math.Atan2(velocityE, velocityN)*180/math.Pi+360, 360)
+	endT := ts[len(ts)-1]
+	endE := meanE + velocityE*(endT-meanT)
+	endN := meanN + velocityN*(endT-meanT)
+	return Track{
+		BearingDeg: bearing,
+		SpeedMps:   math.Hypot(velocityE, velocityN),
+		Points:     len(points),
+		Start:      start,
+		End:        points[len(points)-1].Timestamp,
+		Latitude:   originLat + endN/metresPerDegLat,
+		Longitude:  math.Remainder(originLon+endE/metresPerDegLon, 360),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package detections
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"song-recognition/models"
+)
+
+func trackPoint(lat, lon float64, at time.Time, isDrone bool) models.Detection {
+	return models.Detection{Latitude: &lat, Longitude: &lon, Timestamp: at, IsDrone: isDrone}
+}
+
+func TestEstimateTrackFitsCollinearPoints(t *testing.T) {
+	base := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	// Heading north-east out of London, 0.001 degrees of latitude every 10 seconds,
+	// given out of order with a noise detection that must be ignored
+	detections := []models.Detection{
+		trackPoint(51.502, -0.1168, base.Add(20*time.Second), true),
+		trackPoint(51.500, -0.1200, base, true),
+		trackPoint(51.600, -0.5000, base.Add(15*time.Second), false),
+		trackPoint(51.501, -0.1184, base.Add(10*time.Second), true),
+	}
+
+	track, err := EstimateTrack(detections)
+	if err != nil {
+		t.Fatalf("EstimateTrack returned error: %v", err)
+	}
+
+	// Each step is 111.2 m north and 0.0016 * 69.2 km = 110.7 m east
+	wantBearing := math.Atan2(0.0016*math.Cos(51.5*math.Pi/180), 0.001) * 180 / math.Pi
+	if math.Abs(track.BearingDeg-wantBearing) > 2 {
+		t.Fatalf("expected a bearing near %.1f, got %.1f", wantBearing, track.BearingDeg)
+	}
+	wantSpeed := HaversineKm(51.500, -0.1200, 51.502, -0.1168) * 1000 / 20
+	if math.Abs(track.SpeedMps-wantSpeed) > 0.5 {
+		t.Fatalf("expected a speed near %.1f m/s, got %.1f", wantSpeed, track.SpeedMps)
+	}
+	if track.Points != 3 || !track.Start.Equal(base) || !track.End.Equal(base.Add(20*time.Second)) {
+		t.Fatalf("expected 3 drone points over 20s, got %+v", track)
+	}
+	if HaversineKm(track.Latitude, track.Longitude, 51.502, -0.1168) > 0.01 {
+		t.Fatalf("expected the fitted end at the last detection, got %v,%v", track.Latitude, track.Longitude)
+	}
+}
+
+func TestEstimateTrackNeedsTwoPointsInWindow(t *testing.T) {
+	base := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	for name, detections := range map[string][]models.Detection{
+		"one point":      {trackPoint(51.5, -0.12, base, true)},
+		"one drone":      {trackPoint(51.5, -0.12, base, true), trackPoint(51.6, -0.12, base.Add(time.Minute), false)},
+		"outside window": {trackPoint(51.5, -0.12, base, true), trackPoint(51.6, -0.12, base.Add(time.Hour), true)},
+		"same instant":   {trackPoint(51.5, -0.12, base, true), trackPoint(51.6, -0.12, base, true)},
+	} {
+		if _, err := EstimateTrack(detections); !errors.Is(err, ErrTrackTooShort) {
+			t.Fatalf("%s: expected ErrTrackTooShort, got %v", name, err)
+		}
+	}
+}
@@ -15,8 +15,11 @@ package drone
 // the feature extraction pipeline for drone classification.
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -30,14 +33,26 @@ import (
 type AudioSample struct {
 	Samples    []float64
 	SampleRate int
+	Channels   int // Channels analysed after reformatting (always mono today)
 	Duration   float64
 	Persisted  string
+	Hash       string  // SHA-256 of the reformatted WAV, hex encoded
 	SNRDb      float64 // Signal-to-noise ratio in dB
+	LevelDb    float64 // Mean power of the raw recording in dBFS, before preprocessing
+	Quality    AudioQualityReport
+	Left       []float64 // Raw channels of a stereo recording when stereo features are enabled; nil otherwise
+	Right      []float64
 }
 
 // PrepareAudioSample converts the base64 payload emitted by the client into fixed
 // format PCM samples suitable for feature extraction.
 func PrepareAudioSample(recData models.RecordData, persist bool) (*AudioSample, error) {
+	return PrepareAudioSampleWithConfig(recData, persist, DefaultPreprocessingConfig())
+}
+
+// PrepareAudioSampleWithConfig is PrepareAudioSample with an explicit preprocessing
+// configuration, e.g. a per-request override.
+func PrepareAudioSampleWithConfig(recData models.RecordData, persist bool, config PreprocessingConfig) (*AudioSample, error) {
 	decodedAudioData, err := base64.StdEncoding.DecodeString(recData.Audio)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode base64 audio: %w", err)
@@ -54,6 +69,13 @@ func PrepareAudioSample(recData models.RecordData, persist bool) (*AudioSample,
 		return nil, fmt.Errorf("failed to write wav file: %w", err)
 	}
 
+	// Direction needs both channels; without them the stereo features fall back to mono.
+	// Read them first, as the stereo and mono reformats share a file name
+	var left, right []float64
+	if recData.Channels == 2 && DefaultFeatureConfig().EnableStereo {
+		left, right, _ = readStereoChannels(filePath)
+	}
+
 	reformatted, err := wav.ReformatWAV(filePath, 1)
 	if err != nil {
 		_ = os.Remove(filePath)
@@ -67,6 +89,13 @@ func PrepareAudioSample(recData models.RecordData, persist bool) (*AudioSample,
 		return nil, fmt.Errorf("failed to read wav info: %w", err)
 	}
 
+	hash, err := hashFile(reformatted)
+	if err != nil {
+		_ = os.Remove(filePath)
+		_ = os.Remove(reformatted)
+		return nil, fmt.Errorf("failed to hash recording: %w", err)
+	}
+
 	samples, err := wav.WavBytesToSamples(wavInfo.Data)
 	if err != nil {
 		_ = os.Remove(filePath)
@@ -80,18 +109,22 @@ func PrepareAudioSample(recData models.RecordData, persist bool) (*AudioSample,
 	duration := float64(len(samples)) / float64(wavInfo.SampleRate)
 
 	// Estimate SNR before preprocessing
-	snrDb := EstimateSNR(samples)
+	snrDb := config.EstimateSNR(samples, wavInfo.SampleRate)
 
 	// Apply audio preprocessing to improve detection in noisy environments
-	config := DefaultPreprocessingConfig()
-	// Enable preprocessing by default - can be configured via environment variables
 	preprocessedSamples := PreprocessAudio(samples, wavInfo.SampleRate, config)
 
 	result := &AudioSample{
 		Samples:    preprocessedSamples,
 		SampleRate: wavInfo.SampleRate,
+		Channels:   wavInfo.Channels,
+		Hash:       hash,
 		Duration:   duration,
 		SNRDb:      snrDb,
+		LevelDb:    SignalLevelDb(samples),
+		Quality:    AssessAudioQuality(samples, wavInfo.SampleRate),
+		Left:       left,
+		Right:      right,
 	}
 
 	if persist {
@@ -112,3 +145,44 @@ func PrepareAudioSample(recData models.RecordData, persist bool) (*AudioSample,
 
 	return result, nil
 }
+
+// readStereoChannels reformats the stereo WAV at path like the mono mix and returns its
+// de-interleaved channels.
+func readStereoChannels(path string) (left, right []float64, err error) {
+	reformatted, err := wav.ReformatWAV(path, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(reformatted)
+
+	wavInfo, err := wav.ReadWavInfo(reformatted)
+	if err != nil {
+		return nil, nil, err
+	}
+	interleaved, err := wav.WavBytesToSamples(wavInfo.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	frames := len(interleaved) / 2
+	left, right = make([]float64, frames), make([]float64, frames)
+	for i := range frames {
+		left[i], right[i] = interleaved[2*i], interleaved[2*i+1]
+	}
+	return left, right, nil
+}
+
+// hashFile returns the hex-encoded SHA-256 of a file's contents.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
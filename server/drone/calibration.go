@@ -0,0 +1,87 @@
+package drone
+
+// Noise-Floor Calibration
+//
+// EstimateSNR assumes the first 10% of a recording is background noise, which fails when
+// a drone is audible from the start. Clients can instead record a few seconds of ambient
+// audio at a location; its level becomes the noise reference for that location and later
+// recordings there are thresholded on their level above that reference.
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// silenceLevelDb is reported for recordings with no energy at all.
+const silenceLevelDb = -100.0
+
+// NoiseCalibration is the ambient baseline recorded for one location.
+type NoiseCalibration struct {
+	Key             string    `json:"key"`
+	NoiseLevelDb    float64   `json:"noiseLevelDb"`    // Mean power of the ambient recording in dBFS
+	AmbientSNRDb    float64   `json:"ambientSnrDb"`    // EstimateSNR of the ambient recording itself
+	DurationSeconds float64   `json:"durationSeconds"` // Length of the ambient recording
+	CalibratedAt    time.Time `json:"calibratedAt"`
+}
+
+// SNRFor returns the SNR of a recording with the given level relative to this baseline.
+func (c NoiseCalibration) SNRFor(levelDb float64) float64 {
+	return levelDb - c.NoiseLevelDb
+}
+
+// NoiseCalibrationStore keeps the latest ambient calibration per location.
+type NoiseCalibrationStore struct {
+	mu      sync.RWMutex
+	entries map[string]NoiseCalibration
+}
+
+// NewNoiseCalibrationStore creates an empty in-memory calibration store.
+func NewNoiseCalibrationStore() *NoiseCalibrationStore {
+	return &NoiseCalibrationStore{entries: make(map[string]NoiseCalibration)}
+}
+
+// Calibrate records sample as the ambient baseline for key, replacing any previous one.
+func (s *NoiseCalibrationStore) Calibrate(key string, sample *AudioSample, at time.Time) NoiseCalibration {
+	calibration := NoiseCalibration{
+		Key:             key,
+		NoiseLevelDb:    sample.LevelDb,
+		AmbientSNRDb:    sample.SNRDb,
+		DurationSeconds: sample.Duration,
+		CalibratedAt:    at,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = calibration
+	return calibration
+}
+
+// Lookup returns the calibration for key, if one has been recorded.
+func (s *NoiseCalibrationStore) Lookup(key string) (NoiseCalibration, bool) {
+	if s == nil {
+		return NoiseCalibration{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	calibration, ok := s.entries[key]
+	return calibration, ok
+}
+
+// SignalLevelDb returns the mean power of samples in dBFS.
+func SignalLevelDb(samples []float64) float64 {
+	if len(samples) == 0 {
+		return silenceLevelDb
+	}
+
+	var power float64
+	for _, s := range samples {
+		power += s * s
+	}
+	power /= float64(len(samples))
+	if power <= 0 {
+		return silenceLevelDb
+	}
+	return math.Max(10.0*math.Log10(power), silenceLevelDb)
+}
@@ -21,6 +21,7 @@ package drone
 // 3. Prediction Aggregation:
 //    - For each label, aggregate weights from matching prototypes
 //    - Weight = 1 / (distance + epsilon) - closer prototypes have higher weight
+//    - With a recency half-life set, weights decay by 0.5^(age/half-life) so newer prototypes count more
 //    - Confidence = sum of weights for label / total weight of all k neighbors
 //    - Average distance and support count are also computed per label
 //
@@ -28,11 +29,16 @@ package drone
 //    - DetermineDroneLikely() checks if top prediction:
 //      * Has confidence >= threshold (default 0.55)
 //      * Is not categorized as "noise"
+//      * Is backed by at least the minimum number of same-label neighbours (default 1)
+//    - LowDataThreshold() raises the threshold for models with few prototypes, whose
+//      confidences are unreliable
 //
 // The classifier supports dynamic prototype addition, allowing the system to learn new
 // drone types without retraining. Prototypes can be uploaded via the web interface.
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -40,37 +46,59 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"song-recognition/utils"
 )
 
 const harmonicFeatureCount = 3
 
-// Feature weights for PANNS embeddings (2048 dimensions)
-// All set to 1.0 for equal weighting across all learned features
-var featureWeights []float64
+// hasHarmonicFeatures reports whether vectors of the given length are legacy features,
+// which end in the harmonic features, rather than MFCCs or PANNS embeddings.
+func hasHarmonicFeatures(count int) bool {
+	return count != MFCCCoefficientCount && count != pannsEmbeddingDimension
+}
+
+// ErrEmptyModel is returned by Predict when the classifier holds no prototypes, so callers
+// can tell an unusable model apart from a confident "not a drone".
+var ErrEmptyModel = errors.New("classifier has no prototypes")
 
-func init() {
-	// Initialize 2048 feature weights for PANNS embeddings
-	featureWeights = make([]float64, 2048)
-	for i := range featureWeights {
-		featureWeights[i] = 1.0
+// uniformWeights returns distance weights of 1.0 for every one of dimension features.
+func uniformWeights(dimension int) []float64 {
+	weights := make([]float64, dimension)
+	for i := range weights {
+		weights[i] = 1.0
 	}
+	return weights
 }
 
 // Classifier performs k-nearest prototype lookups in the feature space.
 type Classifier struct {
-	mu            sync.RWMutex
-	prototypes    []Prototype
-	k             int
-	usingExample  bool
-	modelPath     string
-	labelCategory map[string]string
-	labelMetadata map[string]map[string]string
-	featureScaler *FeatureScaler // Standardizes features before distance calculation
+	mu              sync.RWMutex
+	prototypes      []Prototype
+	k               int
+	usingExample    bool
+	modelPath       string
+	labelCategory   map[string]string
+	labelMetadata   map[string]map[string]string // Aggregate of each label's prototype metadata; see MetadataMergeStrategy
+	metadataMerge   MetadataMergeStrategy        // Empty means MetadataLastWins
+	featureScaler   *FeatureScaler               // Standardizes features before distance calculation
+	scalingDisabled bool                         // Prototypes are only L2-normalised; no scaler is ever fitted
+	weights         []float64                    // Per-dimension distance weights sized to the prototypes; nil until known
+	metric          DistanceMetric               // Neighbour distance; empty means MetricCosine
+	harmonicPenalty float64                      // Distance added per zeroed prototype harmonic; 0 disables
+	maxAccept       float64                      // Nearest distance beyond which Predict reports UnknownLabel; 0 disables
+	confidence      confidenceMapping            // Distance-to-confidence strategy; zero value is weight share
+	halfLife        time.Duration                // Recency decay half-life for neighbour weights; 0 disables
+	maxWindows      int                          // Cap on analysed sliding windows; 0 analyses every window
+	minWindowSec    float64                      // Shortest analysis window; 0 uses DefaultMinWindowSeconds
+	persister       *persister                   // Debounces model writes; nil writes synchronously
+	platt           *PlattCalibration            // Drone-confidence recalibration; nil reports raw confidences
 }
 
 type distancePair struct {
@@ -78,8 +106,22 @@ type distancePair struct {
 	distance float64
 }
 
+// LoadOptions adjusts how NewClassifierFromFileWithOptions builds a classifier.
+type LoadOptions struct {
+	// DisableScaling skips the FeatureScaler and only L2-normalises the raw features,
+	// for comparing self-match quality with and without scaling on small models. The
+	// choice is saved with the prototypes (see ScalingMetadataKey), so later loads of
+	// the saved model keep scaling disabled.
+	DisableScaling bool
+}
+
 // NewClassifierFromFile loads prototype embeddings from the supplied path.
 func NewClassifierFromFile(path string, k int) (*Classifier, error) {
+	return NewClassifierFromFileWithOptions(path, k, LoadOptions{})
+}
+
+// NewClassifierFromFileWithOptions is NewClassifierFromFile with load options.
+func NewClassifierFromFileWithOptions(path string, k int, opts LoadOptions) (*Classifier, error) {
 	if k <= 0 {
 		return nil, fmt.Errorf("invalid neighbour count: %d", k)
 	}
@@ -105,14 +147,105 @@ func NewClassifierFromFile(path string, k int) (*Classifier, error) {
 	if err := json.Unmarshal(data, &prototypes); err != nil {
 		return nil, fmt.Errorf("unable to parse prototypes: %w", err)
 	}
+	defaultCreatedAt(prototypes, resolvedPath)
+
+	// A saved scaler keeps scaling fixed across restarts instead of refitting it to
+	// whatever prototypes the model holds now
+	scaler, err := LoadFeatureScaler(ScalerPath(resolvedPath))
+	if err != nil {
+		return nil, err
+	}
+
+	disableScaling := opts.DisableScaling || scalingDisabledByMetadata(prototypes)
+	classifier, err := newClassifier(prototypes, k, resolvedPath, scaler, disableScaling)
+	if err != nil {
+		return nil, err
+	}
+
+	classifier.usingExample = strings.HasSuffix(resolvedPath, ".example")
+
+	// Store the actual model path (not the example fallback)
+	classifier.modelPath = resolvedPath
+	if classifier.usingExample {
+		// If using example, save to the non-example path
+		classifier.modelPath = strings.TrimSuffix(resolvedPath, ".example")
+	}
+	return classifier, nil
+}
+
+// NewClassifierFromDir loads and concatenates every *.json prototype file in dir (for
+// example one file per label), in name order. All files must share one feature
+// dimension. The classifier has no single model file, so uploaded prototypes cannot
+// be saved back.
+func NewClassifierFromDir(dir string, k int) (*Classifier, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid neighbour count: %d", k)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(filepath.Clean(dir), "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prototype files (%s): %w", dir, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no prototype files in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var prototypes []Prototype
+	var dimensionSource string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load prototypes (%s): %w", path, err)
+		}
+		var batch []Prototype
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("unable to parse prototypes (%s): %w", path, err)
+		}
+		defaultCreatedAt(batch, path)
+
+		for _, proto := range batch {
+			if len(prototypes) == 0 {
+				dimensionSource = path
+			} else if len(proto.Features) != len(prototypes[0].Features) {
+				return nil, fmt.Errorf("prototype %s in %s has %d features, but %s has %d",
+					proto.ID, path, len(proto.Features), dimensionSource, len(prototypes[0].Features))
+			}
+			prototypes = append(prototypes, proto)
+		}
+	}
+
+	return newClassifier(prototypes, k, dir, nil, scalingDisabledByMetadata(prototypes))
+}
+
+// defaultCreatedAt treats prototypes saved before timestamps existed as old as the
+// file they were loaded from.
+func defaultCreatedAt(prototypes []Prototype, path string) {
+	modelTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modelTime = info.ModTime()
+	}
+	for idx := range prototypes {
+		if prototypes[idx].CreatedAt.IsZero() {
+			prototypes[idx].CreatedAt = modelTime
+		}
+	}
+}
+
+// newClassifier validates raw prototypes loaded from source, fits the feature scaler
+// (or uses scaler when it matches their dimension) and builds a classifier around them.
+// With disableScaling the prototypes are only L2-normalised.
+func newClassifier(prototypes []Prototype, k int, source string, scaler *FeatureScaler, disableScaling bool) (*Classifier, error) {
 	labelCategory := make(map[string]string)
-	labelMetadata := make(map[string]map[string]string)
-	expectedFeatureCount := len(featureWeights)
+	expectedFeatureCount := 0
+	if len(prototypes) > 0 {
+		expectedFeatureCount = len(prototypes[0].Features)
+	}
 	rcLogger := utils.GetLogger()
 	zeroHarmonicCount := 0
 
 	if len(prototypes) == 0 {
-		rcLogger.Warn("no prototypes loaded; classifier will start empty", "path", resolvedPath)
+		rcLogger.Warn("no prototypes loaded; classifier will start empty", "path", source)
 	} else {
 		for idx := range prototypes {
 			proto := prototypes[idx]
@@ -123,43 +256,38 @@ func NewClassifierFromFile(path string, k int) (*Classifier, error) {
 				return nil, fmt.Errorf("prototype %s missing label", proto.ID)
 			}
 
-			// Require the current feature dimension
+			// Every prototype must share the model's feature dimension
 			if len(proto.Features) != expectedFeatureCount {
-				return nil, fmt.Errorf("prototype %s has %d features, expected %d (prototypes must be regenerated)",
-					proto.ID, len(proto.Features), expectedFeatureCount)
+				return nil, fmt.Errorf("prototype %s has %d features, expected %d like %s (prototypes must be regenerated)",
+					proto.ID, len(proto.Features), expectedFeatureCount, prototypes[0].ID)
 			}
 
-			// Check if harmonic features (last harmonicFeatureCount) are zeros
-			if len(proto.Features) < harmonicFeatureCount {
-				return nil, fmt.Errorf("prototype %s has insufficient harmonic features", proto.ID)
-			}
-			harmonicStart := len(proto.Features) - harmonicFeatureCount
-			harmonicSlice := proto.Features[harmonicStart:]
-			allZero := true
-			for _, value := range harmonicSlice {
-				if value != 0 {
-					allZero = false
-					break
+			// Check if harmonic features (last harmonicFeatureCount) are zeros; MFCCs and
+			// PANNS embeddings have none
+			if hasHarmonicFeatures(len(proto.Features)) {
+				if len(proto.Features) < harmonicFeatureCount {
+					return nil, fmt.Errorf("prototype %s has insufficient harmonic features", proto.ID)
+				}
+				allZero := true
+				for _, value := range proto.Features[len(proto.Features)-harmonicFeatureCount:] {
+					if value != 0 {
+						allZero = false
+						break
+					}
+				}
+				if allZero {
+					zeroHarmonicCount++
+					rcLogger.Warn("prototype has zero harmonic features (needs regeneration)",
+						"id", proto.ID,
+						"label", proto.Label)
 				}
-			}
-			if allZero {
-				zeroHarmonicCount++
-				rcLogger.Warn("prototype has zero harmonic features (needs regeneration)",
-					"id", proto.ID,
-					"label", proto.Label)
 			}
 
 			// Don't normalize yet - we need to compute the scaler first
-			prototypes[idx].Features = proto.Features
+			prototypes[idx].raw = proto.Features
 			if _, ok := labelCategory[proto.Label]; !ok {
 				labelCategory[proto.Label] = proto.Category
 			}
-			if _, ok := labelMetadata[proto.Label]; !ok {
-				labelMetadata[proto.Label] = map[string]string{}
-			}
-			for k, v := range proto.Metadata {
-				labelMetadata[proto.Label][k] = v
-			}
 		}
 	}
 
@@ -168,13 +296,35 @@ func NewClassifierFromFile(path string, k int) (*Classifier, error) {
 	// However, skip scaling for PANNS embeddings (2048 dims) - they're already properly scaled
 	var featureScaler *FeatureScaler
 	if len(prototypes) > 0 {
-		isPANNS := len(prototypes[0].Features) == 2048
+		isPANNS := len(prototypes[0].Features) == pannsEmbeddingDimension
 
 		if isPANNS {
 			rcLogger.Info("detected PANNS embeddings, skipping feature scaling",
 				"prototype_count", len(prototypes),
 				"feature_dimensions", len(prototypes[0].Features))
+		} else if disableScaling {
+			for idx := range prototypes {
+				normalised := append([]float64(nil), prototypes[idx].Features...)
+				NormaliseVectorInPlace(normalised)
+				prototypes[idx].Features = normalised
+			}
+			rcLogger.Warn("feature scaling disabled; using L2-normalised raw features",
+				"path", source,
+				"prototype_count", len(prototypes))
+		} else if scaler != nil && len(scaler.Mean) == len(prototypes[0].Features) {
+			featureScaler = scaler
+			for idx := range prototypes {
+				prototypes[idx].Features = featureScaler.TransformAndNormalize(prototypes[idx].Features)
+			}
+			rcLogger.Info("loaded saved feature scaler",
+				"prototype_count", len(prototypes),
+				"feature_dimensions", len(featureScaler.Mean))
 		} else {
+			if scaler != nil {
+				rcLogger.Warn("saved feature scaler does not match the prototypes; refitting",
+					"scaler_dimensions", len(scaler.Mean),
+					"feature_dimensions", len(prototypes[0].Features))
+			}
 			var err error
 			featureScaler, err = NewFeatureScalerFromPrototypes(prototypes)
 			if err != nil {
@@ -193,19 +343,14 @@ func NewClassifierFromFile(path string, k int) (*Classifier, error) {
 		}
 	}
 
-	usingExample := strings.HasSuffix(resolvedPath, ".example")
-
-	// Store the actual model path (not the example fallback)
-	modelPath := resolvedPath
-	if usingExample {
-		// If using example, save to the non-example path
-		modelPath = strings.TrimSuffix(resolvedPath, ".example")
-	}
-
 	if len(prototypes) > 0 && k > len(prototypes) {
 		k = len(prototypes)
 	}
 
+	if len(prototypes) > 0 && hasHarmonicFeatures(len(prototypes[0].Features)) {
+		warnOnFFTSizeMismatch(prototypes, source)
+	}
+
 	if zeroHarmonicCount > 0 {
 		rcLogger.Warn("prototypes have invalid harmonic features",
 			"count", zeroHarmonicCount,
@@ -213,17 +358,81 @@ func NewClassifierFromFile(path string, k int) (*Classifier, error) {
 			"message", "Detection accuracy will be poor. Regenerate prototypes with new feature extraction.")
 	}
 
+	var weights []float64
+	if expectedFeatureCount > 0 {
+		weights = uniformWeights(expectedFeatureCount)
+	}
+
 	return &Classifier{
-		prototypes:    prototypes,
-		k:             k,
-		usingExample:  usingExample,
-		modelPath:     modelPath,
-		labelCategory: labelCategory,
-		labelMetadata: labelMetadata,
-		featureScaler: featureScaler,
+		prototypes:      prototypes,
+		k:               k,
+		labelCategory:   labelCategory,
+		labelMetadata:   mergeLabelMetadata(prototypes, MetadataLastWins),
+		featureScaler:   featureScaler,
+		weights:         weights,
+		scalingDisabled: disableScaling,
+		platt:           plattFromMetadata(prototypes),
 	}, nil
 }
 
+// distanceMeasure returns the configured metric with the weights it applies.
+func (c *Classifier) distanceMeasure() distanceMeasure {
+	weights := c.featureWeights()
+	c.mu.RLock()
+	metric := c.metric
+	scaler := c.featureScaler
+	harmonicPenalty := c.harmonicPenalty
+	c.mu.RUnlock()
+
+	if metric == MetricMahalanobis {
+		weights = mahalanobisWeights(weights, scaler)
+	}
+	return distanceMeasure{metric: metric, weights: weights, harmonicPenalty: harmonicPenalty}
+}
+
+// featureWeights returns the per-dimension distance weights, creating them from the
+// prototypes' dimension on first use (a model that started empty learns it from its
+// first upload). It returns nil while the model is empty. The result is shared and
+// must not be modified.
+func (c *Classifier) featureWeights() []float64 {
+	c.mu.RLock()
+	weights := c.weights
+	empty := len(c.prototypes) == 0
+	c.mu.RUnlock()
+	if weights != nil || empty {
+		return weights
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.weights == nil && len(c.prototypes) > 0 {
+		c.weights = uniformWeights(len(c.prototypes[0].Features))
+	}
+	return c.weights
+}
+
+// warnOnFFTSizeMismatch logs when prototypes were extracted with a different FFT size
+// than DRONE_FFT_SIZE; their spectral features then differ in resolution from the
+// recordings classified against them.
+func warnOnFFTSizeMismatch(prototypes []Prototype, source string) {
+	configured := DefaultFeatureConfig().FFTSize
+	mismatched := 0
+	for _, proto := range prototypes {
+		// Prototypes without the key were built with per-clip FFTs (size 0).
+		modelSize, _ := strconv.Atoi(proto.Metadata[FFTSizeMetadataKey])
+		if modelSize != configured {
+			mismatched++
+		}
+	}
+	if mismatched > 0 {
+		utils.GetLogger().Warn("prototypes were extracted with a different FFT size than DRONE_FFT_SIZE",
+			"path", source,
+			"count", mismatched,
+			"total", len(prototypes),
+			"fftSize", configured)
+	}
+}
+
 func (c *Classifier) snapshot() (int, []Prototype, map[string]string, map[string]map[string]string, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -271,8 +480,13 @@ func (c *Classifier) AddPrototype(proto Prototype) (Prototype, error) {
 	if len(proto.Features) == 0 {
 		return Prototype{}, errors.New("prototype has no features")
 	}
+	proto.Label = NormalizeLabel(proto.Label)
 
+	proto.raw = append([]float64(nil), proto.Features...)
 	features := append([]float64(nil), proto.Features...)
+	if proto.CreatedAt.IsZero() {
+		proto.CreatedAt = time.Now()
+	}
 
 	// Apply feature scaling if available
 	c.mu.RLock()
@@ -300,17 +514,16 @@ func (c *Classifier) AddPrototype(proto Prototype) (Prototype, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if len(c.prototypes) > 0 && len(proto.Features) != len(c.prototypes[0].Features) {
+		return Prototype{}, fmt.Errorf("prototype has %d features, model expects %d",
+			len(proto.Features), len(c.prototypes[0].Features))
+	}
 	c.prototypes = append(c.prototypes, proto)
 	if proto.Label != "" {
 		if proto.Category != "" {
 			c.labelCategory[proto.Label] = proto.Category
 		}
-		if _, ok := c.labelMetadata[proto.Label]; !ok {
-			c.labelMetadata[proto.Label] = map[string]string{}
-		}
-		for key, value := range proto.Metadata {
-			c.labelMetadata[proto.Label][key] = value
-		}
+		c.mergeLabelMetadataFor(proto.Label)
 	}
 	// once custom prototypes are added, mark underlying set as bespoke
 	c.usingExample = false
@@ -318,8 +531,43 @@ func (c *Classifier) AddPrototype(proto Prototype) (Prototype, error) {
 	return proto, nil
 }
 
-// SavePrototypesToFile persists all prototypes to the model file.
-// This ensures uploaded prototypes survive server restarts.
+// RemovePrototype removes the prototype with id and reports whether the model held it.
+// The feature scaler is kept, so the remaining prototypes stay scaled as they were; only
+// removing the last prototype drops it, since the next upload may have either feature
+// layout (PANNS or legacy). Call SchedulePersist to save the change.
+func (c *Classifier) RemovePrototype(id string) (bool, error) {
+	if id == "" {
+		return false, errors.New("prototype ID is required")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idx := slices.IndexFunc(c.prototypes, func(proto Prototype) bool { return proto.ID == id })
+	if idx < 0 {
+		return false, nil
+	}
+	label := c.prototypes[idx].Label
+	c.prototypes = slices.Delete(c.prototypes, idx, idx+1)
+
+	if slices.ContainsFunc(c.prototypes, func(proto Prototype) bool { return proto.Label == label }) {
+		c.mergeLabelMetadataFor(label)
+	} else {
+		delete(c.labelCategory, label)
+		delete(c.labelMetadata, label)
+	}
+	if len(c.prototypes) == 0 {
+		c.featureScaler = nil
+		c.weights = nil
+	}
+	c.usingExample = false
+
+	return true, nil
+}
+
+// SavePrototypesToFile persists all prototypes to the model file, with their unscaled
+// features, and the feature scaler to its sidecar file (see ScalerPath), so uploaded
+// prototypes survive server restarts and are scaled the same way after them.
 func (c *Classifier) SavePrototypesToFile() error {
 	if c.modelPath == "" {
 		return errors.New("model path not set")
@@ -327,6 +575,21 @@ func (c *Classifier) SavePrototypesToFile() error {
 
 	// Get a snapshot of all prototypes
 	_, prototypes, _, _, _ := c.snapshot()
+	c.mu.RLock()
+	scaler := c.featureScaler
+	scalingDisabled := c.scalingDisabled
+	c.mu.RUnlock()
+	for idx := range prototypes {
+		if prototypes[idx].raw != nil {
+			prototypes[idx].Features = prototypes[idx].raw
+		}
+		if scalingDisabled {
+			if prototypes[idx].Metadata == nil {
+				prototypes[idx].Metadata = map[string]string{}
+			}
+			prototypes[idx].Metadata[ScalingMetadataKey] = ScalingDisabled
+		}
+	}
 
 	// Ensure directory exists
 	dir := filepath.Dir(c.modelPath)
@@ -351,6 +614,12 @@ func (c *Classifier) SavePrototypesToFile() error {
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
 
+	if scaler != nil {
+		if err := SaveFeatureScaler(ScalerPath(c.modelPath), scaler); err != nil {
+			return err
+		}
+	}
+
 	// Mark as no longer using example
 	c.mu.Lock()
 	c.usingExample = false
@@ -359,6 +628,87 @@ func (c *Classifier) SavePrototypesToFile() error {
 	return nil
 }
 
+// RecomputeScaler refits the feature scaler to the unscaled features of every prototype
+// now in the model and rescales them. The scaler is otherwise kept as loaded, so call
+// this (and save) after adding enough prototypes to shift the feature distribution.
+// PANNS models are not scaled.
+func (c *Classifier) RecomputeScaler() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.prototypes) == 0 {
+		return ErrEmptyModel
+	}
+	if len(c.prototypes[0].Features) == pannsEmbeddingDimension {
+		return errors.New("PANNS embeddings are not scaled")
+	}
+	if c.scalingDisabled {
+		return errors.New("feature scaling is disabled for this model")
+	}
+
+	raw := make([]Prototype, len(c.prototypes))
+	for idx, proto := range c.prototypes {
+		if proto.raw != nil {
+			proto.Features = proto.raw
+		}
+		raw[idx] = proto
+	}
+	scaler, err := NewFeatureScalerFromPrototypes(raw)
+	if err != nil {
+		return err
+	}
+
+	for idx := range c.prototypes {
+		c.prototypes[idx].Features = scaler.TransformAndNormalize(raw[idx].Features)
+	}
+	c.featureScaler = scaler
+	return nil
+}
+
+// SetPersistDelay makes SchedulePersist coalesce saves requested within delay of each
+// other into a single write. Zero restores synchronous saves.
+func (c *Classifier) SetPersistDelay(delay time.Duration) {
+	c.mu.Lock()
+	previous := c.persister
+	c.persister = nil
+	if delay > 0 {
+		c.persister = newPersister(delay, c.SavePrototypesToFile)
+	}
+	c.mu.Unlock()
+
+	if previous != nil {
+		if err := previous.flush(); err != nil {
+			log.Printf("[Classifier] Failed to flush pending model save: %v\n", err)
+		}
+	}
+}
+
+// SchedulePersist saves the prototypes to the model file. With a persist delay set the
+// write is deferred and pending is true; otherwise the write happens before returning.
+func (c *Classifier) SchedulePersist() (pending bool, err error) {
+	c.mu.RLock()
+	p := c.persister
+	c.mu.RUnlock()
+
+	if p == nil {
+		return false, c.SavePrototypesToFile()
+	}
+	p.schedule()
+	return true, nil
+}
+
+// FlushPersist writes any deferred save immediately.
+func (c *Classifier) FlushPersist() error {
+	c.mu.RLock()
+	p := c.persister
+	c.mu.RUnlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.flush()
+}
+
 // Stats returns summary metadata about the loaded prototype set.
 func (c *Classifier) Stats() ModelStats {
 	_, prototypes, _, _, usingExample := c.snapshot()
@@ -390,64 +740,379 @@ func (c *Classifier) Stats() ModelStats {
 	}
 }
 
+// Settings reports the settings the classifier runs with, defaults applied.
+func (c *Classifier) Settings() ClassifierSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	settings := ClassifierSettings{
+		K:                       c.k,
+		DistanceMetric:          c.metric,
+		HarmonicMismatchPenalty: c.harmonicPenalty,
+		MaxAcceptDistance:       c.maxAccept,
+		ConfidenceStrategy:      c.confidence.strategy,
+		SoftmaxTemperature:      c.confidence.temperature,
+		BalancedVoting:          c.confidence.balanced,
+		RecencyHalfLife:         c.halfLife.String(),
+		MaxWindows:              c.maxWindows,
+		MinWindowSeconds:        c.minWindowSec,
+		ScalingDisabled:         c.scalingDisabled,
+		MetadataMerge:           c.metadataMerge,
+		RankingBlend:            c.confidence.ranking,
+		PlattCalibration:        c.platt,
+	}
+	if settings.DistanceMetric == "" {
+		settings.DistanceMetric = MetricCosine
+	}
+	if settings.ConfidenceStrategy == "" {
+		settings.ConfidenceStrategy = ConfidenceWeightShare
+	}
+	if settings.SoftmaxTemperature <= 0 {
+		settings.SoftmaxTemperature = DefaultSoftmaxTemperature
+	}
+	if settings.MinWindowSeconds <= 0 {
+		settings.MinWindowSeconds = DefaultMinWindowSeconds
+	}
+	if settings.MetadataMerge == "" {
+		settings.MetadataMerge = MetadataLastWins
+	}
+	return settings
+}
+
+// SetMaxAcceptDistance makes Predict prepend an UnknownLabel prediction when the nearest
+// prototype is further than distance from the query. Zero or less disables rejection.
+func (c *Classifier) SetMaxAcceptDistance(distance float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxAccept = max(distance, 0)
+}
+
+// SetRecencyHalfLife enables recency decay: a prototype's neighbour weight halves for every
+// halfLife of age, so newer recordings of an evolving fleet count more. Zero disables decay.
+func (c *Classifier) SetRecencyHalfLife(halfLife time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if halfLife < 0 {
+		halfLife = 0
+	}
+	c.halfLife = halfLife
+}
+
+// SetDistanceMetric selects the distance used to rank neighbours. Neighbour weights
+// stay 1/(distance+eps) whichever metric is chosen.
+func (c *Classifier) SetDistanceMetric(metric DistanceMetric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metric = metric
+}
+
+// SetHarmonicMismatchPenalty sets the distance added for each zeroed harmonic feature of
+// a prototype extracted before harmonic features existed. Zero or less disables it.
+func (c *Classifier) SetHarmonicMismatchPenalty(penalty float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.harmonicPenalty = max(penalty, 0)
+}
+
+// SetConfidenceStrategy selects how neighbour distances map to confidences. temperature
+// applies to ConfidenceSoftmaxOverDistances only; zero or less uses DefaultSoftmaxTemperature.
+func (c *Classifier) SetConfidenceStrategy(strategy ConfidenceStrategy, temperature float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confidence.strategy = strategy
+	c.confidence.temperature = temperature
+}
+
+// SetBalancedVoting divides each neighbour's vote by the square root of its label's
+// prototype count, so heavily sampled labels do not win on numbers alone.
+func (c *Classifier) SetBalancedVoting(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confidence.balanced = enabled
+}
+
+// SetMaxWindows caps how many sliding windows PredictWithSlidingWindows analyses. Longer
+// clips are subsampled uniformly across their full length. Zero removes the cap.
+func (c *Classifier) SetMaxWindows(maxWindows int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxWindows < 0 {
+		maxWindows = 0
+	}
+	c.maxWindows = maxWindows
+}
+
+// SetMinWindowSeconds sets the shortest window PredictWithSlidingWindows analyses. Zero
+// or less restores DefaultMinWindowSeconds.
+func (c *Classifier) SetMinWindowSeconds(seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seconds < 0 {
+		seconds = 0
+	}
+	c.minWindowSec = seconds
+}
+
+// FeatureDimension reports the length of the stored prototype vectors, or 0 for an empty model.
+func (c *Classifier) FeatureDimension() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.prototypes) == 0 {
+		return 0
+	}
+	return len(c.prototypes[0].Features)
+}
+
+// Fingerprint identifies the model that made a prediction: a hash over the sorted
+// prototype IDs, the feature type, k and the scaler parameters. It is stable across
+// reloads of the same model file and changes when prototypes are added or removed.
+func (c *Classifier) Fingerprint() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]string, len(c.prototypes))
+	for idx, proto := range c.prototypes {
+		ids[idx] = proto.ID
+	}
+	sort.Strings(ids)
+
+	featureType := "legacy"
+	if len(c.prototypes) > 0 {
+		switch len(c.prototypes[0].Features) {
+		case pannsEmbeddingDimension:
+			featureType = "panns"
+		case MFCCCoefficientCount:
+			featureType = "mfcc"
+		}
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "features=%s\nk=%d\n", featureType, c.k)
+	for _, id := range ids {
+		fmt.Fprintf(h, "prototype=%s\n", id)
+	}
+	if c.featureScaler != nil {
+		for i := range c.featureScaler.Mean {
+			fmt.Fprintf(h, "scaler=%s,%s\n",
+				strconv.FormatFloat(c.featureScaler.Mean[i], 'g', -1, 64),
+				strconv.FormatFloat(c.featureScaler.Stddev[i], 'g', -1, 64))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
 // Predict finds the best prototype matches for a feature vector.
 func (c *Classifier) Predict(features []float64) ([]Prediction, error) {
+	return c.PredictWithK(features, 0)
+}
+
+// PredictWithK is Predict with an explicit neighbour count; k <= 0 uses the
+// classifier's configured k.
+func (c *Classifier) PredictWithK(features []float64, k int) ([]Prediction, error) {
 	if len(features) == 0 {
 		return nil, errors.New("feature vector is empty")
 	}
+	return c.predictPrepared(c.PrepareQuery(features), k)
+}
+
+// PreparedQuery is a feature vector already scaled and L2-normalised into the space
+// the model's prototypes live in. Handlers prepare a recording's features once and
+// pass the same PreparedQuery to PredictPrepared and TemplateMatcher.Predict, so the
+// classifier and the templates compare the identical vector.
+type PreparedQuery []float64
+
+// PrepareQuery applies the model's feature scaling and L2 normalisation to a copy of
+// features.
+func (c *Classifier) PrepareQuery(features []float64) PreparedQuery {
+	return c.scaleQuery(append([]float64(nil), features...))
+}
+
+// PredictPrepared is Predict for a query returned by PrepareQuery.
+func (c *Classifier) PredictPrepared(query PreparedQuery) ([]Prediction, error) {
+	if len(query) == 0 {
+		return nil, errors.New("feature vector is empty")
+	}
+	return c.predictPrepared(query, 0)
+}
+
+// BatchPredict classifies every vector like Predict, but against one snapshot of the
+// model, so the scaler and prototypes are copied once for the whole batch rather than
+// once per vector. Prototypes added during the call are not seen. An empty vector gets
+// a nil result instead of failing the batch. Identical vectors may share a result
+// slice, which must not be modified.
+func (c *Classifier) BatchPredict(vectors [][]float64) ([][]Prediction, error) {
+	predictor, err := c.newWindowPredictor()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]Prediction, len(vectors))
+	for i, features := range vectors {
+		if len(features) == 0 {
+			continue
+		}
+		// prepareFeatures normalises in place
+		results[i] = predictor.predict(append([]float64(nil), features...))
+	}
+	return results, nil
+}
+
+func (c *Classifier) predictPrepared(features PreparedQuery, k int) ([]Prediction, error) {
+	return c.predictPreparedExcluding(features, k, nil)
+}
+
+// PredictExcluding is Predict with the prototypes whose IDs are listed left out of the
+// neighbour search, as if the model did not hold them: for example, how a recording
+// would classify without its own prototype. Unknown IDs are ignored. It returns
+// ErrEmptyModel when every prototype is excluded.
+func (c *Classifier) PredictExcluding(features []float64, excludeIDs []string) ([]Prediction, error) {
+	if len(features) == 0 {
+		return nil, errors.New("feature vector is empty")
+	}
+	exclude := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		exclude[id] = true
+	}
+	return c.predictPreparedExcluding(c.PrepareQuery(features), 0, exclude)
+}
+
+// predictPreparedExcluding is predictPrepared without the prototypes whose IDs are in
+// exclude.
+func (c *Classifier) predictPreparedExcluding(features PreparedQuery, k int, exclude map[string]bool) ([]Prediction, error) {
+	c.mu.RLock()
+	halfLife := c.halfLife
+	mapping := c.confidence
+	maxAccept := c.maxAccept
+	c.mu.RUnlock()
+
+	defaultK, prototypes, labelCategory, labelMetadata, _ := c.snapshot()
+	if len(exclude) > 0 {
+		prototypes = slices.DeleteFunc(prototypes, func(proto Prototype) bool { return exclude[proto.ID] })
+	}
+
+	if len(prototypes) == 0 {
+		return nil, ErrEmptyModel
+	}
 
-	// Apply feature scaling to incoming features (critical for correct classification)
-	// However, skip scaling for PANNS embeddings (2048 dims) since they're already properly scaled
+	if k <= 0 {
+		k = defaultK
+	}
+	predictions := predictNeighbours(features, prototypes, -1, k, halfLife, c.distanceMeasure(), mapping, labelCategory, labelMetadata)
+	return rejectOutOfDistribution(predictions, maxAccept), nil
+}
+
+// scaleQuery applies the model's feature scaling and L2 normalisation to an incoming
+// feature vector. Vectors the scaler does not apply to are normalised in place, so
+// callers outside PrepareQuery must pass a copy.
+func (c *Classifier) scaleQuery(features []float64) []float64 {
 	c.mu.RLock()
 	scaler := c.featureScaler
 	c.mu.RUnlock()
 
-	if scaler != nil && len(features) != 2048 {
-		// Only scale legacy hand-crafted features, NOT PANNS embeddings
-		features = scaler.Transform(features)
-		NormaliseVectorInPlace(features)
+	if scaler != nil && len(features) != pannsEmbeddingDimension {
 		log.Printf("[Classifier] Applied scaling to %d-dim features", len(features))
-	} else if len(features) == 2048 {
-		log.Printf("[Classifier] Skipping scaling for PANNS embeddings (2048 dims)")
+	} else if len(features) == pannsEmbeddingDimension {
+		log.Printf("[Classifier] Skipping scaling for PANNS embeddings (%d dims)", pannsEmbeddingDimension)
 	}
+	return prepareFeatures(scaler, features)
+}
 
-	k, prototypes, labelCategory, labelMetadata, _ := c.snapshot()
+// prepareFeatures scales legacy features with scaler (critical for correct
+// classification) and L2-normalises the result. PANNS embeddings (2048 dims) are
+// already properly scaled and are only normalised.
+func prepareFeatures(scaler *FeatureScaler, features []float64) []float64 {
+	if scaler != nil && len(features) != pannsEmbeddingDimension {
+		features = scaler.Transform(features)
+	}
+	NormaliseVectorInPlace(features)
+	return features
+}
+
+// TopKNeighbors returns every prototype ranked by distance to features, before any
+// per-label aggregation. Neighbours that Predict would vote with at the given k are
+// flagged InTopK; k <= 0 uses the classifier's configured k.
+func (c *Classifier) TopKNeighbors(features []float64, k int) []RankedNeighbor {
+	if len(features) == 0 {
+		return nil
+	}
+	features = c.PrepareQuery(features)
 
+	c.mu.RLock()
+	halfLife := c.halfLife
+	c.mu.RUnlock()
+
+	defaultK, prototypes, labelCategory, _, _ := c.snapshot()
 	if len(prototypes) == 0 {
-		return []Prediction{}, nil
+		return nil
 	}
+	if k <= 0 {
+		k = defaultK
+	}
+
+	now := time.Now()
+	distances := nearestPrototypes(features, prototypes, -1, c.distanceMeasure())
+	neighbors := make([]RankedNeighbor, 0, len(distances))
+	for rank, pair := range distances {
+		proto := prototypes[pair.index]
+		neighbors = append(neighbors, RankedNeighbor{
+			Rank:     rank + 1,
+			ID:       proto.ID,
+			Label:    proto.Label,
+			Category: labelCategory[proto.Label],
+			Source:   proto.Source,
+			Distance: pair.distance,
+			Weight:   neighbourWeight(pair.distance, proto.CreatedAt, now, halfLife),
+			InTopK:   rank < k,
+		})
+	}
+	return neighbors
+}
 
-	k = c.k
-	if len(prototypes) < k {
-		k = max(1, len(prototypes))
+// predictNeighbours runs the weighted k-NN vote of features against prototypes. The
+// prototype at index skip is left out (leave-one-out); pass -1 to use every prototype.
+func predictNeighbours(features []float64, prototypes []Prototype, skip int, k int, halfLife time.Duration, measure distanceMeasure,
+	mapping confidenceMapping, labelCategory map[string]string, labelMetadata map[string]map[string]string) []Prediction {
+	candidates := len(prototypes)
+	if skip >= 0 && skip < len(prototypes) {
+		candidates--
+	}
+	if candidates < k {
+		k = max(1, candidates)
 	}
 
 	// Find the k-nearest prototypes
-	distances := make([]distancePair, len(prototypes))
-	for i := range prototypes {
-		// Cosine similarity returns a value between -1 and 1 (1 is most similar).
-		// We convert it to a distance measure (0 is most similar) by subtracting from 1.
-		similarity := cosineSimilarity(features, prototypes[i].Features, featureWeights)
-		distances[i] = distancePair{index: i, distance: 1 - similarity}
-	}
-	sort.Slice(distances, func(i, j int) bool {
-		return distances[i].distance < distances[j].distance
-	})
+	distances := nearestPrototypes(features, prototypes, skip, measure)
 
 	labelScores := make(map[string]struct {
 		weightSum  float64
+		softmaxSum float64
 		distSum    float64
+		nearest    float64
 		count      int
 		prototypes []PrototypeScore
 	})
 
-	var totalWeight float64
+	now := time.Now()
+	shares := mapping.labelShares(prototypes, skip)
+	var totalWeight, softmaxTotal float64
 	for idx := 0; idx < len(distances) && idx < k; idx++ {
 		neighbor := distances[idx]
-		weight := 1.0 / (neighbor.distance + 1e-9) // Add a small epsilon to avoid division by zero
+		label := prototypes[neighbor.index].Label
+		weight := neighbourWeight(neighbor.distance, prototypes[neighbor.index].CreatedAt, now, halfLife)
+		softmax := mapping.softmaxWeight(neighbor.distance) * recencyWeight(prototypes[neighbor.index].CreatedAt, now, halfLife)
+		vote, softmaxVote := weight, softmax
+		if shares != nil {
+			vote *= shares[label]
+			softmaxVote *= shares[label]
+		}
 
-		stats := labelScores[prototypes[neighbor.index].Label]
-		stats.weightSum += weight
+		stats := labelScores[label]
+		if stats.count == 0 {
+			stats.nearest = neighbor.distance
+		}
+		stats.weightSum += vote
+		stats.softmaxSum += softmaxVote
 		stats.distSum += neighbor.distance
 		stats.count++
 		stats.prototypes = append(stats.prototypes, PrototypeScore{
@@ -455,16 +1120,19 @@ func (c *Classifier) Predict(features []float64) ([]Prediction, error) {
 			Distance: neighbor.distance,
 			Weight:   weight,
 			Source:   prototypes[neighbor.index].Source,
+			Metadata: metadataOverrides(prototypes[neighbor.index].Metadata, labelMetadata[label]),
 		})
 
-		labelScores[prototypes[neighbor.index].Label] = stats
-		totalWeight += weight
+		labelScores[label] = stats
+		totalWeight += vote
+		softmaxTotal += softmaxVote
 	}
 
 	if totalWeight == 0 {
-		return []Prediction{}, nil
+		return []Prediction{}
 	}
 
+	margins := labelMargins(distances, prototypes)
 	predictions := make([]Prediction, 0, len(labelScores))
 	for label, stats := range labelScores {
 		labelMeta := labelMetadata[label]
@@ -472,10 +1140,7 @@ func (c *Classifier) Predict(features []float64) ([]Prediction, error) {
 		if labelMeta != nil {
 			description = labelMeta["description"]
 		}
-		confidence := 0.0
-		if totalWeight > 0 {
-			confidence = stats.weightSum / totalWeight
-		}
+		confidence := mapping.labelConfidence(stats.weightSum, totalWeight, stats.softmaxSum, softmaxTotal, stats.nearest)
 		avgDist := 0.0
 		if stats.count > 0 {
 			avgDist = stats.distSum / float64(stats.count)
@@ -488,10 +1153,14 @@ func (c *Classifier) Predict(features []float64) ([]Prediction, error) {
 			Description:   description,
 			Confidence:    confidence,
 			AverageDist:   avgDist,
+			Margin:        margins[label],
 			Support:       stats.count,
 			TopPrototypes: stats.prototypes,
 			Metadata:      labelMeta,
 		}
+		if mapping.ranking.enabled() {
+			entry.RankScore = mapping.ranking.score(stats.weightSum/totalWeight, stats.count, k, avgDist)
+		}
 
 		// Extract threat assessment for defense applications
 		if labelMeta != nil && labelCategory[label] == "drone" {
@@ -504,14 +1173,57 @@ func (c *Classifier) Predict(features []float64) ([]Prediction, error) {
 		predictions = append(predictions, entry)
 	}
 
+	sortPredictions(predictions)
+
+	return predictions
+}
+
+// labelMargins returns, for every label, the distance to the nearest prototype of
+// another label minus the distance to its own nearest prototype. distances must be
+// sorted nearest first; a model with a single label has no margins.
+func labelMargins(distances []distancePair, prototypes []Prototype) map[string]float64 {
+	nearest := make(map[string]float64)
+	var closest []string // the two labels nearest to the query
+	for _, pair := range distances {
+		label := prototypes[pair.index].Label
+		if _, seen := nearest[label]; seen {
+			continue
+		}
+		nearest[label] = pair.distance
+		if len(closest) < 2 {
+			closest = append(closest, label)
+		}
+	}
+
+	margins := make(map[string]float64, len(nearest))
+	if len(closest) < 2 {
+		return margins
+	}
+	for label, own := range nearest {
+		other := closest[0]
+		if label == other {
+			other = closest[1]
+		}
+		margins[label] = nearest[other] - own
+	}
+	return margins
+}
+
+// sortPredictions orders predictions by rank score when a RankingBlend set one, then by
+// confidence, average distance and label, so exact ties always come out in the same order.
+func sortPredictions(predictions []Prediction) {
 	sort.Slice(predictions, func(i, j int) bool {
+		if math.Abs(predictions[i].RankScore-predictions[j].RankScore) > 1e-9 {
+			return predictions[i].RankScore > predictions[j].RankScore
+		}
 		if math.Abs(predictions[i].Confidence-predictions[j].Confidence) > 1e-9 {
 			return predictions[i].Confidence > predictions[j].Confidence
 		}
-		return predictions[i].AverageDist < predictions[j].AverageDist
+		if predictions[i].AverageDist != predictions[j].AverageDist {
+			return predictions[i].AverageDist < predictions[j].AverageDist
+		}
+		return predictions[i].Label < predictions[j].Label
 	})
-
-	return predictions, nil
 }
 
 // PredictWithSlidingWindows analyses raw samples using overlapping windows and aggregates
@@ -524,45 +1236,28 @@ func (c *Classifier) PredictWithSlidingWindows(samples []float64, sampleRate int
 		return nil, nil, errors.New("invalid sample rate")
 	}
 
-	if windowSeconds <= 0 {
-		windowSeconds = 3.0
-	}
-	if overlapSeconds < 0 {
-		overlapSeconds = 0
-	}
-
-	windowSize := int(windowSeconds * float64(sampleRate))
-	if windowSize <= 0 {
-		windowSize = sampleRate * 3
-	}
-	if windowSize > len(samples) {
-		windowSize = len(samples)
-	}
+	c.mu.RLock()
+	maxWindows := c.maxWindows
+	c.mu.RUnlock()
 
-	const minWindowSize = 1024
-	if windowSize < minWindowSize {
-		windowSize = minWindowSize
-		if windowSize > len(samples) {
-			windowSize = len(samples)
-		}
+	predictor, err := c.newWindowPredictor()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	overlapSamples := int(overlapSeconds * float64(sampleRate))
-	hopSize := windowSize - overlapSamples
-	if hopSize <= 0 {
-		hopSize = windowSize / 2
-		if hopSize == 0 {
-			hopSize = 1
-		}
-	}
-	if hopSize > windowSize {
-		hopSize = windowSize
+	minWindow := MinWindowSamples(sampleRate, c.minWindowSeconds())
+	windowSize, hopSize, err := slidingWindowGeometry(len(samples), sampleRate, windowSeconds, overlapSeconds, minWindow)
+	if err != nil {
+		return nil, nil, err
 	}
+	starts := slidingWindowStarts(len(samples), windowSize, hopSize, minWindow)
+	extractor := NewWindowFeatureExtractor(DefaultFeatureConfig())
 
 	type aggregatedLabelStats struct {
 		weightSum       float64
 		distWeightedSum float64
 		support         int
+		rankSum         float64 // averaged over every window, so labels seen in few windows rank lower
 		category        string
 		description     string
 		metadata        map[string]string
@@ -573,34 +1268,29 @@ func (c *Classifier) PredictWithSlidingWindows(samples []float64, sampleRate int
 	var windowPredictions []WindowPrediction
 	totalWeight := 0.0
 
-	for start := 0; start < len(samples); {
-		end := start + windowSize
-		if end > len(samples) {
-			end = len(samples)
-		}
-
+	for _, index := range subsampleWindows(len(starts), maxWindows) {
+		start := starts[index]
+		end := min(start+windowSize, len(samples))
 		windowSamples := samples[start:end]
-		if len(windowSamples) < 256 {
-			break
-		}
-
-		features, err := ExtractFeatureVector(windowSamples, sampleRate)
-		if err != nil {
-			return nil, nil, err
-		}
-		// Don't normalize here - Predict() will handle scaling and normalization
 
-		windowPreds, err := c.Predict(features)
+		features, err := extractor.Extract(windowSamples, sampleRate)
 		if err != nil {
 			return nil, nil, err
 		}
+		// Don't normalize here - the predictor handles scaling and normalization
+		windowPreds := predictor.predict(features)
 
-		windowPredictions = append(windowPredictions, WindowPrediction{
-			Index:       len(windowPredictions),
+		window := WindowPrediction{
+			Index:       index,
 			Start:       float64(start) / float64(sampleRate),
 			End:         float64(end) / float64(sampleRate),
 			Predictions: windowPreds,
-		})
+		}
+		if len(windowPreds) > 0 {
+			window.TopLabel = windowPreds[0].Label
+			window.TopConfidence = windowPreds[0].Confidence
+		}
+		windowPredictions = append(windowPredictions, window)
 
 		for _, pred := range windowPreds {
 			if pred.Confidence <= 0 {
@@ -615,6 +1305,7 @@ func (c *Classifier) PredictWithSlidingWindows(samples []float64, sampleRate int
 			stats.weightSum += pred.Confidence
 			stats.distWeightedSum += pred.AverageDist * pred.Confidence
 			stats.support += pred.Support
+			stats.rankSum += pred.RankScore
 			if stats.category == "" {
 				stats.category = pred.Category
 			}
@@ -628,14 +1319,6 @@ func (c *Classifier) PredictWithSlidingWindows(samples []float64, sampleRate int
 
 			totalWeight += pred.Confidence
 		}
-
-		if end == len(samples) {
-			break
-		}
-		start += hopSize
-		if start >= len(samples) {
-			break
-		}
 	}
 
 	if len(windowPredictions) == 0 {
@@ -663,6 +1346,7 @@ func (c *Classifier) PredictWithSlidingWindows(samples []float64, sampleRate int
 			Confidence:    confidence,
 			AverageDist:   avgDist,
 			Support:       stats.support,
+			RankScore:     stats.rankSum / float64(len(windowPredictions)),
 			TopPrototypes: stats.topPrototypes,
 			Metadata:      labelMeta,
 		}
@@ -677,88 +1361,174 @@ func (c *Classifier) PredictWithSlidingWindows(samples []float64, sampleRate int
 		predictions = append(predictions, entry)
 	}
 
-	sort.Slice(predictions, func(i, j int) bool {
-		if math.Abs(predictions[i].Confidence-predictions[j].Confidence) > 1e-9 {
-			return predictions[i].Confidence > predictions[j].Confidence
-		}
-		return predictions[i].AverageDist < predictions[j].AverageDist
-	})
+	sortPredictions(predictions)
 
 	return predictions, windowPredictions, nil
 }
 
-type neighborMatch struct {
-	prototype Prototype
-	distance  float64
-	weight    float64
+// CompactWindows returns copies of windows without their per-window Predictions,
+// leaving the timing and the top label and confidence. Full predictions repeat every
+// label's metadata and top prototypes per window, which dominates the response size
+// for long clips.
+func CompactWindows(windows []WindowPrediction) []WindowPrediction {
+	if windows == nil {
+		return nil
+	}
+	compact := make([]WindowPrediction, len(windows))
+	for i, window := range windows {
+		window.Predictions = nil
+		compact[i] = window
+	}
+	return compact
 }
 
-func rankNeighbors(features []float64, prototypes []Prototype) []neighborMatch {
-	neighbors := make([]neighborMatch, 0, len(prototypes))
-	for _, proto := range prototypes {
-		dist := weightedDistance(features, proto.Features)
-		weight := 1.0 / (dist + 1e-9)
-		neighbors = append(neighbors, neighborMatch{prototype: proto, distance: dist, weight: weight})
+// SlidingWindowCount returns how many windows PredictWithSlidingWindows would produce
+// for sampleCount samples before any max-windows cap is applied, or 0 when the clip is
+// shorter than the minimum window.
+func (c *Classifier) SlidingWindowCount(sampleCount int, sampleRate int, windowSeconds float64, overlapSeconds float64) int {
+	if sampleCount == 0 || sampleRate <= 0 {
+		return 0
 	}
+	minWindow := MinWindowSamples(sampleRate, c.minWindowSeconds())
+	windowSize, hopSize, err := slidingWindowGeometry(sampleCount, sampleRate, windowSeconds, overlapSeconds, minWindow)
+	if err != nil {
+		return 0
+	}
+	return len(slidingWindowStarts(sampleCount, windowSize, hopSize, minWindow))
+}
 
-	sort.Slice(neighbors, func(i, j int) bool {
-		return neighbors[i].distance < neighbors[j].distance
-	})
+// DefaultMinWindowSeconds is the shortest sliding window analysed unless configured
+// otherwise; shorter windows hold too few cycles of low rotor frequencies.
+const DefaultMinWindowSeconds = 0.1
 
-	return neighbors
+// ErrClipTooShort is returned by PredictWithSlidingWindows for clips shorter than the
+// minimum analysis window.
+var ErrClipTooShort = errors.New("clip is shorter than the minimum analysis window")
+
+func (c *Classifier) minWindowSeconds() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.minWindowSec <= 0 {
+		return DefaultMinWindowSeconds
+	}
+	return c.minWindowSec
+}
+
+// MinWindowSamples converts a minimum window duration into samples at sampleRate, so
+// the shortest analysed window covers the same time at every rate.
+func MinWindowSamples(sampleRate int, minSeconds float64) int {
+	if minSeconds <= 0 {
+		minSeconds = DefaultMinWindowSeconds
+	}
+	return max(1, int(math.Ceil(minSeconds*float64(sampleRate))))
 }
 
-func weightedDistance(a, b []float64) float64 {
-	minLength := len(a)
-	if len(b) < minLength {
-		minLength = len(b)
+// slidingWindowGeometry converts window and overlap durations into sample counts. Windows
+// shorter than minWindow samples are widened to it; a clip shorter than minWindow is
+// rejected with ErrClipTooShort.
+func slidingWindowGeometry(sampleCount int, sampleRate int, windowSeconds float64, overlapSeconds float64, minWindow int) (int, int, error) {
+	if sampleCount < minWindow {
+		return 0, 0, fmt.Errorf("%w: %d samples (%.3fs) at %d Hz, need at least %d (%.3fs)", ErrClipTooShort,
+			sampleCount, float64(sampleCount)/float64(sampleRate), sampleRate, minWindow, float64(minWindow)/float64(sampleRate))
+	}
+	if windowSeconds <= 0 {
+		windowSeconds = 3.0
+	}
+	if overlapSeconds < 0 {
+		overlapSeconds = 0
+	}
+
+	windowSize := int(windowSeconds * float64(sampleRate))
+	if windowSize <= 0 {
+		windowSize = sampleRate * 3
 	}
-	if minLength == 0 {
-		return math.MaxFloat64
+	if windowSize > sampleCount {
+		windowSize = sampleCount
+	}
+	if windowSize < minWindow {
+		windowSize = minWindow
 	}
 
-	var sum float64
-	for i := 0; i < minLength; i++ {
-		diff := a[i] - b[i]
-		weight := 1.0
-		if i < len(featureWeights) {
-			weight = featureWeights[i]
+	overlapSamples := int(overlapSeconds * float64(sampleRate))
+	hopSize := windowSize - overlapSamples
+	if hopSize <= 0 {
+		hopSize = windowSize / 2
+		if hopSize == 0 {
+			hopSize = 1
 		}
-		sum += weight * diff * diff
+	}
+	if hopSize > windowSize {
+		hopSize = windowSize
 	}
 
-	// Account for any remaining dimensions if vectors differ in length
-	for i := minLength; i < len(a); i++ {
-		weight := 1.0
-		if i < len(featureWeights) {
-			weight = featureWeights[i]
+	return windowSize, hopSize, nil
+}
+
+// slidingWindowStarts lists the start offset of every window; trailing windows shorter
+// than minWindow samples are dropped.
+func slidingWindowStarts(sampleCount, windowSize, hopSize, minWindow int) []int {
+	var starts []int
+	for start := 0; sampleCount-start >= minWindow; start += hopSize {
+		starts = append(starts, start)
+		if start+windowSize >= sampleCount {
+			break
 		}
-		sum += weight * a[i] * a[i]
 	}
-	for i := minLength; i < len(b); i++ {
-		weight := 1.0
-		if i < len(featureWeights) {
-			weight = featureWeights[i]
+	return starts
+}
+
+// subsampleWindows returns the indices of the windows to analyse: all of them, or
+// maxWindows indices spread evenly from the first window to the last.
+func subsampleWindows(total, maxWindows int) []int {
+	count := total
+	if maxWindows > 0 && total > maxWindows {
+		count = maxWindows
+	}
+
+	indices := make([]int, count)
+	for i := range indices {
+		if count == total || count == 1 {
+			indices[i] = i
+			continue
 		}
-		sum += weight * b[i] * b[i]
+		indices[i] = int(math.Round(float64(i) * float64(total-1) / float64(count-1)))
 	}
+	return indices
+}
 
-	// Penalize comparisons where harmonic features (last harmonicFeatureCount) mismatch zeros
-	zeroFeaturePenalty := 0.0
-	if len(a) >= harmonicFeatureCount && len(b) >= harmonicFeatureCount {
-		for i := 0; i < harmonicFeatureCount; i++ {
-			idxA := len(a) - harmonicFeatureCount + i
-			idxB := len(b) - harmonicFeatureCount + i
-			if idxA >= len(a) || idxB >= len(b) {
-				continue
-			}
-			if (a[idxA] == 0 && b[idxB] != 0) || (a[idxA] != 0 && b[idxB] == 0) {
-				zeroFeaturePenalty += 0.5
-			}
+// nearestPrototypes ranks prototypes by their measured distance to features, skipping
+// the prototype at index skip (-1 keeps them all).
+func nearestPrototypes(features []float64, prototypes []Prototype, skip int, measure distanceMeasure) []distancePair {
+	distances := make([]distancePair, 0, len(prototypes))
+	for i := range prototypes {
+		if i == skip {
+			continue
 		}
+		distance := measure.prototypeDistance(features, prototypes[i])
+		distances = append(distances, distancePair{index: i, distance: distance})
 	}
+	sort.SliceStable(distances, func(i, j int) bool {
+		return distances[i].distance < distances[j].distance
+	})
+	return distances
+}
 
-	return math.Sqrt(sum) + zeroFeaturePenalty
+// neighbourWeight is a neighbour's vote weight: inverse distance, decayed by age.
+func neighbourWeight(distance float64, createdAt time.Time, now time.Time, halfLife time.Duration) float64 {
+	weight := 1.0 / (distance + 1e-9) // Add a small epsilon to avoid division by zero
+	return weight * recencyWeight(createdAt, now, halfLife)
+}
+
+// recencyWeight returns the decay multiplier for a prototype recorded at createdAt.
+func recencyWeight(createdAt time.Time, now time.Time, halfLife time.Duration) float64 {
+	if halfLife <= 0 || createdAt.IsZero() {
+		return 1
+	}
+	age := now.Sub(createdAt)
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
 }
 
 func copyMetadata(meta map[string]string) map[string]string {
@@ -830,23 +1600,82 @@ func derivePredictionType(label, category string, metadata map[string]string) st
 	return label
 }
 
+// IsAmbiguous reports whether the top two labels are closer in confidence than minGap,
+// making the top-1 label effectively a coin flip. A minGap of 0 disables the check.
+func IsAmbiguous(predictions []Prediction, minGap float64) bool {
+	if minGap <= 0 || len(predictions) < 2 {
+		return false
+	}
+	return predictions[0].Confidence-predictions[1].Confidence < minGap
+}
+
+// CategoryConfidences sums prediction confidences by category: noise-category labels
+// count towards noise, every other label (drones and templates) towards drone, matching
+// DetermineDroneLikely. Merged template scores can push a sum past 1, so both are capped.
+func CategoryConfidences(predictions []Prediction) (droneConfidence, noiseConfidence float64) {
+	for _, pred := range predictions {
+		if strings.EqualFold(pred.Category, "noise") {
+			noiseConfidence += pred.Confidence
+		} else {
+			droneConfidence += pred.Confidence
+		}
+	}
+	return math.Min(droneConfidence, 1), math.Min(noiseConfidence, 1)
+}
+
+// TopPredictions returns the n most confident predictions, or all of them when n <= 0.
+// Predictions must already be sorted by confidence.
+func TopPredictions(predictions []Prediction, n int) []Prediction {
+	if n <= 0 || len(predictions) <= n {
+		return predictions
+	}
+	return predictions[:n]
+}
+
 // DetermineDroneLikely interprets the prediction list to understand whether the
 // analysed audio likely corresponds to a drone target.
 // Uses adaptive threshold based on SNR if provided.
 func DetermineDroneLikely(predictions []Prediction, threshold float64) bool {
-	return DetermineDroneLikelyWithSNR(predictions, threshold, 0.0)
+	return DetermineDroneLikelyWithSNR(predictions, threshold, 0.0, 1)
+}
+
+// lowDataThresholdBoost is added to the confidence threshold for models below the
+// minimum prototype count.
+const lowDataThresholdBoost = 0.15
+
+// LowDataThreshold returns the threshold to use for a model holding prototypeCount
+// prototypes. With fewer than minPrototypes a handful of neighbours decide every
+// prediction and confidences run high, so the threshold is raised (up to 0.95) and
+// lowData is set. minPrototypes <= 0 disables the adjustment.
+func LowDataThreshold(baseThreshold float64, prototypeCount int, minPrototypes int) (threshold float64, lowData bool) {
+	if minPrototypes <= 0 || prototypeCount >= minPrototypes {
+		return baseThreshold, false
+	}
+	return math.Max(baseThreshold, math.Min(baseThreshold+lowDataThresholdBoost, 0.95)), true
 }
 
-// DetermineDroneLikelyWithSNR uses SNR-adjusted threshold for better noise handling
-func DetermineDroneLikelyWithSNR(predictions []Prediction, baseThreshold float64, snrDb float64) bool {
+// DetermineDroneLikelyWithSNR uses SNR-adjusted threshold for better noise handling.
+// minSupport is the number of same-label neighbours the top prediction needs, so a
+// single close prototype cannot trigger an alert on its own when k is large. A higher
+// threshold learned for the top label by LearnPerLabelThresholds overrides
+// baseThreshold; a lower one never relaxes it, so low-data and noise-floor adjustments
+// made by the caller still hold.
+func DetermineDroneLikelyWithSNR(predictions []Prediction, baseThreshold float64, snrDb float64, minSupport int) bool {
 	if len(predictions) == 0 {
 		return false
 	}
 
 	best := predictions[0]
-	if strings.EqualFold(best.Category, "noise") {
+	if strings.EqualFold(best.Category, "noise") || best.Label == UnknownLabel {
 		return false
 	}
+	if best.Support < minSupport {
+		return false
+	}
+
+	if learned, ok := learnedThreshold(best); ok {
+		baseThreshold = math.Max(baseThreshold, learned)
+	}
 
 	// Use adaptive threshold if SNR is provided
 	threshold := baseThreshold
@@ -857,8 +1686,19 @@ func DetermineDroneLikelyWithSNR(predictions []Prediction, baseThreshold float64
 	return best.Confidence >= threshold
 }
 
-// cosineSimilarity computes the weighted cosine similarity between two vectors.
-// A higher value indicates greater similarity.
+// cosineDistance is 1 minus the cosine similarity of a and b, always within [0, 2].
+// How much of that range is used depends on the features: vectors with no negative
+// components (PANNS embeddings, which normally come out of a ReLU, and unscaled legacy
+// features) stay within [0, 1], while standardised legacy features are signed and can
+// reach 2 for anti-correlated vectors. Either way neighbourWeight stays finite: 1e9 at
+// distance 0 and 0.5 at distance 2.
+func cosineDistance(a, b, weights []float64) float64 {
+	return 1 - cosineSimilarity(a, b, weights)
+}
+
+// cosineSimilarity computes the weighted cosine similarity between two vectors,
+// clamped to [-1, 1] so rounding never yields a negative distance. A higher value
+// indicates greater similarity.
 func cosineSimilarity(a, b, weights []float64) float64 {
 	var dotProduct, normA, normB float64
 	limit := min(len(a), len(b))
@@ -879,5 +1719,5 @@ func cosineSimilarity(a, b, weights []float64) float64 {
 		return 0.0
 	}
 
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+	return math.Max(-1, math.Min(1, dotProduct/(math.Sqrt(normA)*math.Sqrt(normB))))
 }
@@ -2,11 +2,18 @@ package drone
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestPrototypesJSONStructure(t *testing.T) {
@@ -26,9 +33,10 @@ func TestPrototypesJSONStructure(t *testing.T) {
 		t.Fatalf("no prototypes defined in %s", path)
 	}
 
+	dimension := len(protos[0].Features)
 	for _, proto := range protos {
-		if len(proto.Features) != len(featureWeights) {
-			t.Fatalf("prototype %s has %d features (expected %d)", proto.ID, len(proto.Features), len(featureWeights))
+		if len(proto.Features) != dimension {
+			t.Fatalf("prototype %s has %d features (expected %d)", proto.ID, len(proto.Features), dimension)
 		}
 		norm := vectorNorm(proto.Features)
 		if math.Abs(norm-1.0) > 1e-6 {
@@ -43,7 +51,7 @@ func TestPrototypesJSONStructure(t *testing.T) {
 		pairs := 0
 		for i := 0; i < len(protos); i++ {
 			for j := i + 1; j < len(protos); j++ {
-				sim := cosineSimilarity(protos[i].Features, protos[j].Features, featureWeights)
+				sim := cosineSimilarity(protos[i].Features, protos[j].Features, nil)
 				if sim < minSim {
 					minSim = sim
 				}
@@ -116,8 +124,380 @@ func TestClassifierPredictRespondsToFeatureShift(t *testing.T) {
 	}
 }
 
+func TestClassifierPredictReportsEmptyModel(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier(nil, 3)
+	target := featureVector(map[int]float64{0: 1.0})
+
+	predictions, err := classifier.Predict(target)
+	if !errors.Is(err, ErrEmptyModel) {
+		t.Fatalf("expected ErrEmptyModel, got predictions=%v err=%v", predictions, err)
+	}
+
+	_, _, err = classifier.PredictWithSlidingWindows(make([]float64, 4096), 44100, 0.05, 0)
+	if !errors.Is(err, ErrEmptyModel) {
+		t.Fatalf("expected ErrEmptyModel from sliding windows, got %v", err)
+	}
+}
+
+func TestClassifierRecencyDecayFavoursNewPrototypes(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	old := newSyntheticPrototype("alpha", "alpha_old", map[int]float64{0: 1.0})
+	old.CreatedAt = now.Add(-365 * 24 * time.Hour)
+	recent := newSyntheticPrototype("beta", "beta_recent", map[int]float64{1: 1.0})
+	recent.CreatedAt = now.Add(-24 * time.Hour)
+
+	classifier := newTestClassifier([]Prototype{old, recent}, 2)
+	// Equidistant from both prototypes
+	target := featureVector(map[int]float64{0: 1.0, 1: 1.0})
+
+	predictions, err := classifier.Predict(target)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if math.Abs(predictions[0].Confidence-0.5) > 1e-6 {
+		t.Fatalf("expected a tie without decay, got %s at %.3f", predictions[0].Label, predictions[0].Confidence)
+	}
+
+	classifier.SetRecencyHalfLife(30 * 24 * time.Hour)
+	predictions, err = classifier.Predict(target)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "beta" {
+		t.Fatalf("expected recent beta prototype to win, got %s", predictions[0].Label)
+	}
+	if predictions[0].Confidence < 0.9 {
+		t.Fatalf("expected beta confidence >= 0.9 with decay, got %.3f", predictions[0].Confidence)
+	}
+}
+
+func TestDetermineDroneLikelyRequiresMinimumSupport(t *testing.T) {
+	t.Parallel()
+
+	protos := []Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{10: 1.0}),
+		newSyntheticPrototype("gamma", "gamma_1", map[int]float64{20: 1.0}),
+		newSyntheticPrototype("delta", "delta_1", map[int]float64{30: 1.0}),
+		newSyntheticPrototype("epsilon", "epsilon_1", map[int]float64{40: 1.0}),
+	}
+
+	classifier := newTestClassifier(protos, 5)
+	predictions, err := classifier.Predict(featureVector(map[int]float64{0: 1.0}))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "alpha" || predictions[0].Support != 1 {
+		t.Fatalf("expected alpha with support=1, got %s with support=%d", predictions[0].Label, predictions[0].Support)
+	}
+
+	if !DetermineDroneLikelyWithSNR(predictions, 0.55, 0.0, 1) {
+		t.Fatalf("expected drone verdict with default minimum support, confidence %.3f", predictions[0].Confidence)
+	}
+	if DetermineDroneLikelyWithSNR(predictions, 0.55, 0.0, 3) {
+		t.Fatalf("expected minimum support of 3 to suppress a single-neighbour verdict")
+	}
+}
+
+func TestIsAmbiguousFlagsNearTiedLabels(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{1: 1.0}),
+	}, 2)
+
+	tied, err := classifier.Predict(featureVector(map[int]float64{0: 1.0, 1: 0.98}))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if len(tied) != 2 {
+		t.Fatalf("expected two labels, got %d", len(tied))
+	}
+	if !IsAmbiguous(tied, 0.1) {
+		t.Fatalf("expected near tie (%.3f vs %.3f) to be ambiguous", tied[0].Confidence, tied[1].Confidence)
+	}
+	if IsAmbiguous(tied, 0) {
+		t.Fatalf("expected a zero gap to disable the check")
+	}
+
+	clear, err := classifier.Predict(featureVector(map[int]float64{0: 1.0, 1: 0.2}))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if IsAmbiguous(clear, 0.1) {
+		t.Fatalf("expected a clear winner (%.3f vs %.3f) not to be ambiguous", clear[0].Confidence, clear[1].Confidence)
+	}
+}
+
+func TestPredictWithSlidingWindowsCapsLongClips(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 8000
+	samples := make([]float64, 10*60*sampleRate)
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+	}
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+	}, 1)
+	classifier.SetMaxWindows(20)
+
+	total := classifier.SlidingWindowCount(len(samples), sampleRate, 3.0, 1.5)
+	if total < 300 {
+		t.Fatalf("expected a 10-minute clip to span hundreds of windows, got %d", total)
+	}
+
+	_, windows, err := classifier.PredictWithSlidingWindows(samples, sampleRate, 3.0, 1.5)
+	if err != nil {
+		t.Fatalf("PredictWithSlidingWindows returned error: %v", err)
+	}
+	if len(windows) != 20 {
+		t.Fatalf("expected window count capped at 20, got %d", len(windows))
+	}
+	if windows[0].Start != 0 || windows[len(windows)-1].Index != total-1 {
+		t.Fatalf("expected subsampled windows to span the whole clip, got first=%d last=%d of %d",
+			windows[0].Index, windows[len(windows)-1].Index, total)
+	}
+}
+
+func TestNewClassifierFromDirConcatenatesPerLabelFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile := func(name string, protos ...Prototype) {
+		data, err := json.Marshal(protos)
+		if err != nil {
+			t.Fatalf("failed to marshal prototypes: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	embedding := func(index int) []float64 {
+		features := make([]float64, 2048)
+		features[index] = 1
+		return features
+	}
+
+	writeFile("quad.json",
+		Prototype{ID: "quad_1", Label: "quad", Category: "drone", Features: embedding(0)},
+		Prototype{ID: "quad_2", Label: "quad", Category: "drone", Features: embedding(1)})
+	writeFile("wind.json",
+		Prototype{ID: "wind_1", Label: "wind", Category: "noise", Features: embedding(2)})
+	if err := os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a model"), 0644); err != nil {
+		t.Fatalf("failed to write README: %v", err)
+	}
+
+	classifier, err := NewClassifierFromDir(dir, 3)
+	if err != nil {
+		t.Fatalf("NewClassifierFromDir returned error: %v", err)
+	}
+	stats := classifier.Stats()
+	if stats.PrototypeCount != 3 {
+		t.Fatalf("expected 3 prototypes from both files, got %d", stats.PrototypeCount)
+	}
+	predictions, err := classifier.Predict(embedding(2))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "wind" || predictions[0].Category != "noise" {
+		t.Fatalf("expected the wind file's prototype to match, got %+v", predictions[0])
+	}
+
+	writeFile("short.json", Prototype{ID: "short_1", Label: "short", Features: []float64{1, 0, 0}})
+	if _, err := NewClassifierFromDir(dir, 3); err == nil || !strings.Contains(err.Error(), "short.json") {
+		t.Fatalf("expected a dimension mismatch naming short.json, got %v", err)
+	}
+}
+
+func TestAntiCorrelatedNeighboursKeepFiniteWeights(t *testing.T) {
+	t.Parallel()
+
+	query := featureVector(map[int]float64{0: 0.8, 1: -0.6})
+	opposite := make([]float64, len(query))
+	for i, value := range query {
+		opposite[i] = -value
+	}
+	alpha := newSyntheticPrototype("alpha", "alpha_1", nil)
+	alpha.Features = query
+	beta := newSyntheticPrototype("beta", "beta_1", nil)
+	beta.Features = opposite
+	classifier := newTestClassifier([]Prototype{alpha, beta}, 2)
+
+	predictions, err := classifier.Predict(query)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if len(predictions) != 2 || predictions[0].Label != "alpha" {
+		t.Fatalf("expected alpha ahead of its opposite, got %+v", predictions)
+	}
+	for _, pred := range predictions {
+		weight := pred.TopPrototypes[0].Weight
+		if math.IsInf(weight, 0) || math.IsNaN(weight) || weight <= 0 {
+			t.Fatalf("expected a finite positive weight for %s, got %v", pred.Label, weight)
+		}
+		if pred.AverageDist < 0 || pred.AverageDist > 2 {
+			t.Fatalf("expected %s's distance within [0, 2], got %v", pred.Label, pred.AverageDist)
+		}
+	}
+	if beta := predictions[1]; math.Abs(beta.AverageDist-2) > 1e-9 || beta.Confidence > 1e-6 {
+		t.Fatalf("expected the anti-correlated label at distance 2 with negligible confidence, got %.6f / %.6f",
+			beta.AverageDist, beta.Confidence)
+	}
+
+	// Rounding must not push identical or opposite vectors outside [0, 2]
+	rng := rand.New(rand.NewSource(9))
+	for trial := 0; trial < 1000; trial++ {
+		v := make([]float64, 64)
+		negated := make([]float64, len(v))
+		for i := range v {
+			v[i] = rng.NormFloat64()
+			negated[i] = -v[i]
+		}
+		if d := cosineDistance(v, v, nil); d < 0 {
+			t.Fatalf("trial %d: identical vectors gave negative distance %v", trial, d)
+		}
+		if d := cosineDistance(v, negated, nil); d > 2 {
+			t.Fatalf("trial %d: opposite vectors gave distance %v above 2", trial, d)
+		}
+	}
+}
+
+func TestPredictionMarginReflectsSeparation(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("alpha", "alpha_2", map[int]float64{0: 1.0, 2: 0.2}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{1: 1.0}),
+	}, 3)
+
+	clear, err := classifier.Predict(featureVector(map[int]float64{0: 1.0, 1: 0.05}))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if clear[0].Label != "alpha" || clear[0].Margin < 0.5 {
+		t.Fatalf("expected alpha with a large margin, got %s with %.3f", clear[0].Label, clear[0].Margin)
+	}
+
+	ambiguous, err := classifier.Predict(featureVector(map[int]float64{0: 1.0, 1: 1.0}))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	for _, pred := range ambiguous {
+		if math.Abs(pred.Margin) > 1e-9 {
+			t.Fatalf("expected a near-zero margin for %s midway between labels, got %.3f", pred.Label, pred.Margin)
+		}
+	}
+}
+
+func TestTiedPredictionsAreOrderedByLabel(t *testing.T) {
+	t.Parallel()
+
+	peaks := map[int]float64{0: 1.0, 1: 0.3}
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("charlie", "charlie_1", peaks),
+		newSyntheticPrototype("alpha", "alpha_1", peaks),
+		newSyntheticPrototype("delta", "delta_1", peaks),
+		newSyntheticPrototype("bravo", "bravo_1", peaks),
+	}, 4)
+	want := []string{"alpha", "bravo", "charlie", "delta"}
+
+	const sampleRate = 8000
+	samples := make([]float64, sampleRate*6)
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+	}
+
+	for run := 0; run < 20; run++ {
+		predictions, err := classifier.Predict(featureVector(map[int]float64{0: 1.0}))
+		if err != nil {
+			t.Fatalf("Predict returned error: %v", err)
+		}
+		if got := predictionLabels(predictions); !slices.Equal(got, want) {
+			t.Fatalf("run %d: expected Predict order %v, got %v", run, want, got)
+		}
+
+		predictions, _, err = classifier.PredictWithSlidingWindows(samples, sampleRate, 3.0, 1.5)
+		if err != nil {
+			t.Fatalf("PredictWithSlidingWindows returned error: %v", err)
+		}
+		if got := predictionLabels(predictions); !slices.Equal(got, want) {
+			t.Fatalf("run %d: expected sliding-window order %v, got %v", run, want, got)
+		}
+	}
+}
+
+func predictionLabels(predictions []Prediction) []string {
+	labels := make([]string, len(predictions))
+	for i, pred := range predictions {
+		labels[i] = pred.Label
+	}
+	return labels
+}
+
+func TestTopKNeighborsMatchesAggregatedNeighbours(t *testing.T) {
+	t.Parallel()
+
+	const k = 3
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0, 1: 0.1}),
+		newSyntheticPrototype("alpha", "alpha_2", map[int]float64{0: 1.0, 2: 0.4}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{0: 0.6, 3: 0.8}),
+		newSyntheticPrototype("beta", "beta_2", map[int]float64{3: 1.0}),
+		newSyntheticPrototype("gamma", "gamma_1", map[int]float64{4: 1.0}),
+	}, k)
+	query := featureVector(map[int]float64{0: 1.0, 3: 0.3})
+
+	neighbors := classifier.TopKNeighbors(query, 0)
+	if len(neighbors) != 5 {
+		t.Fatalf("expected every prototype to be ranked, got %d", len(neighbors))
+	}
+	for i, neighbor := range neighbors {
+		if neighbor.Rank != i+1 {
+			t.Fatalf("expected rank %d at position %d, got %d", i+1, i, neighbor.Rank)
+		}
+		if i > 0 && neighbor.Distance < neighbors[i-1].Distance {
+			t.Fatalf("neighbours not sorted: %.4f after %.4f", neighbor.Distance, neighbors[i-1].Distance)
+		}
+		if neighbor.InTopK != (i < k) {
+			t.Fatalf("neighbour %d InTopK=%v with k=%d", i, neighbor.InTopK, k)
+		}
+	}
+
+	predictions, err := classifier.Predict(query)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	var voted []string
+	for _, pred := range predictions {
+		for _, proto := range pred.TopPrototypes {
+			voted = append(voted, proto.ID)
+		}
+	}
+	var ranked []string
+	for _, neighbor := range neighbors[:k] {
+		ranked = append(ranked, neighbor.ID)
+	}
+	sort.Strings(voted)
+	sort.Strings(ranked)
+	if len(voted) != k || !slices.Equal(voted, ranked) {
+		t.Fatalf("expected top-%d neighbours %v to match aggregated prototypes %v", k, ranked, voted)
+	}
+
+	if wider := classifier.TopKNeighbors(query, 4); !wider[3].InTopK || wider[4].InTopK {
+		t.Fatalf("expected explicit k=4 to move the boundary")
+	}
+}
+
 func featureVector(peaks map[int]float64) []float64 {
-	vec := make([]float64, len(featureWeights))
+	vec := make([]float64, pannsEmbeddingDimension)
 	for idx, value := range peaks {
 		if idx >= len(vec) {
 			continue
@@ -172,3 +552,472 @@ func vectorNorm(values []float64) float64 {
 	}
 	return math.Sqrt(sum)
 }
+
+func TestLowDataThresholdIsStricterForThinModels(t *testing.T) {
+	t.Parallel()
+
+	thin := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("alpha", "alpha_2", map[int]float64{0: 1.0, 1: 0.1}),
+		newSyntheticPrototype("noise", "noise_1", map[int]float64{40: 1.0}),
+	}, 3)
+	var protos []Prototype
+	for i := 0; i < 12; i++ {
+		protos = append(protos, newSyntheticPrototype("alpha", fmt.Sprintf("alpha_%d", i), map[int]float64{0: 1.0, i + 1: 0.1}))
+	}
+	large := newTestClassifier(protos, 3)
+
+	// The same moderately confident prediction from each model
+	predictions := []Prediction{{Label: "alpha", Category: "drone", Confidence: 0.65, Support: 2}}
+
+	threshold, lowData := LowDataThreshold(0.55, thin.Stats().PrototypeCount, 10)
+	if !lowData || threshold <= 0.55 {
+		t.Fatalf("expected a raised threshold for a 3-prototype model, got %.2f (lowData=%v)", threshold, lowData)
+	}
+	if DetermineDroneLikelyWithSNR(predictions, threshold, 0.0, 1) {
+		t.Fatalf("expected the thin model to withhold a 0.65 verdict at threshold %.2f", threshold)
+	}
+
+	threshold, lowData = LowDataThreshold(0.55, large.Stats().PrototypeCount, 10)
+	if lowData || threshold != 0.55 {
+		t.Fatalf("expected the base threshold for a 12-prototype model, got %.2f (lowData=%v)", threshold, lowData)
+	}
+	if !DetermineDroneLikelyWithSNR(predictions, threshold, 0.0, 1) {
+		t.Fatalf("expected the large model to report a 0.65 verdict")
+	}
+
+	if threshold, lowData := LowDataThreshold(0.55, 3, 0); lowData || threshold != 0.55 {
+		t.Fatalf("expected minPrototypes=0 to disable the adjustment")
+	}
+}
+
+func TestFingerprintIsStableAcrossReloadsAndTracksPrototypes(t *testing.T) {
+	t.Parallel()
+
+	embedding := func(index int) []float64 {
+		features := make([]float64, 2048)
+		features[index] = 1
+		return features
+	}
+	path := filepath.Join(t.TempDir(), "prototypes.json")
+	data, err := json.Marshal([]Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: embedding(0)},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: embedding(1)},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal prototypes: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+
+	load := func() *Classifier {
+		classifier, err := NewClassifierFromFile(path, 3)
+		if err != nil {
+			t.Fatalf("NewClassifierFromFile returned error: %v", err)
+		}
+		return classifier
+	}
+	first, second := load(), load()
+	fingerprint := first.Fingerprint()
+	if fingerprint == "" || second.Fingerprint() != fingerprint {
+		t.Fatalf("expected a stable fingerprint across reloads, got %q and %q", fingerprint, second.Fingerprint())
+	}
+
+	if _, err := second.AddPrototype(Prototype{ID: "quad_2", Label: "quad", Category: "drone", Features: embedding(2)}); err != nil {
+		t.Fatalf("AddPrototype returned error: %v", err)
+	}
+	if second.Fingerprint() == fingerprint {
+		t.Fatal("expected the fingerprint to change when a prototype is added")
+	}
+}
+
+func TestFeatureWeightsMatchLoadedModelDimension(t *testing.T) {
+	t.Parallel()
+
+	const dimension = 19
+	vector := func(index int) []float64 {
+		features := make([]float64, dimension)
+		for i := range features {
+			features[i] = 0.1
+		}
+		features[index] = 1
+		return features
+	}
+	path := filepath.Join(t.TempDir(), "prototypes.json")
+	data, err := json.Marshal([]Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: vector(0)},
+		{ID: "quad_2", Label: "quad", Category: "drone", Features: vector(1)},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: vector(10)},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal prototypes: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+
+	classifier, err := NewClassifierFromFile(path, 3)
+	if err != nil {
+		t.Fatalf("NewClassifierFromFile returned error: %v", err)
+	}
+	if weights := classifier.featureWeights(); len(weights) != dimension {
+		t.Fatalf("expected %d feature weights, got %d", dimension, len(weights))
+	}
+
+	if _, err := classifier.AddPrototype(Prototype{ID: "quad_3", Label: "quad", Features: make([]float64, 2048)}); err == nil {
+		t.Fatal("expected AddPrototype to reject a prototype of a different dimension")
+	}
+}
+
+func TestRemovePrototypeKeepsScaler(t *testing.T) {
+	t.Parallel()
+
+	const dimension = 19
+	vector := func(index int) []float64 {
+		features := make([]float64, dimension)
+		for i := range features {
+			features[i] = 0.1
+		}
+		features[index] = 1
+		return features
+	}
+	path := filepath.Join(t.TempDir(), "prototypes.json")
+	if err := WritePrototypes(path, []Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: vector(0)},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: vector(10)},
+	}); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := NewClassifierFromFile(path, 3)
+	if err != nil {
+		t.Fatalf("NewClassifierFromFile returned error: %v", err)
+	}
+	scaler := classifier.featureScaler
+
+	if _, err := classifier.AddPrototype(Prototype{ID: "bad_1", Label: "bad", Category: "drone",
+		Features: vector(5), Metadata: map[string]string{"model": "wrong"}}); err != nil {
+		t.Fatalf("AddPrototype returned error: %v", err)
+	}
+	if count := classifier.Stats().PrototypeCount; count != 3 {
+		t.Fatalf("expected 3 prototypes after adding, got %d", count)
+	}
+
+	removed, err := classifier.RemovePrototype("bad_1")
+	if err != nil || !removed {
+		t.Fatalf("expected bad_1 to be removed, got %v, %v", removed, err)
+	}
+	stats := classifier.Stats()
+	if stats.PrototypeCount != 2 || stats.LabelCount != 2 {
+		t.Fatalf("expected 2 prototypes over 2 labels after removing, got %+v", stats)
+	}
+	if classifier.featureScaler != scaler {
+		t.Fatal("expected removing a prototype to keep the feature scaler")
+	}
+	if _, ok := classifier.labelMetadata["bad"]; ok {
+		t.Fatal("expected the removed label's metadata to go with its last prototype")
+	}
+
+	if removed, err := classifier.RemovePrototype("bad_1"); err != nil || removed {
+		t.Fatalf("expected removing an unknown ID to report false, got %v, %v", removed, err)
+	}
+	if _, err := classifier.RemovePrototype(""); err == nil {
+		t.Fatal("expected an empty ID to be rejected")
+	}
+
+	// An empty model may next receive either feature layout, so the scaler goes with it
+	for _, id := range []string{"quad_1", "wind_1"} {
+		if _, err := classifier.RemovePrototype(id); err != nil {
+			t.Fatalf("RemovePrototype(%s) returned error: %v", id, err)
+		}
+	}
+	if classifier.featureScaler != nil || classifier.FeatureDimension() != 0 {
+		t.Fatal("expected the scaler to be dropped with the last prototype")
+	}
+	if _, err := classifier.AddPrototype(Prototype{ID: "panns_1", Label: "quad", Features: make([]float64, 2048)}); err != nil {
+		t.Fatalf("expected an emptied model to accept another dimension, got %v", err)
+	}
+}
+
+func TestDistanceMetricsRankSyntheticPrototypes(t *testing.T) {
+	t.Parallel()
+
+	protos := []Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{1: 1.0}),
+		newSyntheticPrototype("gamma", "gamma_1", map[int]float64{2: 1.0}),
+	}
+	query := featureVector(map[int]float64{0: 0.6, 1: 0.8})
+
+	// Dimension 0 barely varies across the training set, so Mahalanobis weighs a
+	// mismatch there far above one in dimension 1.
+	stddev := make([]float64, pannsEmbeddingDimension)
+	for i := range stddev {
+		stddev[i] = 1
+	}
+	stddev[0] = 0.1
+
+	ranking := func(metric DistanceMetric) []string {
+		classifier := newTestClassifier(protos, 1)
+		classifier.featureScaler = &FeatureScaler{Mean: make([]float64, pannsEmbeddingDimension), Stddev: stddev}
+		classifier.SetDistanceMetric(metric)
+		var ids []string
+		for _, neighbor := range classifier.TopKNeighbors(query, 0) {
+			ids = append(ids, neighbor.ID)
+		}
+		return ids
+	}
+
+	cosine := ranking(MetricCosine)
+	if want := []string{"beta_1", "alpha_1", "gamma_1"}; !slices.Equal(cosine, want) {
+		t.Fatalf("expected cosine ranking %v, got %v", want, cosine)
+	}
+	if euclidean := ranking(MetricEuclidean); !slices.Equal(euclidean, cosine) {
+		t.Fatalf("expected euclidean to rank unit vectors like cosine %v, got %v", cosine, euclidean)
+	}
+	if mahalanobis := ranking(MetricMahalanobis); !slices.Equal(mahalanobis, []string{"alpha_1", "beta_1", "gamma_1"}) {
+		t.Fatalf("expected mahalanobis to favour the low-variance dimension, got %v", mahalanobis)
+	}
+
+	if _, err := ParseDistanceMetric("manhattan"); err == nil {
+		t.Fatal("expected an unknown metric to be rejected")
+	}
+}
+
+func TestHarmonicMismatchPenaltyDemotesZeroedHarmonics(t *testing.T) {
+	t.Parallel()
+
+	const dimension = 19
+	legacyVector := func(zeroed ...int) []float64 {
+		features := make([]float64, dimension)
+		for i := range features {
+			features[i] = 1
+		}
+		for _, i := range zeroed {
+			features[i] = 0
+		}
+		return features
+	}
+	harmonics := []int{dimension - 3, dimension - 2, dimension - 1}
+
+	// The legacy prototype is nearer the query but predates the harmonic features
+	legacy := Prototype{ID: "legacy_1", Label: "legacy", Category: "drone", Features: legacyVector(harmonics...)}
+	current := Prototype{ID: "current_1", Label: "current", Category: "drone", Features: legacyVector(0, 1, 2, 3)}
+	legacy.raw, current.raw = legacy.Features, current.Features
+	query := legacyVector()
+
+	topLabel := func(penalty float64) string {
+		classifier := newTestClassifier([]Prototype{legacy, current}, 1)
+		classifier.SetHarmonicMismatchPenalty(penalty)
+		predictions, err := classifier.Predict(query)
+		if err != nil {
+			t.Fatalf("Predict returned error: %v", err)
+		}
+		return predictions[0].Label
+	}
+
+	if label := topLabel(0); label != "legacy" {
+		t.Fatalf("expected the nearer legacy prototype to win without a penalty, got %q", label)
+	}
+	if label := topLabel(0.5); label != "current" {
+		t.Fatalf("expected the harmonic penalty to demote the legacy prototype, got %q", label)
+	}
+
+	classifier := newTestClassifier([]Prototype{legacy, current}, 1)
+	classifier.SetHarmonicMismatchPenalty(0.5)
+	classifier.SetDistanceMetric(MetricEuclidean)
+	if neighbors := classifier.TopKNeighbors(query, 0); neighbors[0].ID != "current_1" {
+		t.Fatalf("expected the penalty to apply under the euclidean metric too, got %s first", neighbors[0].ID)
+	}
+}
+
+func TestMaxAcceptDistanceRejectsOrthogonalInput(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{1: 1.0}),
+	}, 2)
+	orthogonal := featureVector(map[int]float64{5: 1.0})
+
+	predictions, err := classifier.Predict(orthogonal)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label == UnknownLabel {
+		t.Fatal("expected no rejection without a maximum accept distance")
+	}
+
+	classifier.SetMaxAcceptDistance(0.5)
+	predictions, err = classifier.Predict(orthogonal)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	unknown := predictions[0]
+	if unknown.Label != UnknownLabel || unknown.Category != UnknownCategory || len(predictions) != 3 {
+		t.Fatalf("expected unknown ahead of both known labels, got %+v", predictions)
+	}
+	// Cosine distance 1 against a threshold of 0.5
+	if math.Abs(unknown.Confidence-0.5) > 1e-9 {
+		t.Fatalf("expected confidence 0.5 for a query twice the accept distance away, got %f", unknown.Confidence)
+	}
+	if DetermineDroneLikely(predictions, 0) {
+		t.Fatal("expected an unknown prediction never to count as a drone")
+	}
+
+	predictions, err = classifier.Predict(featureVector(map[int]float64{0: 1.0, 1: 0.1}))
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "alpha" {
+		t.Fatalf("expected an in-distribution query to keep its label, got %q", predictions[0].Label)
+	}
+}
+
+func TestConfidenceStrategiesStayWithinUnitRange(t *testing.T) {
+	t.Parallel()
+
+	protos := []Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("alpha", "alpha_2", map[int]float64{0: 0.8, 1: 0.6}),
+		newSyntheticPrototype("beta", "beta_1", map[int]float64{1: 1.0}),
+		newSyntheticPrototype("beta", "beta_2", map[int]float64{1: 0.8, 2: 0.6}),
+	}
+	query := featureVector(map[int]float64{0: 0.8, 1: 0.6})
+
+	predict := func(strategy ConfidenceStrategy, temperature float64) []Prediction {
+		classifier := newTestClassifier(protos, 4)
+		classifier.SetConfidenceStrategy(strategy, temperature)
+		predictions, err := classifier.Predict(query)
+		if err != nil {
+			t.Fatalf("Predict returned error: %v", err)
+		}
+		return predictions
+	}
+
+	for _, strategy := range []ConfidenceStrategy{ConfidenceWeightShare, ConfidenceSoftmaxOverDistances, ConfidenceNearestSimilarity} {
+		predictions := predict(strategy, 0)
+		if len(predictions) != 2 || predictions[0].Label != "alpha" {
+			t.Fatalf("%s: expected alpha then beta, got %+v", strategy, predictions)
+		}
+		for _, prediction := range predictions {
+			if prediction.Confidence < 0 || prediction.Confidence > 1 {
+				t.Fatalf("%s: confidence %v for %s outside [0, 1]", strategy, prediction.Confidence, prediction.Label)
+			}
+		}
+	}
+
+	// A hotter softmax spreads the vote, so the winner's share drops towards 1/labels.
+	sharp := predict(ConfidenceSoftmaxOverDistances, 0.05)[0].Confidence
+	flat := predict(ConfidenceSoftmaxOverDistances, 5)[0].Confidence
+	if !(sharp > flat && flat > 0.5) {
+		t.Fatalf("expected temperature 0.05 (%v) to be more confident than 5 (%v), both above 0.5", sharp, flat)
+	}
+}
+
+func TestBalancedVotingLetsCloserMinorityLabelWin(t *testing.T) {
+	t.Parallel()
+
+	// Ten drone prototypes at cosine distance 0.5 from the query and one noise
+	// prototype at 0.1: the unbalanced vote is 20 to 10 for drone.
+	protos := []Prototype{newSyntheticPrototype("wind", "wind_1", map[int]float64{0: 0.9, 1: math.Sqrt(1 - 0.81)})}
+	protos[0].Category = "noise"
+	for i := 0; i < 10; i++ {
+		protos = append(protos, newSyntheticPrototype("quad", fmt.Sprintf("quad_%d", i), map[int]float64{0: 0.5, i + 2: math.Sqrt(0.75)}))
+	}
+	query := featureVector(map[int]float64{0: 1.0})
+
+	predict := func(balanced bool) []Prediction {
+		classifier := newTestClassifier(protos, len(protos))
+		classifier.SetBalancedVoting(balanced)
+		predictions, err := classifier.Predict(query)
+		if err != nil {
+			t.Fatalf("Predict returned error: %v", err)
+		}
+		total := 0.0
+		for _, prediction := range predictions {
+			total += prediction.Confidence
+		}
+		if math.Abs(total-1) > 1e-9 {
+			t.Fatalf("balanced=%v: expected confidences to sum to 1, got %v", balanced, total)
+		}
+		return predictions
+	}
+
+	if top := predict(false)[0]; top.Label != "quad" {
+		t.Fatalf("expected the majority label to win an unbalanced vote, got %s", top.Label)
+	}
+	if top := predict(true)[0]; top.Label != "wind" || top.Support != 1 {
+		t.Fatalf("expected the closer minority label to win a balanced vote, got %+v", top)
+	}
+}
+
+func TestMinWindowScalesWithSampleRate(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("alpha", "alpha_1", map[int]float64{0: 1.0}),
+	}, 1)
+
+	for _, sampleRate := range []int{8000, 16000, 44100, 48000} {
+		want := int(math.Ceil(DefaultMinWindowSeconds * float64(sampleRate)))
+		if got := MinWindowSamples(sampleRate, 0); got != want {
+			t.Fatalf("%d Hz: expected a %d-sample minimum window, got %d", sampleRate, want, got)
+		}
+
+		// A window request below the minimum is widened to it
+		samples := make([]float64, sampleRate)
+		_, windows, err := classifier.PredictWithSlidingWindows(samples, sampleRate, 0.01, 0)
+		if err != nil {
+			t.Fatalf("%d Hz: PredictWithSlidingWindows returned error: %v", sampleRate, err)
+		}
+		if span := windows[0].End - windows[0].Start; span < DefaultMinWindowSeconds-1e-9 {
+			t.Fatalf("%d Hz: expected windows of at least %.2fs, got %.4fs", sampleRate, DefaultMinWindowSeconds, span)
+		}
+
+		short := make([]float64, want-1)
+		if _, _, err := classifier.PredictWithSlidingWindows(short, sampleRate, 3.0, 1.5); !errors.Is(err, ErrClipTooShort) {
+			t.Fatalf("%d Hz: expected ErrClipTooShort for %d samples, got %v", sampleRate, len(short), err)
+		}
+	}
+
+	classifier.SetMinWindowSeconds(0.5)
+	if got := classifier.SlidingWindowCount(44100/4, 44100, 3.0, 0); got != 0 {
+		t.Fatalf("expected no windows for a clip shorter than a configured 0.5s minimum, got %d", got)
+	}
+}
+
+func TestPredictExcludingSkipsListedPrototypes(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("quad", "quad_1", map[int]float64{0: 1.0}),
+		newSyntheticPrototype("quad", "quad_2", map[int]float64{0: 0.2, 1: 1.0}),
+		newSyntheticPrototype("wind", "wind_1", map[int]float64{0: 1.0, 2: 0.4}),
+	}, 1)
+	query := featureVector(map[int]float64{0: 1.0})
+
+	predictions, err := classifier.Predict(query)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "quad" || predictions[0].TopPrototypes[0].ID != "quad_1" {
+		t.Fatalf("expected the exact quad_1 match to win, got %+v", predictions[0])
+	}
+
+	// Without its nearest prototype the query falls to the next closest, a different label
+	predictions, err = classifier.PredictExcluding(query, []string{"quad_1", "unknown"})
+	if err != nil {
+		t.Fatalf("PredictExcluding returned error: %v", err)
+	}
+	if predictions[0].Label != "wind" || predictions[0].TopPrototypes[0].ID != "wind_1" {
+		t.Fatalf("expected wind_1 once quad_1 is excluded, got %+v", predictions[0])
+	}
+	if got := classifier.Stats().PrototypeCount; got != 3 {
+		t.Fatalf("expected exclusion to leave the model untouched, got %d prototypes", got)
+	}
+
+	if _, err := classifier.PredictExcluding(query, []string{"quad_1", "quad_2", "wind_1"}); !errors.Is(err, ErrEmptyModel) {
+		t.Fatalf("expected ErrEmptyModel with every prototype excluded, got %v", err)
+	}
+}
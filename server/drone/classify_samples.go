@@ -0,0 +1,140 @@
+package drone
+
+// In-Process Classification
+//
+// ClassifySamples lets Go programs that already hold decoded PCM classify it without
+// writing a WAV file. It follows the HTTP handler: quality and SNR are measured on
+// the raw samples, the audio is preprocessed, legacy features are extracted, long
+// clips go through sliding-window analysis, and the drone decision uses the same
+// environment-driven threshold, minimum support and ambiguity settings. Templates,
+// noise-floor tracking and site calibrations belong to the server and are not applied.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"song-recognition/utils"
+)
+
+const (
+	librarySlidingWindowDurationSeconds  = 3.0
+	librarySlidingWindowOverlapSeconds   = 1.5
+	libraryMinSlidingAnalysisDurationSec = 4.0
+)
+
+// ClassifySamples preprocesses mono samples recorded at sampleRate with cfg, extracts
+// legacy features and classifies them. The model's prototypes must be legacy features
+// too. An empty model yields ErrEmptyModel together with a summary whose ModelEmpty is
+// set.
+func (c *Classifier) ClassifySamples(samples []float64, sampleRate int, cfg PreprocessingConfig) (ClassificationSummary, error) {
+	started := time.Now()
+	if len(samples) == 0 {
+		return ClassificationSummary{}, errors.New("no samples to classify")
+	}
+	if sampleRate <= 0 {
+		return ClassificationSummary{}, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+
+	quality := AssessAudioQuality(samples, sampleRate)
+	snrDb := cfg.EstimateSNR(samples, sampleRate)
+	duration := float64(len(samples)) / float64(sampleRate)
+	processed := PreprocessAudio(samples, sampleRate, cfg)
+
+	features, err := ExtractFeatureVectorWithConfig(processed, sampleRate, DefaultFeatureConfig())
+	if err != nil {
+		return ClassificationSummary{}, fmt.Errorf("failed to extract features: %w", err)
+	}
+	// Distances between vectors of different lengths are meaningless; PANNS models need
+	// the embedding service and cannot be used here
+	if dim := c.FeatureDimension(); dim != 0 && dim != len(features) {
+		return ClassificationSummary{}, fmt.Errorf("model expects %d features but legacy extraction produced %d", dim, len(features))
+	}
+
+	var predictions []Prediction
+	var windows []WindowPrediction
+	var windowCount int
+	if duration >= libraryMinSlidingAnalysisDurationSec {
+		windowPredictions, windowSummaries, err := c.PredictWithSlidingWindows(processed, sampleRate,
+			librarySlidingWindowDurationSeconds, librarySlidingWindowOverlapSeconds)
+		if err == nil && len(windowPredictions) > 0 {
+			predictions = windowPredictions
+			windows = windowSummaries
+			windowCount = c.SlidingWindowCount(len(processed), sampleRate,
+				librarySlidingWindowDurationSeconds, librarySlidingWindowOverlapSeconds)
+		}
+	}
+	if len(predictions) == 0 {
+		predictions, err = c.Predict(features)
+		if errors.Is(err, ErrEmptyModel) {
+			return ClassificationSummary{
+				Predictions: []Prediction{},
+				LatencyMs:   time.Since(started).Seconds() * 1000,
+				ModelEmpty:  true,
+				Code:        CodeModelEmpty,
+				Reason:      ReasonEmptyModel,
+			}, err
+		}
+		if err != nil {
+			return ClassificationSummary{}, fmt.Errorf("failed to classify samples: %w", err)
+		}
+	}
+
+	baseThreshold, err := strconv.ParseFloat(utils.GetEnv("DRONE_CONFIDENCE_THRESHOLD", "0.55"), 64)
+	if err != nil {
+		baseThreshold = 0.55
+	}
+	minPrototypes, err := strconv.Atoi(utils.GetEnv("DRONE_MIN_PROTOTYPES", "10"))
+	if err != nil {
+		minPrototypes = 10
+	}
+	baseThreshold, lowDataMode := LowDataThreshold(baseThreshold, c.Stats().PrototypeCount, minPrototypes)
+
+	adjustedThreshold := baseThreshold
+	if snrDb != 0.0 {
+		adjustedThreshold = AdaptiveThreshold(baseThreshold, snrDb)
+	}
+
+	minSupport, err := strconv.Atoi(utils.GetEnv("DRONE_MIN_SUPPORT", "1"))
+	if err != nil || minSupport < 1 {
+		minSupport = 1
+	}
+	isDrone := DetermineDroneLikelyWithSNR(predictions, baseThreshold, snrDb, minSupport)
+
+	minGap, err := strconv.ParseFloat(utils.GetEnv("DRONE_MIN_CONFIDENCE_GAP", "0"), 64)
+	if err != nil {
+		minGap = 0
+	}
+	ambiguous := IsAmbiguous(predictions, minGap)
+	if ambiguous && isDrone && utils.GetEnv("DRONE_AMBIGUOUS_WITHHOLD", "false") == "true" {
+		isDrone = false
+	}
+
+	droneConfidence, noiseConfidence := CategoryConfidences(predictions)
+	droneConfidence = c.CalibrateDroneConfidence(droneConfidence)
+	summary := ClassificationSummary{
+		Predictions:        predictions,
+		IsDrone:            isDrone,
+		Ambiguous:          ambiguous,
+		DroneConfidence:    droneConfidence,
+		NoiseConfidence:    noiseConfidence,
+		LowDataMode:        lowDataMode,
+		LatencyMs:          time.Since(started).Seconds() * 1000,
+		FeatureVector:      features,
+		SNRDb:              snrDb,
+		AdjustedThreshold:  adjustedThreshold,
+		Quality:            &quality,
+		AnalyzedSampleRate: sampleRate,
+		AnalyzedChannels:   1,
+		Windows:            windows,
+		WindowCount:        windowCount,
+		WindowsSubsampled:  windowCount > len(windows),
+		ModelFingerprint:   c.Fingerprint(),
+	}
+	if len(predictions) > 0 {
+		summary.PrimaryType = predictions[0].Type
+	}
+	summary.ExplainOutcome()
+	return summary, nil
+}
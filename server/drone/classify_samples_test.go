@@ -0,0 +1,105 @@
+package drone
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestClassifySamplesRecognisesSynthesizedDrone(t *testing.T) {
+	t.Setenv("DRONE_MIN_PROTOTYPES", "0")
+
+	const sampleRate = 16000
+	rng := rand.New(rand.NewSource(5))
+	cfg := DefaultPreprocessingConfig()
+
+	var protos []Prototype
+	for i := 0; i < 4; i++ {
+		hum := preprocessedFeatures(t, droneHum(sampleRate, 1, 170+10*float64(i), rng), sampleRate, cfg)
+		quad := newSyntheticPrototype("quad", fmt.Sprintf("quad_%d", i), nil)
+		quad.Features = hum
+		protos = append(protos, quad)
+
+		hiss := preprocessedFeatures(t, whiteNoise(sampleRate, 1, rng), sampleRate, cfg)
+		wind := newSyntheticPrototype("wind", fmt.Sprintf("wind_%d", i), nil)
+		wind.Category = "noise"
+		wind.Features = hiss
+		protos = append(protos, wind)
+	}
+	classifier := newTestClassifier(protos, 3)
+
+	summary, err := classifier.ClassifySamples(droneHum(sampleRate, 6, 185, rng), sampleRate, cfg)
+	if err != nil {
+		t.Fatalf("ClassifySamples returned error: %v", err)
+	}
+	if len(summary.Predictions) == 0 || summary.Predictions[0].Label != "quad" {
+		t.Fatalf("expected quad as the top prediction, got %+v", summary.Predictions)
+	}
+	if summary.DroneConfidence <= summary.NoiseConfidence {
+		t.Fatalf("expected drone confidence above noise, got %.3f vs %.3f", summary.DroneConfidence, summary.NoiseConfidence)
+	}
+	if summary.WindowCount == 0 || len(summary.Windows) == 0 {
+		t.Fatalf("expected a 6 s clip to use sliding windows, got %d windows", summary.WindowCount)
+	}
+	if summary.Quality == nil || !summary.Quality.Usable {
+		t.Fatalf("expected a usable quality report, got %+v", summary.Quality)
+	}
+	if summary.AnalyzedSampleRate != sampleRate || len(summary.FeatureVector) != DefaultFeatureConfig().Dimension() {
+		t.Fatalf("unexpected analysis metadata: rate=%d features=%d", summary.AnalyzedSampleRate, len(summary.FeatureVector))
+	}
+}
+
+func TestClassifySamplesRejectsUnusableInput(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier(nil, 3)
+	summary, err := classifier.ClassifySamples(whiteNoise(8000, 1, rand.New(rand.NewSource(1))), 8000, DefaultPreprocessingConfig())
+	if !errors.Is(err, ErrEmptyModel) {
+		t.Fatalf("expected ErrEmptyModel, got %v", err)
+	}
+	if !summary.ModelEmpty {
+		t.Fatalf("expected ModelEmpty in the summary")
+	}
+
+	if _, err := classifier.ClassifySamples(nil, 8000, DefaultPreprocessingConfig()); err == nil {
+		t.Fatalf("expected an error for empty samples")
+	}
+
+	embeddings := newTestClassifier([]Prototype{newSyntheticPrototype("quad", "quad_1", map[int]float64{0: 1.0})}, 1)
+	embeddings.prototypes[0].Features = make([]float64, pannsEmbeddingDimension)
+	if _, err := embeddings.ClassifySamples(whiteNoise(8000, 1, rand.New(rand.NewSource(2))), 8000, DefaultPreprocessingConfig()); err == nil {
+		t.Fatalf("expected an error for a model with embedding-sized prototypes")
+	}
+}
+
+// droneHum synthesizes a rotor-like tone: a fundamental with decaying harmonics.
+func droneHum(sampleRate int, seconds int, fundamental float64, rng *rand.Rand) []float64 {
+	samples := make([]float64, seconds*sampleRate)
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		for h := 1; h <= 5; h++ {
+			samples[i] += 0.3 / float64(h) * math.Sin(2*math.Pi*fundamental*float64(h)*t)
+		}
+		samples[i] += 0.02 * (rng.Float64()*2 - 1)
+	}
+	return samples
+}
+
+func whiteNoise(sampleRate int, seconds int, rng *rand.Rand) []float64 {
+	samples := make([]float64, seconds*sampleRate)
+	for i := range samples {
+		samples[i] = 0.3 * (rng.Float64()*2 - 1)
+	}
+	return samples
+}
+
+func preprocessedFeatures(t *testing.T, samples []float64, sampleRate int, cfg PreprocessingConfig) []float64 {
+	t.Helper()
+	features, err := ExtractFeatureVector(PreprocessAudio(samples, sampleRate, cfg), sampleRate)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVector returned error: %v", err)
+	}
+	return features
+}
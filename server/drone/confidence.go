@@ -0,0 +1,104 @@
+package drone
+
+// Confidence Strategies
+//
+// A prediction's confidence maps the k voting neighbours' distances to a score in
+// [0, 1]. WeightShare, the default, is each label's share of the inverse-distance vote.
+// Because a neighbour at distance ~0 carries a weight of ~1e9, one exact match drowns
+// out the rest. SoftmaxOverDistances spreads the vote as exp(-distance/temperature),
+// where a lower temperature sharpens it towards the nearest neighbour. NearestSimilarity
+// ignores the other labels and reports 1 - distance to the label's nearest prototype,
+// which for the cosine metric is the cosine similarity. Recency decay applies to both
+// vote-based strategies.
+//
+// Balanced voting divides every neighbour's vote by the square root of its label's
+// prototype count, so a label with 40 prototypes does not outvote a closer label with 3
+// just by filling more of the k slots. Label sizes come from the prototypes being voted
+// over, so a leave-one-out vote does not count the held-out prototype.
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ConfidenceStrategy selects how neighbour distances become prediction confidences.
+type ConfidenceStrategy string
+
+const (
+	ConfidenceWeightShare          ConfidenceStrategy = "weight_share"       // share of the inverse-distance vote, the default
+	ConfidenceSoftmaxOverDistances ConfidenceStrategy = "softmax"            // share of a softmax over negative distances
+	ConfidenceNearestSimilarity    ConfidenceStrategy = "nearest_similarity" // 1 - distance to the label's nearest prototype
+)
+
+// DefaultSoftmaxTemperature suits cosine distances, which mostly fall within [0, 1].
+const DefaultSoftmaxTemperature = 0.1
+
+// ParseConfidenceStrategy maps a configuration value to a ConfidenceStrategy; empty
+// means weight share.
+func ParseConfidenceStrategy(value string) (ConfidenceStrategy, error) {
+	switch strategy := ConfidenceStrategy(strings.ToLower(strings.TrimSpace(value))); strategy {
+	case "":
+		return ConfidenceWeightShare, nil
+	case ConfidenceWeightShare, ConfidenceSoftmaxOverDistances, ConfidenceNearestSimilarity:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown confidence strategy %q (expected weight_share, softmax or nearest_similarity)", value)
+	}
+}
+
+// confidenceMapping is a strategy together with its softmax temperature, whether votes
+// are balanced by label size, and the blend predictions are ranked by.
+type confidenceMapping struct {
+	strategy    ConfidenceStrategy
+	temperature float64
+	balanced    bool
+	ranking     RankingBlend
+}
+
+// labelShares returns each label's balanced-vote multiplier, 1/sqrt(prototype count),
+// leaving out the prototype at index skip. It returns nil when voting is unbalanced.
+func (m confidenceMapping) labelShares(prototypes []Prototype, skip int) map[string]float64 {
+	if !m.balanced {
+		return nil
+	}
+	sizes := make(map[string]int)
+	for i, proto := range prototypes {
+		if i != skip {
+			sizes[proto.Label]++
+		}
+	}
+	shares := make(map[string]float64, len(sizes))
+	for label, size := range sizes {
+		shares[label] = 1 / math.Sqrt(float64(size))
+	}
+	return shares
+}
+
+// softmaxWeight is a neighbour's unnormalised softmax vote, before recency decay.
+func (m confidenceMapping) softmaxWeight(distance float64) float64 {
+	temperature := m.temperature
+	if temperature <= 0 {
+		temperature = DefaultSoftmaxTemperature
+	}
+	return math.Exp(-distance / temperature)
+}
+
+// labelConfidence returns a label's confidence from its summed inverse-distance and
+// softmax votes, the totals of both over all labels, and its nearest distance.
+func (m confidenceMapping) labelConfidence(weightSum, totalWeight, softmaxSum, softmaxTotal, nearest float64) float64 {
+	switch m.strategy {
+	case ConfidenceSoftmaxOverDistances:
+		if softmaxTotal == 0 {
+			return 0
+		}
+		return softmaxSum / softmaxTotal
+	case ConfidenceNearestSimilarity:
+		return math.Max(0, math.Min(1, 1-nearest))
+	default:
+		if totalWeight == 0 {
+			return 0
+		}
+		return weightSum / totalWeight
+	}
+}
@@ -0,0 +1,111 @@
+package drone
+
+// Cross-Validation
+//
+// Scoring a model on the recordings it was built from overstates its accuracy: every
+// query has itself among the prototypes. CrossValidate splits the prototypes into folds,
+// builds a classifier from all but one fold and classifies the held-out fold with it, so
+// every prototype is scored by a model that never saw it. Each fold's classifier fits its
+// own feature scaler, so the held-out fold does not leak into the scaling either.
+//
+// Folds are stratified and deterministic: each label's prototypes are dealt round-robin,
+// in model order, so every fold holds about the same share of every label and repeated
+// runs report the same numbers.
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// FoldResult is the accuracy of one cross-validation fold.
+type FoldResult struct {
+	Fold     int     `json:"fold"` // 1-based
+	Samples  int     `json:"samples"`
+	Correct  int     `json:"correct"`
+	Accuracy float64 `json:"accuracy"` // percent, like EvaluationReport.OverallAccuracy
+}
+
+// CrossValReport summarises a k-fold cross-validation.
+type CrossValReport struct {
+	Timestamp    time.Time    `json:"timestamp"`
+	Folds        []FoldResult `json:"folds"`
+	MeanAccuracy float64      `json:"meanAccuracy"`
+	StdAccuracy  float64      `json:"stdAccuracy"` // population standard deviation across folds
+}
+
+// CrossValidate runs a folds-fold cross-validation of prototypes with k neighbours.
+// prototypes hold raw features, as saved in a model file. folds is clamped to
+// [2, len(prototypes)]; fewer than two prototypes produce an empty report. A fold whose
+// classifier cannot be built (for example because it would hold no prototypes) counts
+// every held-out prototype as wrong.
+func CrossValidate(prototypes []Prototype, k int, folds int) CrossValReport {
+	report := CrossValReport{Timestamp: time.Now()}
+	if len(prototypes) < 2 {
+		return report
+	}
+	folds = min(max(folds, 2), len(prototypes))
+	if k <= 0 {
+		k = 1
+	}
+
+	assignment := foldAssignment(prototypes, folds)
+	disableScaling := scalingDisabledByMetadata(prototypes)
+	accuracies := make([]float64, 0, folds)
+	for fold := range folds {
+		var training, heldOut []Prototype
+		for idx, proto := range prototypes {
+			// newClassifier rewrites Features, so each fold works on its own copies
+			proto.Features = slices.Clone(proto.Features)
+			if assignment[idx] == fold {
+				heldOut = append(heldOut, proto)
+			} else {
+				training = append(training, proto)
+			}
+		}
+
+		result := FoldResult{Fold: fold + 1, Samples: len(heldOut)}
+		classifier, err := newClassifier(training, k, fmt.Sprintf("cross-validation fold %d", fold+1), nil, disableScaling)
+		if err == nil {
+			for _, proto := range heldOut {
+				predictions, err := classifier.Predict(proto.Features)
+				if err == nil && len(predictions) > 0 && predictions[0].Label == proto.Label {
+					result.Correct++
+				}
+			}
+		}
+		if result.Samples > 0 {
+			result.Accuracy = float64(result.Correct) / float64(result.Samples) * 100
+		}
+		report.Folds = append(report.Folds, result)
+		accuracies = append(accuracies, result.Accuracy)
+	}
+
+	report.MeanAccuracy = meanOf(accuracies)
+	report.StdAccuracy = stdDevOf(accuracies, report.MeanAccuracy)
+	return report
+}
+
+// foldAssignment returns the fold of every prototype, dealing each label's prototypes
+// round-robin across folds. Labels start where the previous label stopped, so small
+// labels do not all land in the first folds.
+func foldAssignment(prototypes []Prototype, folds int) []int {
+	var labels []string
+	byLabel := make(map[string][]int)
+	for idx, proto := range prototypes {
+		if _, ok := byLabel[proto.Label]; !ok {
+			labels = append(labels, proto.Label)
+		}
+		byLabel[proto.Label] = append(byLabel[proto.Label], idx)
+	}
+
+	assignment := make([]int, len(prototypes))
+	next := 0
+	for _, label := range labels {
+		for _, idx := range byLabel[label] {
+			assignment[idx] = next
+			next = (next + 1) % folds
+		}
+	}
+	return assignment
+}
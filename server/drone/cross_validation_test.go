@@ -0,0 +1,75 @@
+package drone
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// clusteredPrototypes returns perLabel prototypes per label, each drawn around its label's
+// centre with the given spread. Vectors have 8 dimensions, so the scaler applies.
+func clusteredPrototypes(rng *rand.Rand, centres map[string][]float64, perLabel int, spread float64) []Prototype {
+	var prototypes []Prototype
+	for i := range perLabel {
+		for _, label := range []string{"quad", "noise"} {
+			features := make([]float64, len(centres[label]))
+			for dim, centre := range centres[label] {
+				features[dim] = centre + rng.NormFloat64()*spread
+			}
+			prototypes = append(prototypes, Prototype{
+				ID:       fmt.Sprintf("%s_%d", label, i),
+				Label:    label,
+				Category: label,
+				Features: features,
+			})
+		}
+	}
+	return prototypes
+}
+
+func TestCrossValidateSeparatesWellAndPoorlyLearnableClasses(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+
+	separated := clusteredPrototypes(rng, map[string][]float64{
+		"quad":  {5, 1, 1, 1, 1, 1, 1, 1},
+		"noise": {1, 1, 1, 1, 1, 1, 1, 5},
+	}, 20, 0.3)
+	report := CrossValidate(separated, 3, 5)
+	if len(report.Folds) != 5 {
+		t.Fatalf("expected 5 folds, got %d", len(report.Folds))
+	}
+	samples := 0
+	for _, fold := range report.Folds {
+		samples += fold.Samples
+		if fold.Samples != 8 {
+			t.Fatalf("expected stratified folds of 8, got %+v", fold)
+		}
+	}
+	if samples != len(separated) {
+		t.Fatalf("expected every prototype held out once, got %d of %d", samples, len(separated))
+	}
+	if report.MeanAccuracy < 95 {
+		t.Fatalf("expected well-separated classes to cross-validate above 95%%, got %.1f%% (%+v)", report.MeanAccuracy, report.Folds)
+	}
+
+	centre := []float64{3, 1, 1, 1, 1, 1, 1, 3}
+	overlapping := clusteredPrototypes(rng, map[string][]float64{"quad": centre, "noise": centre}, 20, 0.3)
+	report = CrossValidate(overlapping, 3, 5)
+	if report.MeanAccuracy > 75 {
+		t.Fatalf("expected indistinguishable classes to cross-validate near chance, got %.1f%% (%+v)", report.MeanAccuracy, report.Folds)
+	}
+}
+
+func TestCrossValidateLeavesPrototypesUntouched(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	prototypes := clusteredPrototypes(rng, map[string][]float64{
+		"quad":  {5, 1, 1, 1, 1, 1, 1, 1},
+		"noise": {1, 1, 1, 1, 1, 1, 1, 5},
+	}, 4, 0.3)
+	before := prototypes[0].Features[0]
+
+	CrossValidate(prototypes, 1, 2)
+	if prototypes[0].Features[0] != before {
+		t.Fatalf("expected raw features to be left unscaled, got %v (was %v)", prototypes[0].Features[0], before)
+	}
+}
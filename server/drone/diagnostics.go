@@ -0,0 +1,224 @@
+package drone
+
+// Model Diagnostics
+//
+// Mirrors the test_self_match and test_determinism CLIs so the checks can be run
+// against a live model without shell access. For every prototype whose source audio
+// is still on disk the features are re-extracted twice:
+//
+//   - Reproducibility: both extractions must be identical (within 1e-12)
+//   - Self-match: classifying the re-extracted features must return the prototype's
+//     own label, ideally with the prototype itself as the nearest neighbour
+//
+// Prototypes whose source is missing (uploads, moved datasets) are reported as skipped.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Diagnostic statuses reported per prototype.
+const (
+	DiagnosticOK            = "ok"
+	DiagnosticMismatch      = "mismatch"
+	DiagnosticMissingSource = "missing_source"
+	DiagnosticError         = "error"
+)
+
+const diagnosticTolerance = 1e-12
+
+// ErrPrototypeNotFound is returned by SelfCheck for an ID the model does not hold.
+var ErrPrototypeNotFound = errors.New("prototype not found")
+
+// FeatureExtractorFunc turns an audio file into the feature vector a model expects.
+type FeatureExtractorFunc func(path string) ([]float64, error)
+
+// PrototypeDiagnostic reports the self-match and reproducibility checks for one prototype.
+type PrototypeDiagnostic struct {
+	ID             string  `json:"id"`
+	Label          string  `json:"label"`
+	Source         string  `json:"source,omitempty"`
+	Status         string  `json:"status"`
+	Error          string  `json:"error,omitempty"`
+	PredictedLabel string  `json:"predictedLabel,omitempty"`
+	Confidence     float64 `json:"confidence,omitempty"`
+	SelfDistance   float64 `json:"selfDistance,omitempty"`
+	SelfNearest    bool    `json:"selfNearest"`    // prototype was its own nearest neighbour
+	Deterministic  bool    `json:"deterministic"`  // repeated extraction produced identical features
+	MaxFeatureDiff float64 `json:"maxFeatureDiff"` // largest per-feature difference between runs
+}
+
+// DiagnosticsReport summarises the diagnostics run across a model.
+type DiagnosticsReport struct {
+	PrototypeCount int                   `json:"prototypeCount"`
+	Checked        int                   `json:"checked"`
+	Skipped        int                   `json:"skipped"`
+	SelfMatched    int                   `json:"selfMatched"`
+	Deterministic  bool                  `json:"deterministic"`
+	Healthy        bool                  `json:"healthy"`
+	Results        []PrototypeDiagnostic `json:"results"`
+}
+
+// RunDiagnostics re-extracts features for every prototype with an existing source file
+// and checks that extraction is reproducible and that the prototype matches itself.
+func (c *Classifier) RunDiagnostics(extract FeatureExtractorFunc) DiagnosticsReport {
+	_, prototypes, _, _, _ := c.snapshot()
+
+	report := DiagnosticsReport{
+		PrototypeCount: len(prototypes),
+		Deterministic:  true,
+		Results:        make([]PrototypeDiagnostic, 0, len(prototypes)),
+	}
+
+	for _, proto := range prototypes {
+		result := PrototypeDiagnostic{ID: proto.ID, Label: proto.Label, Source: proto.Source}
+
+		if _, err := os.Stat(proto.Source); proto.Source == "" || err != nil {
+			result.Status = DiagnosticMissingSource
+			report.Skipped++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		report.Checked++
+		c.diagnosePrototype(proto, extract, &result)
+		if result.Status == DiagnosticOK {
+			report.SelfMatched++
+		}
+		if !result.Deterministic {
+			report.Deterministic = false
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	report.Healthy = report.Deterministic && report.SelfMatched == report.Checked
+	return report
+}
+
+func (c *Classifier) diagnosePrototype(proto Prototype, extract FeatureExtractorFunc, result *PrototypeDiagnostic) {
+	first, err := extract(proto.Source)
+	if err != nil {
+		result.Status = DiagnosticError
+		result.Error = err.Error()
+		return
+	}
+	second, err := extract(proto.Source)
+	if err != nil {
+		result.Status = DiagnosticError
+		result.Error = err.Error()
+		return
+	}
+
+	result.MaxFeatureDiff = maxAbsDifference(first, second)
+	result.Deterministic = len(first) == len(second) && result.MaxFeatureDiff <= diagnosticTolerance
+
+	predictions, err := c.Predict(first)
+	if err != nil {
+		result.Status = DiagnosticError
+		result.Error = err.Error()
+		return
+	}
+	if len(predictions) == 0 {
+		result.Status = DiagnosticMismatch
+		return
+	}
+
+	result.PredictedLabel = predictions[0].Label
+	result.Confidence = predictions[0].Confidence
+	result.SelfDistance, result.SelfNearest = selfNeighbour(predictions, proto.ID)
+
+	if result.PredictedLabel == proto.Label {
+		result.Status = DiagnosticOK
+	} else {
+		result.Status = DiagnosticMismatch
+	}
+}
+
+// SelfCheckResult reports how the model classifies one prototype's stored features.
+type SelfCheckResult struct {
+	ID             string  `json:"id"`
+	Label          string  `json:"label"`
+	PredictedLabel string  `json:"predictedLabel,omitempty"`
+	Confidence     float64 `json:"confidence"`
+	SelfIdentified bool    `json:"selfIdentified"` // top prediction is the prototype's own label
+	SelfNearest    bool    `json:"selfNearest"`    // prototype was its own nearest neighbour
+	SelfDistance   float64 `json:"selfDistance"`
+
+	// The same classification with the prototype itself excluded (see PredictExcluding):
+	// whether the rest of the model still recognises it. Empty when it is the only prototype.
+	HoldoutLabel      string  `json:"holdoutLabel,omitempty"`
+	HoldoutConfidence float64 `json:"holdoutConfidence"`
+	HoldoutIdentified bool    `json:"holdoutIdentified"`
+}
+
+// SelfCheck classifies the stored (already scaled) feature vector of the prototype with
+// the given ID against the whole model, the in-process equivalent of test_self_match,
+// and again without the prototype itself. Unlike RunDiagnostics it needs no source
+// audio, so it also covers uploads.
+func (c *Classifier) SelfCheck(id string) (SelfCheckResult, error) {
+	_, prototypes, _, _, _ := c.snapshot()
+
+	for _, proto := range prototypes {
+		if proto.ID != id {
+			continue
+		}
+		result := SelfCheckResult{ID: proto.ID, Label: proto.Label}
+		predictions, err := c.predictPrepared(PreparedQuery(proto.Features), 0)
+		if err != nil {
+			return result, err
+		}
+		if len(predictions) == 0 {
+			return result, nil
+		}
+		result.PredictedLabel = predictions[0].Label
+		result.Confidence = predictions[0].Confidence
+		result.SelfIdentified = predictions[0].Label == proto.Label
+		result.SelfDistance, result.SelfNearest = selfNeighbour(predictions, proto.ID)
+
+		holdout, err := c.predictPreparedExcluding(PreparedQuery(proto.Features), 0, map[string]bool{proto.ID: true})
+		if err != nil && !errors.Is(err, ErrEmptyModel) {
+			return result, err
+		}
+		if len(holdout) > 0 {
+			result.HoldoutLabel = holdout[0].Label
+			result.HoldoutConfidence = holdout[0].Confidence
+			result.HoldoutIdentified = holdout[0].Label == proto.Label
+		}
+		return result, nil
+	}
+
+	return SelfCheckResult{}, fmt.Errorf("%w: %s", ErrPrototypeNotFound, id)
+}
+
+// selfNeighbour returns the distance at which the prototype id voted in predictions and
+// whether it was the nearest of all voting neighbours.
+func selfNeighbour(predictions []Prediction, id string) (float64, bool) {
+	var selfDistance float64
+	nearestDistance := math.MaxFloat64
+	nearestID := ""
+	for _, pred := range predictions {
+		for _, score := range pred.TopPrototypes {
+			if score.ID == id {
+				selfDistance = score.Distance
+			}
+			if score.Distance < nearestDistance {
+				nearestDistance = score.Distance
+				nearestID = score.ID
+			}
+		}
+	}
+	return selfDistance, nearestID == id
+}
+
+func maxAbsDifference(a, b []float64) float64 {
+	limit := min(len(a), len(b))
+	var maxDiff float64
+	for i := 0; i < limit; i++ {
+		if diff := math.Abs(a[i] - b[i]); diff > maxDiff {
+			maxDiff = diff
+		}
+	}
+	return maxDiff
+}
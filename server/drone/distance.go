@@ -0,0 +1,116 @@
+package drone
+
+// Distance Metrics
+//
+// The k-NN vote ranks prototypes by the classifier's DistanceMetric and weights each
+// neighbour by 1/(distance+eps) whatever the metric. Cosine is the default. Euclidean
+// compares the scaled, L2-normalised vectors directly, which on unit vectors ranks like
+// cosine but spreads distances over [0, 2]. Mahalanobis approximates the covariance by
+// its diagonal, taken from the FeatureScaler's Stddev, so dimensions that vary little
+// across the training prototypes count for more; without a scaler (PANNS embeddings)
+// it is plain Euclidean.
+//
+// Prototypes extracted before the harmonic features existed carry zeros in their last
+// harmonicFeatureCount dimensions. Current extraction always fills them, so each zeroed
+// harmonic is a mismatch with the query; the harmonic mismatch penalty is added to the
+// distance once per zeroed harmonic, whatever the metric. Zeros are read from the
+// prototype's unscaled features, since scaling moves them away from zero.
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DistanceMetric selects how the classifier measures the distance to a prototype.
+type DistanceMetric string
+
+const (
+	MetricCosine      DistanceMetric = "cosine"      // 1 - cosine similarity, the default
+	MetricEuclidean   DistanceMetric = "euclidean"   // straight-line distance between feature vectors
+	MetricMahalanobis DistanceMetric = "mahalanobis" // Euclidean scaled by the scaler's per-dimension variance
+)
+
+// ParseDistanceMetric maps a configuration value to a DistanceMetric; empty means cosine.
+func ParseDistanceMetric(value string) (DistanceMetric, error) {
+	switch metric := DistanceMetric(strings.ToLower(strings.TrimSpace(value))); metric {
+	case "":
+		return MetricCosine, nil
+	case MetricCosine, MetricEuclidean, MetricMahalanobis:
+		return metric, nil
+	default:
+		return "", fmt.Errorf("unknown distance metric %q (expected cosine, euclidean or mahalanobis)", value)
+	}
+}
+
+// distanceMeasure is a metric together with the per-dimension weights it applies and
+// the penalty per zeroed prototype harmonic.
+type distanceMeasure struct {
+	metric          DistanceMetric
+	weights         []float64
+	harmonicPenalty float64
+}
+
+// prototypeDistance is the distance from features to proto plus the harmonic mismatch
+// penalty for each of proto's zeroed harmonic features.
+func (m distanceMeasure) prototypeDistance(features []float64, proto Prototype) float64 {
+	distance := m.distance(features, proto.Features)
+	if m.harmonicPenalty > 0 {
+		distance += m.harmonicPenalty * float64(zeroHarmonicCount(proto.raw))
+	}
+	return distance
+}
+
+func (m distanceMeasure) distance(a, b []float64) float64 {
+	switch m.metric {
+	case MetricEuclidean, MetricMahalanobis:
+		return euclideanDistance(a, b, m.weights)
+	default:
+		return cosineDistance(a, b, m.weights)
+	}
+}
+
+// euclideanDistance is the weighted straight-line distance over the dimensions a and b share.
+func euclideanDistance(a, b, weights []float64) float64 {
+	var sum float64
+	for i := 0; i < min(len(a), len(b)); i++ {
+		weight := 1.0
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		diff := a[i] - b[i]
+		sum += weight * diff * diff
+	}
+	return math.Sqrt(sum)
+}
+
+// mahalanobisWeights scales weights by the inverse variance of each dimension.
+// Dimensions without a usable deviation keep their weight.
+func mahalanobisWeights(weights []float64, scaler *FeatureScaler) []float64 {
+	if scaler == nil || len(scaler.Stddev) != len(weights) {
+		return weights
+	}
+	scaled := make([]float64, len(weights))
+	for i, weight := range weights {
+		scaled[i] = weight
+		if stddev := scaler.Stddev[i]; stddev > 0 {
+			scaled[i] = weight / (stddev * stddev)
+		}
+	}
+	return scaled
+}
+
+// zeroHarmonicCount counts the zeroed harmonic features at the end of raw, an unscaled
+// legacy feature vector. PANNS embeddings and MFCCs have no harmonic features.
+func zeroHarmonicCount(raw []float64) int {
+	if len(raw) < harmonicFeatureCount || !hasHarmonicFeatures(len(raw)) {
+		return 0
+	}
+	count := 0
+	for _, value := range raw[len(raw)-harmonicFeatureCount:] {
+		if value == 0 {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,101 @@
+package drone
+
+// Classification Errors
+//
+// Every transport reports a failed classification as a ClassifyError: a stable,
+// machine-readable Code, a message safe to show the client and an optional remediation
+// Detail. HTTP responds with the code's HTTPStatus and the error as its JSON body, the
+// socket emits the same JSON as an analysisError event, and gRPC derives its status
+// code from the HTTP status. The underlying cause stays available to errors.Is and
+// errors.As but is never shown to clients.
+
+import (
+	"errors"
+	"net/http"
+
+	"song-recognition/wav"
+)
+
+// ErrorCode identifies why a classification failed.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest          ErrorCode = "INVALID_REQUEST"           // malformed payload or parameters
+	CodePayloadTooLarge         ErrorCode = "PAYLOAD_TOO_LARGE"         // recording over the size limit
+	CodeAudioUndecodable        ErrorCode = "AUDIO_UNDECODABLE"         // audio could not be decoded
+	CodeAudioTooShort           ErrorCode = "AUDIO_TOO_SHORT"           // recording holds no samples to analyse
+	CodeModelNotFound           ErrorCode = "MODEL_NOT_FOUND"           // requested model is not served
+	CodeModelEmpty              ErrorCode = "MODEL_EMPTY"               // model has no prototypes yet
+	CodeEmbeddingUnavailable    ErrorCode = "EMBEDDING_UNAVAILABLE"     // embedding service failed and the fallback cannot stand in
+	CodeAudioToolingUnavailable ErrorCode = "AUDIO_TOOLING_UNAVAILABLE" // FFmpeg is missing on the server
+	CodeStreamingUnsupported    ErrorCode = "STREAMING_UNSUPPORTED"     // extractor has no per-window features
+	CodeURLNotAllowed           ErrorCode = "URL_NOT_ALLOWED"           // audio URL blocked by the fetch policy
+	CodeFetchFailed             ErrorCode = "FETCH_FAILED"              // audio URL could not be downloaded
+	CodeFeatureExtraction       ErrorCode = "FEATURE_EXTRACTION_FAILED" // features could not be computed
+	CodeClassifierError         ErrorCode = "CLASSIFIER_ERROR"          // unexpected classifier failure
+)
+
+// errorStatus maps each code to the HTTP status it is reported with.
+var errorStatus = map[ErrorCode]int{
+	CodeInvalidRequest:          http.StatusBadRequest,
+	CodePayloadTooLarge:         http.StatusRequestEntityTooLarge,
+	CodeAudioUndecodable:        http.StatusBadRequest,
+	CodeAudioTooShort:           http.StatusUnprocessableEntity,
+	CodeModelNotFound:           http.StatusNotFound,
+	CodeModelEmpty:              http.StatusServiceUnavailable,
+	CodeEmbeddingUnavailable:    http.StatusServiceUnavailable,
+	CodeAudioToolingUnavailable: http.StatusServiceUnavailable,
+	CodeStreamingUnsupported:    http.StatusNotImplemented,
+	CodeURLNotAllowed:           http.StatusForbidden,
+	CodeFetchFailed:             http.StatusBadGateway,
+	CodeFeatureExtraction:       http.StatusInternalServerError,
+	CodeClassifierError:         http.StatusInternalServerError,
+}
+
+// HTTPStatus returns the HTTP status a code is reported with; unknown codes are
+// internal errors.
+func (c ErrorCode) HTTPStatus() int {
+	if status, ok := errorStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ClassifyError is a classification failure as reported to clients.
+type ClassifyError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Detail  string    `json:"detail,omitempty"`
+	Err     error     `json:"-"` // cause, for logs and errors.Is; never shown to clients
+}
+
+// NewClassifyError returns a ClassifyError with the given code and client-facing
+// message wrapping cause, which may be nil.
+func NewClassifyError(code ErrorCode, message string, cause error) *ClassifyError {
+	return &ClassifyError{Code: code, Message: message, Err: cause}
+}
+
+func (e *ClassifyError) Error() string { return e.Message }
+
+func (e *ClassifyError) Unwrap() error { return e.Err }
+
+// HTTPStatus returns the HTTP status the error is reported with.
+func (e *ClassifyError) HTTPStatus() int { return e.Code.HTTPStatus() }
+
+// AsClassifyError returns err as a ClassifyError. An empty model and missing FFmpeg get
+// their own codes; any other error is a CodeClassifierError with a generic message.
+func AsClassifyError(err error) *ClassifyError {
+	var classifyErr *ClassifyError
+	switch {
+	case errors.As(err, &classifyErr):
+		return classifyErr
+	case errors.Is(err, ErrEmptyModel):
+		return NewClassifyError(CodeModelEmpty, "model has no prototypes", err)
+	case errors.Is(err, wav.ErrFFmpegUnavailable):
+		tooling := NewClassifyError(CodeAudioToolingUnavailable, wav.ErrFFmpegUnavailable.Error(), err)
+		tooling.Detail = wav.FFmpegRemediation
+		return tooling
+	default:
+		return NewClassifyError(CodeClassifierError, "classifier error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package drone
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+func TestAsClassifyErrorAssignsCodes(t *testing.T) {
+	coded := NewClassifyError(CodeAudioTooShort, "recording holds no audio samples", nil)
+	for _, tc := range []struct {
+		name       string
+		err        error
+		wantCode   ErrorCode
+		wantStatus int
+	}{
+		{"coded", fmt.Errorf("pipeline: %w", coded), CodeAudioTooShort, http.StatusUnprocessableEntity},
+		{"empty model", fmt.Errorf("predict: %w", ErrEmptyModel), CodeModelEmpty, http.StatusServiceUnavailable},
+		{"ffmpeg", wav.ErrFFmpegUnavailable, CodeAudioToolingUnavailable, http.StatusServiceUnavailable},
+		{"unexpected", errors.New("boom"), CodeClassifierError, http.StatusInternalServerError},
+	} {
+		got := AsClassifyError(tc.err)
+		if got.Code != tc.wantCode || got.HTTPStatus() != tc.wantStatus {
+			t.Fatalf("%s: expected %s/%d, got %s/%d", tc.name, tc.wantCode, tc.wantStatus, got.Code, got.HTTPStatus())
+		}
+		if !errors.Is(got, tc.err) && !errors.Is(tc.err, got) {
+			t.Fatalf("%s: expected the cause to stay reachable", tc.name)
+		}
+	}
+	if AsClassifyError(wav.ErrFFmpegUnavailable).Detail != wav.FFmpegRemediation {
+		t.Fatal("expected FFmpeg remediation as the detail")
+	}
+}
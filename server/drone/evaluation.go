@@ -0,0 +1,270 @@
+package drone
+
+// Model Evaluation
+//
+// RunEvaluation classifies every recording in a labelled directory tree (one
+// subdirectory per class, named after the label) and reports overall accuracy,
+// per-class metrics, a confusion matrix and the individual misclassifications.
+// Recordings go through ExtractFeaturesFromPath, exactly as the training builders
+// process them.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ClassMetrics tracks per-class performance
+type ClassMetrics struct {
+	ClassName     string
+	TotalSamples  int
+	CorrectCount  int
+	ErrorCount    int // Recordings that could not be classified
+	Accuracy      float64
+	AvgConfidence float64
+	ConfidenceStd float64
+	Misclassified []MisclassificationInfo
+}
+
+// MisclassificationInfo stores details of incorrect predictions
+type MisclassificationInfo struct {
+	Filename       string
+	Path           string // Source recording, used by ExportMisclassified
+	TrueLabel      string
+	PredictedLabel string
+	Confidence     float64
+}
+
+// EvaluationReport contains comprehensive evaluation results
+type EvaluationReport struct {
+	Timestamp       time.Time
+	ModelPath       string
+	TotalSamples    int
+	CorrectCount    int
+	OverallAccuracy float64
+	AvgConfidence   float64
+	ClassMetrics    []ClassMetrics
+	ConfusionMatrix map[string]map[string]int
+	ProcessingTime  time.Duration
+}
+
+// RunEvaluation classifies each recording under testDir with k neighbours (k <= 0
+// uses the classifier's k) and compares the top label with the directory's label.
+func RunEvaluation(classifier *Classifier, testDir string, k int) (EvaluationReport, error) {
+	if classifier == nil {
+		return EvaluationReport{}, errors.New("classifier is required")
+	}
+
+	subdirs, err := evaluationClassDirs(testDir)
+	if err != nil {
+		return EvaluationReport{}, fmt.Errorf("failed to read evaluation directory: %w", err)
+	}
+
+	report := EvaluationReport{
+		Timestamp:       time.Now(),
+		ModelPath:       classifier.modelPath,
+		ConfusionMatrix: make(map[string]map[string]int),
+	}
+
+	totalConfidence := 0.0
+	for _, subdir := range subdirs {
+		metrics := evaluateClass(classifier, subdir, NormalizeLabel(filepath.Base(subdir)), k, &report)
+
+		report.ClassMetrics = append(report.ClassMetrics, metrics)
+		report.CorrectCount += metrics.CorrectCount
+		report.TotalSamples += metrics.TotalSamples
+		totalConfidence += metrics.AvgConfidence * float64(metrics.TotalSamples)
+	}
+
+	if report.TotalSamples > 0 {
+		report.OverallAccuracy = float64(report.CorrectCount) / float64(report.TotalSamples) * 100
+		report.AvgConfidence = totalConfidence / float64(report.TotalSamples)
+	}
+	report.ProcessingTime = time.Since(report.Timestamp)
+
+	return report, nil
+}
+
+// ExportMisclassified copies every misclassified recording in report into
+// dir/<true label>/ so the failures can be listened to or relabelled. It returns
+// the number of files copied.
+func ExportMisclassified(report EvaluationReport, dir string) (int, error) {
+	copied := 0
+	for _, metrics := range report.ClassMetrics {
+		for _, misc := range metrics.Misclassified {
+			if misc.Path == "" {
+				continue
+			}
+			labelDir := filepath.Join(dir, misc.TrueLabel)
+			if err := os.MkdirAll(labelDir, 0755); err != nil {
+				return copied, fmt.Errorf("failed to create %s: %w", labelDir, err)
+			}
+			if err := copyFile(misc.Path, filepath.Join(labelDir, filepath.Base(misc.Path))); err != nil {
+				return copied, fmt.Errorf("failed to copy %s: %w", misc.Path, err)
+			}
+			copied++
+		}
+	}
+	return copied, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func evaluationClassDirs(rootDir string) ([]string, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var subdirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		subdirs = append(subdirs, filepath.Join(rootDir, entry.Name()))
+	}
+
+	return subdirs, nil
+}
+
+func evaluateClass(classifier *Classifier, classDir string, trueLabel string, k int, report *EvaluationReport) ClassMetrics {
+	metrics := ClassMetrics{
+		ClassName: trueLabel,
+	}
+
+	files, err := evaluationAudioFiles(classDir)
+	if err != nil {
+		log.Printf("[Evaluation] Failed to read directory %s: %v\n", classDir, err)
+		return metrics
+	}
+
+	if len(files) == 0 {
+		log.Printf("[Evaluation] No audio files in %s\n", classDir)
+		return metrics
+	}
+
+	var confidences []float64
+
+	for _, filePath := range files {
+		metrics.TotalSamples++
+
+		prediction, conf, err := classifyEvaluationFile(classifier, filePath, k)
+		if err != nil {
+			metrics.ErrorCount++
+			log.Printf("[Evaluation] Failed to classify %s: %v\n", filepath.Base(filePath), err)
+			continue
+		}
+
+		confidences = append(confidences, conf)
+
+		if report.ConfusionMatrix[trueLabel] == nil {
+			report.ConfusionMatrix[trueLabel] = make(map[string]int)
+		}
+		report.ConfusionMatrix[trueLabel][prediction]++
+
+		if prediction == trueLabel {
+			metrics.CorrectCount++
+		} else {
+			metrics.Misclassified = append(metrics.Misclassified, MisclassificationInfo{
+				Filename:       filepath.Base(filePath),
+				Path:           filePath,
+				TrueLabel:      trueLabel,
+				PredictedLabel: prediction,
+				Confidence:     conf,
+			})
+		}
+	}
+
+	if metrics.TotalSamples > 0 {
+		metrics.Accuracy = float64(metrics.CorrectCount) / float64(metrics.TotalSamples) * 100
+	}
+
+	if len(confidences) > 0 {
+		metrics.AvgConfidence = meanOf(confidences)
+		metrics.ConfidenceStd = stdDevOf(confidences, metrics.AvgConfidence)
+	}
+
+	return metrics
+}
+
+func classifyEvaluationFile(classifier *Classifier, filePath string, k int) (string, float64, error) {
+	features, err := ExtractFeaturesFromPath(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	predictions, err := classifier.PredictWithK(features, k)
+	if err != nil {
+		return "", 0, fmt.Errorf("classification failed: %w", err)
+	}
+	if len(predictions) == 0 {
+		return "", 0, errors.New("classification failed: no predictions")
+	}
+
+	return predictions[0].Label, predictions[0].Confidence, nil
+}
+
+func evaluationAudioFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext == ".wav" || ext == ".mp3" {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+func meanOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func stdDevOf(values []float64, mean float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	variance := 0.0
+	for _, v := range values {
+		diff := v - mean
+		variance += diff * diff
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
@@ -0,0 +1,157 @@
+package drone
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+func TestRunEvaluationReportsClassMetrics(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	root := t.TempDir()
+	writeEvaluationTone(t, filepath.Join(root, "Drone_A", "a1.wav"), 440)
+	writeEvaluationTone(t, filepath.Join(root, "Drone_A", "a2.wav"), 450)
+	writeEvaluationTone(t, filepath.Join(root, "wind", "w1.wav"), 3000)
+	writeEvaluationTone(t, filepath.Join(root, "wind", "w2.wav"), 445) // sounds like the drone
+	writeEvaluationTone(t, filepath.Join(root, ".cache", "ignored.wav"), 440)
+	if err := os.WriteFile(filepath.Join(root, "wind", "notes.txt"), []byte("not audio"), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	var protos []Prototype
+	for label, freq := range map[string]float64{"drone a": 440, "wind": 3000} {
+		source := filepath.Join(t.TempDir(), "proto.wav")
+		writeEvaluationTone(t, source, freq)
+		features, err := ExtractFeaturesFromPath(source)
+		if err != nil {
+			t.Fatalf("failed to extract prototype features: %v", err)
+		}
+		protos = append(protos, Prototype{ID: label, Label: label, Features: features})
+	}
+	classifier := newTestClassifier(protos, 3)
+
+	report, err := RunEvaluation(classifier, root, 1)
+	if err != nil {
+		t.Fatalf("RunEvaluation returned error: %v", err)
+	}
+
+	if report.TotalSamples != 4 || report.CorrectCount != 3 {
+		t.Fatalf("expected 3/4 correct, got %d/%d", report.CorrectCount, report.TotalSamples)
+	}
+	if math.Abs(report.OverallAccuracy-75) > 1e-9 {
+		t.Fatalf("expected 75%% accuracy, got %.2f", report.OverallAccuracy)
+	}
+	if len(report.ClassMetrics) != 2 {
+		t.Fatalf("expected metrics for 2 classes, got %d", len(report.ClassMetrics))
+	}
+
+	metrics := map[string]ClassMetrics{}
+	for _, m := range report.ClassMetrics {
+		metrics[m.ClassName] = m
+	}
+	if m := metrics["drone a"]; m.TotalSamples != 2 || m.Accuracy != 100 {
+		t.Fatalf("unexpected drone metrics: %+v", m)
+	}
+	wind := metrics["wind"]
+	if wind.TotalSamples != 2 || wind.CorrectCount != 1 || len(wind.Misclassified) != 1 {
+		t.Fatalf("unexpected wind metrics: %+v", wind)
+	}
+	if miss := wind.Misclassified[0]; miss.Filename != "w2.wav" || miss.PredictedLabel != "drone a" {
+		t.Fatalf("unexpected misclassification: %+v", miss)
+	}
+	if report.ConfusionMatrix["wind"]["drone a"] != 1 || report.ConfusionMatrix["drone a"]["drone a"] != 2 {
+		t.Fatalf("unexpected confusion matrix: %v", report.ConfusionMatrix)
+	}
+}
+
+// copyRunner stands in for FFmpeg when fixtures are already 16-bit mono 44.1 kHz WAV.
+type copyRunner struct{}
+
+func (copyRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (copyRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	var input string
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-i" {
+			input = args[i+1]
+		}
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	return nil, os.WriteFile(args[len(args)-1], data, 0644)
+}
+
+func TestExportMisclassifiedCopiesByTrueLabel(t *testing.T) {
+	srcDir := t.TempDir()
+	sources := map[string]string{
+		"hover.wav": "drone a",
+		"wind.wav":  "noise",
+		"fly.mp3":   "drone a",
+	}
+	var report EvaluationReport
+	byLabel := make(map[string][]MisclassificationInfo)
+	for name, label := range sources {
+		path := filepath.Join(srcDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write source: %v", err)
+		}
+		byLabel[label] = append(byLabel[label], MisclassificationInfo{
+			Filename:       name,
+			Path:           path,
+			TrueLabel:      label,
+			PredictedLabel: "other",
+		})
+	}
+	for label, misc := range byLabel {
+		report.ClassMetrics = append(report.ClassMetrics, ClassMetrics{ClassName: label, Misclassified: misc})
+	}
+
+	outDir := filepath.Join(t.TempDir(), "errors")
+	copied, err := ExportMisclassified(report, outDir)
+	if err != nil {
+		t.Fatalf("ExportMisclassified failed: %v", err)
+	}
+	if copied != len(sources) {
+		t.Fatalf("expected %d files copied, got %d", len(sources), copied)
+	}
+
+	for name, label := range sources {
+		data, err := os.ReadFile(filepath.Join(outDir, label, name))
+		if err != nil {
+			t.Fatalf("expected %s under %s: %v", name, label, err)
+		}
+		if string(data) != name {
+			t.Fatalf("copied %s has unexpected contents %q", name, data)
+		}
+		if _, err := os.Stat(filepath.Join(srcDir, name)); err != nil {
+			t.Fatalf("source %s should be left in place: %v", name, err)
+		}
+	}
+}
+
+func writeEvaluationTone(t *testing.T, path string, frequency float64) {
+	t.Helper()
+
+	const sampleRate = 44100
+	pcm := make([]byte, sampleRate*2)
+	for i := 0; i < sampleRate; i++ {
+		value := 0.5 * math.Sin(2*math.Pi*frequency*float64(i)/sampleRate)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(value*32767)))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create fixture dir: %v", err)
+	}
+	if err := wav.WriteWavFile(path, pcm, sampleRate, 1, 16); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package drone
+
+// Prediction Explanations
+//
+// Explain breaks the top prediction down by feature: for the nearest prototype of the
+// winning label it reports each dimension's weighted squared difference to the query,
+// in the scaled, L2-normalised space the classifier compares in. Under the Euclidean
+// and Mahalanobis metrics the contributions sum to the squared distance; under cosine,
+// on unit vectors, they sum to twice the cosine distance. Either way their shares show
+// which features drove the decision.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// FeatureContribution is one dimension's share of the distance to a prototype.
+type FeatureContribution struct {
+	Index             int     `json:"index"`
+	Name              string  `json:"name"`
+	Contribution      float64 `json:"contribution"`      // weighted squared difference
+	CumulativePercent float64 `json:"cumulativePercent"` // this and every larger contribution, as a share of the total
+}
+
+// Explanation attributes the top prediction's distance to its nearest prototype
+// feature by feature, largest contribution first.
+type Explanation struct {
+	Label         string                `json:"label"`
+	Confidence    float64               `json:"confidence"`
+	PrototypeID   string                `json:"prototypeId"`
+	Distance      float64               `json:"distance"`
+	Contributions []FeatureContribution `json:"contributions"`
+}
+
+// Explain predicts features and breaks the distance from the query to the top label's
+// nearest prototype down by feature. It rejects vectors that match neither a legacy
+// feature layout nor PANNS embeddings, or that differ from the model's dimension.
+func (c *Classifier) Explain(features []float64) (Explanation, error) {
+	names, err := explainFeatureNames(len(features))
+	if err != nil {
+		return Explanation{}, err
+	}
+	if dimension := c.FeatureDimension(); dimension != 0 && dimension != len(features) {
+		return Explanation{}, fmt.Errorf("model expects %d features, got %d", dimension, len(features))
+	}
+
+	query := c.PrepareQuery(features)
+	predictions, err := c.predictPrepared(query, 0)
+	if err != nil {
+		return Explanation{}, err
+	}
+	if len(predictions) == 0 {
+		return Explanation{}, errors.New("no prediction to explain")
+	}
+	top := predictions[0]
+
+	_, prototypes, _, _, _ := c.snapshot()
+	measure := c.distanceMeasure()
+	for _, pair := range nearestPrototypes(query, prototypes, -1, measure) {
+		proto := prototypes[pair.index]
+		if proto.Label != top.Label {
+			continue
+		}
+		return Explanation{
+			Label:         top.Label,
+			Confidence:    top.Confidence,
+			PrototypeID:   proto.ID,
+			Distance:      pair.distance,
+			Contributions: featureContributions(query, proto.Features, measure.weights, names),
+		}, nil
+	}
+	return Explanation{}, fmt.Errorf("no prototype for label %q", top.Label)
+}
+
+// explainFeatureNames names the features of a vector of the given length: the legacy
+// or MFCC feature names, or numbered embedding dimensions for PANNS.
+func explainFeatureNames(count int) ([]string, error) {
+	if count == pannsEmbeddingDimension {
+		names := make([]string, count)
+		for i := range names {
+			names[i] = fmt.Sprintf("Embedding %d", i)
+		}
+		return names, nil
+	}
+	if names := getFeatureNames(count); len(names) == count {
+		return names, nil
+	}
+	return nil, fmt.Errorf("%d features match no known layout (legacy %d, MFCC %d or PANNS %d)",
+		count, FeatureConfig{}.Dimension(), MFCCCoefficientCount, pannsEmbeddingDimension)
+}
+
+// featureContributions returns the weighted squared differences between a and b,
+// largest first, with their cumulative share of the total.
+func featureContributions(a, b, weights []float64, names []string) []FeatureContribution {
+	contributions := make([]FeatureContribution, len(a))
+	var total float64
+	for i := range a {
+		weight := 1.0
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		diff := a[i] - b[i]
+		contributions[i] = FeatureContribution{Index: i, Name: names[i], Contribution: weight * diff * diff}
+		total += contributions[i].Contribution
+	}
+
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].Contribution > contributions[j].Contribution
+	})
+	var cumulative float64
+	for i := range contributions {
+		cumulative += contributions[i].Contribution
+		if total > 0 {
+			contributions[i].CumulativePercent = cumulative / total * 100
+		}
+	}
+	return contributions
+}
@@ -0,0 +1,59 @@
+package drone
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExplainRanksTheDivergentFeatureFirst(t *testing.T) {
+	t.Parallel()
+
+	const dimension = 19
+	vector := func(values map[int]float64) []float64 {
+		features := make([]float64, dimension)
+		for i := range features {
+			features[i] = 1
+		}
+		for i, value := range values {
+			features[i] = value
+		}
+		NormaliseVectorInPlace(features)
+		return features
+	}
+	quiet := map[int]float64{}
+	for i := 0; i < 10; i++ {
+		quiet[i] = 0
+	}
+	classifier := newTestClassifier([]Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: vector(nil)},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: vector(quiet)},
+	}, 1)
+
+	// Close to quad_1 except for a much larger value in feature 5
+	explanation, err := classifier.Explain(vector(map[int]float64{5: 3}))
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	if explanation.Label != "quad" || explanation.PrototypeID != "quad_1" {
+		t.Fatalf("expected quad_1 to explain the quad prediction, got %s for %s", explanation.PrototypeID, explanation.Label)
+	}
+	if len(explanation.Contributions) != dimension {
+		t.Fatalf("expected %d contributions, got %d", dimension, len(explanation.Contributions))
+	}
+	first := explanation.Contributions[0]
+	if first.Index != 5 || first.Name != getFeatureNames(dimension)[5] {
+		t.Fatalf("expected feature 5 (%s) to contribute most, got %d (%s)", getFeatureNames(dimension)[5], first.Index, first.Name)
+	}
+	for i := 1; i < dimension; i++ {
+		if explanation.Contributions[i].Contribution > explanation.Contributions[i-1].Contribution {
+			t.Fatalf("contributions are not sorted descending at %d", i)
+		}
+	}
+	if last := explanation.Contributions[dimension-1].CumulativePercent; math.Abs(last-100) > 1e-9 {
+		t.Fatalf("expected the cumulative percentage to reach 100, got %f", last)
+	}
+
+	if _, err := classifier.Explain(make([]float64, 7)); err == nil {
+		t.Fatal("expected a vector matching no known layout to be rejected")
+	}
+}
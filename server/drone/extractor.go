@@ -0,0 +1,97 @@
+package drone
+
+// Feature Extractors
+//
+// A FeatureExtractor turns a prepared AudioSample into the vector a model compares
+// against its prototypes. The server picks one at startup (PANNS embeddings or the
+// local legacy features) and the HTTP and socket handlers share it, so adding another
+// representation only means adding an implementation here. Extractors whose vectors
+// describe the whole recording report SupportsSlidingWindows false; the handlers then
+// skip per-window analysis, which always uses the legacy features.
+
+import (
+	"errors"
+
+	"song-recognition/embedding"
+	"song-recognition/utils"
+)
+
+const pannsEmbeddingDimension = embedding.DefaultDimension
+
+// FeatureExtractor produces model feature vectors from prepared audio.
+type FeatureExtractor interface {
+	Extract(sample *AudioSample) ([]float64, error)
+	Dimension() int
+	SupportsSlidingWindows() bool
+}
+
+// NewFeatureExtractorFromEnv returns the PANNS extractor, configured by
+// embedding.NewPANNSClientFromEnv, unless USE_PANNS_EMBEDDINGS is disabled, in which
+// case the legacy extractor is used.
+func NewFeatureExtractorFromEnv() FeatureExtractor {
+	if utils.GetEnv("USE_PANNS_EMBEDDINGS", "true") == "true" {
+		return &PANNSExtractor{client: embedding.NewPANNSClientFromEnv()}
+	}
+	return NewLegacyExtractor()
+}
+
+// LegacyExtractor computes the hand-crafted acoustic features locally, or MFCCs when
+// its Config selects the MFCC feature mode.
+type LegacyExtractor struct {
+	Config FeatureConfig
+}
+
+// NewLegacyExtractor returns a legacy extractor using the feature configuration from
+// the environment.
+func NewLegacyExtractor() *LegacyExtractor {
+	return &LegacyExtractor{Config: DefaultFeatureConfig()}
+}
+
+func (e *LegacyExtractor) Extract(sample *AudioSample) ([]float64, error) {
+	var stereo []float64
+	if e.Config.EnableStereo && e.Config.Mode != FeatureModeMFCC && sample.Left != nil {
+		var err error
+		if stereo, err = ExtractStereoFeatures(sample.Left, sample.Right, sample.SampleRate); err != nil {
+			return nil, err
+		}
+	}
+	return extractFeatureVector(sample.Samples, stereo, sample.SampleRate, e.Config, nil)
+}
+
+func (e *LegacyExtractor) Dimension() int { return e.Config.Dimension() }
+
+func (e *LegacyExtractor) SupportsSlidingWindows() bool { return true }
+
+// PANNSExtractor embeds the persisted recording through the PANNS embedding service.
+type PANNSExtractor struct {
+	client *embedding.PANNSClient
+}
+
+// NewPANNSExtractor returns an extractor backed by the service at serviceURL.
+func NewPANNSExtractor(serviceURL string) *PANNSExtractor {
+	return &PANNSExtractor{client: embedding.NewPANNSClient(serviceURL)}
+}
+
+func (e *PANNSExtractor) Extract(sample *AudioSample) ([]float64, error) {
+	if sample.Persisted == "" {
+		return nil, errors.New("PANNS embeddings need a persisted recording")
+	}
+	return e.client.EmbedFile(sample.Persisted)
+}
+
+// ExtractFile embeds the recording at path through the same client, so its cache, retries
+// and dimension check also apply to re-embedding stored prototypes.
+func (e *PANNSExtractor) ExtractFile(path string) ([]float64, error) {
+	return e.client.EmbedFile(path)
+}
+
+// Dimension is the client's expected embedding length; embeddings of any other
+// length are rejected with embedding.ErrDimensionMismatch.
+func (e *PANNSExtractor) Dimension() int {
+	if dimension := e.client.ExpectedDimension(); dimension > 0 {
+		return dimension
+	}
+	return pannsEmbeddingDimension
+}
+
+func (e *PANNSExtractor) SupportsSlidingWindows() bool { return false }
@@ -3,6 +3,7 @@ package drone
 import (
 	"fmt"
 	"math"
+	"sort"
 )
 
 // FeatureScaleAnalysis analyzes the scales of features before normalization
@@ -23,7 +24,7 @@ func AnalyzeFeatureScales(prototypes []Prototype) FeatureScaleAnalysis {
 
 	featureCount := len(prototypes[0].Features)
 	analysis := FeatureScaleAnalysis{
-		FeatureNames: getFeatureNames(),
+		FeatureNames: getFeatureNames(featureCount),
 		MinValues:    make([]float64, featureCount),
 		MaxValues:    make([]float64, featureCount),
 		MeanValues:   make([]float64, featureCount),
@@ -97,6 +98,61 @@ func (f *FeatureScaleAnalysis) PrintFeatureScaleReport() {
 	fmt.Println()
 }
 
+// FeatureDelta is the change in one feature between two vectors.
+type FeatureDelta struct {
+	Index    int
+	Name     string
+	A        float64
+	B        float64
+	Absolute float64 // |A - B|
+	Relative float64 // |A - B| / max(|A|, |B|), 0 when both are 0
+}
+
+// DiffFeatures compares a and b feature by feature, over their common length, and
+// returns the deltas largest relative change first. Legacy features do not share a
+// scale (a harmonic count of several next to a variance near 0.01), so the relative
+// change is what singles out the dimension that drifted. Legacy vectors get their
+// feature names.
+func DiffFeatures(a, b []float64) []FeatureDelta {
+	count := min(len(a), len(b))
+	names := getFeatureNames(count)
+
+	deltas := make([]FeatureDelta, count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("Feature %d", i)
+		if len(names) == count {
+			name = names[i]
+		}
+		absolute := math.Abs(a[i] - b[i])
+		relative := 0.0
+		if scale := math.Max(math.Abs(a[i]), math.Abs(b[i])); scale > 0 {
+			relative = absolute / scale
+		}
+		deltas[i] = FeatureDelta{Index: i, Name: name, A: a[i], B: b[i], Absolute: absolute, Relative: relative}
+	}
+
+	sort.SliceStable(deltas, func(i, j int) bool {
+		if deltas[i].Relative != deltas[j].Relative {
+			return deltas[i].Relative > deltas[j].Relative
+		}
+		return deltas[i].Absolute > deltas[j].Absolute
+	})
+	return deltas
+}
+
+// PrintFeatureDiff prints the first limit deltas of DiffFeatures(prototype, inference)
+// (all of them when limit <= 0).
+func PrintFeatureDiff(deltas []FeatureDelta, limit int) {
+	if limit <= 0 || limit > len(deltas) {
+		limit = len(deltas)
+	}
+	fmt.Printf("%-28s %14s %14s %12s %9s\n", "Feature", "Prototype", "Inference", "Abs delta", "Rel")
+	for _, delta := range deltas[:limit] {
+		fmt.Printf("%-28s %14.6f %14.6f %12.6f %8.1f%%\n",
+			delta.Name, delta.A, delta.B, delta.Absolute, delta.Relative*100)
+	}
+}
+
 // CheckScaleIssues identifies potential scale mismatches
 func (f *FeatureScaleAnalysis) CheckScaleIssues() []string {
 	issues := []string{}
@@ -155,8 +211,36 @@ func (f *FeatureScaleAnalysis) CheckScaleIssues() []string {
 	return issues
 }
 
-func getFeatureNames() []string {
-	return []string{
+// getFeatureNames returns the legacy feature names for vectors of the given length,
+// preferring the configured optional features when several layouts share a length.
+func getFeatureNames(featureCount int) []string {
+	configured := DefaultFeatureConfig()
+	candidates := []FeatureConfig{
+		configured,
+		{},
+		{EnableSecondaryRolloff: true},
+		{EnableRobustEnergy: true},
+		{EnableSecondaryRolloff: true, EnableRobustEnergy: true},
+		{EnableStereo: true},
+		{Mode: FeatureModeMFCC},
+	}
+	for _, config := range candidates {
+		if config.Dimension() == featureCount {
+			return featureNames(config)
+		}
+	}
+	return featureNames(FeatureConfig{})
+}
+
+func featureNames(config FeatureConfig) []string {
+	if config.Mode == FeatureModeMFCC {
+		names := make([]string, MFCCCoefficientCount)
+		for i := range names {
+			names[i] = fmt.Sprintf("MFCC %d", i)
+		}
+		return names
+	}
+	names := []string{
 		"Energy (RMS)",
 		"Zero Crossing Rate",
 		"Spectral Centroid",
@@ -173,10 +257,17 @@ func getFeatureNames() []string {
 		"Spectral Skewness",
 		"Spectral Kurtosis",
 		"Peak Prominence",
-		"Harmonic Ratio",
-		"Harmonic Count",
-		"Harmonic Strength",
 	}
+	if config.EnableSecondaryRolloff {
+		names = append(names, "Secondary Spectral Rolloff", "Rolloff Spread")
+	}
+	if config.EnableRobustEnergy {
+		names = append(names, "Median Frame Energy", "Temporal Crest Factor")
+	}
+	if config.EnableStereo {
+		names = append(names, "Inter-channel Level Difference", "Inter-channel Time Difference", "Inter-channel Coherence")
+	}
+	return append(names, "Harmonic Ratio", "Harmonic Count", "Harmonic Strength")
 }
 
 // ConfidenceAnalysis explains why confidence might not be 100% even for identical audio
@@ -189,6 +280,8 @@ The confidence score is calculated using k-nearest neighbors (k-NN) classificati
 1. Distance Calculation:
    - Cosine similarity is computed between input features and all prototypes
    - Distance = 1 - cosine_similarity (ranges from 0 to 2)
+   - PANNS embeddings and unscaled features are non-negative, so their distances stay
+     within 0 to 1; standardised legacy features are signed and can reach 2
    - Lower distance = more similar
 
 2. Weight Calculation:
@@ -0,0 +1,46 @@
+package drone
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDiffFeaturesFindsTheDriftedFeature(t *testing.T) {
+	t.Parallel()
+
+	config := FeatureConfig{}
+	names := featureNames(config)
+	prototype := make([]float64, config.Dimension())
+	for i := range prototype {
+		prototype[i] = 0.1 * float64(i+1)
+	}
+	harmonicCount := config.Dimension() - 2
+	prototype[harmonicCount] = 6
+
+	inference := append([]float64(nil), prototype...)
+	inference[harmonicCount] = 7 // one more harmonic: the largest absolute delta
+	inference[11] *= 1.4         // 40% onset-rate change: the real culprit
+	inference[5] *= 1.05
+
+	deltas := DiffFeatures(prototype, inference)
+	if len(deltas) != len(prototype) {
+		t.Fatalf("expected %d deltas, got %d", len(prototype), len(deltas))
+	}
+	top := deltas[0]
+	if top.Index != 11 || top.Name != names[11] {
+		t.Fatalf("expected %q to change most, got %+v", names[11], top)
+	}
+	if math.Abs(top.Relative-0.4/1.4) > 1e-9 || math.Abs(top.Absolute-1.2*0.4) > 1e-9 {
+		t.Fatalf("unexpected delta for %s: %+v", top.Name, top)
+	}
+	if deltas[1].Index != harmonicCount || deltas[2].Index != 5 {
+		t.Fatalf("expected the harmonic count and then the 5%% change next, got %s and %s", deltas[1].Name, deltas[2].Name)
+	}
+	if deltas[len(deltas)-1].Absolute != 0 {
+		t.Fatalf("expected unchanged features last, got %+v", deltas[len(deltas)-1])
+	}
+
+	if embedding := DiffFeatures(make([]float64, 2048), make([]float64, 2048)); embedding[0].Name != "Feature 0" {
+		t.Fatalf("expected generic names for embeddings, got %q", embedding[0].Name)
+	}
+}
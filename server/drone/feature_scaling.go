@@ -12,10 +12,32 @@ package drone
 // contribute to the final distance metric.
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
+// ScalingMetadataKey marks, with the value ScalingDisabled, prototypes saved by a
+// classifier loaded with LoadOptions.DisableScaling.
+const (
+	ScalingMetadataKey = "feature_scaling"
+	ScalingDisabled    = "disabled"
+)
+
+// scalingDisabledByMetadata reports whether any prototype was saved with scaling disabled.
+func scalingDisabledByMetadata(prototypes []Prototype) bool {
+	for _, proto := range prototypes {
+		if proto.Metadata[ScalingMetadataKey] == ScalingDisabled {
+			return true
+		}
+	}
+	return false
+}
+
 // FeatureScaler standardizes features across a dataset using z-score normalization.
 // Each feature dimension is transformed to have mean=0 and std=1.
 type FeatureScaler struct {
@@ -84,6 +106,51 @@ func (fs *FeatureScaler) Transform(features []float64) []float64 {
 	return scaled
 }
 
+// ScalerPath returns the sidecar file holding the scaler for the model at modelPath,
+// e.g. prototypes.json -> prototypes.scaler.json.
+func ScalerPath(modelPath string) string {
+	return strings.TrimSuffix(modelPath, filepath.Ext(modelPath)) + ".scaler.json"
+}
+
+// LoadFeatureScaler reads a scaler saved by SaveFeatureScaler. It returns nil and no
+// error when the file does not exist.
+func LoadFeatureScaler(path string) (*FeatureScaler, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature scaler: %w", err)
+	}
+
+	var scaler FeatureScaler
+	if err := json.Unmarshal(data, &scaler); err != nil {
+		return nil, fmt.Errorf("failed to parse feature scaler (%s): %w", path, err)
+	}
+	if len(scaler.Mean) == 0 || len(scaler.Mean) != len(scaler.Stddev) {
+		return nil, fmt.Errorf("feature scaler %s has %d means and %d deviations", path, len(scaler.Mean), len(scaler.Stddev))
+	}
+	return &scaler, nil
+}
+
+// SaveFeatureScaler writes the scaler to path atomically.
+func SaveFeatureScaler(path string, scaler *FeatureScaler) error {
+	data, err := json.MarshalIndent(scaler, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal feature scaler: %w", err)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write feature scaler: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
+
 // TransformAndNormalize applies scaling followed by L2 normalization
 func (fs *FeatureScaler) TransformAndNormalize(features []float64) []float64 {
 	scaled := fs.Transform(features)
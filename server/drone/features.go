@@ -29,6 +29,17 @@ package drone
 //   - Spectral Kurtosis: Peakedness of the frequency distribution
 //   - Peak Prominence: Contrast between the strongest peaks and average spectrum level
 //
+// Optional High-Frequency Features (FeatureConfig.EnableSecondaryRolloff):
+//   - Secondary Rolloff: Rolloff at a higher percentile (default 95%)
+//   - Rolloff Spread: Secondary minus primary rolloff; small propellers push energy
+//     into the upper band and widen the spread
+//
+// Optional Robust Energy Features (FeatureConfig.EnableRobustEnergy):
+//   - Median Frame Energy: Median RMS over 20 ms frames; a door slam or clap barely
+//     moves it, unlike the whole-window RMS
+//   - Temporal Crest Factor: Loudest frame relative to the median frame; high for
+//     impulsive noise, close to zero for a sustained rotor
+//
 // Harmonic Features (critical for drone detection):
 //   - Harmonic Ratio: Ratio of harmonic energy to total energy
 //   - Harmonic Count: Number of significant harmonic peaks
@@ -41,21 +52,144 @@ package drone
 // 4. Compute Features: Calculate each feature from the magnitude spectrum
 // 5. Normalize: Vector is normalized to unit length for distance-based classification
 //
-// These features form a compact 19-dimensional descriptor that captures the acoustic
-// signature of drone propellers, which typically have distinct spectral characteristics
-// including harmonic content, rotor blade frequencies, and motor noise patterns.
+// These features form a compact 19-dimensional descriptor (two or three more for each
+// optional group) that captures the acoustic signature of drone propellers, which
+// typically have distinct spectral characteristics including harmonic content, rotor
+// blade frequencies, and motor noise patterns. Harmonic features always come last.
 
 import (
 	"errors"
 	"math"
 	"math/cmplx"
 	"sort"
+	"strconv"
+	"strings"
 
-	"song-recognition/shazam"
+	"song-recognition/utils"
 )
 
-// ExtractFeatureVector derives a compact descriptor for an audio waveform.
+const (
+	baseFeatureCount             = 19
+	secondaryRolloffFeatureCount = 2
+	robustEnergyFeatureCount     = 2
+
+	energyFrameSeconds  = 0.02
+	defaultOnsetRateCap = 20.0 // significant onsets per second
+
+	// FFTSizeMetadataKey records FeatureConfig.FFTSize on prototypes built with a fixed
+	// FFT size, so a model can be checked against the running configuration.
+	FFTSizeMetadataKey = "fft_size"
+)
+
+// FeatureMode selects the local feature front-end.
+type FeatureMode string
+
+const (
+	FeatureModeLegacy FeatureMode = "legacy" // the hand-crafted features, the default
+	FeatureModeMFCC   FeatureMode = "mfcc"   // MFCCCoefficientCount mel-frequency cepstral coefficients (see ExtractMFCC)
+)
+
+// FeatureConfig selects optional features. Prototypes and recordings must be extracted
+// with the same configuration because enabling a feature changes the vector dimension.
+type FeatureConfig struct {
+	Mode                       FeatureMode // legacy (default) or mfcc; the options below only apply to legacy features
+	RolloffPercentile          float64     // default 0.85
+	EnableSecondaryRolloff     bool
+	SecondaryRolloffPercentile float64 // default 0.95
+	EnableRobustEnergy         bool
+	OnsetRateCap               float64 // onsets per second mapped to 1.0; default 20
+	EnableWhitening            bool    // flatten the long-term spectrum before spectral features
+	EnableStereo               bool    // append inter-channel level/time difference and coherence (see ExtractStereoFeatures)
+	FFTSize                    int     // fixed FFT size (a power of two); 0 sizes the FFT to each clip
+}
+
+// DefaultFeatureConfig returns the feature configuration from the environment.
+func DefaultFeatureConfig() FeatureConfig {
+	return FeatureConfig{
+		Mode:                       parseFeatureMode(utils.GetEnv("DRONE_FEATURE_MODE", "legacy")),
+		RolloffPercentile:          parsePercentile(utils.GetEnv("DRONE_ROLLOFF_PERCENTILE", "0.85"), 0.85),
+		EnableSecondaryRolloff:     utils.GetEnv("DRONE_SECONDARY_ROLLOFF", "false") == "true",
+		SecondaryRolloffPercentile: parsePercentile(utils.GetEnv("DRONE_SECONDARY_ROLLOFF_PERCENTILE", "0.95"), 0.95),
+		EnableRobustEnergy:         utils.GetEnv("DRONE_ROBUST_ENERGY", "false") == "true",
+		EnableWhitening:            utils.GetEnv("DRONE_SPECTRAL_WHITENING", "false") == "true",
+		EnableStereo:               utils.GetEnv("DRONE_STEREO_FEATURES", "false") == "true",
+		OnsetRateCap:               parsePositive(utils.GetEnv("DRONE_ONSET_RATE_CAP", "20"), defaultOnsetRateCap),
+		FFTSize:                    parseFFTSize(utils.GetEnv("DRONE_FFT_SIZE", "0")),
+	}
+}
+
+// Dimension returns the length of feature vectors extracted with this configuration.
+func (c FeatureConfig) Dimension() int {
+	if c.Mode == FeatureModeMFCC {
+		return MFCCCoefficientCount
+	}
+	dimension := baseFeatureCount
+	if c.EnableSecondaryRolloff {
+		dimension += secondaryRolloffFeatureCount
+	}
+	if c.EnableRobustEnergy {
+		dimension += robustEnergyFeatureCount
+	}
+	if c.EnableStereo {
+		dimension += stereoFeatureCount
+	}
+	return dimension
+}
+
+// parseFeatureMode accepts "mfcc" (any case); anything else selects the legacy features.
+func parseFeatureMode(value string) FeatureMode {
+	if FeatureMode(strings.ToLower(strings.TrimSpace(value))) == FeatureModeMFCC {
+		return FeatureModeMFCC
+	}
+	return FeatureModeLegacy
+}
+
+func parsePositive(value string, fallback float64) float64 {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed <= 0 || math.IsInf(parsed, 0) {
+		return fallback
+	}
+	return parsed
+}
+
+// parseFFTSize accepts a power of two of at least 256; anything else selects the
+// per-clip FFT size.
+func parseFFTSize(value string) int {
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 256 || parsed&(parsed-1) != 0 {
+		return 0
+	}
+	return parsed
+}
+
+func parsePercentile(value string, fallback float64) float64 {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed <= 0 || parsed >= 1 {
+		return fallback
+	}
+	return parsed
+}
+
+// ExtractFeatureVector derives a compact descriptor for an audio waveform using the
+// feature configuration from the environment.
 func ExtractFeatureVector(samples []float64, sampleRate int) ([]float64, error) {
+	return ExtractFeatureVectorWithConfig(samples, sampleRate, DefaultFeatureConfig())
+}
+
+// ExtractFeatureVectorWithConfig derives a descriptor using an explicit feature configuration.
+// With EnableStereo the samples are treated as mono; see LegacyExtractor for stereo input.
+func ExtractFeatureVectorWithConfig(samples []float64, sampleRate int, config FeatureConfig) ([]float64, error) {
+	return extractFeatureVector(samples, nil, sampleRate, config, nil)
+}
+
+// extractFeatureVector derives the descriptor of samples, appending stereo (from
+// ExtractStereoFeatures) when config.EnableStereo is set; nil stereo means mono. A
+// non-nil buffers is reused for the spectrum. In the MFCC mode it returns the MFCCs of
+// samples instead.
+func extractFeatureVector(samples []float64, stereo []float64, sampleRate int, config FeatureConfig, buffers *spectrumBuffers) ([]float64, error) {
+	if config.Mode == FeatureModeMFCC {
+		return ExtractMFCC(samples, sampleRate, MFCCCoefficientCount)
+	}
 	if len(samples) == 0 {
 		return nil, errors.New("no samples provided")
 	}
@@ -67,17 +201,27 @@ func ExtractFeatureVector(samples []float64, sampleRate int) ([]float64, error)
 	zcr := zeroCrossingRate(samples)
 	variance := signalVariance(samples)
 
-	spectrum, freqs := computeSpectrum(samples, sampleRate)
+	if buffers == nil {
+		buffers = &spectrumBuffers{}
+	}
+	spectrum, freqs := buffers.compute(samples, sampleRate, config.FFTSize)
+	if config.EnableWhitening {
+		whitenSpectrum(spectrum)
+	}
 	centroid := spectralCentroid(spectrum, freqs)
 	bandwidth := spectralBandwidth(spectrum, freqs, centroid)
-	rolloff := spectralRolloff(spectrum, freqs, 0.85)
+	rolloff := spectralRolloff(spectrum, freqs, config.RolloffPercentile)
+	var secondaryRolloff float64
+	if config.EnableSecondaryRolloff {
+		secondaryRolloff = spectralRolloff(spectrum, freqs, config.SecondaryRolloffPercentile)
+	}
 	flatness := spectralFlatness(spectrum)
 	crest := spectralCrestFactor(spectrum)
 	entropy := spectralEntropy(spectrum)
 	dominant := dominantFrequency(spectrum, freqs)
 
 	temporalCentre := temporalCentroid(samples, sampleRate)
-	onsetRateNorm := onsetRate(samples, sampleRate)
+	onsetRateNorm := onsetRate(samples, sampleRate, config.OnsetRateCap)
 	amDepth := amplitudeModulationDepth(samples)
 	// Calculate skewness and kurtosis using raw Hz values (they're normalized internally)
 	skewness := spectralSkewness(spectrum, freqs, centroid, bandwidth)
@@ -99,6 +243,7 @@ func ExtractFeatureVector(samples []float64, sampleRate int) ([]float64, error)
 		centroid = clamp01(centroid / nyquistFreq)
 		bandwidth = clamp01(bandwidth / nyquistFreq)
 		rolloff = clamp01(rolloff / nyquistFreq)
+		secondaryRolloff = clamp01(secondaryRolloff / nyquistFreq)
 		dominant = clamp01(dominant / nyquistFreq)
 	}
 
@@ -108,7 +253,8 @@ func ExtractFeatureVector(samples []float64, sampleRate int) ([]float64, error)
 	// Kurtosis typically ranges from -3 to 10+, normalize to 0-1
 	kurtosis = clamp01((kurtosis + 3.0) / 13.0) // Shift and scale to 0-1 range
 
-	return []float64{
+	features := make([]float64, 0, config.Dimension())
+	features = append(features,
 		energy,
 		zcr,
 		centroid,
@@ -125,10 +271,24 @@ func ExtractFeatureVector(samples []float64, sampleRate int) ([]float64, error)
 		skewness,
 		kurtosis,
 		peakProminence,
-		harmonicRatio,
-		harmonicCount,
-		harmonicStrength,
-	}, nil
+	)
+	if config.EnableSecondaryRolloff {
+		features = append(features, secondaryRolloff, secondaryRolloff-rolloff)
+	}
+	if config.EnableRobustEnergy {
+		medianEnergy, temporalCrest := frameEnergyStats(samples, sampleRate)
+		features = append(features, medianEnergy, temporalCrest)
+	}
+	if config.EnableStereo {
+		if stereo == nil {
+			stereo = monoStereoFeatures
+		}
+		features = append(features, stereo...)
+	}
+	// Harmonic features stay last; model loading inspects them by position
+	features = append(features, harmonicRatio, harmonicCount, harmonicStrength)
+
+	return features, nil
 }
 
 func rootMeanSquare(samples []float64) float64 {
@@ -142,6 +302,38 @@ func rootMeanSquare(samples []float64) float64 {
 	return math.Sqrt(sum / float64(len(samples)))
 }
 
+// frameEnergyStats returns the median RMS over short frames and the loudest frame's
+// excess over that median (normalised to 0-1).
+func frameEnergyStats(samples []float64, sampleRate int) (median float64, temporalCrest float64) {
+	frameSize := max(1, int(float64(sampleRate)*energyFrameSeconds))
+	var frames []float64
+	for start := 0; start < len(samples); start += frameSize {
+		end := min(start+frameSize, len(samples))
+		frames = append(frames, rootMeanSquare(samples[start:end]))
+	}
+	if len(frames) == 0 {
+		return 0, 0
+	}
+
+	peak := 0.0
+	for _, energy := range frames {
+		peak = math.Max(peak, energy)
+	}
+	sort.Float64s(frames)
+	median = frames[len(frames)/2]
+	if len(frames)%2 == 0 {
+		median = (frames[len(frames)/2-1] + frames[len(frames)/2]) / 2
+	}
+	if median <= 1e-12 {
+		if peak > 1e-12 {
+			return median, 1
+		}
+		return median, 0
+	}
+	// A sustained source stays near 1x; a transient 20x above the bed saturates
+	return median, clamp01((peak/median - 1) / 19)
+}
+
 func zeroCrossingRate(samples []float64) float64 {
 	if len(samples) <= 1 {
 		return 0
@@ -175,24 +367,149 @@ func signalVariance(samples []float64) float64 {
 	return variance / float64(len(samples))
 }
 
-func computeSpectrum(samples []float64, sampleRate int) ([]float64, []float64) {
-	fftSize := nextPowerOfTwo(len(samples))
-	buffer := make([]float64, fftSize)
-	copy(buffer, samples)
-	applyHannWindow(buffer)
+// computeSpectrum returns the magnitude spectrum of samples and the bin frequencies.
+// With fftSize 0 a single FFT covers the whole clip, so the frequency resolution
+// depends on its length. A fixed fftSize instead averages Hann-windowed segments of
+// that size with 50% overlap (zero-padding clips shorter than one segment), so clips
+// of any length share one resolution.
+func computeSpectrum(samples []float64, sampleRate int, fftSize int) ([]float64, []float64) {
+	var buffers spectrumBuffers
+	return buffers.compute(samples, sampleRate, fftSize)
+}
+
+// spectrumBuffers holds the FFT plan and buffers, Hann window, magnitudes and bin
+// frequencies computeSpectrum needs for one FFT size, so a run of equally sized
+// windows can reuse them. The returned slices are overwritten by the next compute.
+type spectrumBuffers struct {
+	fftSize    int
+	sampleRate int
+	plan       fftPlan
+	buffer     []complex128
+	hann       []float64
+	magnitude  []float64
+	freqs      []float64
+}
+
+// compute is computeSpectrum using, and if the FFT size or sample rate changed
+// replacing, the buffers in b.
+func (b *spectrumBuffers) compute(samples []float64, sampleRate int, fftSize int) ([]float64, []float64) {
+	segmentCount := 1
+	if fftSize <= 0 {
+		fftSize = nextPowerOfTwo(len(samples))
+	} else if len(samples) > fftSize {
+		segmentCount = (len(samples)-fftSize)/(fftSize/2) + 1
+	}
 
-	fft := shazam.FFT(buffer)
 	binCount := fftSize / 2
-	magnitude := make([]float64, binCount)
-	freqs := make([]float64, binCount)
+	if b.fftSize != fftSize || b.sampleRate != sampleRate {
+		b.fftSize, b.sampleRate = fftSize, sampleRate
+		b.plan = newFFTPlan(fftSize)
+		b.buffer = make([]complex128, fftSize)
+		b.hann = make([]float64, fftSize)
+		for i := range b.hann {
+			b.hann[i] = 1
+		}
+		applyHannWindow(b.hann)
+		b.magnitude = make([]float64, binCount)
+		b.freqs = make([]float64, binCount)
+		for i := range b.freqs {
+			b.freqs[i] = float64(i) * float64(sampleRate) / float64(fftSize)
+		}
+	}
+	clear(b.magnitude)
+
+	hop := fftSize / 2
+	for segment := 0; segment < segmentCount; segment++ {
+		clear(b.buffer)
+		for i, sample := range samples[segment*hop : min(segment*hop+fftSize, len(samples))] {
+			b.buffer[i] = complex(sample*b.hann[i], 0)
+		}
+
+		b.plan.transform(b.buffer)
+		for i := 0; i < binCount; i++ {
+			b.magnitude[i] += cmplx.Abs(b.buffer[i]) / float64(segmentCount)
+		}
+	}
+
+	return b.magnitude, b.freqs
+}
+
+// fftPlan is an in-place iterative radix-2 FFT of one power-of-two size, computing the
+// bit-reversal permutation and twiddle factors once rather than allocating at every
+// level of the recursion like shazam.FFT.
+type fftPlan struct {
+	reversed []int
+	twiddles []complex128
+}
+
+func newFFTPlan(size int) fftPlan {
+	plan := fftPlan{reversed: make([]int, size), twiddles: make([]complex128, size/2)}
+	bits := 0
+	for 1<<bits < size {
+		bits++
+	}
+	for i := range plan.reversed {
+		for bit := 0; bit < bits; bit++ {
+			if i&(1<<bit) != 0 {
+				plan.reversed[i] |= 1 << (bits - 1 - bit)
+			}
+		}
+	}
+	for k := range plan.twiddles {
+		angle := -2 * math.Pi * float64(k) / float64(size)
+		plan.twiddles[k] = complex(math.Cos(angle), math.Sin(angle))
+	}
+	return plan
+}
+
+// transform replaces data, whose length is the plan's size, with its FFT.
+func (p fftPlan) transform(data []complex128) {
+	for i, j := range p.reversed {
+		if i < j {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+	for size := 2; size <= len(data); size <<= 1 {
+		half, step := size/2, len(data)/size
+		for start := 0; start < len(data); start += size {
+			for k := 0; k < half; k++ {
+				t := p.twiddles[k*step] * data[start+k+half]
+				data[start+k+half] = data[start+k] - t
+				data[start+k] += t
+			}
+		}
+	}
+}
+
+// whitenSpectrum divides each bin by the mean magnitude of the surrounding 1/3 octave,
+// in place. Microphone colouration is smooth across frequency, so it cancels out, while
+// narrow peaks such as rotor harmonics stand out against their neighbourhood.
+func whitenSpectrum(magnitude []float64) {
+	if len(magnitude) < 2 {
+		return
+	}
+
+	prefix := make([]float64, len(magnitude)+1)
+	for i, mag := range magnitude {
+		prefix[i+1] = prefix[i] + mag
+	}
 
-	for i := 0; i < binCount; i++ {
-		mag := cmplx.Abs(fft[i])
-		magnitude[i] = mag
-		freqs[i] = float64(i) * float64(sampleRate) / float64(fftSize)
+	const halfBand = 1.122462048309373 // 2^(1/6): the band spans 1/3 octave
+	const minHalfWidth = 4
+	envelope := make([]float64, len(magnitude))
+	for i := range magnitude {
+		lo := min(int(float64(i)/halfBand), i-minHalfWidth)
+		hi := max(int(float64(i)*halfBand), i+minHalfWidth)
+		lo = max(lo, 0)
+		hi = min(hi, len(magnitude)-1)
+		envelope[i] = (prefix[hi+1] - prefix[lo]) / float64(hi-lo+1)
 	}
 
-	return magnitude, freqs
+	for i := range magnitude {
+		if envelope[i] > 0 {
+			magnitude[i] /= envelope[i]
+		}
+	}
 }
 
 func nextPowerOfTwo(n int) int {
@@ -538,8 +855,9 @@ func temporalCentroid(samples []float64, sampleRate int) float64 {
 	return centroidIndex / float64(len(samples))
 }
 
-// onsetRate estimates the rate of amplitude onsets, normalised to 0-1 with cap.
-func onsetRate(samples []float64, sampleRate int) float64 {
+// onsetRate estimates the rate of amplitude onsets, normalised to 0-1 by maxRate
+// onsets per second (defaultOnsetRateCap when maxRate is not positive).
+func onsetRate(samples []float64, sampleRate int, maxRate float64) float64 {
 	if len(samples) < 2 || sampleRate <= 0 {
 		return 0
 	}
@@ -577,7 +895,9 @@ func onsetRate(samples []float64, sampleRate int) float64 {
 	}
 
 	rate := float64(onsetCount) / duration
-	const maxRate = 20.0 // normalise assuming max 20 significant onsets per second
+	if maxRate <= 0 {
+		maxRate = defaultOnsetRateCap
+	}
 	if rate > maxRate {
 		rate = maxRate
 	}
@@ -0,0 +1,307 @@
+package drone
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+func TestSecondaryRolloffExceedsPrimaryForBroadbandSignal(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 44100
+	rng := rand.New(rand.NewSource(7))
+	samples := make([]float64, sampleRate/2)
+	for i := range samples {
+		samples[i] = rng.Float64()*2 - 1
+	}
+
+	spectrum, freqs := computeSpectrum(samples, sampleRate, 0)
+	primary := spectralRolloff(spectrum, freqs, 0.85)
+	secondary := spectralRolloff(spectrum, freqs, 0.95)
+	if secondary <= primary {
+		t.Fatalf("expected 0.95 rolloff above 0.85 rolloff, got %.1f Hz <= %.1f Hz", secondary, primary)
+	}
+
+	config := FeatureConfig{RolloffPercentile: 0.85, EnableSecondaryRolloff: true, SecondaryRolloffPercentile: 0.95}
+	features, err := ExtractFeatureVectorWithConfig(samples, sampleRate, config)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+	if len(features) != config.Dimension() {
+		t.Fatalf("expected %d features, got %d", config.Dimension(), len(features))
+	}
+	if names := getFeatureNames(len(features)); len(names) != len(features) {
+		t.Fatalf("expected %d feature names, got %d", len(features), len(names))
+	}
+
+	spread := features[baseFeatureCount-harmonicFeatureCount+1]
+	if spread <= 0 {
+		t.Fatalf("expected positive rolloff spread, got %.4f", spread)
+	}
+
+	legacy, err := ExtractFeatureVectorWithConfig(samples, sampleRate, FeatureConfig{RolloffPercentile: 0.85})
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+	if len(legacy) != baseFeatureCount {
+		t.Fatalf("expected %d features with the flag off, got %d", baseFeatureCount, len(legacy))
+	}
+}
+
+func TestRobustEnergyIgnoresSingleTransient(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 44100
+	steady := make([]float64, sampleRate)
+	for i := range steady {
+		steady[i] = 0.1 * math.Sin(2*math.Pi*180*float64(i)/sampleRate)
+	}
+	// A 50 ms door slam near full scale
+	slammed := append([]float64(nil), steady...)
+	for i := sampleRate / 2; i < sampleRate/2+sampleRate/20; i++ {
+		slammed[i] = 0.95 * math.Sin(2*math.Pi*90*float64(i)/sampleRate)
+	}
+
+	config := FeatureConfig{RolloffPercentile: 0.85, EnableRobustEnergy: true}
+	before, err := ExtractFeatureVectorWithConfig(steady, sampleRate, config)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+	after, err := ExtractFeatureVectorWithConfig(slammed, sampleRate, config)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+	if len(after) != config.Dimension() || config.Dimension() != baseFeatureCount+robustEnergyFeatureCount {
+		t.Fatalf("expected %d features, got %d", config.Dimension(), len(after))
+	}
+
+	medianIdx := baseFeatureCount - harmonicFeatureCount
+	if rmsGrowth := after[0] / before[0]; rmsGrowth < 2 {
+		t.Fatalf("expected the transient to spike plain RMS, grew only %.2fx", rmsGrowth)
+	}
+	if change := math.Abs(after[medianIdx]-before[medianIdx]) / before[medianIdx]; change > 0.05 {
+		t.Fatalf("expected median frame energy to hold steady, changed by %.1f%%", change*100)
+	}
+	if before[medianIdx+1] > 0.05 || after[medianIdx+1] < 0.3 {
+		t.Fatalf("expected temporal crest to flag the transient, got %.3f -> %.3f", before[medianIdx+1], after[medianIdx+1])
+	}
+	if names := featureNames(config); names[medianIdx] != "Median Frame Energy" {
+		t.Fatalf("expected feature names to follow the layout, got %q", names[medianIdx])
+	}
+}
+
+func TestOnsetRateCapAvoidsClipping(t *testing.T) {
+	const sampleRate = 44100
+	// A 60 Hz rectified hum yields ~120 onsets per second, far above the default cap
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*60*float64(i)/sampleRate)
+	}
+
+	const onsetIdx = 11
+	clipped, err := ExtractFeatureVectorWithConfig(samples, sampleRate, FeatureConfig{RolloffPercentile: 0.85})
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+	widened := FeatureConfig{RolloffPercentile: 0.85, OnsetRateCap: 400}
+	unclipped, err := ExtractFeatureVectorWithConfig(samples, sampleRate, widened)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+
+	if len(unclipped) != len(clipped) {
+		t.Fatalf("onset cap changed the vector dimension: %d vs %d", len(unclipped), len(clipped))
+	}
+	if clipped[onsetIdx] != 1 {
+		t.Fatalf("expected the default cap to clip the onset rate, got %.3f", clipped[onsetIdx])
+	}
+	if unclipped[onsetIdx] <= 0.1 || unclipped[onsetIdx] >= 0.9 {
+		t.Fatalf("expected a distinguishable onset rate with a 400/s cap, got %.3f", unclipped[onsetIdx])
+	}
+	if names := featureNames(widened); names[onsetIdx] != "Onset Rate" {
+		t.Fatalf("expected index %d to be the onset rate, got %q", onsetIdx, names[onsetIdx])
+	}
+}
+
+func TestWhiteningReducesMicrophoneColouration(t *testing.T) {
+	const sampleRate = 44100
+	rng := rand.New(rand.NewSource(11))
+	source := make([]float64, sampleRate)
+	for i := range source {
+		seconds := float64(i) / sampleRate
+		for h := 1.0; h <= 4; h++ {
+			source[i] += 0.2 / h * math.Sin(2*math.Pi*180*h*seconds)
+		}
+		source[i] += 0.05 * (rng.Float64()*2 - 1)
+	}
+
+	// Two microphones: one bass-heavy (low-pass), one tinny (first difference)
+	bassy := make([]float64, len(source))
+	tinny := make([]float64, len(source))
+	var low float64
+	for i, s := range source {
+		low += 0.1 * (s - low)
+		bassy[i] = low
+		if i > 0 {
+			tinny[i] = s - source[i-1]
+		}
+	}
+
+	distance := func(config FeatureConfig) float64 {
+		a, err := ExtractFeatureVectorWithConfig(bassy, sampleRate, config)
+		if err != nil {
+			t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+		}
+		b, err := ExtractFeatureVectorWithConfig(tinny, sampleRate, config)
+		if err != nil {
+			t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+		}
+		if len(a) != config.Dimension() {
+			t.Fatalf("expected %d features, got %d", config.Dimension(), len(a))
+		}
+		var sum float64
+		for i := range a {
+			sum += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return math.Sqrt(sum)
+	}
+
+	plain := distance(FeatureConfig{RolloffPercentile: 0.85})
+	whitened := distance(FeatureConfig{RolloffPercentile: 0.85, EnableWhitening: true})
+	if whitened >= plain {
+		t.Fatalf("expected whitening to bring coloured versions closer, got %.4f >= %.4f", whitened, plain)
+	}
+	t.Logf("feature distance between microphones: %.4f plain, %.4f whitened", plain, whitened)
+}
+
+func TestFixedFFTSizeMatchesFeaturesAcrossClipLengths(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 16000
+	tone := func(samples int) []float64 {
+		rng := rand.New(rand.NewSource(int64(samples)))
+		clip := make([]float64, samples)
+		for i := range clip {
+			phase := 2 * math.Pi * 440 * float64(i) / sampleRate
+			clip[i] = 0.5*math.Sin(phase) + 0.2*math.Sin(3*phase) + 0.02*(rng.Float64()*2-1)
+		}
+		return clip
+	}
+	// 2.1 s pads to a 65536-point FFT, which 4 s nearly fills
+	short, long := tone(sampleRate*21/10), tone(sampleRate*4)
+
+	centroidGap := func(config FeatureConfig) float64 {
+		a, err := ExtractFeatureVectorWithConfig(short, sampleRate, config)
+		if err != nil {
+			t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+		}
+		b, err := ExtractFeatureVectorWithConfig(long, sampleRate, config)
+		if err != nil {
+			t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+		}
+		return math.Abs(a[2] - b[2]) // spectral centroid, normalised by Nyquist
+	}
+
+	variable := centroidGap(FeatureConfig{RolloffPercentile: 0.85})
+	fixed := centroidGap(FeatureConfig{RolloffPercentile: 0.85, FFTSize: 4096})
+	if fixed > 1e-3 {
+		t.Fatalf("expected matching centroids under a fixed FFT size, gap %.6f", fixed)
+	}
+	if fixed >= variable {
+		t.Fatalf("expected the fixed FFT size to narrow the centroid gap, got %.6f vs %.6f", fixed, variable)
+	}
+}
+
+func TestPrototypesRecordTheFixedFFTSize(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+	source := filepath.Join(t.TempDir(), "hover.wav")
+	writeEvaluationTone(t, source, 440)
+
+	proto, err := BuildPrototypeFromPath(source, "quad", "drone", "", "hover.wav", nil)
+	if err != nil {
+		t.Fatalf("BuildPrototypeFromPath returned error: %v", err)
+	}
+	if _, ok := proto.Metadata[FFTSizeMetadataKey]; ok {
+		t.Fatalf("expected no FFT size metadata for per-clip FFTs, got %v", proto.Metadata)
+	}
+
+	t.Setenv("DRONE_FFT_SIZE", "4096")
+	proto, err = BuildPrototypeFromPath(source, "quad", "drone", "", "hover.wav", nil)
+	if err != nil {
+		t.Fatalf("BuildPrototypeFromPath returned error: %v", err)
+	}
+	if got := proto.Metadata[FFTSizeMetadataKey]; got != "4096" {
+		t.Fatalf("expected fft_size 4096 in the prototype metadata, got %q", got)
+	}
+}
+
+func TestStereoFeaturesDistinguishPanning(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 44100
+	tone := make([]float64, sampleRate/2)
+	for i := range tone {
+		tone[i] = 0.3 * math.Sin(2*math.Pi*180*float64(i)/sampleRate)
+	}
+	silence := make([]float64, len(tone))
+
+	hardLeft, err := ExtractStereoFeatures(tone, silence, sampleRate)
+	if err != nil {
+		t.Fatalf("ExtractStereoFeatures returned error: %v", err)
+	}
+	hardRight, err := ExtractStereoFeatures(silence, tone, sampleRate)
+	if err != nil {
+		t.Fatalf("ExtractStereoFeatures returned error: %v", err)
+	}
+	if hardLeft[0] != 1 || hardRight[0] != -1 {
+		t.Fatalf("expected level differences of +1 hard left and -1 hard right, got %.3f and %.3f", hardLeft[0], hardRight[0])
+	}
+
+	// The same broadband sound reaching the right microphone 20 samples after the left
+	rng := rand.New(rand.NewSource(5))
+	noise := make([]float64, sampleRate/2)
+	for i := range noise {
+		noise[i] = rng.Float64()*2 - 1
+	}
+	const delay = 20
+	delayed := append(make([]float64, delay), noise[:len(noise)-delay]...)
+	leftFirst, err := ExtractStereoFeatures(noise, delayed, sampleRate)
+	if err != nil {
+		t.Fatalf("ExtractStereoFeatures returned error: %v", err)
+	}
+	rightFirst, err := ExtractStereoFeatures(delayed, noise, sampleRate)
+	if err != nil {
+		t.Fatalf("ExtractStereoFeatures returned error: %v", err)
+	}
+	maxLag := math.Floor(sampleRate * stereoMaxLagSeconds)
+	if math.Abs(leftFirst[1]-delay/maxLag) > 1e-9 || math.Abs(rightFirst[1]+delay/maxLag) > 1e-9 {
+		t.Fatalf("expected time differences of ±%.3f, got %.3f and %.3f", delay/maxLag, leftFirst[1], rightFirst[1])
+	}
+	if leftFirst[2] < 0.9 {
+		t.Fatalf("expected delayed copies to stay coherent, got %.3f", leftFirst[2])
+	}
+	if bearing := StereoBearing(leftFirst); bearing >= 0 {
+		t.Fatalf("expected a left-leading sound to bear left, got %.1f degrees", bearing)
+	}
+
+	// Mono input keeps the dimension, with the harmonic features still last
+	config := FeatureConfig{RolloffPercentile: 0.85, EnableStereo: true}
+	features, err := ExtractFeatureVectorWithConfig(tone, sampleRate, config)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+	}
+	if len(features) != baseFeatureCount+stereoFeatureCount || config.Dimension() != len(features) {
+		t.Fatalf("expected %d features, got %d", baseFeatureCount+stereoFeatureCount, len(features))
+	}
+	stereoIdx := baseFeatureCount - harmonicFeatureCount
+	if features[stereoIdx] != 0 || features[stereoIdx+1] != 0 || features[stereoIdx+2] != 1 {
+		t.Fatalf("expected mono stereo features 0, 0, 1, got %v", features[stereoIdx:stereoIdx+stereoFeatureCount])
+	}
+	if names := featureNames(config); names[stereoIdx] != "Inter-channel Level Difference" || names[len(names)-1] != "Harmonic Strength" {
+		t.Fatalf("expected feature names to follow the layout, got %q", names)
+	}
+}
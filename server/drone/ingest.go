@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"song-recognition/utils"
 	"song-recognition/wav"
@@ -12,6 +14,7 @@ import (
 
 // BuildPrototypeFromPath ingests an audio asset, normalises it and emits a Prototype.
 func BuildPrototypeFromPath(path string, label string, category string, description string, source string, metadata map[string]string) (Prototype, error) {
+	label = NormalizeLabel(label)
 	if label == "" {
 		return Prototype{}, errors.New("label is required")
 	}
@@ -20,62 +23,92 @@ func BuildPrototypeFromPath(path string, label string, category string, descript
 		category = "drone"
 	}
 
-	workingPath := path
+	features, err := ExtractFeaturesFromPath(path)
+	if err != nil {
+		return Prototype{}, err
+	}
+
+	// Don't normalize here - let the classifier handle scaling and normalization
+	// to ensure consistency with existing prototypes
+
+	metaCopy := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		metaCopy[key] = value
+	}
+	if config := DefaultFeatureConfig(); config.Mode != FeatureModeMFCC && config.FFTSize > 0 {
+		metaCopy[FFTSizeMetadataKey] = strconv.Itoa(config.FFTSize)
+	}
+
+	proto := Prototype{
+		ID:          buildPrototypeID(label),
+		Label:       label,
+		Category:    category,
+		Description: description,
+		Source:      source,
+		Features:    features,
+		Metadata:    metaCopy,
+	}
+
+	return proto, nil
+}
+
+// ExtractFeaturesFromPath converts an audio asset to mono WAV, applies the live
+// preprocessing chain and returns the raw (unscaled) feature vector of the configured
+// feature mode.
+func ExtractFeaturesFromPath(path string) ([]float64, error) {
+	features, _, err := ExtractFeaturesFromPathTimed(path)
+	return features, err
+}
+
+// IngestTimings records how long each stage of ExtractFeaturesFromPathTimed took.
+type IngestTimings struct {
+	Convert    time.Duration // conversion to mono WAV and decoding to samples
+	Preprocess time.Duration
+	Extract    time.Duration
+}
+
+// ExtractFeaturesFromPathTimed is ExtractFeaturesFromPath, also reporting the time
+// spent in each stage.
+func ExtractFeaturesFromPathTimed(path string) ([]float64, IngestTimings, error) {
+	var timings IngestTimings
 	var cleanup []string
+	defer func() { discardTempFiles(cleanup) }()
 
-	convertedPath, err := wav.ConvertToWAV(workingPath, 1)
+	started := time.Now()
+	convertedPath, err := wav.ConvertToWAV(path, 1)
 	if err != nil {
-		return Prototype{}, fmt.Errorf("failed to convert audio: %w", err)
+		return nil, timings, fmt.Errorf("failed to convert audio: %w", err)
 	}
 	if convertedPath != path {
 		cleanup = append(cleanup, convertedPath)
 	}
-	workingPath = convertedPath
 
-	wavInfo, err := wav.ReadWavInfo(workingPath)
+	wavInfo, err := wav.ReadWavInfo(convertedPath)
 	if err != nil {
-		discardTempFiles(cleanup)
-		return Prototype{}, fmt.Errorf("failed to read wav info: %w", err)
+		return nil, timings, fmt.Errorf("failed to read wav info: %w", err)
 	}
 
 	samples, err := wav.WavBytesToSamples(wavInfo.Data)
 	if err != nil {
-		discardTempFiles(cleanup)
-		return Prototype{}, fmt.Errorf("failed to decode samples: %w", err)
+		return nil, timings, fmt.Errorf("failed to decode samples: %w", err)
 	}
+	timings.Convert = time.Since(started)
 
 	// Apply the exact same preprocessing used during live detection to avoid
 	// feature drift between prototypes and inference samples.
+	started = time.Now()
 	preprocessCfg := DefaultPreprocessingConfig()
 	processedSamples := PreprocessAudio(samples, wavInfo.SampleRate, preprocessCfg)
+	timings.Preprocess = time.Since(started)
 
+	started = time.Now()
 	features, err := ExtractFeatureVector(processedSamples, wavInfo.SampleRate)
 	if err != nil {
-		discardTempFiles(cleanup)
-		return Prototype{}, fmt.Errorf("failed to extract features: %w", err)
-	}
-
-	// Don't normalize here - let the classifier handle scaling and normalization
-	// to ensure consistency with existing prototypes
-
-	metaCopy := make(map[string]string, len(metadata))
-	for key, value := range metadata {
-		metaCopy[key] = value
+		return nil, timings, fmt.Errorf("failed to extract features: %w", err)
 	}
+	timings.Extract = time.Since(started)
 
-	proto := Prototype{
-		ID:          buildPrototypeID(label),
-		Label:       label,
-		Category:    category,
-		Description: description,
-		Source:      source,
-		Features:    features,
-		Metadata:    metaCopy,
-	}
-
-	discardTempFiles(cleanup)
-
-	return proto, nil
+	return features, timings, nil
 }
 
 func buildPrototypeID(label string) string {
@@ -0,0 +1,182 @@
+package drone
+
+// Directory Ingestion
+//
+// IngestDirectory is the one way the training CLIs turn a tree of recordings into
+// prototypes. It walks the directory (skipping hidden entries), keeps audio files by
+// extension, infers each file's label from its class folder or its file name, infers
+// the category from noise keywords in the label and builds the prototype with
+// BuildPrototypeFromPath. A file that fails to process is counted and reported to
+// Progress rather than aborting the run.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// LabelSource selects where IngestDirectory takes a recording's label from.
+type LabelSource string
+
+const (
+	LabelFromDirectory LabelSource = "directory" // the top-level folder under the root, e.g. DroneA/day1/a.wav -> "drone a"
+	LabelFromFilename  LabelSource = "filename"  // the file name without extension and variant suffix
+)
+
+// DefaultIngestExtensions are the audio extensions ingested when none are configured.
+var DefaultIngestExtensions = []string{".wav", ".mp3"}
+
+// filenameVariantSuffixes are augmentation suffixes dropped from file-name labels,
+// so quad_fast.wav and quad_slow.wav both ingest as "quad".
+var filenameVariantSuffixes = []string{"_fast", "_slow", "_noisy"}
+
+// IngestOptions configures IngestDirectory.
+type IngestOptions struct {
+	Dir        string
+	LabelFrom  LabelSource // empty means LabelFromDirectory
+	Category   string      // category for labels without a noise keyword; empty means "drone"
+	Extensions []string    // lower-case extensions to ingest; empty means DefaultIngestExtensions
+	// NoiseKeywords extends the canonical noise keywords (see InferCategory).
+	NoiseKeywords []string
+	// NoisePrefix prefixes "noise " to labels that carry no noise keyword, for
+	// ingesting a folder of noise recordings named after what they contain.
+	NoisePrefix bool
+	// Progress, when set, is called after every file with its prototype or error.
+	Progress func(path string, proto Prototype, err error)
+}
+
+// IngestStats counts what IngestDirectory found and built.
+type IngestStats struct {
+	Files      int            // audio files found
+	Created    int            // prototypes built
+	Failed     int            // files that could not be processed
+	Labels     map[string]int // prototypes per label
+	Categories map[string]int // prototypes per category
+}
+
+// IngestDirectory builds a prototype from every audio file under opts.Dir. With
+// LabelFromDirectory, files directly in opts.Dir have no class folder and are ignored.
+func IngestDirectory(opts IngestOptions) ([]Prototype, IngestStats, error) {
+	stats := IngestStats{Labels: make(map[string]int), Categories: make(map[string]int)}
+	if opts.Dir == "" {
+		return nil, stats, errors.New("ingest directory is required")
+	}
+	labelFrom := opts.LabelFrom
+	if labelFrom == "" {
+		labelFrom = LabelFromDirectory
+	}
+	if labelFrom != LabelFromDirectory && labelFrom != LabelFromFilename {
+		return nil, stats, fmt.Errorf("unknown label source %q", labelFrom)
+	}
+	extensions := opts.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultIngestExtensions
+	}
+
+	files, err := IngestFiles(opts.Dir, extensions)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to read %s: %w", opts.Dir, err)
+	}
+
+	var prototypes []Prototype
+	for _, path := range files {
+		rel, _ := filepath.Rel(opts.Dir, path)
+		label := ingestLabel(rel, labelFrom, opts.NoisePrefix, opts.NoiseKeywords)
+		if label == "" {
+			continue
+		}
+		stats.Files++
+
+		category := InferCategory(label, opts.Category, opts.NoiseKeywords)
+		proto, err := BuildPrototypeFromPath(path, label, category,
+			fmt.Sprintf("%s from %s", label, filepath.Base(path)), path, nil)
+		if opts.Progress != nil {
+			opts.Progress(path, proto, err)
+		}
+		if err != nil {
+			stats.Failed++
+			continue
+		}
+
+		prototypes = append(prototypes, proto)
+		stats.Created++
+		stats.Labels[proto.Label]++
+		stats.Categories[proto.Category]++
+	}
+
+	return prototypes, stats, nil
+}
+
+// IngestFiles lists the files under dir with one of extensions, in lexical order,
+// skipping hidden files and directories.
+func IngestFiles(dir string, extensions []string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && slices.Contains(extensions, strings.ToLower(filepath.Ext(path))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// ingestLabel infers the label of the file at rel, relative to the ingest root. It
+// returns "" for a file with no class folder under LabelFromDirectory.
+func ingestLabel(rel string, labelFrom LabelSource, noisePrefix bool, noiseKeywords []string) string {
+	var label string
+	if labelFrom == LabelFromDirectory {
+		folder, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		if !nested {
+			return ""
+		}
+		label = NormalizeLabel(folder)
+	} else {
+		name := strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+		for _, suffix := range filenameVariantSuffixes {
+			name = strings.TrimSuffix(name, suffix)
+		}
+		label = NormalizeLabel(name)
+	}
+
+	if noisePrefix && !hasNoiseKeyword(label, noiseKeywords) {
+		label = NormalizeLabel("noise " + label)
+	}
+	return label
+}
+
+// WritePrototypes writes prototypes to path as indented JSON, creating the directory
+// and replacing any existing file atomically.
+func WritePrototypes(path string, prototypes []Prototype) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(prototypes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal prototypes: %w", err)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write prototypes: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package drone
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+func TestIngestDirectoryLabelsNestedTree(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	root := t.TempDir()
+	writeEvaluationTone(t, filepath.Join(root, "Drone_A", "a1.wav"), 440)
+	writeEvaluationTone(t, filepath.Join(root, "Drone_A", "day2", "a2.wav"), 450)
+	writeEvaluationTone(t, filepath.Join(root, "Wind_Noise", "w1.wav"), 3000)
+	writeEvaluationTone(t, filepath.Join(root, ".cache", "ignored.wav"), 440)
+	writeEvaluationTone(t, filepath.Join(root, "loose.wav"), 440) // no class folder
+	for path, content := range map[string]string{
+		filepath.Join(root, "Wind_Noise", "notes.txt"): "not audio",
+		filepath.Join(root, "Drone_B", "broken.wav"):   "not audio either",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create fixture dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write fixture: %v", err)
+		}
+	}
+
+	var reported int
+	prototypes, stats, err := IngestDirectory(IngestOptions{
+		Dir:      root,
+		Progress: func(string, Prototype, error) { reported++ },
+	})
+	if err != nil {
+		t.Fatalf("IngestDirectory returned error: %v", err)
+	}
+	if stats.Files != 4 || stats.Created != 3 || stats.Failed != 1 || reported != 4 {
+		t.Fatalf("expected 4 files, 3 prototypes and 1 failure all reported, got %+v (%d reported)", stats, reported)
+	}
+	if want := map[string]int{"drone a": 2, "wind noise": 1}; !maps.Equal(stats.Labels, want) {
+		t.Fatalf("expected labels %v, got %v", want, stats.Labels)
+	}
+	if want := map[string]int{"drone": 2, "noise": 1}; !maps.Equal(stats.Categories, want) {
+		t.Fatalf("expected categories %v, got %v", want, stats.Categories)
+	}
+	for _, proto := range prototypes {
+		if proto.Source == "" || len(proto.Features) == 0 {
+			t.Fatalf("expected prototype %s to carry its source and features", proto.ID)
+		}
+	}
+
+	// File-name labels drop variant suffixes; the noise prefix marks plain names
+	flat := t.TempDir()
+	writeEvaluationTone(t, filepath.Join(flat, "fan_fast.wav"), 440)
+	writeEvaluationTone(t, filepath.Join(flat, "fan_slow.wav"), 460)
+	writeEvaluationTone(t, filepath.Join(flat, "rain.wav"), 3000)
+	_, stats, err = IngestDirectory(IngestOptions{Dir: flat, LabelFrom: LabelFromFilename, Category: "noise", NoisePrefix: true})
+	if err != nil {
+		t.Fatalf("IngestDirectory returned error: %v", err)
+	}
+	if want := map[string]int{"noise fan": 2, "rain": 1}; !maps.Equal(stats.Labels, want) {
+		t.Fatalf("expected file-name labels %v, got %v", want, stats.Labels)
+	}
+	if stats.Categories["noise"] != 3 {
+		t.Fatalf("expected every prototype in the noise category, got %v", stats.Categories)
+	}
+}
@@ -0,0 +1,115 @@
+package drone
+
+// Label Metadata
+//
+// Metadata is stored per prototype, but predictions are per label, so the metadata a
+// prediction carries is an aggregate over every prototype of its label. When two
+// prototypes disagree on a key the MetadataMergeStrategy decides which value the label
+// reports: the last prototype's (the default, and the historical behaviour), the first
+// prototype's, or neither. Under MetadataPerPrototype a conflicting key is left out of
+// the label's metadata altogether, so the label only claims what all of its prototypes
+// agree on. Whatever the strategy, a neighbour in TopPrototypes lists the keys where its
+// own metadata differs from its label's, so no prototype's values are lost.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetadataMergeStrategy selects how a label's metadata is aggregated from its prototypes.
+type MetadataMergeStrategy string
+
+const (
+	MetadataLastWins     MetadataMergeStrategy = "last_wins"     // a later prototype overwrites an earlier one's value, the default
+	MetadataFirstWins    MetadataMergeStrategy = "first_wins"    // the first prototype to set a key keeps it
+	MetadataPerPrototype MetadataMergeStrategy = "per_prototype" // conflicting keys are left to the prototypes
+)
+
+// ParseMetadataMergeStrategy maps a configuration value to a MetadataMergeStrategy; empty
+// means last wins.
+func ParseMetadataMergeStrategy(value string) (MetadataMergeStrategy, error) {
+	switch strategy := MetadataMergeStrategy(strings.ToLower(strings.TrimSpace(value))); strategy {
+	case "":
+		return MetadataLastWins, nil
+	case MetadataLastWins, MetadataFirstWins, MetadataPerPrototype:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown metadata merge strategy %q (expected last_wins, first_wins or per_prototype)", value)
+	}
+}
+
+// mergeLabelMetadata aggregates the metadata of prototypes per label, in prototype order.
+// Every label gets a map, even when its prototypes carry no metadata.
+func mergeLabelMetadata(prototypes []Prototype, strategy MetadataMergeStrategy) map[string]map[string]string {
+	labelMetadata := make(map[string]map[string]string)
+	conflicts := make(map[string]map[string]bool)
+	for _, proto := range prototypes {
+		merged, ok := labelMetadata[proto.Label]
+		if !ok {
+			merged = map[string]string{}
+			labelMetadata[proto.Label] = merged
+		}
+		for key, value := range proto.Metadata {
+			existing, seen := merged[key]
+			switch {
+			case !seen && !conflicts[proto.Label][key]:
+				merged[key] = value
+			case strategy == MetadataFirstWins:
+			case strategy == MetadataPerPrototype:
+				if seen && existing != value {
+					delete(merged, key)
+					if conflicts[proto.Label] == nil {
+						conflicts[proto.Label] = map[string]bool{}
+					}
+					conflicts[proto.Label][key] = true
+				}
+			default:
+				merged[key] = value
+			}
+		}
+	}
+	return labelMetadata
+}
+
+// metadataOverrides returns the keys of a prototype's metadata whose values its label's
+// metadata does not report, or nil when there are none.
+func metadataOverrides(protoMetadata, labelMetadata map[string]string) map[string]string {
+	var overrides map[string]string
+	for key, value := range protoMetadata {
+		if labelValue, ok := labelMetadata[key]; ok && labelValue == value {
+			continue
+		}
+		if overrides == nil {
+			overrides = map[string]string{}
+		}
+		overrides[key] = value
+	}
+	return overrides
+}
+
+// SetMetadataMergeStrategy selects how label metadata is aggregated from prototypes and
+// re-aggregates the loaded prototypes with it. An empty strategy means MetadataLastWins.
+func (c *Classifier) SetMetadataMergeStrategy(strategy MetadataMergeStrategy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if strategy == "" {
+		strategy = MetadataLastWins
+	}
+	c.metadataMerge = strategy
+	c.labelMetadata = mergeLabelMetadata(c.prototypes, strategy)
+}
+
+// mergeLabelMetadataFor re-aggregates the metadata of label alone; the caller holds c.mu.
+func (c *Classifier) mergeLabelMetadataFor(label string) {
+	var labelPrototypes []Prototype
+	for _, proto := range c.prototypes {
+		if proto.Label == label {
+			labelPrototypes = append(labelPrototypes, proto)
+		}
+	}
+	merged := mergeLabelMetadata(labelPrototypes, c.metadataMerge)
+	if c.labelMetadata == nil {
+		c.labelMetadata = map[string]map[string]string{}
+	}
+	c.labelMetadata[label] = merged[label]
+}
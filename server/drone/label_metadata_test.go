@@ -0,0 +1,54 @@
+package drone
+
+import "testing"
+
+func TestMetadataMergeStrategyResolvesConflicts(t *testing.T) {
+	for _, test := range []struct {
+		strategy  MetadataMergeStrategy
+		model     string // label-level "model" after adding Mavic then Mini; "" means absent
+		overrides int    // neighbours reporting their own "model"
+	}{
+		{MetadataLastWins, "Mini", 1},
+		{MetadataFirstWins, "Mavic", 1},
+		{MetadataPerPrototype, "", 2},
+	} {
+		classifier := newTestClassifier(nil, 2)
+		classifier.SetMetadataMergeStrategy(test.strategy)
+
+		first := newSyntheticPrototype("quad", "quad_1", map[int]float64{0: 1})
+		first.Metadata = map[string]string{"model": "Mavic", "rotor_count": "4"}
+		second := newSyntheticPrototype("quad", "quad_2", map[int]float64{0: 1, 1: 0.1})
+		second.Metadata = map[string]string{"model": "Mini", "rotor_count": "4"}
+		for _, proto := range []Prototype{first, second} {
+			if _, err := classifier.AddPrototype(proto); err != nil {
+				t.Fatalf("%s: failed to add %s: %v", test.strategy, proto.ID, err)
+			}
+		}
+
+		predictions, err := classifier.Predict(first.Features)
+		if err != nil {
+			t.Fatalf("%s: prediction failed: %v", test.strategy, err)
+		}
+		metadata := predictions[0].Metadata
+		if model, ok := metadata["model"]; model != test.model || ok != (test.model != "") {
+			t.Fatalf("%s: expected label model %q, got %q (present %v)", test.strategy, test.model, model, ok)
+		}
+		// Keys every prototype agrees on stay on the label
+		if metadata["rotor_count"] != "4" {
+			t.Fatalf("%s: expected the agreed rotor_count on the label, got %v", test.strategy, metadata)
+		}
+
+		var overrides int
+		for _, neighbour := range predictions[0].TopPrototypes {
+			if _, ok := neighbour.Metadata["model"]; ok {
+				overrides++
+			}
+			if _, ok := neighbour.Metadata["rotor_count"]; ok {
+				t.Fatalf("%s: expected %s to omit metadata matching its label, got %v", test.strategy, neighbour.ID, neighbour.Metadata)
+			}
+		}
+		if overrides != test.overrides {
+			t.Fatalf("%s: expected %d neighbours to keep their own model, got %d", test.strategy, test.overrides, overrides)
+		}
+	}
+}
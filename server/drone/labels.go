@@ -0,0 +1,156 @@
+package drone
+
+// Label Normalisation
+//
+// Labels come from directory names, file names and upload forms, so the same class can
+// arrive as "Drone-A", "drone_a" or "droneA". NormalizeLabel maps them all to one
+// canonical form: lowercase words separated by single spaces, with camelCase boundaries
+// treated as word breaks ("drone a"). Operators can additionally merge variants that
+// normalisation alone cannot (e.g. "mavic 3" -> "dji mavic 3") with an alias map, loaded
+// from the JSON file named by DRONE_LABEL_ALIASES on first use.
+//
+// InferCategory decides whether a label names a noise class from one canonical keyword
+// list, so every tool files the same folder under the same category.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"song-recognition/utils"
+)
+
+var (
+	labelAliasesMu   sync.RWMutex
+	labelAliases     map[string]string
+	labelAliasesOnce sync.Once
+)
+
+// loadLabelAliasesFromEnv loads DRONE_LABEL_ALIASES once. A missing or invalid file is
+// logged and normalisation continues without aliases.
+func loadLabelAliasesFromEnv() {
+	labelAliasesOnce.Do(func() {
+		path := utils.GetEnv("DRONE_LABEL_ALIASES", "")
+		if path == "" {
+			return
+		}
+		aliases, err := readLabelAliases(path)
+		if err != nil {
+			log.Printf("[Labels] %v; continuing without aliases\n", err)
+			return
+		}
+		storeLabelAliases(aliases)
+	})
+}
+
+// NormalizeLabel returns the canonical form of a class label, applying any configured alias.
+func NormalizeLabel(label string) string {
+	loadLabelAliasesFromEnv()
+	canonical := normalizeLabelWords(label)
+
+	labelAliasesMu.RLock()
+	defer labelAliasesMu.RUnlock()
+	if alias, ok := labelAliases[canonical]; ok {
+		return alias
+	}
+	return canonical
+}
+
+// SetLabelAliases replaces the alias map. Keys and values are normalised, so aliases can
+// be written in any of the variant spellings.
+func SetLabelAliases(aliases map[string]string) {
+	// Explicit aliases take precedence over the environment
+	loadLabelAliasesFromEnv()
+	storeLabelAliases(aliases)
+}
+
+func storeLabelAliases(aliases map[string]string) {
+	normalized := make(map[string]string, len(aliases))
+	for variant, canonical := range aliases {
+		normalized[normalizeLabelWords(variant)] = normalizeLabelWords(canonical)
+	}
+
+	labelAliasesMu.Lock()
+	defer labelAliasesMu.Unlock()
+	labelAliases = normalized
+}
+
+// LoadLabelAliases reads a JSON object mapping label variants to canonical labels and
+// makes it the active alias map.
+func LoadLabelAliases(path string) error {
+	aliases, err := readLabelAliases(path)
+	if err != nil {
+		return err
+	}
+	SetLabelAliases(aliases)
+	return nil
+}
+
+func readLabelAliases(path string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read label aliases: %w", err)
+	}
+
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to parse label aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+func normalizeLabelWords(label string) string {
+	runes := []rune(strings.TrimSpace(label))
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || unicode.IsSpace(r):
+			b.WriteRune(' ')
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// "droneA" -> "drone a", "DJIMavic" -> "dji mavic"
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// NoiseKeywords mark a label as a noise (non-drone) class wherever they appear in it.
+var NoiseKeywords = []string{"noise", "ambient", "silence", "background",
+	"music", "voice", "speech", "traffic", "nature", "wind", "rain"}
+
+// InferCategory returns "noise" when label contains one of NoiseKeywords or
+// extraNoiseKeywords (case-insensitively) and defaultCategory, or "drone" when that is
+// empty, otherwise.
+func InferCategory(label string, defaultCategory string, extraNoiseKeywords []string) string {
+	if hasNoiseKeyword(label, extraNoiseKeywords) {
+		return "noise"
+	}
+	if defaultCategory == "" {
+		return "drone"
+	}
+	return defaultCategory
+}
+
+func hasNoiseKeyword(label string, extraNoiseKeywords []string) bool {
+	label = strings.ToLower(label)
+	for _, keywords := range [][]string{NoiseKeywords, extraNoiseKeywords} {
+		for _, keyword := range keywords {
+			keyword = strings.ToLower(strings.TrimSpace(keyword))
+			if keyword != "" && strings.Contains(label, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package drone
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLabelMergesVariants(t *testing.T) {
+	t.Parallel()
+
+	for _, variant := range []string{"Drone-A", "drone_a", "droneA", "  Drone  A "} {
+		if got := normalizeLabelWords(variant); got != "drone a" {
+			t.Fatalf("normalizeLabelWords(%q) = %q, want %q", variant, got, "drone a")
+		}
+	}
+	if got := normalizeLabelWords("DJIMavic3"); got != "dji mavic3" {
+		t.Fatalf("expected acronym boundary to split, got %q", got)
+	}
+}
+
+func TestNormalizeLabelAppliesAliases(t *testing.T) {
+	SetLabelAliases(map[string]string{"Mavic_3": "DJI Mavic 3"})
+	t.Cleanup(func() { SetLabelAliases(nil) })
+
+	for _, variant := range []string{"Drone-A", "drone_a", "droneA"} {
+		if got := NormalizeLabel(variant); got != "drone a" {
+			t.Fatalf("NormalizeLabel(%q) = %q, want %q", variant, got, "drone a")
+		}
+	}
+	if got := NormalizeLabel("mavic-3"); got != "dji mavic 3" {
+		t.Fatalf("expected alias to apply, got %q", got)
+	}
+}
+
+func TestInferCategoryIsConsistentAcrossKeywords(t *testing.T) {
+	t.Parallel()
+
+	for _, keyword := range NoiseKeywords {
+		// Folder and file names reach InferCategory in any of these spellings
+		for _, label := range []string{keyword, strings.ToUpper(keyword), "Field_" + keyword + "_01", NormalizeLabel("Night " + keyword)} {
+			if got := InferCategory(label, "drone", nil); got != "noise" {
+				t.Fatalf("InferCategory(%q) = %q, want noise", label, got)
+			}
+		}
+	}
+
+	if got := InferCategory("dji mavic 3", "", nil); got != "drone" {
+		t.Fatalf("expected a label without noise keywords to default to drone, got %q", got)
+	}
+	if got := InferCategory("dji mavic 3", "aircraft", nil); got != "aircraft" {
+		t.Fatalf("expected the default category to apply, got %q", got)
+	}
+	if got := InferCategory("Birdsong", "drone", []string{" BIRD "}); got != "noise" {
+		t.Fatalf("expected an extra keyword to mark noise, got %q", got)
+	}
+	if got := InferCategory("Birdsong", "drone", nil); got != "drone" {
+		t.Fatalf("expected extra keywords not to leak into later calls, got %q", got)
+	}
+}
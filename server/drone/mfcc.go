@@ -0,0 +1,149 @@
+package drone
+
+// Mel-Frequency Cepstral Coefficients
+//
+// MFCCs are an alternative front-end to the hand-crafted features, selected with
+// DRONE_FEATURE_MODE=mfcc. The signal is cut into Hann-windowed frames of
+// mfccFrameSeconds every mfccHopSeconds. Each frame's power spectrum is pooled by
+// mfccFilterCount triangular filters spaced evenly on the mel scale up to Nyquist, the
+// log filter energies are decorrelated with an orthonormal DCT-II, and the
+// coefficients are averaged over the frames.
+//
+// Coefficient 0 follows the overall level and coefficient 1 the spectral tilt
+// (positive when the energy sits in the low bands); the higher coefficients describe
+// finer spectral shape such as rotor harmonics. Scaling the signal only moves
+// coefficient 0, so the shape coefficients do not depend on how close the drone is.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// MFCCCoefficientCount is the length of MFCC feature vectors in the MFCC feature
+	// mode, which tells an MFCC model apart from legacy and PANNS models.
+	MFCCCoefficientCount = 13
+
+	mfccFrameSeconds = 0.025
+	mfccHopSeconds   = 0.010
+	mfccFilterCount  = 40
+	mfccEnergyFloor  = 1e-10 // keeps the log finite for silent bands
+)
+
+// ExtractMFCC returns the first numCoeffs mel-frequency cepstral coefficients of
+// samples, averaged over frames. Clips shorter than one frame are zero-padded to one.
+func ExtractMFCC(samples []float64, sampleRate, numCoeffs int) ([]float64, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("no samples provided")
+	}
+	if sampleRate <= 0 {
+		return nil, errors.New("invalid sample rate")
+	}
+	if numCoeffs <= 0 || numCoeffs > mfccFilterCount {
+		return nil, fmt.Errorf("coefficient count %d must be between 1 and %d", numCoeffs, mfccFilterCount)
+	}
+
+	frameSize := max(int(mfccFrameSeconds*float64(sampleRate)), 2)
+	hop := max(int(mfccHopSeconds*float64(sampleRate)), 1)
+	fftSize := nextPowerOfTwo(frameSize)
+	plan := newFFTPlan(fftSize)
+	filters := melFilterbank(mfccFilterCount, fftSize, sampleRate)
+
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 1
+	}
+	applyHannWindow(window)
+
+	coefficients := make([]float64, numCoeffs)
+	buffer := make([]complex128, fftSize)
+	power := make([]float64, fftSize/2+1)
+	logEnergies := make([]float64, mfccFilterCount)
+	frames := 0
+	for start := 0; frames == 0 || start+frameSize <= len(samples); start += hop {
+		clear(buffer)
+		for i, sample := range samples[start:min(start+frameSize, len(samples))] {
+			buffer[i] = complex(sample*window[i], 0)
+		}
+		plan.transform(buffer)
+		for k := range power {
+			magnitude := cmplx.Abs(buffer[k])
+			power[k] = magnitude * magnitude
+		}
+
+		for m, filter := range filters {
+			var energy float64
+			for k, weight := range filter.weights {
+				energy += weight * power[filter.start+k]
+			}
+			logEnergies[m] = math.Log(max(energy, mfccEnergyFloor))
+		}
+		for n := range coefficients {
+			coefficients[n] += dctII(logEnergies, n)
+		}
+		frames++
+	}
+
+	for n := range coefficients {
+		coefficients[n] /= float64(frames)
+	}
+	return coefficients, nil
+}
+
+// melFilter is one triangular filter: weights for the power spectrum bins from start.
+type melFilter struct {
+	start   int
+	weights []float64
+}
+
+// melFilterbank returns count triangular filters over the bins of an fftSize-point
+// spectrum at sampleRate, with centres evenly spaced in mel between 0 Hz and Nyquist.
+// Each filter rises from its lower neighbour's centre and falls to its upper one's.
+func melFilterbank(count, fftSize, sampleRate int) []melFilter {
+	nyquist := float64(sampleRate) / 2
+	maxMel := hzToMel(nyquist)
+	edges := make([]float64, count+2) // in bins, fractional
+	for i := range edges {
+		hz := melToHz(maxMel * float64(i) / float64(count+1))
+		edges[i] = hz * float64(fftSize) / float64(sampleRate)
+	}
+
+	filters := make([]melFilter, count)
+	for m := range filters {
+		lower, centre, upper := edges[m], edges[m+1], edges[m+2]
+		first := int(math.Ceil(lower))
+		last := min(int(math.Floor(upper)), fftSize/2)
+		filter := melFilter{start: first}
+		for bin := first; bin <= last; bin++ {
+			position := float64(bin)
+			weight := 0.0
+			if position <= centre && centre > lower {
+				weight = (position - lower) / (centre - lower)
+			} else if position > centre && upper > centre {
+				weight = (upper - position) / (upper - centre)
+			}
+			filter.weights = append(filter.weights, max(weight, 0))
+		}
+		filters[m] = filter
+	}
+	return filters
+}
+
+func hzToMel(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+
+func melToHz(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+// dctII returns coefficient n of the orthonormal DCT-II of values.
+func dctII(values []float64, n int) float64 {
+	count := float64(len(values))
+	var sum float64
+	for m, value := range values {
+		sum += value * math.Cos(math.Pi*float64(n)*(float64(m)+0.5)/count)
+	}
+	if n == 0 {
+		return sum * math.Sqrt(1/count)
+	}
+	return sum * math.Sqrt(2/count)
+}
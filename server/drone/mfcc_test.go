@@ -0,0 +1,101 @@
+package drone
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+// mfccTone renders a tone over quiet white noise, so every mel band holds energy.
+func mfccTone(frequency, amplitude float64, sampleRate int) []float64 {
+	rng := rand.New(rand.NewSource(7))
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		samples[i] = amplitude * (0.5*math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate)) + 0.01*rng.NormFloat64())
+	}
+	return samples
+}
+
+func TestMFCCOfToneConcentratesInExpectedCoefficients(t *testing.T) {
+	const sampleRate = 16000
+
+	quiet, err := ExtractMFCC(mfccTone(440, 0.25, sampleRate), sampleRate, MFCCCoefficientCount)
+	if err != nil {
+		t.Fatalf("ExtractMFCC returned error: %v", err)
+	}
+	if len(quiet) != MFCCCoefficientCount {
+		t.Fatalf("expected %d coefficients, got %d", MFCCCoefficientCount, len(quiet))
+	}
+
+	// Doubling the level adds log 4 to every band energy, which only coefficient 0 sees
+	loud, _ := ExtractMFCC(mfccTone(440, 0.5, sampleRate), sampleRate, MFCCCoefficientCount)
+	if shift, want := loud[0]-quiet[0], math.Log(4)*math.Sqrt(mfccFilterCount); math.Abs(shift-want) > 1e-6 {
+		t.Fatalf("expected coefficient 0 to rise by %.4f, got %.4f", want, shift)
+	}
+	for n := 1; n < len(quiet); n++ {
+		if math.Abs(loud[n]-quiet[n]) > 1e-6 {
+			t.Fatalf("expected coefficient %d to ignore the level, got %.6f vs %.6f", n, loud[n], quiet[n])
+		}
+	}
+
+	// Coefficient 1 follows the tilt: positive for a low tone, negative for a high one
+	high, _ := ExtractMFCC(mfccTone(6000, 0.25, sampleRate), sampleRate, MFCCCoefficientCount)
+	low, _ := ExtractMFCC(mfccTone(150, 0.25, sampleRate), sampleRate, MFCCCoefficientCount)
+	if low[1] <= 0 || high[1] >= 0 {
+		t.Fatalf("expected coefficient 1 positive for 150 Hz and negative for 6 kHz, got %.3f and %.3f", low[1], high[1])
+	}
+}
+
+func TestMFCCModeBuildsAndLoadsPrototypes(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+	t.Setenv("DRONE_FEATURE_MODE", "mfcc")
+	t.Setenv("DRONE_FFT_SIZE", "4096")
+
+	dir := t.TempDir()
+	var prototypes []Prototype
+	for i, frequency := range []float64{220, 880} {
+		source := filepath.Join(dir, "tone.wav")
+		writeEvaluationTone(t, source, frequency)
+		proto, err := BuildPrototypeFromPath(source, []string{"quad", "wind"}[i], "drone", "", "tone.wav", nil)
+		if err != nil {
+			t.Fatalf("BuildPrototypeFromPath returned error: %v", err)
+		}
+		if len(proto.Features) != MFCCCoefficientCount {
+			t.Fatalf("expected %d MFCC features, got %d", MFCCCoefficientCount, len(proto.Features))
+		}
+		if _, ok := proto.Metadata[FFTSizeMetadataKey]; ok {
+			t.Fatalf("expected no FFT size metadata on MFCC prototypes, got %v", proto.Metadata)
+		}
+		prototypes = append(prototypes, proto)
+	}
+
+	modelPath := filepath.Join(dir, "model.json")
+	data, _ := json.Marshal(prototypes)
+	if err := os.WriteFile(modelPath, data, 0o644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := NewClassifierFromFile(modelPath, 1)
+	if err != nil {
+		t.Fatalf("expected the MFCC layout to load, got %v", err)
+	}
+
+	features, err := ExtractFeaturesFromPath(filepath.Join(dir, "tone.wav"))
+	if err != nil {
+		t.Fatalf("ExtractFeaturesFromPath returned error: %v", err)
+	}
+	predictions, err := classifier.Predict(features)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "wind" {
+		t.Fatalf("expected the 880 Hz recording to match its own prototype, got %s", predictions[0].Label)
+	}
+	if _, err := explainFeatureNames(MFCCCoefficientCount); err != nil {
+		t.Fatalf("expected MFCC features to have names, got %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package drone
 
+import "time"
+
 // Prototype represents a single embedding vector describing a labelled audio asset.
 type Prototype struct {
 	ID          string            `json:"id"`
@@ -9,6 +11,9 @@ type Prototype struct {
 	Source      string            `json:"source,omitempty"`
 	Features    []float64         `json:"features"`
 	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt,omitzero"` // Used for recency decay; defaults to the model file mtime
+
+	raw []float64 // Unscaled features as loaded or uploaded; saved in place of the scaled Features
 }
 
 // PrototypeScore captures the similarity between the analysed audio and a stored prototype.
@@ -17,6 +22,20 @@ type PrototypeScore struct {
 	Distance float64 `json:"distance"`
 	Weight   float64 `json:"weight"`
 	Source   string  `json:"source,omitempty"`
+	// Metadata holds the prototype's metadata where it differs from its label's aggregate
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// RankedNeighbor is a single prototype in distance order, before per-label aggregation.
+type RankedNeighbor struct {
+	Rank     int     `json:"rank"`
+	ID       string  `json:"id"`
+	Label    string  `json:"label"`
+	Category string  `json:"category,omitempty"`
+	Source   string  `json:"source,omitempty"`
+	Distance float64 `json:"distance"`
+	Weight   float64 `json:"weight"`
+	InTopK   bool    `json:"inTopK"`
 }
 
 // Prediction summarises the per-class aggregation across nearest prototypes.
@@ -27,18 +46,23 @@ type Prediction struct {
 	Description      string            `json:"description,omitempty"`
 	Confidence       float64           `json:"confidence"`
 	AverageDist      float64           `json:"averageDistance"`
+	Margin           float64           `json:"margin"` // Nearest other-label distance minus nearest same-label distance
 	Support          int               `json:"support"`
+	RankScore        float64           `json:"rankScore,omitempty"` // RankingBlend score the predictions are ordered by, when one is configured
 	TopPrototypes    []PrototypeScore  `json:"topPrototypes"`
 	Metadata         map[string]string `json:"metadata,omitempty"`
 	ThreatAssessment *ThreatAssessment `json:"threatAssessment,omitempty"` // Defense-focused intelligence
 }
 
-// WindowPrediction captures predictions for a specific temporal window.
+// WindowPrediction captures predictions for a specific temporal window. CompactWindows
+// drops Predictions, leaving the top label and confidence.
 type WindowPrediction struct {
-	Index       int          `json:"index"`
-	Start       float64      `json:"start"`       // seconds
-	End         float64      `json:"end"`         // seconds
-	Predictions []Prediction `json:"predictions"` // sorted by confidence
+	Index         int          `json:"index"`                 // position in the full window sequence, even when subsampled
+	Start         float64      `json:"start"`                 // seconds
+	End           float64      `json:"end"`                   // seconds
+	TopLabel      string       `json:"topLabel,omitempty"`    // label of Predictions[0]
+	TopConfidence float64      `json:"topConfidence"`         // confidence of Predictions[0]
+	Predictions   []Prediction `json:"predictions,omitempty"` // sorted by confidence; omitted from compact windows
 }
 
 // ModelStats exposes metadata about the loaded prototype collection.
@@ -49,6 +73,24 @@ type ModelStats struct {
 	UsingExample   bool             `json:"usingExample"`
 }
 
+// ClassifierSettings are the settings a classifier runs with, defaults applied.
+type ClassifierSettings struct {
+	K                       int                   `json:"k"`
+	DistanceMetric          DistanceMetric        `json:"distanceMetric"`
+	HarmonicMismatchPenalty float64               `json:"harmonicMismatchPenalty"`
+	MaxAcceptDistance       float64               `json:"maxAcceptDistance"`
+	ConfidenceStrategy      ConfidenceStrategy    `json:"confidenceStrategy"`
+	SoftmaxTemperature      float64               `json:"softmaxTemperature"`
+	BalancedVoting          bool                  `json:"balancedVoting"`
+	RecencyHalfLife         string                `json:"recencyHalfLife"` // e.g. "720h0m0s"; "0s" disables decay
+	MaxWindows              int                   `json:"maxWindows"`
+	MinWindowSeconds        float64               `json:"minWindowSeconds"`
+	ScalingDisabled         bool                  `json:"scalingDisabled"`
+	MetadataMerge           MetadataMergeStrategy `json:"metadataMerge"`
+	RankingBlend            RankingBlend          `json:"rankingBlend"`
+	PlattCalibration        *PlattCalibration     `json:"plattCalibration,omitempty"` // see LearnPlattCalibration
+}
+
 // ModelLabelStat summarises prototype density per label.
 type ModelLabelStat struct {
 	Label      string `json:"label"`
@@ -58,16 +100,37 @@ type ModelLabelStat struct {
 
 // ClassificationSummary packages the raw predictions together with auxiliary telemetry.
 type ClassificationSummary struct {
-	Predictions       []Prediction       `json:"predictions"`
-	IsDrone           bool               `json:"isDrone"`
-	LatencyMs         float64            `json:"latencyMs"`
-	FeatureVector     []float64          `json:"featureVector"`
-	PrimaryType       string             `json:"primaryType,omitempty"`
-	SNRDb             float64            `json:"snrDb,omitempty"`             // Signal-to-noise ratio in dB
-	AdjustedThreshold float64            `json:"adjustedThreshold,omitempty"` // Threshold used after SNR adjustment
-	Windows           []WindowPrediction `json:"windows,omitempty"`
-	Latitude          *float64           `json:"latitude,omitempty"`
-	Longitude         *float64           `json:"longitude,omitempty"`
-	RecordingPath     string             `json:"recordingPath,omitempty"`
-	TemplatePreds     []Prediction       `json:"templatePredictions,omitempty"`
+	Predictions        []Prediction        `json:"predictions"`
+	IsDrone            bool                `json:"isDrone"`
+	Ambiguous          bool                `json:"ambiguous,omitempty"`   // Top two labels are within DRONE_MIN_CONFIDENCE_GAP
+	DroneConfidence    float64             `json:"droneConfidence"`       // Summed confidence of non-noise labels
+	NoiseConfidence    float64             `json:"noiseConfidence"`       // Summed confidence of noise-category labels
+	LowDataMode        bool                `json:"lowDataMode,omitempty"` // Model is below DRONE_MIN_PROTOTYPES, so the threshold was raised
+	LatencyMs          float64             `json:"latencyMs"`
+	FeatureVector      []float64           `json:"featureVector,omitempty"`
+	PrimaryType        string              `json:"primaryType,omitempty"`
+	SNRDb              float64             `json:"snrDb,omitempty"`              // Signal-to-noise ratio in dB
+	AdjustedThreshold  float64             `json:"adjustedThreshold,omitempty"`  // Threshold used after SNR adjustment
+	CalibratedSNRDb    float64             `json:"calibratedSnrDb,omitempty"`    // SNR against the location's ambient calibration, when one exists
+	Quality            *AudioQualityReport `json:"quality,omitempty"`            // Problems the user can fix in the recording itself
+	AnalyzedSampleRate int                 `json:"analyzedSampleRate,omitempty"` // Sample rate after server-side reformatting
+	AnalyzedChannels   int                 `json:"analyzedChannels,omitempty"`   // Channel count after server-side reformatting
+	Windows            []WindowPrediction  `json:"windows,omitempty"`
+	WindowCount        int                 `json:"windowCount,omitempty"`       // Windows covering the clip before any cap
+	WindowsSubsampled  bool                `json:"windowsSubsampled,omitempty"` // Set when only a subset of WindowCount was analysed
+	Latitude           *float64            `json:"latitude,omitempty"`
+	Longitude          *float64            `json:"longitude,omitempty"`
+	RecordingPath      string              `json:"recordingPath,omitempty"`
+	RecordingHash      string              `json:"recordingHash,omitempty"`
+	TemplatePreds      []Prediction        `json:"templatePredictions,omitempty"` // Whole-file template matches
+	TemplatesMerged    bool                `json:"templatesMerged,omitempty"`     // Set when TemplatePreds were folded into Predictions
+	Screened           bool                `json:"screened,omitempty"`            // Set when the two-stage screen ruled out a drone before the full classifier ran
+	Model              string              `json:"model,omitempty"`               // Name of the site model that produced the predictions
+	ModelFingerprint   string              `json:"modelFingerprint,omitempty"`    // Classifier.Fingerprint of that model
+	ModelEmpty         bool                `json:"modelEmpty,omitempty"`          // Set when the model has no prototypes to compare against
+	Code               ErrorCode           `json:"code,omitempty"`                // CodeModelEmpty alongside ModelEmpty, matching the ClassifyError codes
+	StableLabel        string              `json:"stableLabel,omitempty"`         // DetectionSmoother label over the client's recent recordings
+	StableConfidence   float64             `json:"stableConfidence,omitempty"`    // Mean confidence of StableLabel in the smoothing window
+	Analyzed           bool                `json:"analyzed"`                      // False when the result says nothing about the audio; see Reason
+	Reason             string              `json:"reason,omitempty"`              // Why IsDrone is false: one of the Reason* constants
 }
@@ -0,0 +1,139 @@
+package drone
+
+// Learned Noise Floor
+//
+// AdaptiveThreshold reacts only to the SNR of the current recording. A site that is
+// consistently noisy (roadside, generator, wind) then flips between buckets from one
+// recording to the next. NoiseFloorTracker keeps an exponentially weighted estimate of
+// the typical SNR per location and raises the threshold when recent conditions have
+// been poor, so a noisy site stays appropriately conservative.
+//
+// Recordings classified as drones start a cooldown during which observations for that
+// location are ignored: the drone's own signal would otherwise inflate the estimate and
+// make the site look quieter than it is.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// noiseFloorPriorSNRDb seeds new locations with a clean-environment estimate so a
+// single noisy recording cannot make a site conservative on its own.
+const noiseFloorPriorSNRDb = 30.0
+
+// GlobalNoiseFloorKey is used when observations are not grouped by location.
+const GlobalNoiseFloorKey = "global"
+
+// NoiseFloorTracker learns the typical SNR of each monitored location over time.
+type NoiseFloorTracker struct {
+	mu          sync.Mutex
+	alpha       float64
+	cooldown    time.Duration
+	perLocation bool
+	estimates   map[string]*noiseFloorEstimate
+}
+
+type noiseFloorEstimate struct {
+	snrDb         float64
+	observations  int
+	cooldownUntil time.Time
+}
+
+// NewNoiseFloorTracker creates a tracker. alpha is the EWMA smoothing factor in (0, 1];
+// cooldown is how long observations are ignored after a drone detection. When
+// perLocation is false every recording shares a single global estimate.
+func NewNoiseFloorTracker(alpha float64, cooldown time.Duration, perLocation bool) *NoiseFloorTracker {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.1
+	}
+	if cooldown < 0 {
+		cooldown = 0
+	}
+	return &NoiseFloorTracker{
+		alpha:       alpha,
+		cooldown:    cooldown,
+		perLocation: perLocation,
+		estimates:   make(map[string]*noiseFloorEstimate),
+	}
+}
+
+// Observe folds the SNR of a classified recording into the estimate for key.
+// Drone detections start a cooldown instead of being folded in.
+func (t *NoiseFloorTracker) Observe(key string, snrDb float64, isDrone bool, at time.Time) {
+	if t == nil || snrDb == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	estimate, ok := t.estimates[key]
+	if !ok {
+		estimate = &noiseFloorEstimate{snrDb: noiseFloorPriorSNRDb}
+		t.estimates[key] = estimate
+	}
+
+	if isDrone {
+		estimate.cooldownUntil = at.Add(t.cooldown)
+		return
+	}
+	if at.Before(estimate.cooldownUntil) {
+		return
+	}
+
+	estimate.snrDb += t.alpha * (snrDb - estimate.snrDb)
+	estimate.observations++
+}
+
+// TypicalSNR returns the learned SNR for key and whether any observation has been made.
+func (t *NoiseFloorTracker) TypicalSNR(key string) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	estimate, ok := t.estimates[key]
+	if !ok || estimate.observations == 0 {
+		return 0, false
+	}
+	return estimate.snrDb, true
+}
+
+// Threshold returns the detection threshold for a recording at key. It is the stricter
+// of the instantaneous SNR adjustment and the adjustment implied by the learned SNR.
+func (t *NoiseFloorTracker) Threshold(key string, baseThreshold float64, snrDb float64) float64 {
+	threshold := baseThreshold
+	if snrDb != 0.0 {
+		threshold = AdaptiveThreshold(baseThreshold, snrDb)
+	}
+
+	if typical, ok := t.TypicalSNR(key); ok {
+		if learned := AdaptiveThreshold(baseThreshold, typical); learned > threshold {
+			threshold = learned
+		}
+	}
+
+	return threshold
+}
+
+// Key returns the estimate key for a recording location. Locations are grouped into
+// roughly 1 km cells so nearby sensors share an estimate; recordings without a
+// location share the global estimate.
+func (t *NoiseFloorTracker) Key(latitude, longitude *float64) string {
+	if t == nil || !t.perLocation {
+		return GlobalNoiseFloorKey
+	}
+	return LocationKey(latitude, longitude)
+}
+
+// LocationKey groups a recording location into a roughly 1 km cell. Recordings without
+// a location map to GlobalNoiseFloorKey.
+func LocationKey(latitude, longitude *float64) string {
+	if latitude == nil || longitude == nil {
+		return GlobalNoiseFloorKey
+	}
+	return fmt.Sprintf("%.2f,%.2f", *latitude, *longitude)
+}
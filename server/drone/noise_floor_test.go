@@ -0,0 +1,57 @@
+package drone
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoiseFloorTrackerRaisesThresholdForNoisySite(t *testing.T) {
+	t.Parallel()
+
+	const base = 0.55
+	tracker := NewNoiseFloorTracker(0.2, time.Minute, true)
+	lat, lng := 51.5, -0.12
+	key := tracker.Key(&lat, &lng)
+
+	start := time.Now()
+	initial := tracker.Threshold(key, base, 0)
+	previous := initial
+	for i := 0; i < 20; i++ {
+		tracker.Observe(key, 5.0, false, start.Add(time.Duration(i)*time.Second))
+		current := tracker.Threshold(key, base, 0)
+		if current < previous {
+			t.Fatalf("threshold dropped from %.2f to %.2f after observation %d", previous, current, i)
+		}
+		previous = current
+	}
+
+	if previous <= initial {
+		t.Fatalf("expected learned threshold to rise above %.2f, got %.2f", initial, previous)
+	}
+	if other := tracker.Threshold(GlobalNoiseFloorKey, base, 0); other != base {
+		t.Fatalf("expected untouched location to keep base threshold %.2f, got %.2f", base, other)
+	}
+}
+
+func TestNoiseFloorTrackerIgnoresObservationsDuringCooldown(t *testing.T) {
+	t.Parallel()
+
+	tracker := NewNoiseFloorTracker(0.5, time.Minute, false)
+	key := tracker.Key(nil, nil)
+	start := time.Now()
+
+	tracker.Observe(key, 40.0, true, start)
+	tracker.Observe(key, 5.0, false, start.Add(30*time.Second))
+	if _, ok := tracker.TypicalSNR(key); ok {
+		t.Fatalf("expected observation inside cooldown to be ignored")
+	}
+
+	tracker.Observe(key, 5.0, false, start.Add(2*time.Minute))
+	snr, ok := tracker.TypicalSNR(key)
+	if !ok {
+		t.Fatalf("expected observation after cooldown to be recorded")
+	}
+	if snr >= noiseFloorPriorSNRDb {
+		t.Fatalf("expected typical SNR below prior %.1f, got %.1f", noiseFloorPriorSNRDb, snr)
+	}
+}
@@ -0,0 +1,31 @@
+package drone
+
+// Reasons a ClassificationSummary is not a drone detection. Only ReasonLowConfidence
+// means the recording was analysed and found nothing drone-like; the others mean the
+// result says nothing about the audio.
+const (
+	ReasonEmptyModel    = "empty_model"    // The model has no prototypes to compare against
+	ReasonTooShort      = "too_short"      // The recording is shorter than the quality gate allows
+	ReasonNoSignal      = "no_signal"      // The recording is silent or too quiet to classify
+	ReasonLowConfidence = "low_confidence" // Analysed; no drone label reached the threshold
+)
+
+// ExplainOutcome sets Analyzed and Reason from the rest of the summary. It must run
+// after IsDrone is final. A drone detection is analysed and has no reason; otherwise an
+// empty model comes first, then the recording's quality errors, then low confidence.
+func (s *ClassificationSummary) ExplainOutcome() {
+	s.Analyzed, s.Reason = false, ""
+	switch {
+	case s.ModelEmpty:
+		s.Reason = ReasonEmptyModel
+	case s.IsDrone:
+		s.Analyzed = true
+	case s.Quality != nil && s.Quality.hasIssue("too_short"):
+		s.Reason = ReasonTooShort
+	case s.Quality != nil && s.Quality.hasIssue("too_quiet"):
+		s.Reason = ReasonNoSignal
+	default:
+		s.Analyzed = true
+		s.Reason = ReasonLowConfidence
+	}
+}
@@ -0,0 +1,68 @@
+package drone
+
+// Debounced Model Persistence
+//
+// Uploads add prototypes one batch at a time and each batch used to rewrite the whole
+// model file on the request path. A persister instead coalesces save requests: every
+// request restarts a short timer and the model is written once the uploads go quiet.
+// The write snapshots the classifier when it runs, so it always covers every prototype
+// added before it.
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type persister struct {
+	mu      sync.Mutex
+	saveMu  sync.Mutex // serialises writes so two timers never race on the temp file
+	delay   time.Duration
+	save    func() error
+	timer   *time.Timer
+	pending bool
+}
+
+func newPersister(delay time.Duration, save func() error) *persister {
+	return &persister{delay: delay, save: save}
+}
+
+// schedule requests a save, postponing any pending write until delay has passed
+// without further requests.
+func (p *persister) schedule() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = true
+	if p.timer != nil {
+		p.timer.Reset(p.delay)
+		return
+	}
+	p.timer = time.AfterFunc(p.delay, p.fire)
+}
+
+func (p *persister) fire() {
+	if err := p.flush(); err != nil {
+		log.Printf("[Classifier] Deferred model save failed: %v\n", err)
+	}
+}
+
+// flush writes immediately if a save is pending.
+func (p *persister) flush() error {
+	p.mu.Lock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	pending := p.pending
+	p.pending = false
+	p.mu.Unlock()
+
+	if !pending {
+		return nil
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+	return p.save()
+}
@@ -0,0 +1,219 @@
+package drone
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulePersistCoalescesRapidUploads(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier(nil, 3)
+	classifier.modelPath = filepath.Join(t.TempDir(), "model.json")
+	classifier.SetPersistDelay(50 * time.Millisecond)
+
+	var writes atomic.Int32
+	save := classifier.persister.save
+	classifier.persister.save = func() error {
+		writes.Add(1)
+		return save()
+	}
+
+	const uploads = 5
+	for i := 0; i < uploads; i++ {
+		proto := newSyntheticPrototype("alpha", fmt.Sprintf("alpha_%d", i), map[int]float64{i: 1.0})
+		if _, err := classifier.AddPrototype(proto); err != nil {
+			t.Fatalf("AddPrototype returned error: %v", err)
+		}
+		pending, err := classifier.SchedulePersist()
+		if err != nil || !pending {
+			t.Fatalf("expected a deferred save, got pending=%v err=%v", pending, err)
+		}
+	}
+
+	if got := writes.Load(); got != 0 {
+		t.Fatalf("expected no writes before the debounce elapses, got %d", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for writes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if got := writes.Load(); got != 1 {
+		t.Fatalf("expected exactly one write after debounce, got %d", got)
+	}
+
+	data, err := os.ReadFile(classifier.modelPath)
+	if err != nil {
+		t.Fatalf("failed to read model: %v", err)
+	}
+	var saved []Prototype
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("failed to decode model: %v", err)
+	}
+	if len(saved) != uploads {
+		t.Fatalf("expected the single write to hold all %d prototypes, got %d", uploads, len(saved))
+	}
+}
+
+func TestSavedScalerSurvivesRestartAndUploads(t *testing.T) {
+	t.Parallel()
+
+	const dimension = 19
+	vector := func(seed int) []float64 {
+		features := make([]float64, dimension)
+		for i := range features {
+			features[i] = float64((seed*7+i*3)%11) + 0.1*float64(seed)
+		}
+		return features
+	}
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	data, err := json.Marshal([]Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: vector(1)},
+		{ID: "quad_2", Label: "quad", Category: "drone", Features: vector(2)},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: vector(3)},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+
+	load := func() *Classifier {
+		classifier, err := NewClassifierFromFile(modelPath, 3)
+		if err != nil {
+			t.Fatalf("NewClassifierFromFile returned error: %v", err)
+		}
+		return classifier
+	}
+
+	// An upload far from the fitted distribution must not shift the saved scaling
+	first := load()
+	if _, err := first.AddPrototype(Prototype{ID: "wind_2", Label: "wind", Category: "noise", Features: vector(40)}); err != nil {
+		t.Fatalf("AddPrototype returned error: %v", err)
+	}
+	if err := first.SavePrototypesToFile(); err != nil {
+		t.Fatalf("SavePrototypesToFile returned error: %v", err)
+	}
+	if _, err := os.Stat(ScalerPath(modelPath)); err != nil {
+		t.Fatalf("expected a scaler sidecar next to the model: %v", err)
+	}
+
+	query := vector(5)
+	want := first.PrepareQuery(query)
+	second, third := load(), load()
+	for name, classifier := range map[string]*Classifier{"second": second, "third": third} {
+		if got := classifier.PrepareQuery(query); !slices.Equal(got, want) {
+			t.Fatalf("%s load transformed the query differently:\ngot  %v\nwant %v", name, got, want)
+		}
+		_, prototypes, _, _, _ := classifier.snapshot()
+		_, original, _, _, _ := first.snapshot()
+		for i := range prototypes {
+			if !slices.Equal(prototypes[i].Features, original[i].Features) {
+				t.Fatalf("%s load scaled prototype %s differently", name, prototypes[i].ID)
+			}
+		}
+	}
+
+	if err := second.RecomputeScaler(); err != nil {
+		t.Fatalf("RecomputeScaler returned error: %v", err)
+	}
+	if slices.Equal(second.PrepareQuery(query), want) {
+		t.Fatal("expected refitting to include the upload and change the scaling")
+	}
+}
+
+func TestDisableScalingImprovesSelfMatchOnTinyModel(t *testing.T) {
+	t.Parallel()
+
+	// Dimension 16 is near-constant across the four prototypes, like the spectral
+	// crest factor, so the fitted scaler blows a small extraction drift there up
+	// until it drowns out the dimensions that separate the labels
+	const dimension = 19
+	vector := func(quad bool, seed int) []float64 {
+		features := make([]float64, dimension)
+		for i := 0; i < 16; i++ {
+			features[i] = 1
+			if (i < 8) == quad {
+				features[i] = 5
+			}
+		}
+		features[16] = 0.997 + 0.0001*float64(seed)
+		features[17] = 0.2 + 0.05*float64(seed)
+		features[18] = 3 + float64(seed)
+		return features
+	}
+	prototypes := []Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Features: vector(true, 0)},
+		{ID: "quad_2", Label: "quad", Category: "drone", Features: vector(true, 1)},
+		{ID: "wind_1", Label: "wind", Category: "noise", Features: vector(false, 2)},
+		{ID: "wind_2", Label: "wind", Category: "noise", Features: vector(false, 3)},
+	}
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	data, err := json.Marshal(prototypes)
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+
+	// Re-extracting each prototype's source drifts the near-constant dimension
+	meanSelfMatch := func(classifier *Classifier) float64 {
+		var total float64
+		for _, proto := range prototypes {
+			query := append([]float64(nil), proto.Features...)
+			query[16] += 0.003
+			predictions, err := classifier.Predict(query)
+			if err != nil {
+				t.Fatalf("Predict returned error: %v", err)
+			}
+			for _, prediction := range predictions {
+				if prediction.Label == proto.Label {
+					total += prediction.Confidence
+				}
+			}
+		}
+		return total / float64(len(prototypes))
+	}
+
+	scaled, err := NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("NewClassifierFromFile returned error: %v", err)
+	}
+	unscaled, err := NewClassifierFromFileWithOptions(modelPath, 3, LoadOptions{DisableScaling: true})
+	if err != nil {
+		t.Fatalf("NewClassifierFromFileWithOptions returned error: %v", err)
+	}
+	if scaledScore, unscaledScore := meanSelfMatch(scaled), meanSelfMatch(unscaled); unscaledScore <= scaledScore {
+		t.Fatalf("expected disabling scaling to improve self-match confidence, got %.3f scaled and %.3f unscaled",
+			scaledScore, unscaledScore)
+	}
+
+	// The choice is saved with the prototypes and survives a plain reload
+	if err := unscaled.SavePrototypesToFile(); err != nil {
+		t.Fatalf("SavePrototypesToFile returned error: %v", err)
+	}
+	if _, err := os.Stat(ScalerPath(modelPath)); !os.IsNotExist(err) {
+		t.Fatalf("expected no scaler sidecar for an unscaled model, got %v", err)
+	}
+	reloaded, err := NewClassifierFromFile(modelPath, 3)
+	if err != nil {
+		t.Fatalf("NewClassifierFromFile returned error: %v", err)
+	}
+	if !reloaded.scalingDisabled || reloaded.featureScaler != nil {
+		t.Fatal("expected the saved model to load with scaling disabled")
+	}
+	if err := reloaded.RecomputeScaler(); err == nil {
+		t.Fatal("expected RecomputeScaler to refuse a model with scaling disabled")
+	}
+}
@@ -0,0 +1,216 @@
+package drone
+
+// Platt Scaling
+//
+// The k-NN drone confidence is a vote share, not a probability: a recording whose top
+// neighbours are all drones reports 1.0 however far away they are. Platt scaling maps
+// the raw drone confidence s through a logistic curve 1/(1+exp(A*s+B)) fitted so the
+// result matches how often a score is actually right.
+//
+// LearnPlattCalibration fits A and B from leave-one-out results: every prototype is
+// classified against the rest of the model, its summed drone confidence is the score
+// and its own category the label. The fit uses Platt's smoothed targets and the Newton
+// method with backtracking of Lin, Lin and Weng (2007), which stays stable when the
+// classes separate perfectly. The parameters are stored in every prototype's metadata,
+// so they are saved with the model and picked up again when it is loaded.
+//
+// Only the reported DroneConfidence is recalibrated. Predictions, thresholds and the
+// drone decision keep using the raw confidences.
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys holding the model's Platt parameters A and B.
+const (
+	PlattAMetadataKey = "platt_a"
+	PlattBMetadataKey = "platt_b"
+)
+
+// ErrCalibrationNeedsBothCategories is returned by LearnPlattCalibration when the model
+// lacks drone or noise prototypes, so there is nothing to calibrate against.
+var ErrCalibrationNeedsBothCategories = errors.New("calibration needs drone and noise prototypes")
+
+// PlattCalibration is a fitted logistic recalibration of drone confidence.
+type PlattCalibration struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// Apply returns the calibrated probability for the raw drone confidence score.
+func (p PlattCalibration) Apply(score float64) float64 {
+	return plattProbability(p.A*score + p.B)
+}
+
+// FitPlattScaling fits the parameters of P(label=1 | score) = 1/(1+exp(a*score+b)) to
+// the score/label pairs, where a label above 0.5 counts as positive. An increasing
+// calibration has a negative a. It returns 0, 0, which maps every score to 0.5, when
+// there are no pairs or the lengths differ.
+func FitPlattScaling(scores, labels []float64) (a, b float64) {
+	if len(scores) == 0 || len(scores) != len(labels) {
+		return 0, 0
+	}
+
+	var positives, negatives float64
+	for _, label := range labels {
+		if label > 0.5 {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+
+	// Smoothed targets keep a perfectly separable set from driving a to infinity
+	hiTarget := (positives + 1) / (positives + 2)
+	loTarget := 1 / (negatives + 2)
+	targets := make([]float64, len(labels))
+	for i, label := range labels {
+		targets[i] = loTarget
+		if label > 0.5 {
+			targets[i] = hiTarget
+		}
+	}
+
+	const (
+		maxIterations = 100
+		minStep       = 1e-10
+		sigma         = 1e-12 // keeps the Hessian positive definite
+		tolerance     = 1e-5
+	)
+	b = math.Log((negatives + 1) / (positives + 1))
+	loss := plattLoss(scores, targets, a, b)
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		h11, h22, h21 := sigma, sigma, 0.0
+		var g1, g2 float64
+		for i, score := range scores {
+			p := plattProbability(a*score + b)
+			d2 := p * (1 - p)
+			h11 += score * score * d2
+			h22 += d2
+			h21 += score * d2
+			d1 := targets[i] - p
+			g1 += score * d1
+			g2 += d1
+		}
+		if math.Abs(g1) < tolerance && math.Abs(g2) < tolerance {
+			break
+		}
+
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		descent := g1*dA + g2*dB
+
+		step := 1.0
+		for ; step >= minStep; step /= 2 {
+			newA, newB := a+step*dA, b+step*dB
+			if newLoss := plattLoss(scores, targets, newA, newB); newLoss < loss+1e-4*step*descent {
+				a, b, loss = newA, newB, newLoss
+				break
+			}
+		}
+		if step < minStep {
+			break
+		}
+	}
+	return a, b
+}
+
+// plattProbability returns 1/(1+exp(f)) without overflowing for large |f|.
+func plattProbability(f float64) float64 {
+	if f >= 0 {
+		e := math.Exp(-f)
+		return e / (1 + e)
+	}
+	return 1 / (1 + math.Exp(f))
+}
+
+// plattLoss is the cross-entropy of the targets under parameters a and b.
+func plattLoss(scores, targets []float64, a, b float64) float64 {
+	var loss float64
+	for i, score := range scores {
+		f := a*score + b
+		if f >= 0 {
+			loss += targets[i]*f + math.Log1p(math.Exp(-f))
+		} else {
+			loss += (targets[i]-1)*f + math.Log1p(math.Exp(f))
+		}
+	}
+	return loss
+}
+
+// LearnPlattCalibration fits a Platt calibration of drone confidence to the model's
+// leave-one-out results, stores it in every prototype's metadata and applies it to
+// later CalibrateDroneConfidence calls.
+func (c *Classifier) LearnPlattCalibration() (PlattCalibration, error) {
+	k, prototypes, labelCategory, labelMetadata, _ := c.snapshot()
+	measure := c.distanceMeasure()
+	c.mu.RLock()
+	halfLife := c.halfLife
+	mapping := c.confidence
+	c.mu.RUnlock()
+
+	var scores, labels []float64
+	var drones, noise int
+	for idx, proto := range prototypes {
+		predictions := predictNeighbours(proto.Features, prototypes, idx, k, halfLife, measure, mapping, labelCategory, labelMetadata)
+		droneConfidence, _ := CategoryConfidences(predictions)
+		label := 1.0
+		if strings.EqualFold(proto.Category, "noise") {
+			label = 0
+			noise++
+		} else {
+			drones++
+		}
+		scores = append(scores, droneConfidence)
+		labels = append(labels, label)
+	}
+	if drones == 0 || noise == 0 {
+		return PlattCalibration{}, ErrCalibrationNeedsBothCategories
+	}
+
+	a, b := FitPlattScaling(scores, labels)
+	calibration := PlattCalibration{A: a, B: b}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	valueA := strconv.FormatFloat(a, 'g', -1, 64)
+	valueB := strconv.FormatFloat(b, 'g', -1, 64)
+	for idx := range c.prototypes {
+		if c.prototypes[idx].Metadata == nil {
+			c.prototypes[idx].Metadata = map[string]string{}
+		}
+		c.prototypes[idx].Metadata[PlattAMetadataKey] = valueA
+		c.prototypes[idx].Metadata[PlattBMetadataKey] = valueB
+	}
+	c.platt = &calibration
+	return calibration, nil
+}
+
+// CalibrateDroneConfidence returns the Platt-calibrated probability for a raw drone
+// confidence, or the raw confidence when the model has no calibration.
+func (c *Classifier) CalibrateDroneConfidence(raw float64) float64 {
+	c.mu.RLock()
+	platt := c.platt
+	c.mu.RUnlock()
+	if platt == nil {
+		return raw
+	}
+	return platt.Apply(raw)
+}
+
+// plattFromMetadata returns the calibration stored on the first prototype carrying
+// both parameters, or nil when none does.
+func plattFromMetadata(prototypes []Prototype) *PlattCalibration {
+	for _, proto := range prototypes {
+		a, errA := strconv.ParseFloat(proto.Metadata[PlattAMetadataKey], 64)
+		b, errB := strconv.ParseFloat(proto.Metadata[PlattBMetadataKey], 64)
+		if errA == nil && errB == nil {
+			return &PlattCalibration{A: a, B: b}
+		}
+	}
+	return nil
+}
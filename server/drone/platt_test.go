@@ -0,0 +1,84 @@
+package drone
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPlattScalingLowersBrierScore(t *testing.T) {
+	t.Parallel()
+
+	// An overconfident scorer: a raw score s is only right with probability s^3
+	rng := rand.New(rand.NewSource(11))
+	scores := make([]float64, 2000)
+	labels := make([]float64, len(scores))
+	for i := range scores {
+		scores[i] = rng.Float64()
+		if rng.Float64() < math.Pow(scores[i], 3) {
+			labels[i] = 1
+		}
+	}
+
+	a, b := FitPlattScaling(scores, labels)
+	if a >= 0 {
+		t.Fatalf("expected an increasing calibration (a < 0), got a=%.3f b=%.3f", a, b)
+	}
+	calibration := PlattCalibration{A: a, B: b}
+
+	var rawBrier, calibratedBrier float64
+	for i, score := range scores {
+		rawBrier += math.Pow(score-labels[i], 2)
+		calibratedBrier += math.Pow(calibration.Apply(score)-labels[i], 2)
+	}
+	rawBrier /= float64(len(scores))
+	calibratedBrier /= float64(len(scores))
+	if calibratedBrier >= rawBrier {
+		t.Fatalf("expected calibration to lower the Brier score, got %.4f from %.4f", calibratedBrier, rawBrier)
+	}
+
+	if a, b := FitPlattScaling(scores, labels[:10]); a != 0 || b != 0 {
+		t.Fatalf("expected mismatched inputs to fit nothing, got a=%.3f b=%.3f", a, b)
+	}
+}
+
+func TestLearnPlattCalibrationIsStoredInMetadata(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(3))
+	var protos []Prototype
+	for i := 0; i < 8; i++ {
+		protos = append(protos, newSyntheticPrototype("quad", fmt.Sprintf("quad_%d", i),
+			map[int]float64{0: 1.0, 2 + i: 0.3 * rng.Float64()}))
+		noise := newSyntheticPrototype("wind", fmt.Sprintf("wind_%d", i),
+			map[int]float64{1: 1.0, 0: 0.4 * rng.Float64(), 20 + i: 0.3 * rng.Float64()})
+		noise.Category = "noise"
+		protos = append(protos, noise)
+	}
+
+	classifier := newTestClassifier(protos, 3)
+	if got := classifier.CalibrateDroneConfidence(0.8); got != 0.8 {
+		t.Fatalf("expected an uncalibrated model to report raw confidence, got %.3f", got)
+	}
+	calibration, err := classifier.LearnPlattCalibration()
+	if err != nil {
+		t.Fatalf("LearnPlattCalibration returned error: %v", err)
+	}
+	if low, high := classifier.CalibrateDroneConfidence(0.1), classifier.CalibrateDroneConfidence(0.9); low >= high {
+		t.Fatalf("expected calibrated confidence to rise with the raw score, got %.3f and %.3f", low, high)
+	}
+
+	// Saving and reloading the model keeps the calibration
+	_, saved, _, _, _ := classifier.snapshot()
+	reloaded := plattFromMetadata(saved)
+	if reloaded == nil || *reloaded != calibration {
+		t.Fatalf("expected the metadata to hold %+v, got %+v", calibration, reloaded)
+	}
+
+	onlyDrones := newTestClassifier(protos[:1], 1)
+	if _, err := onlyDrones.LearnPlattCalibration(); !errors.Is(err, ErrCalibrationNeedsBothCategories) {
+		t.Fatalf("expected ErrCalibrationNeedsBothCategories, got %v", err)
+	}
+}
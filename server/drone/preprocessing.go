@@ -13,8 +13,24 @@ package drone
 
 import (
 	"math"
+	"math/cmplx"
+	"sort"
+
+	"song-recognition/shazam"
+)
+
+// LimiterMode selects how ApplyAGCWithLimiter treats samples above the knee after gain.
+type LimiterMode string
+
+const (
+	LimiterSoft LimiterMode = "soft" // tanh limiting, the default; bends loud peaks and adds harmonics
+	LimiterHard LimiterMode = "hard" // clip at the knee; only the samples above it are distorted
+	LimiterOff  LimiterMode = "off"  // pure gain, leaving loud signals undistorted but unbounded
 )
 
+// defaultLimiterKnee is the amplitude above which ApplyAGC limits.
+const defaultLimiterKnee = 0.95
+
 // PreprocessingConfig holds configuration for audio preprocessing
 type PreprocessingConfig struct {
 	EnableHighPass       bool
@@ -23,9 +39,12 @@ type PreprocessingConfig struct {
 	BandPassLow          float64 // Hz, default 100
 	BandPassHigh         float64 // Hz, default 5000
 	EnableAGC            bool
-	AGCTargetLevel       float64 // Target RMS level, default 0.3
+	AGCTargetLevel       float64     // Target RMS level, default 0.3
+	AGCLimiter           LimiterMode // Empty means LimiterSoft
+	AGCLimiterKnee       float64     // Amplitude where limiting starts, default 0.95
 	EnableNoiseReduction bool
-	NoiseReductionAlpha  float64 // Spectral subtraction factor, default 0.1
+	NoiseReductionAlpha  float64 // Multiple of the noise profile spectral subtraction removes, default 1
+	RobustSNR            bool    // Estimate SNR with EstimateSNRRobust rather than from a quiet start
 }
 
 // DefaultPreprocessingConfig returns a sensible default configuration
@@ -38,8 +57,10 @@ func DefaultPreprocessingConfig() PreprocessingConfig {
 		BandPassHigh:         5000.0,
 		EnableAGC:            true,
 		AGCTargetLevel:       0.3,
+		AGCLimiter:           LimiterSoft,
+		AGCLimiterKnee:       defaultLimiterKnee,
 		EnableNoiseReduction: false, // Disabled by default, requires noise estimation
-		NoiseReductionAlpha:  0.1,
+		NoiseReductionAlpha:  1.0,
 	}
 }
 
@@ -64,13 +85,14 @@ func PreprocessAudio(samples []float64, sampleRate int, config PreprocessingConf
 
 	// Step 3: Automatic Gain Control
 	if config.EnableAGC {
-		result = ApplyAGC(result, config.AGCTargetLevel)
+		result = ApplyAGCWithLimiter(result, config.AGCTargetLevel, config.AGCLimiter, config.AGCLimiterKnee)
 	}
 
-	// Step 4: Spectral subtraction (if enabled and noise estimate available)
-	// Note: This requires noise estimation which is complex, so we'll do a simple version
+	// Step 4: Spectral subtraction of a noise profile from the first 10% (assumed quiet)
 	if config.EnableNoiseReduction {
-		result = SimpleNoiseReduction(result, sampleRate, config.NoiseReductionAlpha)
+		noiseFrames := max(1, len(result)/10/(spectralFrameSize(sampleRate)/2))
+		profile := EstimateNoiseProfile(result, sampleRate, noiseFrames)
+		result = SpectralSubtraction(result, sampleRate, profile, config.NoiseReductionAlpha)
 	}
 
 	return result
@@ -135,6 +157,14 @@ func BandPassFilter(samples []float64, sampleRate int, lowHz, highHz float64) []
 
 // ApplyAGC normalizes audio levels using Automatic Gain Control
 func ApplyAGC(samples []float64, targetRMS float64) []float64 {
+	return ApplyAGCWithLimiter(samples, targetRMS, LimiterSoft, defaultLimiterKnee)
+}
+
+// ApplyAGCWithLimiter is ApplyAGC with a choice of limiter. The soft limiter reshapes
+// every peak above the knee, which alters the harmonic content drones are identified
+// by; LimiterHard or a higher knee distort less, and LimiterOff not at all. An empty
+// mode means LimiterSoft and a knee outside (0, 1] means 0.95.
+func ApplyAGCWithLimiter(samples []float64, targetRMS float64, mode LimiterMode, knee float64) []float64 {
 	if len(samples) == 0 {
 		return samples
 	}
@@ -153,53 +183,105 @@ func ApplyAGC(samples []float64, targetRMS float64) []float64 {
 	// Calculate gain factor
 	gain := targetRMS / currentRMS
 
-	// Apply gain with soft limiting to prevent clipping
+	if knee <= 0 || knee > 1 {
+		knee = defaultLimiterKnee
+	}
+
+	// Apply gain, limiting peaks above the knee to prevent clipping
 	result := make([]float64, len(samples))
 	for i, s := range samples {
 		amplified := s * gain
-		// Soft limiter: tanh provides smooth limiting
-		if math.Abs(amplified) > 0.95 {
-			result[i] = math.Tanh(amplified) * 0.95
-		} else {
+		switch {
+		case mode == LimiterOff || math.Abs(amplified) <= knee:
 			result[i] = amplified
+		case mode == LimiterHard:
+			result[i] = math.Copysign(knee, amplified)
+		default:
+			// Soft limiter: tanh provides smooth limiting
+			result[i] = math.Tanh(amplified) * knee
 		}
 	}
 
 	return result
 }
 
-// SimpleNoiseReduction applies basic spectral subtraction
-// This is a simplified version - full implementation would require noise estimation
-func SimpleNoiseReduction(samples []float64, sampleRate int, alpha float64) []float64 {
-	if len(samples) < 1024 {
-		return samples // Too short for meaningful processing
-	}
+// Spectral subtraction works on STFT frames of about spectralFrameSeconds, rounded up
+// to a power of two for the FFT, overlapping by half.
+const (
+	spectralFrameSeconds = 0.032
+	spectralFloor        = 0.05 // fraction of each bin's magnitude always kept, against musical noise
+)
 
-	// Estimate noise from first 10% of signal (assuming it's relatively quiet)
-	noiseLength := len(samples) / 10
-	if noiseLength < 512 {
-		noiseLength = 512
+// spectralFrameSize returns the FFT frame length SpectralSubtraction uses at sampleRate.
+func spectralFrameSize(sampleRate int) int {
+	return max(256, nextPowerOfTwo(int(float64(sampleRate)*spectralFrameSeconds)))
+}
+
+// EstimateNoiseProfile averages the magnitude spectrum of the first frames analysis
+// frames of samples, which should hold noise only. It returns nil when samples are
+// shorter than one frame.
+func EstimateNoiseProfile(samples []float64, sampleRate, frames int) []float64 {
+	frameSize := spectralFrameSize(sampleRate)
+	hop := frameSize / 2
+	if frames <= 0 || len(samples) < frameSize {
+		return nil
 	}
 
-	noiseEstimate := estimateNoiseFloor(samples[:noiseLength], sampleRate)
+	profile := make([]float64, frameSize/2+1)
+	counted := 0
+	buffer := make([]float64, frameSize)
+	for start := 0; start+frameSize <= len(samples) && counted < frames; start += hop {
+		copy(buffer, samples[start:start+frameSize])
+		applyHannWindow(buffer)
+		spectrum := shazam.FFT(buffer)
+		for k := range profile {
+			profile[k] += cmplx.Abs(spectrum[k])
+		}
+		counted++
+	}
+	for k := range profile {
+		profile[k] /= float64(counted)
+	}
+	return profile
+}
 
-	// Apply spectral subtraction in frequency domain
-	// For simplicity, we'll do a basic time-domain approach
-	// Full implementation would use FFT-based spectral subtraction
-	result := make([]float64, len(samples))
-	noiseThreshold := noiseEstimate * (1.0 + alpha)
+// SpectralSubtraction removes noiseProfile (see EstimateNoiseProfile) from samples.
+// Each STFT frame's magnitudes are reduced by alpha times the profile, but never below
+// spectralFloor of their original value; the noisy phase is kept and the frames are
+// resynthesised with Hann-weighted overlap-add (shazam.ISTFT), so the gain changes
+// between frames leave no blocking artifacts. Samples are returned unchanged when they
+// are shorter than one frame or the profile was estimated at a different frame size.
+func SpectralSubtraction(samples []float64, sampleRate int, noiseProfile []float64, alpha float64) []float64 {
+	frameSize := spectralFrameSize(sampleRate)
+	hop := frameSize / 2
+	if len(samples) < frameSize || len(noiseProfile) != frameSize/2+1 {
+		return samples
+	}
 
-	for i, s := range samples {
-		if math.Abs(s) > noiseThreshold {
-			// Reduce noise component
-			result[i] = s - math.Copysign(noiseEstimate*alpha, s)
-		} else {
-			// Below threshold, reduce more aggressively
-			result[i] = s * (1.0 - alpha*2.0)
+	frames, err := shazam.STFT(samples, frameSize, hop)
+	if err != nil {
+		return samples
+	}
+	for _, spectrum := range frames {
+		for k, value := range spectrum {
+			bin := k
+			if bin > frameSize/2 {
+				bin = frameSize - k // mirror bins share the positive frequency's profile
+			}
+			magnitude := cmplx.Abs(value)
+			gain := 0.0
+			if magnitude > 0 {
+				gain = math.Max(magnitude-alpha*noiseProfile[bin], spectralFloor*magnitude) / magnitude
+			}
+			spectrum[k] = complex(gain*real(value), gain*imag(value))
 		}
 	}
 
-	return result
+	output, err := shazam.ISTFT(frames, frameSize, hop, len(samples))
+	if err != nil {
+		return samples
+	}
+	return output
 }
 
 // estimateNoiseFloor estimates the noise floor from a sample segment
@@ -255,6 +337,47 @@ func EstimateSNR(samples []float64) float64 {
 	return 10.0 * math.Log10(snr)
 }
 
+// Percentiles of the short-time energy envelope EstimateSNRRobust takes as the noise
+// floor and the signal level.
+const (
+	snrNoisePercentile  = 0.10
+	snrSignalPercentile = 0.90
+)
+
+// EstimateSNRRobust estimates signal-to-noise ratio in dB from the short-time energy
+// envelope: the 10th percentile frame power is the noise floor and the 90th the signal.
+// Unlike EstimateSNR it works wherever in the recording the quiet and loud parts are.
+func EstimateSNRRobust(samples []float64, sampleRate int) float64 {
+	if len(samples) == 0 {
+		return 0.0
+	}
+
+	frameSize := max(1, int(float64(sampleRate)*energyFrameSeconds))
+	var powers []float64
+	for start := 0; start < len(samples); start += frameSize {
+		rms := rootMeanSquare(samples[start:min(start+frameSize, len(samples))])
+		powers = append(powers, rms*rms)
+	}
+	sort.Float64s(powers)
+
+	last := float64(len(powers) - 1)
+	noisePower := powers[int(snrNoisePercentile*last)]
+	signalPower := powers[int(math.Ceil(snrSignalPercentile*last))]
+	if noisePower == 0 {
+		return 100.0 // Very high SNR if no noise detected
+	}
+	return 10.0 * math.Log10(signalPower/noisePower)
+}
+
+// EstimateSNR estimates the SNR of samples with the estimator config selects:
+// EstimateSNRRobust when RobustSNR is set, otherwise the quiet-start EstimateSNR.
+func (config PreprocessingConfig) EstimateSNR(samples []float64, sampleRate int) float64 {
+	if config.RobustSNR {
+		return EstimateSNRRobust(samples, sampleRate)
+	}
+	return EstimateSNR(samples)
+}
+
 // AdaptiveThreshold calculates confidence threshold based on SNR
 func AdaptiveThreshold(baseThreshold float64, snrDb float64) float64 {
 	// Lower SNR = higher threshold (more conservative)
@@ -0,0 +1,129 @@
+package drone
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDisabledLimiterPreservesHarmonicRatioOfLoudSignal(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 16000
+	rng := rand.New(rand.NewSource(3))
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		phase := 2 * math.Pi * 180 * float64(i) / sampleRate
+		samples[i] = math.Sin(phase) + 0.5*math.Sin(2*phase) + 0.3*math.Sin(3*phase) + 0.1*(rng.Float64()*2-1)
+	}
+
+	harmonicRatio := func(signal []float64) float64 {
+		spectrum, freqs := computeSpectrum(signal, sampleRate, 0)
+		ratio, _, _ := harmonicFeatures(spectrum, freqs, 180, sampleRate)
+		return ratio
+	}
+	original := harmonicRatio(samples)
+
+	// An 0.8 RMS target pushes the peaks well past the 0.95 knee
+	const target = 0.8
+	soft := math.Abs(harmonicRatio(ApplyAGC(samples, target)) - original)
+	off := math.Abs(harmonicRatio(ApplyAGCWithLimiter(samples, target, LimiterOff, 0)) - original)
+	if off > 1e-9 {
+		t.Fatalf("expected pure gain to leave the harmonic ratio unchanged, drift %.6f", off)
+	}
+	if soft <= off {
+		t.Fatalf("expected the soft limiter to distort the harmonic ratio, drift %.6f vs %.6f", soft, off)
+	}
+	t.Logf("harmonic ratio %.4f; drift %.4f soft limited, %.4f unlimited", original, soft, off)
+
+	limited := ApplyAGCWithLimiter(samples, target, LimiterHard, 0.99)
+	for i, value := range limited {
+		if math.Abs(value) > 0.99 {
+			t.Fatalf("expected the hard limiter to clip at the knee, sample %d is %.4f", i, value)
+		}
+	}
+}
+
+func TestRobustSNRHandlesLoudStart(t *testing.T) {
+	t.Parallel()
+
+	// A drone audible for the first 30% of the clip over a quiet noise bed
+	const sampleRate = 16000
+	rng := rand.New(rand.NewSource(7))
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		samples[i] = 0.01 * (rng.Float64()*2 - 1)
+		if i < len(samples)*3/10 {
+			samples[i] += 0.5 * math.Sin(2*math.Pi*180*float64(i)/sampleRate)
+		}
+	}
+
+	quietStart := EstimateSNR(samples)
+	robust := EstimateSNRRobust(samples, sampleRate)
+	t.Logf("SNR %.1f dB assuming a quiet start, %.1f dB from the energy envelope", quietStart, robust)
+	if quietStart > 3 {
+		t.Fatalf("expected the quiet-start estimate to take the drone for noise, got %.1f dB", quietStart)
+	}
+	if robust < 20 {
+		t.Fatalf("expected the robust estimate to see the drone well above the noise bed, got %.1f dB", robust)
+	}
+
+	if got := (PreprocessingConfig{RobustSNR: true}).EstimateSNR(samples, sampleRate); got != robust {
+		t.Fatalf("expected RobustSNR to select EstimateSNRRobust, got %.1f dB", got)
+	}
+	if got := DefaultPreprocessingConfig().EstimateSNR(samples, sampleRate); got != quietStart {
+		t.Fatalf("expected the default configuration to keep EstimateSNR, got %.1f dB", got)
+	}
+}
+
+func TestSpectralSubtractionImprovesToneSNR(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 16000
+	rng := rand.New(rand.NewSource(11))
+	whiteNoise := func(n int) []float64 {
+		noise := make([]float64, n)
+		for i := range noise {
+			noise[i] = 0.2 * (rng.Float64()*2 - 1)
+		}
+		return noise
+	}
+
+	tone := make([]float64, sampleRate)
+	noisy := whiteNoise(len(tone))
+	for i := range tone {
+		tone[i] = 0.3 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+		noisy[i] += tone[i]
+	}
+	snrAgainstTone := func(signal []float64) float64 {
+		var power, errPower float64
+		for i := range tone {
+			power += tone[i] * tone[i]
+			errPower += (signal[i] - tone[i]) * (signal[i] - tone[i])
+		}
+		return 10 * math.Log10(power/errPower)
+	}
+
+	profile := EstimateNoiseProfile(whiteNoise(sampleRate/4), sampleRate, 10)
+	if len(profile) != spectralFrameSize(sampleRate)/2+1 {
+		t.Fatalf("expected a profile of %d bins, got %d", spectralFrameSize(sampleRate)/2+1, len(profile))
+	}
+	cleaned := SpectralSubtraction(noisy, sampleRate, profile, 1)
+	if len(cleaned) != len(noisy) {
+		t.Fatalf("expected %d samples back, got %d", len(noisy), len(cleaned))
+	}
+
+	before, after := snrAgainstTone(noisy), snrAgainstTone(cleaned)
+	t.Logf("SNR %.1f dB before spectral subtraction, %.1f dB after", before, after)
+	if after < before+3 {
+		t.Fatalf("expected spectral subtraction to improve SNR by at least 3 dB, got %.1f -> %.1f dB", before, after)
+	}
+
+	// Without noise to remove, overlap-add reconstructs the input
+	unchanged := SpectralSubtraction(tone, sampleRate, make([]float64, len(profile)), 1)
+	for i := range tone {
+		if math.Abs(unchanged[i]-tone[i]) > 1e-9 {
+			t.Fatalf("expected a zero profile to reconstruct the input, sample %d is %.6f vs %.6f", i, unchanged[i], tone[i])
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package drone
+
+// Audio Quality Gate
+//
+// AssessAudioQuality inspects a raw recording (before preprocessing, which would hide
+// clipping and DC offset) and reports problems the user can fix: too short, clipped,
+// too quiet, wind rumble, DC offset or a start louder than the rest. Issues with
+// severity "error" make the recording unusable for classification; warnings are
+// informational.
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	qualityMinDurationSec  = 1.0
+	qualityClipLevel       = 0.999 // |sample| at or above this counts as clipped
+	qualityMaxClipFraction = 0.001
+	qualityMinLevelDb      = -60.0
+	qualityMaxDCOffset     = 0.05
+	qualityWindCutoffHz    = 100.0
+	qualityMaxWindRatio    = 0.5 // share of (DC-free) power below qualityWindCutoffHz
+	qualityMinSNRDb        = -3.0
+	qualitySeverityError   = "error"
+	qualitySeverityWarning = "warning"
+)
+
+// AudioQualityIssue describes one problem found in a recording.
+type AudioQualityIssue struct {
+	Code     string `json:"code"`     // too_short, clipped, too_quiet, wind, dc_offset, low_snr
+	Severity string `json:"severity"` // error or warning
+	Message  string `json:"message"`
+}
+
+// AudioQualityReport is the verdict of AssessAudioQuality.
+type AudioQualityReport struct {
+	Usable           bool                `json:"usable"`
+	Issues           []AudioQualityIssue `json:"issues,omitempty"`
+	DurationSec      float64             `json:"durationSec"`
+	ClippingFraction float64             `json:"clippingFraction"`
+	LevelDb          float64             `json:"levelDb"`
+	DCOffset         float64             `json:"dcOffset"`
+	WindRatio        float64             `json:"windRatio"`
+	SNRDb            float64             `json:"snrDb"`
+}
+
+// AssessAudioQuality checks samples recorded at sampleRate. EstimateSNR treats the
+// first 10% of the clip as noise, so a steady source reads about 0 dB; only an
+// estimate below qualityMinSNRDb, where the start is clearly louder than the rest,
+// is flagged.
+func AssessAudioQuality(samples []float64, sampleRate int) AudioQualityReport {
+	report := AudioQualityReport{LevelDb: silenceLevelDb}
+	if sampleRate > 0 {
+		report.DurationSec = float64(len(samples)) / float64(sampleRate)
+	}
+
+	if len(samples) > 0 {
+		clipped := 0
+		var sum float64
+		for _, s := range samples {
+			if math.Abs(s) >= qualityClipLevel {
+				clipped++
+			}
+			sum += s
+		}
+		report.ClippingFraction = float64(clipped) / float64(len(samples))
+		report.DCOffset = sum / float64(len(samples))
+		report.LevelDb = SignalLevelDb(samples)
+		report.WindRatio = lowFrequencyRatio(samples, sampleRate, report.DCOffset, qualityWindCutoffHz)
+		report.SNRDb = EstimateSNR(samples)
+	}
+
+	if report.DurationSec < qualityMinDurationSec {
+		report.addIssue("too_short", qualitySeverityError,
+			fmt.Sprintf("Recording is too short (%.1f s); record at least %.0f s.", report.DurationSec, qualityMinDurationSec))
+	}
+	if report.ClippingFraction > qualityMaxClipFraction {
+		report.addIssue("clipped", qualitySeverityError,
+			fmt.Sprintf("Recording is clipped (%.1f%% of samples at full scale); lower the input gain or move the microphone away from the source.", report.ClippingFraction*100))
+	}
+	if len(samples) > 0 && report.LevelDb < qualityMinLevelDb {
+		report.addIssue("too_quiet", qualitySeverityError,
+			fmt.Sprintf("Recording is too quiet (%.0f dBFS); move closer or raise the input gain.", report.LevelDb))
+	}
+	if report.WindRatio > qualityMaxWindRatio {
+		report.addIssue("wind", qualitySeverityWarning,
+			"Strong low-frequency rumble, likely wind; shield the microphone with a windscreen.")
+	}
+	if math.Abs(report.DCOffset) > qualityMaxDCOffset {
+		report.addIssue("dc_offset", qualitySeverityWarning,
+			fmt.Sprintf("Signal has a DC offset of %.2f; check the microphone or audio interface.", report.DCOffset))
+	}
+	if len(samples) > 0 && report.SNRDb < qualityMinSNRDb {
+		report.addIssue("low_snr", qualitySeverityWarning,
+			"Background noise is louder than the signal; record closer to the source.")
+	}
+
+	report.Usable = true
+	for _, issue := range report.Issues {
+		if issue.Severity == qualitySeverityError {
+			report.Usable = false
+		}
+	}
+	return report
+}
+
+// hasIssue reports whether the report contains an issue with the given code.
+func (r *AudioQualityReport) hasIssue(code string) bool {
+	for _, issue := range r.Issues {
+		if issue.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *AudioQualityReport) addIssue(code, severity, message string) {
+	r.Issues = append(r.Issues, AudioQualityIssue{Code: code, Severity: severity, Message: message})
+}
+
+// lowFrequencyRatio returns the share of the signal's AC power below cutoffHz, using a
+// one-pole low-pass filter.
+func lowFrequencyRatio(samples []float64, sampleRate int, dcOffset float64, cutoffHz float64) float64 {
+	if sampleRate <= 0 || len(samples) == 0 {
+		return 0
+	}
+
+	alpha := 1 - math.Exp(-2*math.Pi*cutoffHz/float64(sampleRate))
+	var low, lowPower, totalPower float64
+	for _, s := range samples {
+		s -= dcOffset
+		low += alpha * (s - low)
+		lowPower += low * low
+		totalPower += s * s
+	}
+	if totalPower == 0 {
+		return 0
+	}
+	return lowPower / totalPower
+}
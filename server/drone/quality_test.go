@@ -0,0 +1,39 @@
+package drone
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAssessAudioQualityReportsClippedShortClip(t *testing.T) {
+	const sampleRate = 44100
+
+	// Half a second of a tone driven well past full scale
+	clipped := make([]float64, sampleRate/2)
+	for i := range clipped {
+		clipped[i] = math.Max(-1, math.Min(1, 1.5*math.Sin(2*math.Pi*440*float64(i)/sampleRate)))
+	}
+
+	report := AssessAudioQuality(clipped, sampleRate)
+	if report.Usable {
+		t.Fatalf("expected a clipped, short clip to be unusable: %+v", report)
+	}
+	codes := make(map[string]bool)
+	for _, issue := range report.Issues {
+		codes[issue.Code] = true
+		if issue.Message == "" {
+			t.Fatalf("issue %s has no message", issue.Code)
+		}
+	}
+	if !codes["too_short"] || !codes["clipped"] {
+		t.Fatalf("expected too_short and clipped issues, got %+v", report.Issues)
+	}
+
+	clean := make([]float64, 2*sampleRate)
+	for i := range clean {
+		clean[i] = 0.3 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+	}
+	if report := AssessAudioQuality(clean, sampleRate); !report.Usable || len(report.Issues) != 0 {
+		t.Fatalf("expected a clean tone to pass, got %+v", report.Issues)
+	}
+}
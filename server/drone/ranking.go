@@ -0,0 +1,84 @@
+package drone
+
+// Ranking Blend
+//
+// Predictions are ordered by confidence, with exact ties broken by average distance. That
+// leaves no way to say which of two labels with the same vote should win when one owes
+// it to a single close neighbour and the other to several far ones. A RankingBlend
+// replaces the ordering with a weighted score of three terms, each in [0, 1]:
+//
+//	share      the label's share of the inverse-distance vote
+//	support    the fraction of the k voting neighbours that carry the label
+//	closeness  1 / (1 + average distance) to the label's voting neighbours
+//
+// Weighting support biases the ranking towards consensus, weighting closeness towards the
+// nearest match. Confidences are unchanged; only the order, and so the top prediction,
+// moves. Labels found only by template matching have no score and rank after the k-NN
+// labels. The zero blend keeps the confidence ordering.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RankingBlend weights the terms of the score predictions are ranked by.
+type RankingBlend struct {
+	Share     float64 `json:"share"`
+	Support   float64 `json:"support"`
+	Closeness float64 `json:"closeness"`
+}
+
+// enabled reports whether the blend replaces the confidence ordering.
+func (b RankingBlend) enabled() bool {
+	return b.Share > 0 || b.Support > 0 || b.Closeness > 0
+}
+
+// score blends a label's vote share, its fraction of the k voting neighbours and its
+// average neighbour distance.
+func (b RankingBlend) score(share float64, support, k int, averageDistance float64) float64 {
+	supportFraction := 0.0
+	if k > 0 {
+		supportFraction = float64(support) / float64(k)
+	}
+	return b.Share*share + b.Support*supportFraction + b.Closeness/(1+averageDistance)
+}
+
+// ParseRankingBlend maps a configuration value such as "share=1,support=0.5" to a
+// RankingBlend. Omitted terms weigh zero; empty means the confidence ordering.
+func ParseRankingBlend(value string) (RankingBlend, error) {
+	var blend RankingBlend
+	for _, term := range strings.Split(value, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		name, weightText, ok := strings.Cut(term, "=")
+		if !ok {
+			return RankingBlend{}, fmt.Errorf("invalid ranking term %q (expected name=weight)", term)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+		if err != nil || weight < 0 {
+			return RankingBlend{}, fmt.Errorf("invalid weight %q for ranking term %q", weightText, name)
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "share":
+			blend.Share = weight
+		case "support":
+			blend.Support = weight
+		case "closeness":
+			blend.Closeness = weight
+		default:
+			return RankingBlend{}, fmt.Errorf("unknown ranking term %q (expected share, support or closeness)", name)
+		}
+	}
+	return blend, nil
+}
+
+// SetRankingBlend orders predictions by blend instead of by confidence. The zero blend
+// restores the confidence ordering.
+func (c *Classifier) SetRankingBlend(blend RankingBlend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confidence.ranking = blend
+}
@@ -0,0 +1,56 @@
+package drone
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRankingBlendFlipsTopLabel(t *testing.T) {
+	// One "near" prototype at cosine distance 0.1 and three "crowd" prototypes at 0.3
+	// carry the same inverse-distance vote, so confidence alone cannot separate them.
+	nearOff := math.Sqrt(1 - 0.9*0.9)
+	crowdOff := math.Sqrt(1 - 0.7*0.7)
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("near", "near_1", map[int]float64{0: 0.9, 1: nearOff}),
+		newSyntheticPrototype("crowd", "crowd_1", map[int]float64{0: 0.7, 2: crowdOff}),
+		newSyntheticPrototype("crowd", "crowd_2", map[int]float64{0: 0.7, 3: crowdOff}),
+		newSyntheticPrototype("crowd", "crowd_3", map[int]float64{0: 0.7, 4: crowdOff}),
+	}, 4)
+	query := featureVector(map[int]float64{0: 1})
+
+	for _, test := range []struct {
+		blend RankingBlend
+		top   string
+	}{
+		{RankingBlend{Share: 1, Support: 1}, "crowd"},
+		{RankingBlend{Share: 1, Closeness: 1}, "near"},
+	} {
+		classifier.SetRankingBlend(test.blend)
+		predictions, err := classifier.Predict(append([]float64(nil), query...))
+		if err != nil {
+			t.Fatalf("%+v: prediction failed: %v", test.blend, err)
+		}
+		if len(predictions) != 2 || predictions[0].Label != test.top {
+			t.Fatalf("%+v: expected %s first, got %+v", test.blend, test.top, predictions)
+		}
+		if math.Abs(predictions[0].Confidence-predictions[1].Confidence) > 1e-6 {
+			t.Fatalf("%+v: expected the blend to leave confidences tied, got %v and %v",
+				test.blend, predictions[0].Confidence, predictions[1].Confidence)
+		}
+	}
+}
+
+func TestParseRankingBlend(t *testing.T) {
+	blend, err := ParseRankingBlend(" share=1, support=0.5 ")
+	if err != nil || blend != (RankingBlend{Share: 1, Support: 0.5}) {
+		t.Fatalf("expected share and support weights, got %+v (%v)", blend, err)
+	}
+	if blend, err := ParseRankingBlend(""); err != nil || blend.enabled() {
+		t.Fatalf("expected an empty value to disable the blend, got %+v (%v)", blend, err)
+	}
+	for _, value := range []string{"share", "share=-1", "distance=1"} {
+		if _, err := ParseRankingBlend(value); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
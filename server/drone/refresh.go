@@ -0,0 +1,79 @@
+package drone
+
+// Model Refresh
+//
+// Prototype features are only comparable with query features extracted by the same
+// code. When extraction changes, RefreshModel re-runs the current pipeline (convert,
+// preprocess, extract) on every prototype whose source audio is still on disk and
+// rewrites the model in place, keeping IDs, labels and metadata. Prototypes without a
+// source keep their old features, so the refresh is refused when the new features no
+// longer have the same dimension as those stale ones.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// RefreshModel recomputes the legacy features of every prototype in modelPath whose
+// source file exists and saves the model. Prototypes with a missing source are counted
+// as skipped. PANNS models must be re-embedded through the embedding service instead.
+func RefreshModel(modelPath string) (refreshed, skipped int, err error) {
+	data, err := os.ReadFile(modelPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read model: %w", err)
+	}
+	var prototypes []Prototype
+	if err := json.Unmarshal(data, &prototypes); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse model: %w", err)
+	}
+	if len(prototypes) == 0 {
+		return 0, 0, errors.New("model has no prototypes")
+	}
+	if len(prototypes[0].Features) == pannsEmbeddingDimension {
+		return 0, 0, errors.New("model holds PANNS embeddings, which cannot be refreshed with legacy extraction")
+	}
+
+	refreshedDim, staleDim := 0, 0
+	fftSize := DefaultFeatureConfig().FFTSize
+	for i := range prototypes {
+		proto := &prototypes[i]
+		if _, statErr := os.Stat(proto.Source); proto.Source == "" || statErr != nil {
+			skipped++
+			staleDim = len(proto.Features)
+			continue
+		}
+
+		features, err := ExtractFeaturesFromPath(proto.Source)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to refresh prototype %s: %w", proto.ID, err)
+		}
+		proto.Features = features
+		refreshedDim = len(features)
+		if proto.Metadata == nil {
+			proto.Metadata = map[string]string{}
+		}
+		if fftSize > 0 {
+			proto.Metadata[FFTSizeMetadataKey] = strconv.Itoa(fftSize)
+		} else {
+			delete(proto.Metadata, FFTSizeMetadataKey)
+		}
+		refreshed++
+	}
+
+	if refreshed > 0 && skipped > 0 && refreshedDim != staleDim {
+		return 0, 0, fmt.Errorf("extraction now produces %d features but %d prototypes without sources keep %d; restore their sources or remove them",
+			refreshedDim, skipped, staleDim)
+	}
+	if refreshed == 0 {
+		return 0, skipped, nil
+	}
+
+	if err := WritePrototypes(modelPath, prototypes); err != nil {
+		return 0, 0, err
+	}
+
+	return refreshed, skipped, nil
+}
@@ -0,0 +1,74 @@
+package drone
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+func TestRefreshModelRecomputesStaleFeatures(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "quad_01.wav")
+	tone := make([]float64, SyntheticSampleRate)
+	for i := range tone {
+		tone[i] = 0.5 * math.Sin(2*math.Pi*180*float64(i)/SyntheticSampleRate)
+	}
+	if err := wav.WriteSamplesToWav(source, tone, SyntheticSampleRate); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	current, err := ExtractFeaturesFromPath(source)
+	if err != nil {
+		t.Fatalf("ExtractFeaturesFromPath returned error: %v", err)
+	}
+
+	// Both prototypes hold features from an older extractor
+	stale := make([]float64, len(current))
+	for i := range stale {
+		stale[i] = 0.5
+	}
+	modelPath := filepath.Join(dir, "model.json")
+	original := []Prototype{
+		{ID: "quad_1", Label: "quad", Category: "drone", Source: source, Features: stale, Metadata: map[string]string{"site": "north"}},
+		{ID: "wind_1", Label: "wind", Category: "noise", Source: filepath.Join(dir, "missing.wav"), Features: stale},
+	}
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+
+	refreshed, skipped, err := RefreshModel(modelPath)
+	if err != nil {
+		t.Fatalf("RefreshModel returned error: %v", err)
+	}
+	if refreshed != 1 || skipped != 1 {
+		t.Fatalf("expected 1 refreshed and 1 skipped prototype, got %d and %d", refreshed, skipped)
+	}
+
+	data, err = os.ReadFile(modelPath)
+	if err != nil {
+		t.Fatalf("failed to read refreshed model: %v", err)
+	}
+	var saved []Prototype
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("failed to parse refreshed model: %v", err)
+	}
+	if len(saved) != 2 || saved[0].ID != "quad_1" || saved[0].Label != "quad" || saved[0].Metadata["site"] != "north" {
+		t.Fatalf("expected identity and metadata to be preserved, got %+v", saved)
+	}
+	if !reflect.DeepEqual(saved[0].Features, current) {
+		t.Fatalf("expected quad_1 to hold freshly extracted features")
+	}
+	if !reflect.DeepEqual(saved[1].Features, stale) {
+		t.Fatalf("expected wind_1 to keep its features while its source is missing")
+	}
+}
@@ -0,0 +1,46 @@
+package drone
+
+// Out-of-Distribution Rejection
+//
+// The k-NN vote always lands on a known label, however far the query is from every
+// prototype, so birds or thunder still come out as the nearest drone. With a maximum
+// accept distance set, a query whose nearest prototype lies further away than that
+// gets a synthetic UnknownLabel prediction in front of the known ones. Its confidence,
+// 1 - maxAccept/nearest, is 0 at the threshold and approaches 1 the further the query
+// is out of distribution. The threshold is in the units of the distance metric.
+
+// UnknownLabel and UnknownCategory mark the prediction prepended for a query that is
+// further than the maximum accept distance from every prototype.
+const (
+	UnknownLabel    = "unknown"
+	UnknownCategory = "unknown"
+)
+
+// rejectOutOfDistribution prepends an UnknownLabel prediction when the nearest voting
+// prototype is further than maxAccept. maxAccept <= 0 disables rejection.
+func rejectOutOfDistribution(predictions []Prediction, maxAccept float64) []Prediction {
+	if maxAccept <= 0 || len(predictions) == 0 {
+		return predictions
+	}
+
+	nearest := -1.0
+	for _, pred := range predictions {
+		for _, score := range pred.TopPrototypes {
+			if nearest < 0 || score.Distance < nearest {
+				nearest = score.Distance
+			}
+		}
+	}
+	if nearest <= maxAccept {
+		return predictions
+	}
+
+	unknown := Prediction{
+		Label:       UnknownLabel,
+		Category:    UnknownCategory,
+		Type:        UnknownLabel,
+		Confidence:  1 - maxAccept/nearest,
+		AverageDist: nearest,
+	}
+	return append([]Prediction{unknown}, predictions...)
+}
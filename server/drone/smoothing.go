@@ -0,0 +1,84 @@
+package drone
+
+// Detection Smoothing
+//
+// A client streaming short recordings sees every classification on its own, so one
+// mis-fire among steady noise raises a false alarm. DetectionSmoother debounces a stream
+// of results: it keeps the top label of the last N classifications and only changes the
+// reported (stable) label once M of them agree on a new one. Until a label first reaches
+// M votes nothing is reported. The stable confidence is the mean confidence of the
+// results in the window that carry the stable label.
+
+import "sync"
+
+// DetectionSmoother reports a stable label over a sliding window of classifications. It
+// is safe for concurrent use.
+type DetectionSmoother struct {
+	mu               sync.Mutex
+	window           int
+	agreement        int
+	recent           []smoothedResult
+	stableLabel      string
+	stableConfidence float64
+}
+
+type smoothedResult struct {
+	label      string
+	confidence float64
+}
+
+// NewDetectionSmoother returns a smoother over the last window classifications that
+// needs agreement of them to change the stable label. A window below 1 is 1; an
+// agreement outside [1, window] is a simple majority of the window.
+func NewDetectionSmoother(window, agreement int) *DetectionSmoother {
+	window = max(window, 1)
+	if agreement < 1 || agreement > window {
+		agreement = window/2 + 1
+	}
+	return &DetectionSmoother{window: window, agreement: agreement}
+}
+
+// Update adds summary's top prediction to the window and returns the stable label and
+// its confidence. A summary without predictions counts as a vote for no label.
+func (s *DetectionSmoother) Update(summary ClassificationSummary) (stableLabel string, stableConfidence float64) {
+	var result smoothedResult
+	if len(summary.Predictions) > 0 {
+		result = smoothedResult{label: summary.Predictions[0].Label, confidence: summary.Predictions[0].Confidence}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recent = append(s.recent, result)
+	if len(s.recent) > s.window {
+		s.recent = s.recent[len(s.recent)-s.window:]
+	}
+
+	// Votes for the current stable label win ties, so it only flips to a clear successor
+	votes := make(map[string]int)
+	for _, recent := range s.recent {
+		votes[recent.label]++
+	}
+	candidate, best := s.stableLabel, votes[s.stableLabel]
+	for _, recent := range s.recent {
+		if votes[recent.label] > best {
+			candidate, best = recent.label, votes[recent.label]
+		}
+	}
+	if best >= s.agreement {
+		s.stableLabel = candidate
+	}
+
+	var sum float64
+	var count int
+	for _, recent := range s.recent {
+		if recent.label == s.stableLabel {
+			sum += recent.confidence
+			count++
+		}
+	}
+	if count > 0 {
+		s.stableConfidence = sum / float64(count)
+	}
+	return s.stableLabel, s.stableConfidence
+}
@@ -0,0 +1,53 @@
+package drone
+
+import (
+	"math"
+	"testing"
+)
+
+func smoothingSummary(label string, confidence float64) ClassificationSummary {
+	return ClassificationSummary{
+		Predictions: []Prediction{{Label: label, Confidence: confidence}},
+		IsDrone:     label == "quad",
+	}
+}
+
+func TestDetectionSmootherIgnoresSingleSpuriousDrone(t *testing.T) {
+	smoother := NewDetectionSmoother(5, 3)
+
+	for i, step := range []struct {
+		label  string
+		stable string
+	}{
+		{"wind", ""}, // nothing is reported before three results agree
+		{"wind", ""},
+		{"wind", "wind"},
+		{"quad", "wind"}, // a lone mis-fire
+		{"wind", "wind"},
+		{"wind", "wind"},
+		{"wind", "wind"},
+		{"quad", "wind"},
+		{"quad", "wind"},
+		{"quad", "quad"}, // three of the last five
+	} {
+		stable, confidence := smoother.Update(smoothingSummary(step.label, 0.8))
+		if stable != step.stable {
+			t.Fatalf("step %d (%s): expected stable label %q, got %q", i, step.label, step.stable, stable)
+		}
+		if stable != "" && math.Abs(confidence-0.8) > 1e-9 {
+			t.Fatalf("step %d: expected the stable label's mean confidence 0.8, got %v", i, confidence)
+		}
+	}
+}
+
+func TestDetectionSmootherDefaultsToMajority(t *testing.T) {
+	smoother := NewDetectionSmoother(4, 0)
+	for _, label := range []string{"quad", "quad"} {
+		if stable, _ := smoother.Update(smoothingSummary(label, 0.9)); stable != "" {
+			t.Fatalf("expected no stable label before a majority of 3, got %q", stable)
+		}
+	}
+	if stable, confidence := smoother.Update(smoothingSummary("quad", 0.6)); stable != "quad" || math.Abs(confidence-0.8) > 1e-9 {
+		t.Fatalf("expected quad at mean confidence 0.8, got %q at %v", stable, confidence)
+	}
+}
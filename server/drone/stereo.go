@@ -0,0 +1,97 @@
+package drone
+
+// Stereo Directional Features
+//
+// Recordings are mixed down to mono for analysis, which throws away where a sound came
+// from. For stereo recordings ExtractStereoFeatures compares the two channels:
+//
+// 1. Level difference: (L - R) / (L + R) of the channel RMS levels; +1 is hard left
+// 2. Time difference: the lag maximising the cross-correlation, within the travel time
+//    across the microphone pair (stereoMaxLagSeconds), scaled to -1..1; positive when
+//    the left channel leads
+// 3. Coherence: the normalised cross-correlation at that lag; a low value means the
+//    channels share little and the other two say little about direction
+//
+// With FeatureConfig.EnableStereo the three are appended to the legacy feature vector,
+// before the harmonic features. Mono recordings, and every path that only has the mono
+// mix, get monoStereoFeatures so vectors keep one dimension. StereoBearing turns the
+// time difference into a rough bearing.
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	stereoFeatureCount = 3
+
+	// stereoMaxLagSeconds is the longest inter-channel delay considered, about the
+	// travel time of sound across 34 cm of microphone spacing.
+	stereoMaxLagSeconds = 0.001
+)
+
+// monoStereoFeatures are the stereo features of identical channels.
+var monoStereoFeatures = []float64{0, 0, 1}
+
+// ExtractStereoFeatures returns the inter-channel level difference, time difference and
+// coherence of a stereo recording.
+func ExtractStereoFeatures(left, right []float64, sampleRate int) ([]float64, error) {
+	if len(left) == 0 || len(right) == 0 {
+		return nil, errors.New("no samples provided")
+	}
+	if len(left) != len(right) {
+		return nil, errors.New("channels differ in length")
+	}
+	if sampleRate <= 0 {
+		return nil, errors.New("invalid sample rate")
+	}
+
+	var levelDifference float64
+	leftLevel, rightLevel := rootMeanSquare(left), rootMeanSquare(right)
+	if total := leftLevel + rightLevel; total > 0 {
+		levelDifference = (leftLevel - rightLevel) / total
+	}
+
+	maxLag := max(1, int(float64(sampleRate)*stereoMaxLagSeconds))
+	bestLag, bestCorrelation := 0, 0.0
+	if norm := math.Sqrt(sumOfSquares(left) * sumOfSquares(right)); norm > 0 {
+		for lag := -maxLag; lag <= maxLag; lag++ {
+			correlation := crossCorrelation(left, right, lag) / norm
+			if correlation > bestCorrelation {
+				bestLag, bestCorrelation = lag, correlation
+			}
+		}
+	}
+
+	return []float64{levelDifference, float64(bestLag) / float64(maxLag), clamp01(bestCorrelation)}, nil
+}
+
+// StereoBearing estimates the bearing in degrees from the stereo features, from -90
+// (hard left) through 0 (straight ahead or behind) to 90 (hard right), assuming the
+// microphones are stereoMaxLagSeconds of travel time apart.
+func StereoBearing(stereo []float64) float64 {
+	if len(stereo) < 2 {
+		return 0
+	}
+	return -math.Asin(math.Max(-1, math.Min(1, stereo[1]))) * 180 / math.Pi
+}
+
+// crossCorrelation sums left[i-lag] * right[i]; it peaks at a positive lag when the
+// right channel repeats the left lag samples later.
+func crossCorrelation(left, right []float64, lag int) float64 {
+	var sum float64
+	for i := range right {
+		if j := i - lag; j >= 0 && j < len(left) {
+			sum += left[j] * right[i]
+		}
+	}
+	return sum
+}
+
+func sumOfSquares(samples []float64) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += s * s
+	}
+	return sum
+}
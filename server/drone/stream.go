@@ -0,0 +1,122 @@
+package drone
+
+// Streaming Windows
+//
+// A client monitoring continuously sends audio in small chunks rather than as one
+// recording. StreamWindower buffers the chunks and cuts the stream into the same
+// overlapping windows PredictWithSlidingWindows uses for a whole clip, handing out each
+// window as soon as its last sample arrives. Only the samples a later window still
+// needs are kept, so memory stays bounded however long the stream runs.
+//
+// A StreamSession is one client's continuous classification built on a windower: the
+// rolling buffer carries each window's overlap over into the next, so a drone heard
+// across chunk boundaries is classified within whole windows, and the session tracks
+// whether a drone is currently being detected so each detection is reported once, when
+// it begins.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StreamWindow is one completed window of a stream.
+type StreamWindow struct {
+	Index   int       // position in the stream's window sequence
+	Start   float64   // seconds since the start of the stream
+	End     float64   // seconds
+	Samples []float64 // owned by the caller
+}
+
+// StreamWindower cuts a stream of samples into overlapping windows. It is not safe for
+// concurrent use.
+type StreamWindower struct {
+	sampleRate int
+	windowSize int
+	hopSize    int
+	pending    []float64
+	offset     int // stream position of pending[0], in samples
+	next       int // index of the next window
+}
+
+// NewStreamWindower returns a windower for a stream at sampleRate with windows of
+// windowSeconds overlapping by overlapSeconds. An overlap of the whole window or more
+// is treated as half a window, as in PredictWithSlidingWindows.
+func NewStreamWindower(sampleRate int, windowSeconds, overlapSeconds float64) (*StreamWindower, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	windowSize := int(windowSeconds * float64(sampleRate))
+	if windowSize <= 0 {
+		return nil, errors.New("stream window must be longer than zero")
+	}
+	hopSize := windowSize - int(max(overlapSeconds, 0)*float64(sampleRate))
+	if hopSize <= 0 {
+		hopSize = max(windowSize/2, 1)
+	}
+	return &StreamWindower{sampleRate: sampleRate, windowSize: windowSize, hopSize: hopSize}, nil
+}
+
+// Push appends samples to the stream and returns the windows they completed, in order.
+func (w *StreamWindower) Push(samples []float64) []StreamWindow {
+	w.pending = append(w.pending, samples...)
+
+	var windows []StreamWindow
+	for len(w.pending) >= w.windowSize {
+		window := make([]float64, w.windowSize)
+		copy(window, w.pending)
+		start := float64(w.offset) / float64(w.sampleRate)
+		windows = append(windows, StreamWindow{
+			Index:   w.next,
+			Start:   start,
+			End:     start + float64(w.windowSize)/float64(w.sampleRate),
+			Samples: window,
+		})
+		w.next++
+
+		// Keep only what later windows still need
+		w.pending = append(w.pending[:0], w.pending[w.hopSize:]...)
+		w.offset += w.hopSize
+	}
+	return windows
+}
+
+// StreamSession is the state of one client's continuous classification. It is not safe
+// for concurrent use.
+type StreamSession struct {
+	SampleRate int
+	Channels   int
+	Model      string
+	windower   *StreamWindower
+	detecting  bool
+}
+
+// NewStreamSession returns a session for a stream of sampleRate audio with channels
+// interleaved channels classified against model, cut into windows of windowSeconds
+// overlapping by overlapSeconds.
+func NewStreamSession(sampleRate, channels int, model string, windowSeconds, overlapSeconds float64) (*StreamSession, error) {
+	windower, err := NewStreamWindower(sampleRate, windowSeconds, overlapSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamSession{SampleRate: sampleRate, Channels: channels, Model: model, windower: windower}, nil
+}
+
+// Continues reports whether a chunk in the given format for model belongs to this
+// session rather than starting a new one.
+func (s *StreamSession) Continues(sampleRate, channels int, model string) bool {
+	return s.SampleRate == sampleRate && s.Channels == channels && s.Model == model
+}
+
+// Push appends mono samples to the rolling buffer and returns the windows they
+// completed, in order.
+func (s *StreamSession) Push(samples []float64) []StreamWindow {
+	return s.windower.Push(samples)
+}
+
+// Observe records whether the latest window held a drone and reports whether that
+// starts a detection, i.e. the previous window held none.
+func (s *StreamSession) Observe(isDrone bool) bool {
+	onset := isDrone && !s.detecting
+	s.detecting = isDrone
+	return onset
+}
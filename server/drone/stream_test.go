@@ -0,0 +1,76 @@
+package drone
+
+import "testing"
+
+func TestStreamWindowerEmitsOverlappingWindows(t *testing.T) {
+	const sampleRate = 1000
+	windower, err := NewStreamWindower(sampleRate, 3.0, 1.5)
+	if err != nil {
+		t.Fatalf("NewStreamWindower returned error: %v", err)
+	}
+
+	// Six seconds in uneven chunks, with a sample's stream position as its value
+	var windows []StreamWindow
+	position := 0
+	for _, size := range []int{700, 1300, 2500, 1, 1499} {
+		chunk := make([]float64, size)
+		for i := range chunk {
+			chunk[i] = float64(position + i)
+		}
+		position += size
+		windows = append(windows, windower.Push(chunk)...)
+	}
+
+	wantStarts := []float64{0, 1.5, 3}
+	if len(windows) != len(wantStarts) {
+		t.Fatalf("expected %d windows from 6 s of audio, got %d", len(wantStarts), len(windows))
+	}
+	for i, window := range windows {
+		if window.Index != i || window.Start != wantStarts[i] || window.End != wantStarts[i]+3 {
+			t.Fatalf("window %d: got index %d at %.1f-%.1f s", i, window.Index, window.Start, window.End)
+		}
+		if len(window.Samples) != 3*sampleRate || window.Samples[0] != wantStarts[i]*sampleRate {
+			t.Fatalf("window %d: expected 3 s of samples from %.0f, got %d from %.0f",
+				i, wantStarts[i]*sampleRate, len(window.Samples), window.Samples[0])
+		}
+	}
+	if len(windower.pending) >= windower.windowSize {
+		t.Fatalf("expected only a partial window to stay buffered, got %d samples", len(windower.pending))
+	}
+}
+
+func TestStreamSessionCarriesOverlapAndReportsOnsets(t *testing.T) {
+	const sampleRate = 1000
+	session, err := NewStreamSession(sampleRate, 1, "site-north", 3.0, 1.5)
+	if err != nil {
+		t.Fatalf("NewStreamSession returned error: %v", err)
+	}
+	if !session.Continues(sampleRate, 1, "site-north") || session.Continues(sampleRate, 2, "site-north") ||
+		session.Continues(sampleRate, 1, "default") {
+		t.Fatal("expected only chunks in the same format and model to continue the session")
+	}
+
+	// The second window's first half is carried over from the first
+	first := session.Push(make([]float64, 3*sampleRate))
+	chunk := make([]float64, 1500)
+	for i := range chunk {
+		chunk[i] = 1
+	}
+	second := session.Push(chunk)
+	if len(first) != 1 || len(second) != 1 || second[0].Start != 1.5 {
+		t.Fatalf("expected one window per push, the second from 1.5 s, got %d and %d", len(first), len(second))
+	}
+	if second[0].Samples[0] != 0 || second[0].Samples[len(second[0].Samples)-1] != 1 {
+		t.Fatal("expected the second window to start with the carried-over samples")
+	}
+
+	var onsets []int
+	for i, isDrone := range []bool{false, true, true, false, true} {
+		if session.Observe(isDrone) {
+			onsets = append(onsets, i)
+		}
+	}
+	if len(onsets) != 2 || onsets[0] != 1 || onsets[1] != 4 {
+		t.Fatalf("expected detections to start at windows 1 and 4, got %v", onsets)
+	}
+}
@@ -0,0 +1,63 @@
+package drone
+
+import (
+	"path/filepath"
+	"testing"
+
+	"song-recognition/wav"
+)
+
+func TestSyntheticDatasetTrainsRecoverableDroneClass(t *testing.T) {
+	t.Cleanup(wav.SetRunner(copyRunner{}))
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	classes := map[string]SynthSpec{
+		"quad":  {FundamentalHz: 180, Jitter: 0.03, NoiseLevel: 0.05, Count: 6},
+		"noise": {NoiseLevel: 0.3, Count: 6},
+	}
+	trainDir := t.TempDir()
+	if err := GenerateSyntheticDataset(trainDir, classes); err != nil {
+		t.Fatalf("GenerateSyntheticDataset returned error: %v", err)
+	}
+	for class, spec := range classes {
+		spec.Seed = 1
+		classes[class] = spec
+	}
+	testDir := t.TempDir()
+	if err := GenerateSyntheticDataset(testDir, classes); err != nil {
+		t.Fatalf("GenerateSyntheticDataset returned error: %v", err)
+	}
+
+	var protos []Prototype
+	for class := range classes {
+		files, err := evaluationAudioFiles(filepath.Join(trainDir, class))
+		if err != nil || len(files) != 6 {
+			t.Fatalf("expected 6 %s recordings, got %d (%v)", class, len(files), err)
+		}
+		category := "drone"
+		if class == "noise" {
+			category = "noise"
+		}
+		for _, file := range files {
+			proto, err := BuildPrototypeFromPath(file, class, category, "", filepath.Base(file), nil)
+			if err != nil {
+				t.Fatalf("BuildPrototypeFromPath returned error: %v", err)
+			}
+			protos = append(protos, proto)
+		}
+	}
+	classifier := newTestClassifier(protos, 3)
+
+	report, err := RunEvaluation(classifier, testDir, 3)
+	if err != nil {
+		t.Fatalf("RunEvaluation returned error: %v", err)
+	}
+	for _, metrics := range report.ClassMetrics {
+		if metrics.ClassName == "quad" && (metrics.TotalSamples != 6 || metrics.Accuracy < 95) {
+			t.Fatalf("expected the drone class to be recovered, got %+v", metrics)
+		}
+	}
+	if report.OverallAccuracy < 90 {
+		t.Fatalf("expected high overall accuracy, got %.1f%% (%v)", report.OverallAccuracy, report.ConfusionMatrix)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 )
 
 // Template captures a single reference embedding derived from a labelled audio sample.
@@ -17,7 +18,9 @@ type Template struct {
 }
 
 // TemplateMatcher performs cosine-similarity lookups against a small template bank.
+// It is safe for concurrent use; the zero value matches nothing until ReloadFromFile.
 type TemplateMatcher struct {
+	mu        sync.RWMutex
 	templates []Template
 	threshold float64
 }
@@ -27,11 +30,41 @@ func (tm *TemplateMatcher) TemplateCount() int {
 	if tm == nil {
 		return 0
 	}
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
 	return len(tm.templates)
 }
 
 // NewTemplateMatcherFromFile loads template embeddings from disk.
 func NewTemplateMatcherFromFile(path string, threshold float64) (*TemplateMatcher, error) {
+	templates, err := loadTemplates(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateMatcher{
+		templates: templates,
+		threshold: clamp01(threshold),
+	}, nil
+}
+
+// ReloadFromFile replaces the template bank and threshold with those loaded from path.
+// The swap happens under the write lock once the file has been parsed, so in-flight
+// predictions see either the old or the new set; on error the current set is kept.
+func (tm *TemplateMatcher) ReloadFromFile(path string, threshold float64) error {
+	templates, err := loadTemplates(path)
+	if err != nil {
+		return err
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.templates = templates
+	tm.threshold = clamp01(threshold)
+	return nil
+}
+
+func loadTemplates(path string) ([]Template, error) {
 	data, err := os.ReadFile(filepath.Clean(path))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read template file: %w", err)
@@ -46,30 +79,53 @@ func NewTemplateMatcherFromFile(path string, threshold float64) (*TemplateMatche
 		return nil, fmt.Errorf("template file %s contained no entries", path)
 	}
 
+	dimension := len(templates[0].Features)
 	for idx := range templates {
-		if len(templates[idx].Features) != len(featureWeights) {
+		if len(templates[idx].Features) == 0 || len(templates[idx].Features) != dimension {
 			return nil, fmt.Errorf("template %s has %d features, expected %d",
-				templates[idx].Label, len(templates[idx].Features), len(featureWeights))
+				templates[idx].Label, len(templates[idx].Features), dimension)
 		}
 		NormaliseVectorInPlace(templates[idx].Features)
 	}
 
-	return &TemplateMatcher{
-		templates: templates,
-		threshold: clamp01(threshold),
-	}, nil
+	return templates, nil
+}
+
+// Dimension reports the feature length templates were built with, or 0 for no templates.
+func (tm *TemplateMatcher) Dimension() int {
+	if tm == nil {
+		return 0
+	}
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.dimension()
+}
+
+func (tm *TemplateMatcher) dimension() int {
+	if len(tm.templates) == 0 {
+		return 0
+	}
+	return len(tm.templates[0].Features)
 }
 
 // Predict emits ranked predictions based on cosine similarity between
-// the analysed feature vector and each stored template.
+// the analysed feature vector and each stored template. Features from a different
+// extractor (e.g. legacy features against PANNS templates) are not comparable and
+// produce no predictions. Pass the classifier's PreparedQuery for the recording so
+// templates and prototypes are matched against the same vector.
 func (tm *TemplateMatcher) Predict(features []float64) []Prediction {
 	if tm == nil || len(features) == 0 {
 		return nil
 	}
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if len(features) != tm.dimension() {
+		return nil
+	}
 
 	results := make([]Prediction, 0, len(tm.templates))
 	for _, tpl := range tm.templates {
-		similarity := cosineSimilarity(features, tpl.Features, featureWeights)
+		similarity := cosineSimilarity(features, tpl.Features, nil)
 		confidence := similarityToConfidence(similarity)
 		if tm.threshold > 0 && confidence < tm.threshold {
 			continue
@@ -97,7 +153,8 @@ func (tm *TemplateMatcher) Predict(features []float64) []Prediction {
 }
 
 // MergePredictions merges template predictions into the canonical list,
-// keeping the higher-confidence entry when labels overlap.
+// keeping the higher-confidence entry when labels overlap. A template entry that replaces
+// a k-NN one keeps its rank score.
 func MergePredictions(base []Prediction, additions []Prediction) []Prediction {
 	if len(additions) == 0 {
 		return base
@@ -112,6 +169,7 @@ func MergePredictions(base []Prediction, additions []Prediction) []Prediction {
 		key := strings.ToLower(pred.Label)
 		if existing, ok := index[key]; ok {
 			if pred.Confidence > existing.Confidence {
+				pred.RankScore = existing.RankScore
 				index[key] = pred
 			}
 		} else {
@@ -124,16 +182,23 @@ func MergePredictions(base []Prediction, additions []Prediction) []Prediction {
 		merged = append(merged, pred)
 	}
 
-	sort.Slice(merged, func(i, j int) bool {
-		if merged[i].Confidence != merged[j].Confidence {
-			return merged[i].Confidence > merged[j].Confidence
-		}
-		return merged[i].AverageDist < merged[j].AverageDist
-	})
+	sortPredictions(merged)
 
 	return merged
 }
 
+// CombineTemplatePredictions folds whole-file template predictions into the classifier
+// predictions when both describe the same audio span. Sliding-window predictions are
+// aggregated over windows, so whole-file template scores are not comparable with them;
+// in that case the classifier predictions are returned unchanged and merged is false,
+// leaving the template predictions to be reported separately.
+func CombineTemplatePredictions(predictions []Prediction, windowed bool, templatePredictions []Prediction) (combined []Prediction, merged bool) {
+	if windowed || len(templatePredictions) == 0 {
+		return predictions, false
+	}
+	return MergePredictions(predictions, templatePredictions), true
+}
+
 // BuildTemplatesFromDir ingests every WAV file in the dir and emits template embeddings.
 func BuildTemplatesFromDir(dir string) ([]Template, error) {
 	entries, err := os.ReadDir(dir)
@@ -0,0 +1,176 @@
+package drone
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCombineTemplatePredictionsKeepsScopesApart(t *testing.T) {
+	t.Parallel()
+
+	matcher := &TemplateMatcher{templates: []Template{
+		{Label: "alpha", Source: "alpha.wav", Features: featureVector(map[int]float64{0: 1.0})},
+		{Label: "gamma", Source: "gamma.wav", Features: featureVector(map[int]float64{20: 1.0})},
+	}}
+
+	// Legacy window features are not comparable with whole-file PANNS templates
+	if preds := matcher.Predict(make([]float64, baseFeatureCount)); preds != nil {
+		t.Fatalf("expected no template predictions for %d-dim features, got %v", baseFeatureCount, preds)
+	}
+
+	templatePreds := matcher.Predict(featureVector(map[int]float64{0: 1.0}))
+	if len(templatePreds) != 2 || templatePreds[0].Label != "alpha" {
+		t.Fatalf("expected alpha as the best template match, got %v", templatePreds)
+	}
+
+	knn := []Prediction{
+		{Label: "alpha", Category: "drone", Confidence: 0.6, Support: 3},
+		{Label: "beta", Category: "drone", Confidence: 0.4, Support: 2},
+	}
+
+	windowed, merged := CombineTemplatePredictions(knn, true, templatePreds)
+	if merged {
+		t.Fatalf("expected whole-file templates to stay separate from window predictions")
+	}
+	if len(windowed) != len(knn) || windowed[0].Confidence != knn[0].Confidence || windowed[0].Category != "drone" {
+		t.Fatalf("expected window predictions unchanged, got %v", windowed)
+	}
+
+	combined, merged := CombineTemplatePredictions(knn, false, templatePreds)
+	if !merged {
+		t.Fatalf("expected whole-file predictions to absorb template matches")
+	}
+	seen := make(map[string]int)
+	for _, pred := range combined {
+		seen[strings.ToLower(pred.Label)]++
+	}
+	for label, count := range seen {
+		if count != 1 {
+			t.Fatalf("expected %s once in combined predictions, got %d", label, count)
+		}
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected alpha, beta and gamma in combined predictions, got %v", combined)
+	}
+	if combined[0].Label != "alpha" || combined[0].Category != "template" || combined[0].Support != 1 {
+		t.Fatalf("expected the stronger template match to replace alpha without summing support, got %+v", combined[0])
+	}
+}
+
+func TestTemplateMatcherReloadWhilePredicting(t *testing.T) {
+	dir := t.TempDir()
+	alphaPath := filepath.Join(dir, "alpha.json")
+	betaPath := filepath.Join(dir, "beta.json")
+	if err := SaveTemplates(alphaPath, []Template{{Label: "alpha", Source: "a.wav", Features: featureVector(map[int]float64{0: 1.0})}}); err != nil {
+		t.Fatalf("failed to save templates: %v", err)
+	}
+	if err := SaveTemplates(betaPath, []Template{
+		{Label: "beta", Source: "b.wav", Features: featureVector(map[int]float64{0: 1.0})},
+		{Label: "gamma", Source: "g.wav", Features: featureVector(map[int]float64{20: 1.0})},
+	}); err != nil {
+		t.Fatalf("failed to save templates: %v", err)
+	}
+
+	matcher, err := NewTemplateMatcherFromFile(alphaPath, 0)
+	if err != nil {
+		t.Fatalf("NewTemplateMatcherFromFile failed: %v", err)
+	}
+
+	query := featureVector(map[int]float64{0: 1.0})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				preds := matcher.Predict(query)
+				// Each prediction must come from one complete template set
+				if len(preds) == 0 || (preds[0].Label == "alpha") != (len(preds) == 1) {
+					t.Errorf("prediction mixed template sets: %v", preds)
+					return
+				}
+				_ = matcher.TemplateCount()
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		path := alphaPath
+		if i%2 == 0 {
+			path = betaPath
+		}
+		if err := matcher.ReloadFromFile(path, 0); err != nil {
+			t.Fatalf("ReloadFromFile failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if err := matcher.ReloadFromFile(filepath.Join(dir, "missing.json"), 0.9); err == nil {
+		t.Fatalf("expected an error reloading a missing file")
+	}
+	if matcher.TemplateCount() != 1 || matcher.Predict(query)[0].Label != "alpha" {
+		t.Fatalf("expected a failed reload to keep the previous templates")
+	}
+}
+
+func TestTemplatesAndClassifierShareThePreparedQuery(t *testing.T) {
+	t.Parallel()
+
+	// Legacy-sized vectors so the model applies its feature scaler
+	raw := map[string][]float64{
+		"alpha": {0.9, 0.1, 40, 0.2, 3},
+		"beta":  {0.1, 0.8, 10, 0.7, 1},
+		"gamma": {0.5, 0.5, 25, 0.1, 9},
+	}
+	var protos []Prototype
+	for _, label := range []string{"alpha", "beta", "gamma"} {
+		protos = append(protos, Prototype{ID: label + "_1", Label: label, Category: "drone", Features: raw[label]})
+	}
+	scaler, err := NewFeatureScalerFromPrototypes(protos)
+	if err != nil {
+		t.Fatalf("NewFeatureScalerFromPrototypes failed: %v", err)
+	}
+	matcher := &TemplateMatcher{}
+	for idx := range protos {
+		protos[idx].Features = scaler.TransformAndNormalize(protos[idx].Features)
+		matcher.templates = append(matcher.templates, Template{Label: protos[idx].Label, Features: protos[idx].Features})
+	}
+	classifier := newTestClassifier(protos, 1)
+	classifier.featureScaler = scaler
+
+	features := append([]float64(nil), raw["alpha"]...)
+	query := classifier.PrepareQuery(features)
+	if !slices.Equal(features, raw["alpha"]) {
+		t.Fatalf("PrepareQuery must not modify the caller's features")
+	}
+
+	predictions, err := classifier.PredictPrepared(query)
+	if err != nil {
+		t.Fatalf("PredictPrepared failed: %v", err)
+	}
+	templatePreds := matcher.Predict(query)
+	if predictions[0].Label != "alpha" || templatePreds[0].Label != "alpha" {
+		t.Fatalf("expected both to match alpha, got %s and %s", predictions[0].Label, templatePreds[0].Label)
+	}
+	// Both compare the identical vector, so the alpha prototype and template are exact matches
+	if d := predictions[0].TopPrototypes[0].Distance; d > 1e-9 {
+		t.Fatalf("expected the prepared query to coincide with the alpha prototype, distance %g", d)
+	}
+	if d := templatePreds[0].AverageDist; d > 1e-9 {
+		t.Fatalf("expected the prepared query to coincide with the alpha template, distance %g", d)
+	}
+
+	// The unprepared vector lives in a different space from the templates
+	if d := matcher.Predict(features)[0].AverageDist; d < 1e-3 {
+		t.Fatalf("expected raw features to differ from the scaled templates, distance %g", d)
+	}
+	viaPredict, err := classifier.Predict(features)
+	if err != nil {
+		t.Fatalf("Predict failed: %v", err)
+	}
+	if viaPredict[0].Label != predictions[0].Label || viaPredict[0].Confidence != predictions[0].Confidence {
+		t.Fatalf("expected Predict to prepare the query the same way, got %+v vs %+v", viaPredict[0], predictions[0])
+	}
+}
@@ -0,0 +1,161 @@
+package drone
+
+// Data-Driven Confidence Threshold
+//
+// The 0.55 default threshold is hand-picked. SuggestThreshold derives one from the model
+// itself: every noise-category prototype is classified against the rest of the model
+// (leave-one-out). A noise prototype whose top prediction is a non-noise label with
+// confidence c would raise a false alarm at any threshold <= c, so the suggested threshold
+// is the lowest value that keeps the fraction of such alarms at or below the target rate.
+//
+// LearnPerLabelThresholds applies the same rule to each drone label separately, counting
+// only the noise prototypes that alarm as that label. A label whose recordings overlap
+// the noise gets a higher threshold than one the model separates cleanly. The thresholds
+// are stored in the label's metadata, so they are saved with the model and raise the
+// threshold DetermineDroneLikelyWithSNR applies to that label via Prediction.Metadata.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minSuggestedThreshold matches the lower clamp applied by AdaptiveThreshold.
+const minSuggestedThreshold = 0.5
+
+// LabelThresholdMetadataKey holds a label's learned confidence threshold in its metadata.
+const LabelThresholdMetadataKey = "confidence_threshold"
+
+// ErrNoNoisePrototypes is returned by SuggestThreshold when the model has no noise samples.
+var ErrNoNoisePrototypes = errors.New("model has no noise-category prototypes")
+
+// SuggestThreshold returns the lowest confidence threshold whose leave-one-out false-positive
+// rate over the noise-category prototypes does not exceed targetFPR.
+func (c *Classifier) SuggestThreshold(targetFPR float64) (float64, error) {
+	if targetFPR < 0 || targetFPR >= 1 {
+		return 0, fmt.Errorf("target false-positive rate must be in [0, 1), got %v", targetFPR)
+	}
+
+	k, prototypes, labelCategory, labelMetadata, _ := c.snapshot()
+	measure := c.distanceMeasure()
+	c.mu.RLock()
+	halfLife := c.halfLife
+	mapping := c.confidence
+	c.mu.RUnlock()
+
+	// alarmScores holds, per noise prototype, the confidence at which it would be reported
+	// as a drone; noise prototypes that match noise never alarm and score 0.
+	var alarmScores []float64
+	for idx, proto := range prototypes {
+		if !strings.EqualFold(proto.Category, "noise") {
+			continue
+		}
+		predictions := predictNeighbours(proto.Features, prototypes, idx, k, halfLife, measure, mapping, labelCategory, labelMetadata)
+		score := 0.0
+		if len(predictions) > 0 && !strings.EqualFold(predictions[0].Category, "noise") {
+			score = predictions[0].Confidence
+		}
+		alarmScores = append(alarmScores, score)
+	}
+	if len(alarmScores) == 0 {
+		return 0, ErrNoNoisePrototypes
+	}
+
+	return thresholdForFPR(alarmScores, targetFPR), nil
+}
+
+// LearnPerLabelThresholds derives a leave-one-out threshold for every drone label that
+// keeps the fraction of noise prototypes alarming as that label at or below targetFPR,
+// and records it under LabelThresholdMetadataKey on the label's prototypes. It returns
+// nil when targetFPR is out of range or the model has no noise-category prototypes.
+func (c *Classifier) LearnPerLabelThresholds(targetFPR float64) map[string]float64 {
+	if targetFPR < 0 || targetFPR >= 1 {
+		return nil
+	}
+
+	k, prototypes, labelCategory, labelMetadata, _ := c.snapshot()
+	measure := c.distanceMeasure()
+	c.mu.RLock()
+	halfLife := c.halfLife
+	mapping := c.confidence
+	c.mu.RUnlock()
+
+	// Every noise prototype contributes one score per label: the confidence at which it
+	// would alarm as that label, or 0 when its top prediction is another label.
+	noiseCount := 0
+	alarmsByLabel := make(map[string][]float64)
+	for idx, proto := range prototypes {
+		if !strings.EqualFold(proto.Category, "noise") {
+			continue
+		}
+		noiseCount++
+		predictions := predictNeighbours(proto.Features, prototypes, idx, k, halfLife, measure, mapping, labelCategory, labelMetadata)
+		if len(predictions) > 0 && !strings.EqualFold(predictions[0].Category, "noise") {
+			alarmsByLabel[predictions[0].Label] = append(alarmsByLabel[predictions[0].Label], predictions[0].Confidence)
+		}
+	}
+	if noiseCount == 0 {
+		return nil
+	}
+
+	thresholds := make(map[string]float64)
+	for label, category := range labelCategory {
+		if strings.EqualFold(category, "noise") {
+			continue
+		}
+		scores := make([]float64, noiseCount)
+		copy(scores, alarmsByLabel[label])
+		thresholds[label] = thresholdForFPR(scores, targetFPR)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for label, threshold := range thresholds {
+		value := strconv.FormatFloat(threshold, 'f', -1, 64)
+		if c.labelMetadata[label] == nil {
+			c.labelMetadata[label] = map[string]string{}
+		}
+		c.labelMetadata[label][LabelThresholdMetadataKey] = value
+		for idx := range c.prototypes {
+			if c.prototypes[idx].Label != label {
+				continue
+			}
+			if c.prototypes[idx].Metadata == nil {
+				c.prototypes[idx].Metadata = map[string]string{}
+			}
+			c.prototypes[idx].Metadata[LabelThresholdMetadataKey] = value
+		}
+	}
+
+	return thresholds
+}
+
+// learnedThreshold returns the threshold LearnPerLabelThresholds stored for a prediction.
+func learnedThreshold(prediction Prediction) (float64, bool) {
+	value, ok := prediction.Metadata[LabelThresholdMetadataKey]
+	if !ok {
+		return 0, false
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 || threshold >= 1 {
+		return 0, false
+	}
+	return threshold, true
+}
+
+// thresholdForFPR returns the lowest threshold at which at most targetFPR of the alarm
+// scores (0 for samples that never alarm) reach it.
+func thresholdForFPR(alarmScores []float64, targetFPR float64) float64 {
+	sort.Sort(sort.Reverse(sort.Float64Slice(alarmScores)))
+	allowed := int(math.Floor(targetFPR * float64(len(alarmScores))))
+	if allowed >= len(alarmScores) {
+		return minSuggestedThreshold
+	}
+
+	// Sit just above the first score that must not alarm
+	threshold := math.Nextafter(alarmScores[allowed], math.Inf(1))
+	return math.Max(threshold, minSuggestedThreshold)
+}
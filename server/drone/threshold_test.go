@@ -0,0 +1,126 @@
+package drone
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSuggestThresholdMeetsTargetFalsePositiveRate(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(42))
+	var protos []Prototype
+	for i := 0; i < 10; i++ {
+		protos = append(protos, newSyntheticPrototype("quad", fmt.Sprintf("quad_%d", i),
+			map[int]float64{0: 1.0, 2 + i: 0.2 * rng.Float64()}))
+	}
+	// Noise recordings range from clean background to ones that resemble the drone
+	for i := 0; i < 20; i++ {
+		blend := float64(i) / 19
+		noise := newSyntheticPrototype("wind", fmt.Sprintf("wind_%d", i),
+			map[int]float64{0: blend, 1: 1 - blend, 40 + i: 0.2 * rng.Float64()})
+		noise.Category = "noise"
+		protos = append(protos, noise)
+	}
+
+	const k = 3
+	classifier := newTestClassifier(protos, k)
+
+	for _, target := range []float64{0.1, 0.25} {
+		threshold, err := classifier.SuggestThreshold(target)
+		if err != nil {
+			t.Fatalf("SuggestThreshold(%.2f) returned error: %v", target, err)
+		}
+
+		// Measure the false-positive rate independently, holding each noise sample out
+		var noiseCount, alarms int
+		for idx, proto := range protos {
+			if proto.Category != "noise" {
+				continue
+			}
+			noiseCount++
+			rest := append(append([]Prototype{}, protos[:idx]...), protos[idx+1:]...)
+			predictions, err := newTestClassifier(rest, k).Predict(proto.Features)
+			if err != nil {
+				t.Fatalf("Predict returned error: %v", err)
+			}
+			if DetermineDroneLikely(predictions, threshold) {
+				alarms++
+			}
+		}
+
+		fpr := float64(alarms) / float64(noiseCount)
+		if fpr > target {
+			t.Fatalf("threshold %.3f gives FPR %.2f above target %.2f", threshold, fpr, target)
+		}
+		if fpr < target-0.1 {
+			t.Fatalf("threshold %.3f gives FPR %.2f, far below target %.2f", threshold, fpr, target)
+		}
+	}
+}
+
+func TestSuggestThresholdRequiresNoisePrototypes(t *testing.T) {
+	t.Parallel()
+
+	classifier := newTestClassifier([]Prototype{
+		newSyntheticPrototype("quad", "quad_1", map[int]float64{0: 1.0}),
+	}, 1)
+	if _, err := classifier.SuggestThreshold(0.05); !errors.Is(err, ErrNoNoisePrototypes) {
+		t.Fatalf("expected ErrNoNoisePrototypes, got %v", err)
+	}
+}
+
+func TestLearnPerLabelThresholdsRaisesNoisyClass(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(7))
+	var protos []Prototype
+	for i := 0; i < 10; i++ {
+		// "hex" sits well away from the noise; "quad" recordings are spread towards it
+		protos = append(protos, newSyntheticPrototype("hex", fmt.Sprintf("hex_%d", i),
+			map[int]float64{10: 1.0, 20 + i: 0.1 * rng.Float64()}))
+		blend := 0.3 + 0.6*float64(i)/9
+		protos = append(protos, newSyntheticPrototype("quad", fmt.Sprintf("quad_%d", i),
+			map[int]float64{0: blend, 1: 1 - blend, 30 + i: 0.2 * rng.Float64()}))
+	}
+	for i := 0; i < 20; i++ {
+		blend := 0.6 * float64(i) / 19
+		noise := newSyntheticPrototype("wind", fmt.Sprintf("wind_%d", i),
+			map[int]float64{0: blend, 1: 1 - blend, 40 + i: 0.2 * rng.Float64()})
+		noise.Category = "noise"
+		protos = append(protos, noise)
+	}
+	classifier := newTestClassifier(protos, 3)
+
+	thresholds := classifier.LearnPerLabelThresholds(0.05)
+	if _, ok := thresholds["wind"]; ok {
+		t.Fatalf("expected no threshold for the noise label, got %v", thresholds)
+	}
+	if thresholds["quad"] <= thresholds["hex"] {
+		t.Fatalf("expected the noisy class to get the higher threshold, got %v", thresholds)
+	}
+
+	// The thresholds are saved on the prototypes and apply to their predictions
+	_, snapshot, _, _, _ := classifier.snapshot()
+	for _, proto := range snapshot {
+		if proto.Label == "quad" && proto.Metadata[LabelThresholdMetadataKey] == "" {
+			t.Fatalf("expected %s to carry the learned threshold, got %v", proto.ID, proto.Metadata)
+		}
+	}
+	predictions, err := classifier.Predict(protos[1].Features)
+	if err != nil {
+		t.Fatalf("Predict returned error: %v", err)
+	}
+	if predictions[0].Label != "quad" {
+		t.Fatalf("expected quad to be predicted, got %s", predictions[0].Label)
+	}
+	if learned, ok := learnedThreshold(predictions[0]); !ok || learned != thresholds["quad"] {
+		t.Fatalf("expected the prediction to carry threshold %.3f, got %.3f", thresholds["quad"], learned)
+	}
+	predictions[0].Confidence = thresholds["quad"] - 0.01
+	if DetermineDroneLikelyWithSNR(predictions[:1], 0.5, 0, 1) {
+		t.Fatal("expected the learned threshold to reject a confidence below it")
+	}
+}
@@ -0,0 +1,44 @@
+package drone
+
+// Two-Stage Detection
+//
+// In two-stage mode a cheap screen decides whether a clip could be a drone at all
+// before the full classifier runs. Stage one is a single whole-clip prediction reduced
+// to its drone share (see CategoryConfidences); a clip below the minimum drone
+// confidence is reported as screened and stage two never runs. Stage two is whatever
+// fine-grained pipeline the caller passes in: sliding windows, template matching and so
+// on. Most of what a microphone hears is noise, so the expensive stages run for the few
+// clips that deserve them, and noise the later stages might mistake for a drone never
+// reaches them.
+
+// TwoStageResult is the outcome of DetectTwoStage.
+type TwoStageResult struct {
+	Predictions             []Prediction
+	StageOneDroneConfidence float64 // drone share of the stage-one predictions
+	Screened                bool    // stage one ruled out a drone, so Predictions are stage one's
+}
+
+// DetectTwoStage predicts query in a single pass and, only when the drone share of
+// that prediction reaches minDroneConfidence, calls stageTwo with it for the full
+// classification. stageTwo may return the stage-one predictions unchanged when it has
+// nothing finer to offer.
+func (c *Classifier) DetectTwoStage(query PreparedQuery, minDroneConfidence float64, stageTwo func(stageOne []Prediction) ([]Prediction, error)) (TwoStageResult, error) {
+	stageOne, err := c.PredictPrepared(query)
+	if err != nil {
+		return TwoStageResult{}, err
+	}
+
+	droneConfidence, _ := CategoryConfidences(stageOne)
+	result := TwoStageResult{Predictions: stageOne, StageOneDroneConfidence: droneConfidence}
+	if droneConfidence < minDroneConfidence {
+		result.Screened = true
+		return result, nil
+	}
+
+	predictions, err := stageTwo(stageOne)
+	if err != nil {
+		return result, err
+	}
+	result.Predictions = predictions
+	return result, nil
+}
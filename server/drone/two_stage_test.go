@@ -0,0 +1,46 @@
+package drone
+
+import "testing"
+
+func TestTwoStageShortCircuitsNoiseAtStageOne(t *testing.T) {
+	t.Parallel()
+
+	wind := newSyntheticPrototype("wind", "wind_1", map[int]float64{10: 1})
+	wind.Category = "noise"
+	traffic := newSyntheticPrototype("traffic", "traffic_1", map[int]float64{10: 1, 11: 0.2})
+	traffic.Category = "noise"
+	classifier := newTestClassifier([]Prototype{
+		wind,
+		traffic,
+		newSyntheticPrototype("quad", "quad_1", map[int]float64{500: 1}),
+		newSyntheticPrototype("quad", "quad_2", map[int]float64{500: 1, 501: 0.2}),
+	}, 2)
+
+	stageTwoCalls := 0
+	stageTwo := func(stageOne []Prediction) ([]Prediction, error) {
+		stageTwoCalls++
+		return stageOne, nil
+	}
+
+	noise, err := classifier.DetectTwoStage(classifier.PrepareQuery(featureVector(map[int]float64{10: 1, 11: 0.1})), 0.3, stageTwo)
+	if err != nil {
+		t.Fatalf("DetectTwoStage returned error for noise: %v", err)
+	}
+	if !noise.Screened || stageTwoCalls != 0 {
+		t.Fatalf("expected noise to be screened at stage one, screened=%v with %d stage-two calls", noise.Screened, stageTwoCalls)
+	}
+	if len(noise.Predictions) == 0 || noise.Predictions[0].Category != "noise" {
+		t.Fatalf("expected the stage-one noise predictions to be returned, got %+v", noise.Predictions)
+	}
+
+	quad, err := classifier.DetectTwoStage(classifier.PrepareQuery(featureVector(map[int]float64{500: 1, 501: 0.1})), 0.3, stageTwo)
+	if err != nil {
+		t.Fatalf("DetectTwoStage returned error for a drone: %v", err)
+	}
+	if quad.Screened || stageTwoCalls != 1 {
+		t.Fatalf("expected a drone to proceed to stage two, screened=%v with %d stage-two calls", quad.Screened, stageTwoCalls)
+	}
+	if quad.StageOneDroneConfidence < 0.3 || quad.Predictions[0].Label != "quad" {
+		t.Fatalf("expected stage two to confirm quad, got %+v (stage-one drone confidence %.2f)", quad.Predictions, quad.StageOneDroneConfidence)
+	}
+}
@@ -0,0 +1,24 @@
+package drone
+
+// WindowFeatureExtractor extracts the legacy feature vector from a run of analysis
+// windows. Sliding-window analysis cuts a clip into many windows of the same length,
+// and extracting each with ExtractFeatureVectorWithConfig allocates a fresh FFT input,
+// Hann window, magnitude spectrum and frequency table per window. The extractor keeps
+// them between calls and only replaces them when the window length (and so the FFT
+// size) changes, such as for a shorter final window.
+type WindowFeatureExtractor struct {
+	config  FeatureConfig
+	buffers spectrumBuffers
+}
+
+// NewWindowFeatureExtractor returns an extractor for config. It is not safe for
+// concurrent use; give each goroutine its own.
+func NewWindowFeatureExtractor(config FeatureConfig) *WindowFeatureExtractor {
+	return &WindowFeatureExtractor{config: config}
+}
+
+// Extract returns the same features as ExtractFeatureVectorWithConfig for samples.
+// The returned vector is newly allocated and may be kept.
+func (e *WindowFeatureExtractor) Extract(samples []float64, sampleRate int) ([]float64, error) {
+	return extractFeatureVector(samples, nil, sampleRate, e.config, &e.buffers)
+}
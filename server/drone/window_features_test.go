@@ -0,0 +1,91 @@
+package drone
+
+import (
+	"math/cmplx"
+	"reflect"
+	"testing"
+
+	"song-recognition/shazam"
+)
+
+func TestFFTPlanMatchesShazamFFT(t *testing.T) {
+	t.Parallel()
+
+	input := slidingWindowTestClip(8000, 1)[:1024]
+	want := shazam.FFT(input)
+	got := make([]complex128, len(input))
+	for i, sample := range input {
+		got[i] = complex(sample, 0)
+	}
+	newFFTPlan(len(input)).transform(got)
+	for i := range want {
+		if cmplx.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("bin %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWindowFeatureExtractorMatchesPerWindowExtraction(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 8000
+	samples := slidingWindowTestClip(sampleRate, 10)
+	const windowSize, hop = 3 * sampleRate, sampleRate
+
+	for _, config := range []FeatureConfig{
+		{RolloffPercentile: 0.85, OnsetRateCap: defaultOnsetRateCap},
+		{RolloffPercentile: 0.85, OnsetRateCap: defaultOnsetRateCap, FFTSize: 2048, EnableWhitening: true},
+	} {
+		extractor := NewWindowFeatureExtractor(config)
+		var previous []float64
+		// The last window is shorter, so the buffers are resized once along the way
+		for start := 0; start < len(samples)-hop; start += hop {
+			window := samples[start:min(start+windowSize, len(samples))]
+			want, err := ExtractFeatureVectorWithConfig(window, sampleRate, config)
+			if err != nil {
+				t.Fatalf("ExtractFeatureVectorWithConfig returned error: %v", err)
+			}
+			got, err := extractor.Extract(window, sampleRate)
+			if err != nil {
+				t.Fatalf("Extract returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("FFT size %d, window at %d: reused buffers changed the features:\ngot  %v\nwant %v", config.FFTSize, start, got, want)
+			}
+			if previous != nil && &previous[0] == &got[0] {
+				t.Fatal("expected every window to get its own feature vector")
+			}
+			previous = got
+		}
+	}
+}
+
+// BenchmarkWindowFeatureExtraction reports allocations per 3 s window at 16 kHz.
+func BenchmarkWindowFeatureExtraction(b *testing.B) {
+	const sampleRate = 16000
+	samples := slidingWindowTestClip(sampleRate, 30)
+	config := DefaultFeatureConfig()
+	const windowSize, hop = 3 * sampleRate, sampleRate * 3 / 2
+	var windows [][]float64
+	for start := 0; start+windowSize <= len(samples); start += hop {
+		windows = append(windows, samples[start:start+windowSize])
+	}
+
+	b.Run("fresh-buffers", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ExtractFeatureVectorWithConfig(windows[i%len(windows)], sampleRate, config); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reused-buffers", func(b *testing.B) {
+		b.ReportAllocs()
+		extractor := NewWindowFeatureExtractor(config)
+		for i := 0; i < b.N; i++ {
+			if _, err := extractor.Extract(windows[i%len(windows)], sampleRate); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package drone
+
+// Sliding-Window Prediction Cache
+//
+// PredictWithSlidingWindows used to call Predict once per window, and every call took a
+// fresh deep copy of the model (prototypes and metadata), re-read the feature
+// configuration and logged the scaling step. A windowPredictor takes the snapshot once
+// per clip and reuses it for every window. It also remembers the predictions for each
+// scaled query vector, so windows with identical content (digital silence, looped test
+// tones) skip the distance scan entirely. Results are identical to calling Predict per
+// window.
+//
+// Incremental feature extraction across overlapping windows is not attempted: the
+// spectral features come from a single FFT over the whole window, which cannot be
+// updated from the overlapping part. PANNS embeddings never take this path.
+//
+// Measured with BenchmarkSlidingWindows (500 prototypes, 30 s clip at 16 kHz, 3 s
+// windows, 1.5 s hop): about 713 ms per clip against 753 ms for per-window Predict, and
+// slightly fewer allocations. The gain is small because the FFT in computeSpectrum takes
+// roughly 80% of the time; the snapshot and distance scan are a minor share at this
+// model size and grow with the prototype count.
+
+import (
+	"hash/fnv"
+	"math"
+	"slices"
+	"time"
+)
+
+type cachedWindow struct {
+	features    []float64
+	predictions []Prediction
+}
+
+type windowPredictor struct {
+	scaler        *FeatureScaler
+	k             int
+	halfLife      time.Duration
+	measure       distanceMeasure
+	mapping       confidenceMapping
+	maxAccept     float64
+	prototypes    []Prototype
+	labelCategory map[string]string
+	labelMetadata map[string]map[string]string
+	cache         map[uint64][]cachedWindow
+	hits          int
+}
+
+// newWindowPredictor snapshots the classifier for the windows of one clip.
+func (c *Classifier) newWindowPredictor() (*windowPredictor, error) {
+	c.mu.RLock()
+	scaler := c.featureScaler
+	halfLife := c.halfLife
+	mapping := c.confidence
+	maxAccept := c.maxAccept
+	c.mu.RUnlock()
+
+	k, prototypes, labelCategory, labelMetadata, _ := c.snapshot()
+	if len(prototypes) == 0 {
+		return nil, ErrEmptyModel
+	}
+
+	return &windowPredictor{
+		scaler:        scaler,
+		k:             k,
+		halfLife:      halfLife,
+		measure:       c.distanceMeasure(),
+		mapping:       mapping,
+		maxAccept:     maxAccept,
+		prototypes:    prototypes,
+		labelCategory: labelCategory,
+		labelMetadata: labelMetadata,
+		cache:         make(map[uint64][]cachedWindow),
+	}, nil
+}
+
+// predict matches Classifier.Predict for one window's unscaled features. The returned
+// slice may be shared with other windows and must not be modified.
+func (p *windowPredictor) predict(features []float64) []Prediction {
+	features = prepareFeatures(p.scaler, features)
+
+	key := hashFeatures(features)
+	for _, cached := range p.cache[key] {
+		if slices.Equal(cached.features, features) {
+			p.hits++
+			return cached.predictions
+		}
+	}
+
+	predictions := predictNeighbours(features, p.prototypes, -1, p.k, p.halfLife, p.measure, p.mapping, p.labelCategory, p.labelMetadata)
+	predictions = rejectOutOfDistribution(predictions, p.maxAccept)
+	p.cache[key] = append(p.cache[key], cachedWindow{features: features, predictions: predictions})
+	return predictions
+}
+
+func hashFeatures(features []float64) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, value := range features {
+		bits := math.Float64bits(value)
+		for i := range buf {
+			buf[i] = byte(bits >> (8 * i))
+		}
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
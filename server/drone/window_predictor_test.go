@@ -0,0 +1,225 @@
+package drone
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSlidingWindowPredictorMatchesPerWindowPredict(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 8000
+	samples := slidingWindowTestClip(sampleRate, 12)
+	classifier := slidingWindowTestClassifier(t, sampleRate, 40)
+
+	predictions, windows, err := classifier.PredictWithSlidingWindows(samples, sampleRate, 3.0, 1.5)
+	if err != nil {
+		t.Fatalf("PredictWithSlidingWindows returned error: %v", err)
+	}
+	if len(predictions) == 0 {
+		t.Fatalf("expected consolidated predictions")
+	}
+
+	naive := naiveWindowPredictions(t, classifier, samples, sampleRate, 3.0, 1.5)
+	if len(windows) != len(naive) {
+		t.Fatalf("expected %d windows, got %d", len(naive), len(windows))
+	}
+	for i := range windows {
+		if !reflect.DeepEqual(windows[i].Predictions, naive[i]) {
+			t.Fatalf("window %d differs from per-window Predict:\ngot  %+v\nwant %+v", i, windows[i].Predictions, naive[i])
+		}
+	}
+
+	// The trailing silence yields identical windows, which the cache answers
+	predictor, err := classifier.newWindowPredictor()
+	if err != nil {
+		t.Fatalf("newWindowPredictor returned error: %v", err)
+	}
+	silence, err := ExtractFeatureVector(make([]float64, 3*sampleRate), sampleRate)
+	if err != nil {
+		t.Fatalf("ExtractFeatureVector returned error: %v", err)
+	}
+	first := predictor.predict(silence)
+	second := predictor.predict(append([]float64(nil), silence...))
+	if predictor.hits != 1 || !reflect.DeepEqual(first, second) {
+		t.Fatalf("expected repeated window to be served from the cache, hits=%d", predictor.hits)
+	}
+}
+
+func BenchmarkSlidingWindows(b *testing.B) {
+	const sampleRate = 16000
+	samples := slidingWindowTestClip(sampleRate, 30)
+	classifier := slidingWindowTestClassifier(b, sampleRate, 500)
+
+	b.Run("per-window-predict", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			naiveWindowPredictions(b, classifier, samples, sampleRate, 3.0, 1.5)
+		}
+	})
+	b.Run("window-predictor", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := classifier.PredictWithSlidingWindows(samples, sampleRate, 3.0, 1.5); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// naiveWindowPredictions is the reference implementation: extract and Predict each window.
+func naiveWindowPredictions(tb testing.TB, classifier *Classifier, samples []float64, sampleRate int, windowSeconds, overlapSeconds float64) [][]Prediction {
+	tb.Helper()
+
+	minWindow := MinWindowSamples(sampleRate, classifier.minWindowSeconds())
+	windowSize, hopSize, err := slidingWindowGeometry(len(samples), sampleRate, windowSeconds, overlapSeconds, minWindow)
+	if err != nil {
+		tb.Fatalf("slidingWindowGeometry returned error: %v", err)
+	}
+	var results [][]Prediction
+	for _, start := range slidingWindowStarts(len(samples), windowSize, hopSize, minWindow) {
+		end := min(start+windowSize, len(samples))
+		features, err := ExtractFeatureVector(samples[start:end], sampleRate)
+		if err != nil {
+			tb.Fatalf("ExtractFeatureVector returned error: %v", err)
+		}
+		preds, err := classifier.Predict(features)
+		if err != nil {
+			tb.Fatalf("Predict returned error: %v", err)
+		}
+		results = append(results, preds)
+	}
+	return results
+}
+
+// slidingWindowTestClip is a rising tone over noise followed by silence.
+func slidingWindowTestClip(sampleRate int, seconds int) []float64 {
+	rng := rand.New(rand.NewSource(3))
+	samples := make([]float64, seconds*sampleRate)
+	for i := range samples[:len(samples)*2/3] {
+		freq := 150 + 200*float64(i)/float64(len(samples))
+		samples[i] = 0.4*math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)) + 0.05*(rng.Float64()*2-1)
+	}
+	return samples
+}
+
+// slidingWindowTestClassifier builds prototypes from tones across the clip's range.
+func slidingWindowTestClassifier(tb testing.TB, sampleRate int, count int) *Classifier {
+	tb.Helper()
+
+	rng := rand.New(rand.NewSource(11))
+	var protos []Prototype
+	for i := 0; i < count; i++ {
+		freq := 100 + 400*rng.Float64()
+		tone := make([]float64, sampleRate)
+		for j := range tone {
+			tone[j] = 0.4*math.Sin(2*math.Pi*freq*float64(j)/float64(sampleRate)) + 0.05*(rng.Float64()*2-1)
+		}
+		features, err := ExtractFeatureVector(tone, sampleRate)
+		if err != nil {
+			tb.Fatalf("ExtractFeatureVector returned error: %v", err)
+		}
+		label := "quad"
+		if freq > 300 {
+			label = "wind"
+		}
+		proto := newSyntheticPrototype(label, fmt.Sprintf("%s_%d", label, i), nil)
+		proto.Features = features
+		proto.Metadata = map[string]string{"description": label + " recording"}
+		protos = append(protos, proto)
+	}
+	return newTestClassifier(protos, 5)
+}
+
+func TestBatchPredictMatchesPredict(t *testing.T) {
+	t.Parallel()
+
+	const sampleRate = 8000
+	classifier := slidingWindowTestClassifier(t, sampleRate, 40)
+	vectors := batchTestVectors(t, sampleRate, 12)
+	vectors[5] = nil
+
+	results, err := classifier.BatchPredict(vectors)
+	if err != nil {
+		t.Fatalf("BatchPredict returned error: %v", err)
+	}
+	if len(results) != len(vectors) || results[5] != nil {
+		t.Fatalf("expected %d results with a nil entry for the empty vector, got %d", len(vectors), len(results))
+	}
+	for i, features := range vectors {
+		if len(features) == 0 {
+			continue
+		}
+		want, err := classifier.Predict(features)
+		if err != nil {
+			t.Fatalf("Predict returned error: %v", err)
+		}
+		if !reflect.DeepEqual(results[i], want) {
+			t.Fatalf("vector %d differs from Predict:\ngot  %+v\nwant %+v", i, results[i], want)
+		}
+	}
+
+	// Uploads during a batch must not race with it (run with -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if _, err := classifier.AddPrototype(Prototype{ID: fmt.Sprintf("late_%d", i), Label: "late", Features: vectors[0]}); err != nil {
+				t.Errorf("AddPrototype returned error: %v", err)
+			}
+		}
+	}()
+	if _, err := classifier.BatchPredict(vectors); err != nil {
+		t.Fatalf("BatchPredict returned error: %v", err)
+	}
+	<-done
+}
+
+// BenchmarkBatchPredict compares one BatchPredict call with a Predict call per vector.
+// With 500 prototypes and 200 vectors BatchPredict took about 40-55 ms against 80-85 ms
+// for sequential Predict and allocated 2.3 MB instead of 66 MB, since Predict deep-copies
+// the model for every vector. The distance scan is the remaining cost.
+func BenchmarkBatchPredict(b *testing.B) {
+	const sampleRate = 8000
+	classifier := slidingWindowTestClassifier(b, sampleRate, 500)
+	vectors := batchTestVectors(b, sampleRate, 200)
+
+	b.Run("sequential-predict", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, features := range vectors {
+				if _, err := classifier.Predict(features); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batch-predict", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := classifier.BatchPredict(vectors); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// batchTestVectors extracts features from count noisy tones between 100 and 500 Hz.
+func batchTestVectors(tb testing.TB, sampleRate int, count int) [][]float64 {
+	tb.Helper()
+
+	rng := rand.New(rand.NewSource(5))
+	vectors := make([][]float64, count)
+	for i := range vectors {
+		freq := 100 + 400*rng.Float64()
+		tone := make([]float64, sampleRate/2)
+		for j := range tone {
+			tone[j] = 0.4*math.Sin(2*math.Pi*freq*float64(j)/float64(sampleRate)) + 0.05*(rng.Float64()*2-1)
+		}
+		features, err := ExtractFeatureVector(tone, sampleRate)
+		if err != nil {
+			tb.Fatalf("ExtractFeatureVector returned error: %v", err)
+		}
+		vectors[i] = features
+	}
+	return vectors
+}
@@ -0,0 +1,131 @@
+package embedding
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// diskCacheMagic starts every cache entry.
+var diskCacheMagic = []byte("PEMB")
+
+// DiskCache keeps embeddings on disk so recordings embedded once are not sent to the
+// embedding service again, even across runs. Entries are keyed by the SHA-256 of the
+// recording's bytes and tagged with the embedding model version; an entry written under
+// another version is a miss and is overwritten.
+//
+// Each entry is one file, dir/<key[:2]>/<key>.emb, holding the magic "PEMB", the
+// version as a uint16 length and its bytes, the dimension as a uint32 and the values as
+// little-endian float64s.
+type DiskCache struct {
+	dir     string
+	version string
+}
+
+// NewDiskCache returns a cache in dir, creating it if needed, for embeddings produced by
+// modelVersion.
+func NewDiskCache(dir, modelVersion string) (*DiskCache, error) {
+	if dir == "" {
+		return nil, errors.New("embedding cache directory is empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create embedding cache: %w", err)
+	}
+	return &DiskCache{dir: dir, version: modelVersion}, nil
+}
+
+// ContentKey returns the cache key of a recording's bytes.
+func ContentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// path returns the file of key, spread over 256 subdirectories.
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".emb")
+}
+
+// Get returns the embedding stored under key, or false when there is none for the
+// cache's model version or the entry cannot be read.
+func (c *DiskCache) Get(key string) ([]float64, bool) {
+	if len(key) < 2 {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	reader := bytes.NewReader(data)
+	magic := make([]byte, len(diskCacheMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, diskCacheMagic) {
+		return nil, false
+	}
+	var versionLen uint16
+	if err := binary.Read(reader, binary.LittleEndian, &versionLen); err != nil {
+		return nil, false
+	}
+	version := make([]byte, versionLen)
+	if _, err := io.ReadFull(reader, version); err != nil || string(version) != c.version {
+		return nil, false
+	}
+	var dimension uint32
+	if err := binary.Read(reader, binary.LittleEndian, &dimension); err != nil || int(dimension)*8 != reader.Len() {
+		return nil, false
+	}
+
+	embedding := make([]float64, dimension)
+	if err := binary.Read(reader, binary.LittleEndian, embedding); err != nil {
+		return nil, false
+	}
+	return embedding, true
+}
+
+// Put stores embedding under key. The entry is written to a temporary file and renamed
+// into place, so a concurrent Get never sees a partial entry.
+func (c *DiskCache) Put(key string, embedding []float64) error {
+	if len(key) < 2 {
+		return fmt.Errorf("invalid embedding cache key %q", key)
+	}
+	if len(c.version) > math.MaxUint16 {
+		return errors.New("embedding model version is too long")
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(diskCacheMagic) + 2 + len(c.version) + 4 + 8*len(embedding))
+	buf.Write(diskCacheMagic)
+	binary.Write(&buf, binary.LittleEndian, uint16(len(c.version)))
+	buf.WriteString(c.version)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(embedding)))
+	binary.Write(&buf, binary.LittleEndian, embedding)
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create embedding cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write embedding cache entry: %w", err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write embedding cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write embedding cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write embedding cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package embedding
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWarmDiskCacheSkipsEmbeddingService(t *testing.T) {
+	var calls atomic.Int32
+	embedding := []float64{0.25, 1.0 / 3, -2e-7}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(EmbeddingResponse{Embedding: embedding, Dimension: len(embedding)})
+	}))
+	defer service.Close()
+
+	recording := filepath.Join(t.TempDir(), "rec.wav")
+	if err := os.WriteFile(recording, []byte("RIFF fake recording"), 0o644); err != nil {
+		t.Fatalf("failed to write recording: %v", err)
+	}
+	cacheDir := t.TempDir()
+
+	// Each run gets a fresh client and cache, as separate training runs would
+	embed := func(version string) []float64 {
+		t.Helper()
+		cache, err := NewDiskCache(cacheDir, version)
+		if err != nil {
+			t.Fatalf("NewDiskCache returned error: %v", err)
+		}
+		client := NewPANNSClient(service.URL)
+		client.SetExpectedDimension(len(embedding))
+		client.SetDiskCache(cache)
+		got, err := client.EmbedFile(recording)
+		if err != nil {
+			t.Fatalf("EmbedFile returned error: %v", err)
+		}
+		return got
+	}
+
+	if got := embed("v1"); !slices.Equal(got, embedding) || calls.Load() != 1 {
+		t.Fatalf("expected a cold cache to call the service once, got %v after %d calls", got, calls.Load())
+	}
+	if got := embed("v1"); !slices.Equal(got, embedding) || calls.Load() != 1 {
+		t.Fatalf("expected a warm cache to return the exact embedding without a call, got %v after %d calls", got, calls.Load())
+	}
+	if embed("v2"); calls.Load() != 2 {
+		t.Fatalf("expected a new model version to invalidate the entry, got %d calls", calls.Load())
+	}
+}
+
+func TestDiskCacheIgnoresCorruptEntries(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), "v1")
+	if err != nil {
+		t.Fatalf("NewDiskCache returned error: %v", err)
+	}
+	key := ContentKey([]byte("recording"))
+	if err := cache.Put(key, []float64{1, 2, 3}); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	data, _ := os.ReadFile(cache.path(key))
+	if err := os.WriteFile(cache.path(key), data[:len(data)-3], 0o644); err != nil {
+		t.Fatalf("failed to truncate entry: %v", err)
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("expected a truncated entry to be a miss")
+	}
+}
@@ -3,19 +3,35 @@ package embedding
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
+
+	"song-recognition/utils"
 )
 
+// DefaultDimension is the length of a PANNS CNN14 embedding.
+const DefaultDimension = 2048
+
+// ErrDimensionMismatch is returned for an embedding whose length is not the client's
+// expected dimension, usually because the service runs a different model.
+var ErrDimensionMismatch = errors.New("embedding has the wrong dimension")
+
 // PANNSClient communicates with the Python PANNS embedding service
 type PANNSClient struct {
 	serviceURL string
 	client     *http.Client
+	cache      *DiskCache
+	dimension  int // expected embedding length; 0 accepts any
+	retry      RetryPolicy
+	breaker    circuitBreaker
 }
 
 // EmbeddingResponse represents the response from the embedding service
@@ -35,11 +51,112 @@ func NewPANNSClient(serviceURL string) *PANNSClient {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		dimension: DefaultDimension,
+		retry:     DefaultRetryPolicy(),
+		breaker:   circuitBreaker{threshold: DefaultBreakerThreshold, cooldown: DefaultBreakerCooldown},
+	}
+}
+
+// DefaultModelVersion tags cached embeddings when EMBEDDING_MODEL_VERSION is unset.
+const DefaultModelVersion = "panns-cnn14"
+
+// NewPANNSClientFromEnv returns a client for EMBEDDING_SERVICE_URL that expects
+// embeddings of EMBEDDING_DIMENSION values. When EMBEDDING_CACHE_DIR is set, embeddings
+// are cached there under EMBEDDING_MODEL_VERSION; a cache directory that cannot be
+// created is logged and left out. Failed requests are retried and the circuit breaker
+// configured from EMBEDDING_RETRY_ATTEMPTS, EMBEDDING_RETRY_BACKOFF,
+// EMBEDDING_BREAKER_THRESHOLD and EMBEDDING_BREAKER_COOLDOWN; invalid values keep the
+// defaults.
+func NewPANNSClientFromEnv() *PANNSClient {
+	client := NewPANNSClient(utils.GetEnv("EMBEDDING_SERVICE_URL", "http://localhost:5002"))
+	if value := utils.GetEnv("EMBEDDING_DIMENSION", ""); value != "" {
+		if dimension, err := strconv.Atoi(value); err == nil && dimension >= 0 {
+			client.SetExpectedDimension(dimension)
+		} else {
+			log.Printf("WARNING: invalid EMBEDDING_DIMENSION %q, expecting %d\n", value, DefaultDimension)
+		}
+	}
+	if dir := utils.GetEnv("EMBEDDING_CACHE_DIR", ""); dir != "" {
+		cache, err := NewDiskCache(dir, utils.GetEnv("EMBEDDING_MODEL_VERSION", DefaultModelVersion))
+		if err != nil {
+			log.Printf("WARNING: embedding cache disabled: %v\n", err)
+		} else {
+			client.SetDiskCache(cache)
+		}
+	}
+
+	retry := DefaultRetryPolicy()
+	if attempts, err := strconv.Atoi(utils.GetEnv("EMBEDDING_RETRY_ATTEMPTS", strconv.Itoa(DefaultRetryAttempts))); err == nil && attempts >= 1 {
+		retry.Attempts = attempts
+	} else {
+		log.Printf("WARNING: invalid EMBEDDING_RETRY_ATTEMPTS, using %d\n", DefaultRetryAttempts)
+	}
+	if backoff, err := time.ParseDuration(utils.GetEnv("EMBEDDING_RETRY_BACKOFF", DefaultRetryBackoff.String())); err == nil && backoff >= 0 {
+		retry.Backoff = backoff
+	} else {
+		log.Printf("WARNING: invalid EMBEDDING_RETRY_BACKOFF, using %s\n", DefaultRetryBackoff)
+	}
+	client.SetRetryPolicy(retry)
+
+	threshold, err := strconv.Atoi(utils.GetEnv("EMBEDDING_BREAKER_THRESHOLD", strconv.Itoa(DefaultBreakerThreshold)))
+	if err != nil || threshold < 0 {
+		log.Printf("WARNING: invalid EMBEDDING_BREAKER_THRESHOLD, using %d\n", DefaultBreakerThreshold)
+		threshold = DefaultBreakerThreshold
+	}
+	cooldown, err := time.ParseDuration(utils.GetEnv("EMBEDDING_BREAKER_COOLDOWN", DefaultBreakerCooldown.String()))
+	if err != nil || cooldown < 0 {
+		log.Printf("WARNING: invalid EMBEDDING_BREAKER_COOLDOWN, using %s\n", DefaultBreakerCooldown)
+		cooldown = DefaultBreakerCooldown
+	}
+	client.SetCircuitBreaker(threshold, cooldown)
+	return client
+}
+
+// SetExpectedDimension makes the client reject embeddings that do not have dimension
+// values with ErrDimensionMismatch. Zero accepts any length.
+func (pc *PANNSClient) SetExpectedDimension(dimension int) {
+	pc.dimension = max(dimension, 0)
+}
+
+// ExpectedDimension returns the embedding length the client accepts, or 0 when it
+// accepts any.
+func (pc *PANNSClient) ExpectedDimension() int {
+	return pc.dimension
+}
+
+// checkResponse rejects a response whose reported dimension disagrees with the
+// embedding it carries, or whose embedding is not the expected dimension.
+func (pc *PANNSClient) checkResponse(resp EmbeddingResponse) error {
+	if resp.Dimension != 0 && resp.Dimension != len(resp.Embedding) {
+		return fmt.Errorf("%w: service reported %d values but sent %d", ErrDimensionMismatch, resp.Dimension, len(resp.Embedding))
+	}
+	return pc.checkDimension(resp.Embedding)
+}
+
+// checkDimension rejects an embedding whose length is not the expected dimension.
+func (pc *PANNSClient) checkDimension(embedding []float64) error {
+	if pc.dimension > 0 && len(embedding) != pc.dimension {
+		return fmt.Errorf("%w: got %d values, expected %d (check the embedding service's model)", ErrDimensionMismatch, len(embedding), pc.dimension)
 	}
+	return nil
 }
 
-// HealthCheck verifies the embedding service is running
+// SetDiskCache makes EmbedFile look recordings up in cache before calling the service
+// and store what the service returns. nil disables caching.
+func (pc *PANNSClient) SetDiskCache(cache *DiskCache) {
+	pc.cache = cache
+}
+
+// HealthCheck verifies the embedding service is running. It is sent even while the
+// circuit breaker is open, and its result feeds the breaker: a healthy service closes
+// it, so requests resume before the cooldown ends.
 func (pc *PANNSClient) HealthCheck() error {
+	err := pc.healthCheck()
+	pc.breaker.record(err)
+	return err
+}
+
+func (pc *PANNSClient) healthCheck() error {
 	resp, err := pc.client.Get(pc.serviceURL + "/health")
 	if err != nil {
 		return fmt.Errorf("embedding service not reachable: %w", err)
@@ -53,8 +170,13 @@ func (pc *PANNSClient) HealthCheck() error {
 	return nil
 }
 
-// EmbedFile generates a PANNS embedding from an audio file
+// EmbedFile generates a PANNS embedding from an audio file. With a disk cache, a
+// recording whose bytes were embedded before is answered from the cache.
 func (pc *PANNSClient) EmbedFile(audioPath string) ([]float64, error) {
+	if pc.cache != nil {
+		return pc.embedFileCached(audioPath)
+	}
+
 	// Open the audio file
 	file, err := os.Open(filepath.Clean(audioPath))
 	if err != nil {
@@ -87,9 +209,9 @@ func (pc *PANNSClient) EmbedFile(audioPath string) ([]float64, error) {
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := pc.client.Do(req)
+	resp, err := pc.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("embedding request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -107,10 +229,37 @@ func (pc *PANNSClient) EmbedFile(audioPath string) ([]float64, error) {
 	if len(embResp.Embedding) == 0 {
 		return nil, fmt.Errorf("received empty embedding")
 	}
+	if err := pc.checkResponse(embResp); err != nil {
+		return nil, err
+	}
 
 	return embResp.Embedding, nil
 }
 
+// embedFileCached answers EmbedFile from the disk cache, embedding and storing the
+// recording on a miss. A failed store is logged; the embedding is still returned.
+func (pc *PANNSClient) embedFileCached(audioPath string) ([]float64, error) {
+	data, err := os.ReadFile(filepath.Clean(audioPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file: %w", err)
+	}
+
+	key := ContentKey(data)
+	// An entry cached under another expected dimension is embedded again
+	if embedding, ok := pc.cache.Get(key); ok && pc.checkDimension(embedding) == nil {
+		return embedding, nil
+	}
+
+	embedding, err := pc.EmbedBytes(data, filepath.Base(audioPath))
+	if err != nil {
+		return nil, err
+	}
+	if err := pc.cache.Put(key, embedding); err != nil {
+		log.Printf("WARNING: failed to cache embedding of %s: %v\n", audioPath, err)
+	}
+	return embedding, nil
+}
+
 // EmbedBytes generates a PANNS embedding from audio bytes
 func (pc *PANNSClient) EmbedBytes(audioData []byte, filename string) ([]float64, error) {
 	// Create multipart form
@@ -138,9 +287,9 @@ func (pc *PANNSClient) EmbedBytes(audioData []byte, filename string) ([]float64,
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := pc.client.Do(req)
+	resp, err := pc.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("embedding request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -158,6 +307,9 @@ func (pc *PANNSClient) EmbedBytes(audioData []byte, filename string) ([]float64,
 	if len(embResp.Embedding) == 0 {
 		return nil, fmt.Errorf("received empty embedding")
 	}
+	if err := pc.checkResponse(embResp); err != nil {
+		return nil, err
+	}
 
 	return embResp.Embedding, nil
 }
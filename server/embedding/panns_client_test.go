@@ -0,0 +1,147 @@
+package embedding
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEmbedRejectsWrongDimension(t *testing.T) {
+	// A misconfigured service returning a smaller model's embeddings
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(EmbeddingResponse{Embedding: make([]float64, 512), Dimension: 512})
+	}))
+	defer service.Close()
+
+	recording := filepath.Join(t.TempDir(), "rec.wav")
+	if err := os.WriteFile(recording, []byte("RIFF fake recording"), 0o644); err != nil {
+		t.Fatalf("failed to write recording: %v", err)
+	}
+
+	client := NewPANNSClient(service.URL)
+	if _, err := client.EmbedFile(recording); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected EmbedFile to reject a 512-dim embedding, got %v", err)
+	}
+	if _, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected EmbedBytes to reject a 512-dim embedding, got %v", err)
+	}
+
+	client.SetExpectedDimension(512)
+	if embedding, err := client.EmbedFile(recording); err != nil || len(embedding) != 512 {
+		t.Fatalf("expected a configured 512-dim client to accept it, got %d values (%v)", len(embedding), err)
+	}
+}
+
+func TestEmbedRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A restarting service fails the first two requests
+		if calls.Add(1) <= 2 {
+			http.Error(w, "starting up", http.StatusServiceUnavailable)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil || r.MultipartForm.File["audio"] == nil {
+			http.Error(w, "missing audio", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(EmbeddingResponse{Embedding: []float64{1, 2, 3}, Dimension: 3})
+	}))
+	defer service.Close()
+
+	recording := filepath.Join(t.TempDir(), "rec.wav")
+	if err := os.WriteFile(recording, []byte("RIFF fake recording"), 0o644); err != nil {
+		t.Fatalf("failed to write recording: %v", err)
+	}
+
+	client := NewPANNSClient(service.URL)
+	client.SetExpectedDimension(3)
+	client.SetRetryPolicy(RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	embedding, err := client.EmbedFile(recording)
+	if err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if len(embedding) != 3 || calls.Load() != 3 {
+		t.Fatalf("expected a 3-dim embedding after 3 calls, got %d values after %d calls", len(embedding), calls.Load())
+	}
+}
+
+func TestCircuitBreakerShortCircuitsUntilHealthy(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(EmbeddingResponse{Embedding: []float64{1}, Dimension: 1})
+	}))
+	defer service.Close()
+
+	client := NewPANNSClient(service.URL)
+	client.SetExpectedDimension(1)
+	client.SetRetryPolicy(RetryPolicy{Attempts: 1})
+	client.SetCircuitBreaker(2, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: expected the service's failure, got %v", i+1, err)
+		}
+	}
+	if _, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); !errors.Is(err, ErrCircuitOpen) || calls.Load() != 2 {
+		t.Fatalf("expected the open breaker to fail fast after 2 calls, got %v after %d calls", err, calls.Load())
+	}
+	if err := client.HealthCheck(); err == nil || !client.CircuitOpen() {
+		t.Fatalf("expected a failed health check to keep the breaker open, got %v", err)
+	}
+
+	healthy.Store(true)
+	if err := client.HealthCheck(); err != nil || client.CircuitOpen() {
+		t.Fatalf("expected a healthy service to close the breaker, got %v", err)
+	}
+	if _, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); err != nil {
+		t.Fatalf("expected requests to resume, got %v", err)
+	}
+}
+
+func TestEmbedRejectsMismatchedResponses(t *testing.T) {
+	var response EmbeddingResponse
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer service.Close()
+
+	client := NewPANNSClient(service.URL)
+	if client.ExpectedDimension() != DefaultDimension {
+		t.Fatalf("expected a new client to expect %d dims, got %d", DefaultDimension, client.ExpectedDimension())
+	}
+
+	// A service running another model, consistent with itself
+	response = EmbeddingResponse{Embedding: make([]float64, 1024), Dimension: 1024}
+	if _, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected a 1024-dim embedding to be rejected, got %v", err)
+	}
+
+	// A response whose reported dimension disagrees with its embedding
+	response = EmbeddingResponse{Embedding: make([]float64, DefaultDimension), Dimension: 527}
+	if _, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected a reported dimension of 527 to be rejected, got %v", err)
+	}
+
+	response = EmbeddingResponse{Embedding: make([]float64, DefaultDimension), Dimension: DefaultDimension}
+	if embedding, err := client.EmbedBytes([]byte("RIFF"), "rec.wav"); err != nil || len(embedding) != DefaultDimension {
+		t.Fatalf("expected a %d-dim embedding to be accepted, got %d values (%v)", DefaultDimension, len(embedding), err)
+	}
+}
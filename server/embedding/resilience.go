@@ -0,0 +1,166 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the embedding service while the
+// client's circuit breaker is open after repeated failures.
+var ErrCircuitOpen = errors.New("embedding service circuit open")
+
+// Retry and circuit breaker defaults, overridden by EMBEDDING_RETRY_ATTEMPTS,
+// EMBEDDING_RETRY_BACKOFF, EMBEDDING_BREAKER_THRESHOLD and EMBEDDING_BREAKER_COOLDOWN.
+const (
+	DefaultRetryAttempts    = 3
+	DefaultRetryBackoff     = 200 * time.Millisecond
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// RetryPolicy decides how often a failed embedding request is sent again. Retry n
+// (from 1) waits Backoff*2^(n-1), capped at MaxBackoff.
+type RetryPolicy struct {
+	Attempts   int           // total attempts including the first; below 1 means 1
+	Backoff    time.Duration // wait before the first retry
+	MaxBackoff time.Duration // 0 leaves the wait uncapped
+}
+
+// DefaultRetryPolicy retries twice, waiting 200 ms and then 400 ms.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Attempts: DefaultRetryAttempts, Backoff: DefaultRetryBackoff, MaxBackoff: 5 * time.Second}
+}
+
+// delay returns the wait before retry n.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < retry; i++ {
+		wait *= 2
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return wait
+}
+
+// circuitBreaker stops calls to a service that keeps failing. After threshold
+// consecutive failures it opens for cooldown, during which calls fail fast with
+// ErrCircuitOpen. Once the cooldown has passed calls are let through again: a success
+// closes the breaker and another failure reopens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// allow returns ErrCircuitOpen, with the time left, while the breaker is open.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return nil
+	}
+	if remaining := time.Until(b.openUntil); remaining > 0 {
+		return fmt.Errorf("%w: retrying in %s", ErrCircuitOpen, remaining.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// record counts a call's outcome: nil closes the breaker, an error counts towards
+// opening it.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// open reports whether calls are currently short-circuited.
+func (b *circuitBreaker) open() bool {
+	return b.allow() != nil
+}
+
+// SetRetryPolicy replaces how failed requests are retried.
+func (pc *PANNSClient) SetRetryPolicy(policy RetryPolicy) {
+	pc.retry = policy
+}
+
+// SetCircuitBreaker opens the breaker for cooldown after threshold consecutive failed
+// requests. A threshold of 0 disables it.
+func (pc *PANNSClient) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	pc.breaker.mu.Lock()
+	defer pc.breaker.mu.Unlock()
+	pc.breaker.threshold = max(threshold, 0)
+	pc.breaker.cooldown = cooldown
+	pc.breaker.failures = 0
+}
+
+// CircuitOpen reports whether requests currently fail fast with ErrCircuitOpen.
+func (pc *PANNSClient) CircuitOpen() bool {
+	return pc.breaker.open()
+}
+
+// Do sends req to the embedding service, retrying transport errors and 5xx responses
+// with the client's backoff, and returns the first other response for the caller to
+// check and close. A request that exhausts its attempts counts as one failure towards
+// the circuit breaker; while the breaker is open Do fails with ErrCircuitOpen without
+// sending anything. Retries resend the body through req.GetBody, which
+// http.NewRequest sets for in-memory bodies.
+func (pc *PANNSClient) Do(req *http.Request) (*http.Response, error) {
+	if err := pc.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	attempts := max(pc.retry.Attempts, 1)
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		send := req
+		if attempt > 0 {
+			if req.GetBody == nil && req.Body != nil {
+				break
+			}
+			select {
+			case <-time.After(pc.retry.delay(attempt)):
+			case <-req.Context().Done():
+				pc.breaker.record(lastErr)
+				return nil, lastErr
+			}
+			send = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					break
+				}
+				send.Body = body
+			}
+		}
+
+		resp, err := pc.client.Do(send)
+		if err != nil {
+			lastErr = fmt.Errorf("embedding request failed: %w", err)
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			lastErr = fmt.Errorf("embedding service returned status %d: %s", resp.StatusCode, string(bodyBytes))
+			continue
+		}
+		pc.breaker.record(nil)
+		return resp, nil
+	}
+	pc.breaker.record(lastErr)
+	return nil, lastErr
+}
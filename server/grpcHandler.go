@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"song-recognition/drone"
+	"song-recognition/grpcserver"
+	"song-recognition/models"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCClassifier runs gRPC recordings through the same pipeline as HTTP uploads,
+// with the default preprocessing, and maps its failures to gRPC status codes.
+func newGRPCClassifier(registry *modelRegistry, classify recordingPipeline) grpcserver.ClassifyFunc {
+	return func(ctx context.Context, recData models.RecordData) (drone.ClassificationSummary, error) {
+		summary, err := classify(ctx, recData, recData.Model, drone.DefaultPreprocessingConfig())
+		switch {
+		case errors.Is(err, drone.ErrEmptyModel):
+			return summary, status.Errorf(codes.Unavailable, "model %q has no prototypes", summary.Model)
+		case err != nil:
+			failure := drone.AsClassifyError(err)
+			return summary, status.Error(grpcCode(failure.HTTPStatus()), failure.Message)
+		}
+		summary.Predictions = drone.TopPredictions(summary.Predictions, detectionSettingsFromEnv(registry).TopN)
+		return summary, nil
+	}
+}
+
+// grpcCode maps the HTTP status of a ClassifyError to its gRPC equivalent.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// serveGRPC starts the gRPC classification service on port alongside the HTTP server.
+// Recordings are capped at DRONE_MAX_REQUEST_BYTES of PCM.
+func serveGRPC(port string, registry *modelRegistry, classify recordingPipeline) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("gRPC server listen on port %s: %v", port, err)
+	}
+	log.Printf("Starting gRPC classifier on port %s\n", port)
+	go func() {
+		if err := grpcserver.Serve(listener, newGRPCClassifier(registry, classify), int(maxRequestBytes())); err != nil {
+			log.Fatalf("gRPC server Serve: %v", err)
+		}
+	}()
+}
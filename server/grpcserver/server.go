@@ -0,0 +1,146 @@
+// Package grpcserver exposes drone classification over gRPC for systems that do not
+// speak JSON over HTTP.
+//
+// A client streams a recording to DroneClassifier.Classify as raw PCM chunks; the
+// server reassembles them into the same models.RecordData an HTTP upload decodes to and
+// hands it to a ClassifyFunc, which in the server is the pipeline behind
+// POST /api/audio/classify. The stubs in classifierpb are generated from
+// classifierpb/classifier.proto.
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+
+	"song-recognition/drone"
+	"song-recognition/grpcserver/classifierpb"
+	"song-recognition/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClassifyFunc classifies a reassembled recording. Errors should carry a gRPC status;
+// any other error is reported as codes.Internal.
+type ClassifyFunc func(ctx context.Context, recData models.RecordData) (drone.ClassificationSummary, error)
+
+// Server implements classifierpb.DroneClassifierServer.
+type Server struct {
+	classifierpb.UnimplementedDroneClassifierServer
+	classify ClassifyFunc
+	maxBytes int
+}
+
+// NewServer returns a server that classifies recordings with classify, rejecting
+// recordings over maxAudioBytes of PCM (0 means no limit).
+func NewServer(classify ClassifyFunc, maxAudioBytes int) *Server {
+	return &Server{classify: classify, maxBytes: maxAudioBytes}
+}
+
+// Classify reassembles the streamed chunks and classifies the recording once the client
+// closes its side of the stream.
+func (s *Server) Classify(stream classifierpb.DroneClassifier_ClassifyServer) error {
+	recData, err := s.receive(stream)
+	if err != nil {
+		return err
+	}
+
+	summary, err := s.classify(stream.Context(), recData)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendAndClose(summaryToProto(summary))
+}
+
+// receive reads chunks until the client closes the stream and returns the recording they
+// make up.
+func (s *Server) receive(stream classifierpb.DroneClassifier_ClassifyServer) (models.RecordData, error) {
+	var first *classifierpb.AudioChunk
+	var audio []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return models.RecordData{}, err
+		}
+		if first == nil {
+			first = chunk
+		}
+		if s.maxBytes > 0 && len(audio)+len(chunk.GetAudio()) > s.maxBytes {
+			return models.RecordData{}, status.Errorf(codes.ResourceExhausted, "recording exceeds %d bytes", s.maxBytes)
+		}
+		audio = append(audio, chunk.GetAudio()...)
+	}
+
+	if first == nil || len(audio) == 0 {
+		return models.RecordData{}, status.Error(codes.InvalidArgument, "no audio received")
+	}
+	if first.GetSampleRate() <= 0 || first.GetChannels() <= 0 || first.GetSampleSize() <= 0 {
+		return models.RecordData{}, status.Error(codes.InvalidArgument, "first chunk must set sample_rate, channels and sample_size")
+	}
+
+	frameBytes := int(first.GetChannels()) * int(first.GetSampleSize()) / 8
+	if frameBytes == 0 || len(audio)%frameBytes != 0 {
+		return models.RecordData{}, status.Errorf(codes.InvalidArgument, "audio is not a whole number of %d-byte frames", frameBytes)
+	}
+
+	return models.RecordData{
+		Audio:      base64.StdEncoding.EncodeToString(audio),
+		Duration:   float64(len(audio)/frameBytes) / float64(first.GetSampleRate()),
+		Channels:   int(first.GetChannels()),
+		SampleRate: int(first.GetSampleRate()),
+		SampleSize: int(first.GetSampleSize()),
+		Latitude:   first.Latitude,
+		Longitude:  first.Longitude,
+		Model:      first.GetModel(),
+	}, nil
+}
+
+// summaryToProto copies the decision fields of summary into its wire form.
+func summaryToProto(summary drone.ClassificationSummary) *classifierpb.ClassificationSummary {
+	predictions := make([]*classifierpb.Prediction, len(summary.Predictions))
+	for i, prediction := range summary.Predictions {
+		predictions[i] = &classifierpb.Prediction{
+			Label:           prediction.Label,
+			Category:        prediction.Category,
+			Type:            prediction.Type,
+			Confidence:      prediction.Confidence,
+			AverageDistance: prediction.AverageDist,
+			Margin:          prediction.Margin,
+			Support:         int32(prediction.Support),
+		}
+	}
+	return &classifierpb.ClassificationSummary{
+		Predictions:       predictions,
+		IsDrone:           summary.IsDrone,
+		Ambiguous:         summary.Ambiguous,
+		DroneConfidence:   summary.DroneConfidence,
+		NoiseConfidence:   summary.NoiseConfidence,
+		LowDataMode:       summary.LowDataMode,
+		LatencyMs:         summary.LatencyMs,
+		PrimaryType:       summary.PrimaryType,
+		SnrDb:             summary.SNRDb,
+		AdjustedThreshold: summary.AdjustedThreshold,
+		Screened:          summary.Screened,
+		Model:             summary.Model,
+		ModelFingerprint:  summary.ModelFingerprint,
+		RecordingHash:     summary.RecordingHash,
+	}
+}
+
+// Serve registers a Server for classify on a new gRPC server and serves listener until
+// it fails.
+func Serve(listener net.Listener, classify ClassifyFunc, maxAudioBytes int) error {
+	server := grpc.NewServer()
+	classifierpb.RegisterDroneClassifierServer(server, NewServer(classify, maxAudioBytes))
+	return server.Serve(listener)
+}
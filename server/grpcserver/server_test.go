@@ -0,0 +1,113 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"song-recognition/drone"
+	"song-recognition/grpcserver/classifierpb"
+	"song-recognition/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves classify over an in-memory listener and returns a client for it.
+func newTestClient(t *testing.T, classify ClassifyFunc) classifierpb.DroneClassifierClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	classifierpb.RegisterDroneClassifierServer(server, NewServer(classify, 64))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return classifierpb.NewDroneClassifierClient(conn)
+}
+
+// classifyChunks streams chunks and returns the summary or error.
+func classifyChunks(t *testing.T, client classifierpb.DroneClassifierClient, chunks ...*classifierpb.AudioChunk) (*classifierpb.ClassificationSummary, error) {
+	t.Helper()
+
+	stream, err := client.Classify(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	for _, chunk := range chunks {
+		if err := stream.Send(chunk); err != nil {
+			t.Fatalf("failed to send chunk: %v", err)
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestClassifyReassemblesChunks(t *testing.T) {
+	var received models.RecordData
+	client := newTestClient(t, func(ctx context.Context, recData models.RecordData) (drone.ClassificationSummary, error) {
+		received = recData
+		return drone.ClassificationSummary{
+			Predictions: []drone.Prediction{{Label: "quad", Category: "drone", Confidence: 0.9, Support: 3}},
+			IsDrone:     true,
+		}, nil
+	})
+
+	latitude := 51.5
+	summary, err := classifyChunks(t, client,
+		&classifierpb.AudioChunk{Audio: []byte{1, 2, 3, 4}, SampleRate: 8000, Channels: 1, SampleSize: 16, Model: "site", Latitude: &latitude},
+		&classifierpb.AudioChunk{Audio: []byte{5, 6}},
+	)
+	if err != nil {
+		t.Fatalf("classification failed: %v", err)
+	}
+
+	audio, _ := base64.StdEncoding.DecodeString(received.Audio)
+	if string(audio) != string([]byte{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("expected the chunks concatenated in order, got %v", audio)
+	}
+	if received.SampleRate != 8000 || received.Channels != 1 || received.SampleSize != 16 || received.Model != "site" {
+		t.Fatalf("expected the first chunk's format and model, got %+v", received)
+	}
+	if received.Latitude == nil || *received.Latitude != latitude || received.Longitude != nil {
+		t.Fatalf("expected only the latitude to be set, got %v / %v", received.Latitude, received.Longitude)
+	}
+	if received.Duration != 3.0/8000 {
+		t.Fatalf("expected a duration of 3 frames, got %v", received.Duration)
+	}
+	if !summary.IsDrone || len(summary.Predictions) != 1 || summary.Predictions[0].Label != "quad" || summary.Predictions[0].Support != 3 {
+		t.Fatalf("expected the summary to round-trip, got %+v", summary)
+	}
+}
+
+func TestClassifyRejectsInvalidStreams(t *testing.T) {
+	client := newTestClient(t, func(ctx context.Context, recData models.RecordData) (drone.ClassificationSummary, error) {
+		t.Fatal("classify should not run for an invalid stream")
+		return drone.ClassificationSummary{}, nil
+	})
+
+	for name, test := range map[string]struct {
+		chunks []*classifierpb.AudioChunk
+		code   codes.Code
+	}{
+		"empty":          {nil, codes.InvalidArgument},
+		"missing format": {[]*classifierpb.AudioChunk{{Audio: []byte{1, 2}}}, codes.InvalidArgument},
+		"partial frame":  {[]*classifierpb.AudioChunk{{Audio: []byte{1, 2, 3}, SampleRate: 8000, Channels: 1, SampleSize: 16}}, codes.InvalidArgument},
+		"too large":      {[]*classifierpb.AudioChunk{{Audio: make([]byte, 66), SampleRate: 8000, Channels: 1, SampleSize: 16}}, codes.ResourceExhausted},
+	} {
+		_, err := classifyChunks(t, client, test.chunks...)
+		if status.Code(err) != test.code {
+			t.Fatalf("%s: expected %v, got %v", name, test.code, err)
+		}
+	}
+}
@@ -42,8 +42,9 @@ func main() {
 		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 		protocol := serveCmd.String("proto", "http", "Protocol to use (http or https)")
 		port := serveCmd.String("p", "5000", "Port to use")
+		grpcPort := serveCmd.String("grpc-port", "50051", "Port for the gRPC classification service (empty to disable)")
 		serveCmd.Parse(os.Args[2:])
-		serve(*protocol, *port)
+		serve(*protocol, *port, *grpcPort)
 	default:
 		fmt.Println("Expected 'serve' subcommand")
 		os.Exit(1)
@@ -0,0 +1,121 @@
+// Package metrics counts classification outcomes and latency and serves them at /metrics
+// in the Prometheus text exposition format. The handful of series the server exports
+// does not warrant the Prometheus client library, so the format is written directly:
+//
+//	classifications_total{is_drone="true"}   counter of finished classifications
+//	predictions_by_label{label="quad"}       counter of classifications by top label
+//	classification_latency_seconds           histogram of end-to-end latency
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the latency histogram buckets.
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds the classification metrics of one server.
+type Registry struct {
+	mu              sync.Mutex
+	classifications map[bool]uint64
+	labels          map[string]uint64
+	latencyBuckets  []uint64 // observations per bucket, not cumulative; the last is +Inf
+	latencySum      float64
+	latencyCount    uint64
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		classifications: map[bool]uint64{false: 0, true: 0},
+		labels:          make(map[string]uint64),
+		latencyBuckets:  make([]uint64, len(LatencyBuckets)+1),
+	}
+}
+
+// Default is the registry the server records to and serves.
+var Default = NewRegistry()
+
+// ObserveClassification records a finished classification on Default.
+func ObserveClassification(isDrone bool, topLabel string, latency time.Duration) {
+	Default.ObserveClassification(isDrone, topLabel, latency)
+}
+
+// Handler serves Default.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// ObserveClassification records a finished classification. An empty topLabel (no
+// predictions) is not counted by label.
+func (r *Registry) ObserveClassification(isDrone bool, topLabel string, latency time.Duration) {
+	seconds := latency.Seconds()
+	bucket, _ := slices.BinarySearch(LatencyBuckets, seconds)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.classifications[isDrone]++
+	if topLabel != "" {
+		r.labels[topLabel]++
+	}
+	r.latencyBuckets[bucket]++
+	r.latencySum += seconds
+	r.latencyCount++
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "# HELP classifications_total Classifications completed, by whether a drone was detected.")
+	fmt.Fprintln(out, "# TYPE classifications_total counter")
+	for _, isDrone := range []bool{false, true} {
+		fmt.Fprintf(out, "classifications_total{is_drone=\"%t\"} %d\n", isDrone, r.classifications[isDrone])
+	}
+
+	fmt.Fprintln(out, "# HELP predictions_by_label Classifications completed, by top predicted label.")
+	fmt.Fprintln(out, "# TYPE predictions_by_label counter")
+	labels := make([]string, 0, len(r.labels))
+	for label := range r.labels {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	for _, label := range labels {
+		fmt.Fprintf(out, "predictions_by_label{label=\"%s\"} %d\n", escapeLabelValue(label), r.labels[label])
+	}
+
+	fmt.Fprintln(out, "# HELP classification_latency_seconds End-to-end classification latency.")
+	fmt.Fprintln(out, "# TYPE classification_latency_seconds histogram")
+	var cumulative uint64
+	for i, bound := range LatencyBuckets {
+		cumulative += r.latencyBuckets[i]
+		fmt.Fprintf(out, "classification_latency_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(out, "classification_latency_seconds_bucket{le=\"+Inf\"} %d\n", r.latencyCount)
+	fmt.Fprintf(out, "classification_latency_seconds_sum %s\n", strconv.FormatFloat(r.latencySum, 'g', -1, 64))
+	fmt.Fprintf(out, "classification_latency_seconds_count %d\n", r.latencyCount)
+	return out.Flush()
+}
+
+// escapeLabelValue escapes a label value as the text format requires.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
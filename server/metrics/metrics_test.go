@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryWritesCumulativeHistogram(t *testing.T) {
+	registry := NewRegistry()
+	registry.ObserveClassification(true, "quad", 80*time.Millisecond)
+	registry.ObserveClassification(false, `wind "gust"`, 300*time.Millisecond)
+	registry.ObserveClassification(false, "", time.Minute)
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+	text := out.String()
+
+	for _, line := range []string{
+		`classifications_total{is_drone="false"} 2`,
+		`classifications_total{is_drone="true"} 1`,
+		`predictions_by_label{label="quad"} 1`,
+		`predictions_by_label{label="wind \"gust\""} 1`,
+		`classification_latency_seconds_bucket{le="0.05"} 0`,
+		`classification_latency_seconds_bucket{le="0.1"} 1`,
+		`classification_latency_seconds_bucket{le="0.5"} 2`,
+		`classification_latency_seconds_bucket{le="30"} 2`,
+		`classification_latency_seconds_bucket{le="+Inf"} 3`,
+		`classification_latency_seconds_sum 60.38`,
+		`classification_latency_seconds_count 3`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("expected %q in:\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, `label=""`) {
+		t.Fatalf("expected a classification without predictions to skip the label counter:\n%s", text)
+	}
+}
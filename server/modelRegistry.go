@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"song-recognition/drone"
+)
+
+const (
+	defaultModelName = "default"
+	modelHeader      = "X-Drone-Model"
+	modelQueryParam  = "model"
+)
+
+// modelRegistry holds one classifier per deployment site so a single server
+// instance can serve several site-specific drone fleets.
+type modelRegistry struct {
+	mu          sync.RWMutex
+	classifiers map[string]*drone.Classifier
+
+	// thresholdTargetFPR is DRONE_THRESHOLD_TARGET_FPR. When it is set, derivedThreshold
+	// holds the confidence threshold suggested by the default model's noise prototypes,
+	// or 0 when none could be derived.
+	thresholdTargetFPR float64
+	derivedThreshold   float64
+}
+
+func newModelRegistry(defaultClassifier *drone.Classifier) *modelRegistry {
+	registry := &modelRegistry{classifiers: make(map[string]*drone.Classifier)}
+	if defaultClassifier != nil {
+		registry.classifiers[defaultModelName] = defaultClassifier
+	}
+	return registry
+}
+
+// register adds or replaces the classifier stored under name.
+func (mr *modelRegistry) register(name string, classifier *drone.Classifier) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.classifiers[name] = classifier
+}
+
+// loadModelDir loads every *.json prototype file in dir as a named model.
+// The model name is the file name without its extension, e.g. "site-north.json"
+// becomes "site-north".
+func (mr *modelRegistry) loadModelDir(dir string, k int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read model directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if name == defaultModelName {
+			log.Printf("Skipping %s: model name %q is reserved for DRONE_MODEL_PATH\n", entry.Name(), defaultModelName)
+			continue
+		}
+
+		classifier, err := drone.NewClassifierFromFile(filepath.Join(dir, entry.Name()), k)
+		if err != nil {
+			return fmt.Errorf("failed to load model %s: %w", name, err)
+		}
+		mr.register(name, classifier)
+		log.Printf("Loaded model %q from %s (%d prototypes)\n", name, entry.Name(), classifier.Stats().PrototypeCount)
+	}
+
+	return nil
+}
+
+// lookup returns the classifier stored under name.
+func (mr *modelRegistry) lookup(name string) (*drone.Classifier, bool) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	classifier, ok := mr.classifiers[name]
+	return classifier, ok
+}
+
+// defaultClassifier returns the model loaded from DRONE_MODEL_PATH.
+func (mr *modelRegistry) defaultClassifier() *drone.Classifier {
+	classifier, _ := mr.lookup(defaultModelName)
+	return classifier
+}
+
+// setThresholdTarget derives the confidence threshold from the default model at
+// targetFPR, and again whenever refreshDerivedThreshold is called.
+func (mr *modelRegistry) setThresholdTarget(targetFPR float64) {
+	mr.mu.Lock()
+	mr.thresholdTargetFPR = targetFPR
+	mr.mu.Unlock()
+	mr.refreshDerivedThreshold()
+}
+
+// refreshDerivedThreshold re-derives the confidence threshold after the default model
+// was reloaded or its prototypes changed. When no threshold can be derived the handlers
+// fall back to the default.
+func (mr *modelRegistry) refreshDerivedThreshold() {
+	mr.mu.RLock()
+	target := mr.thresholdTargetFPR
+	mr.mu.RUnlock()
+	classifier := mr.defaultClassifier()
+	if target <= 0 || classifier == nil {
+		return
+	}
+
+	threshold, err := classifier.SuggestThreshold(target)
+	if err != nil {
+		log.Printf("WARNING: unable to derive confidence threshold, using the default: %v\n", err)
+		threshold = 0
+	} else {
+		log.Printf("Confidence threshold derived from noise prototypes: %.4f (target FPR %.2f)\n", threshold, target)
+	}
+	mr.mu.Lock()
+	mr.derivedThreshold = threshold
+	mr.mu.Unlock()
+}
+
+// suggestedThreshold returns the confidence threshold derived from the default model,
+// if there is one.
+func (mr *modelRegistry) suggestedThreshold() (float64, bool) {
+	if mr == nil {
+		return 0, false
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	return mr.derivedThreshold, mr.derivedThreshold > 0
+}
+
+// resolve returns the classifier for name, using the default model when name is empty.
+func (mr *modelRegistry) resolve(name string) (*drone.Classifier, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultModelName
+	}
+
+	classifier, ok := mr.lookup(name)
+	if !ok {
+		return nil, name, fmt.Errorf("unknown model %q", name)
+	}
+	return classifier, name, nil
+}
+
+// requestedModel reads the model selection from the X-Drone-Model header,
+// falling back to the ?model= query parameter.
+func requestedModel(r *http.Request) string {
+	if name := strings.TrimSpace(r.Header.Get(modelHeader)); name != "" {
+		return name
+	}
+	return strings.TrimSpace(r.URL.Query().Get(modelQueryParam))
+}
+
+// names lists the registered model names in sorted order.
+func (mr *modelRegistry) names() []string {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	names := make([]string, 0, len(mr.classifiers))
+	for name := range mr.classifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
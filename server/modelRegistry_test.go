@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"song-recognition/drone"
+	"song-recognition/models"
+	"song-recognition/wav"
+)
+
+func TestClassificationHandlerRoutesByModel(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	// Both sites know both labels but learned them from opposite tones, so the same
+	// 440 Hz recording only ranks differently if matching runs against the chosen model
+	modelDir := t.TempDir()
+	writeToneModel(t, filepath.Join(modelDir, "site-north.json"), tonePrototype{"alpha", 440}, tonePrototype{"beta", 2000})
+	writeToneModel(t, filepath.Join(modelDir, "site-south.json"), tonePrototype{"alpha", 2000}, tonePrototype{"beta", 440})
+
+	registry := newModelRegistry(nil)
+	if err := registry.loadModelDir(modelDir, 3); err != nil {
+		t.Fatalf("loadModelDir returned error: %v", err)
+	}
+
+	handler := newAudioClassificationHandler(registry, drone.NewLegacyExtractor(), nil, false, nil, nil)
+	body := newTestRecording(t, 1.0)
+
+	for model, wantLabel := range map[string]string{"site-north": "alpha", "site-south": "beta"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/audio/classify", bytes.NewReader(body))
+		req.Header.Set(modelHeader, model)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("model %s: expected 200, got %d: %s", model, rec.Code, rec.Body.String())
+		}
+		var summary drone.ClassificationSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("model %s: failed to decode response: %v", model, err)
+		}
+		if len(summary.Predictions) == 0 {
+			t.Fatalf("model %s: no predictions returned", model)
+		}
+		if summary.Predictions[0].Label != wantLabel {
+			t.Fatalf("model %s: expected %s, got %s", model, wantLabel, summary.Predictions[0].Label)
+		}
+		if summary.Model != model {
+			t.Fatalf("expected summary model %s, got %s", model, summary.Model)
+		}
+	}
+}
+
+func TestClassificationHandlerRejectsUnknownModel(t *testing.T) {
+	t.Cleanup(wav.SetRunner(passthroughRunner{}))
+
+	modelDir := t.TempDir()
+	writeTestModel(t, filepath.Join(modelDir, "site-north.json"), "alpha")
+
+	registry := newModelRegistry(nil)
+	if err := registry.loadModelDir(modelDir, 3); err != nil {
+		t.Fatalf("loadModelDir returned error: %v", err)
+	}
+
+	handler := newAudioClassificationHandler(registry, drone.NewLegacyExtractor(), nil, false, nil, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/audio/classify?model=site-east", bytes.NewReader(newTestRecording(t, 0.5)))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown model, got %d", rec.Code)
+	}
+}
+
+// writeTestModel writes a PANNS-sized model file holding one constant prototype per
+// label. Legacy features are shorter than its prototypes, so tests that depend on
+// which label a recording matches use writeToneModel instead.
+func writeTestModel(t *testing.T, path string, labels ...string) {
+	t.Helper()
+
+	protos := make([]drone.Prototype, 0, len(labels))
+	for i, label := range labels {
+		features := make([]float64, 2048)
+		for j := range features {
+			features[j] = 1.0 / float64(i+1)
+		}
+		protos = append(protos, drone.Prototype{
+			ID:       label + "_1",
+			Label:    label,
+			Category: "drone",
+			Features: features,
+		})
+	}
+
+	data, err := json.Marshal(protos)
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+}
+
+// tonePrototype is a label learned from a pure tone at frequency Hz.
+type tonePrototype struct {
+	label     string
+	frequency float64
+}
+
+// writeToneModel writes a legacy-feature model whose prototypes are extracted from
+// 1 s tones, so recordings are matched on real features of the same dimension.
+func writeToneModel(t *testing.T, path string, tones ...tonePrototype) {
+	t.Helper()
+
+	protos := make([]drone.Prototype, 0, len(tones))
+	for _, tone := range tones {
+		samples := make([]float64, testSampleRate)
+		for i := range samples {
+			samples[i] = 0.5 * math.Sin(2*math.Pi*tone.frequency*float64(i)/testSampleRate)
+		}
+		processed := drone.PreprocessAudio(samples, testSampleRate, drone.DefaultPreprocessingConfig())
+		features, err := drone.ExtractFeatureVector(processed, testSampleRate)
+		if err != nil {
+			t.Fatalf("failed to extract %s features: %v", tone.label, err)
+		}
+		protos = append(protos, drone.Prototype{
+			ID:       tone.label + "_1",
+			Label:    tone.label,
+			Category: "drone",
+			Features: features,
+		})
+	}
+
+	data, err := json.Marshal(protos)
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+}
+
+// newTestRecording returns a JSON classification request carrying a 16-bit
+// mono 440 Hz tone of the given duration.
+func newTestRecording(t *testing.T, seconds float64) []byte {
+	t.Helper()
+
+	return newLocatedRecording(t, testTonePCM(440, seconds), seconds, nil, nil)
+}
+
+// newLocatedRecording returns a JSON recording request carrying 16-bit mono pcm
+// captured at the given location.
+func newLocatedRecording(t *testing.T, pcm []byte, seconds float64, latitude, longitude *float64) []byte {
+	t.Helper()
+
+	payload, err := json.Marshal(models.RecordData{
+		Audio:      base64.StdEncoding.EncodeToString(pcm),
+		Duration:   seconds,
+		Channels:   1,
+		SampleRate: testSampleRate,
+		SampleSize: 16,
+		Latitude:   latitude,
+		Longitude:  longitude,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal recording: %v", err)
+	}
+	return payload
+}
+
+func TestDerivedThresholdFollowsTheDefaultModel(t *testing.T) {
+	t.Setenv("DRONE_CONFIDENCE_THRESHOLD", "")
+
+	// Low tones are the drone and high ones the noise the threshold must reject
+	writeModel := func(path string, withNoise bool) {
+		t.Helper()
+		var protos []drone.Prototype
+		for i, frequency := range []float64{180, 220, 260, 300, 1200, 1800, 2400, 3000} {
+			category := "drone"
+			if i >= 4 {
+				if !withNoise {
+					break
+				}
+				category = "noise"
+			}
+			samples := make([]float64, testSampleRate)
+			for j := range samples {
+				samples[j] = 0.5 * math.Sin(2*math.Pi*frequency*float64(j)/testSampleRate)
+			}
+			features, err := drone.ExtractFeatureVector(drone.PreprocessAudio(samples, testSampleRate, drone.DefaultPreprocessingConfig()), testSampleRate)
+			if err != nil {
+				t.Fatalf("failed to extract features: %v", err)
+			}
+			protos = append(protos, drone.Prototype{ID: fmt.Sprintf("%s_%d", category, i), Label: category, Category: category, Features: features})
+		}
+		data, err := json.Marshal(protos)
+		if err != nil {
+			t.Fatalf("failed to marshal model: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("failed to write model: %v", err)
+		}
+	}
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeModel(modelPath, true)
+	loadModel := func() (*drone.Classifier, error) { return drone.NewClassifierFromFile(modelPath, 3) }
+	classifier, err := loadModel()
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	want, err := classifier.SuggestThreshold(0.25)
+	if err != nil {
+		t.Fatalf("SuggestThreshold returned error: %v", err)
+	}
+
+	registry := newModelRegistry(classifier)
+	registry.setThresholdTarget(0.25)
+	if got := detectionSettingsFromEnv(registry).ConfidenceThreshold; got != want {
+		t.Fatalf("expected the derived threshold %.4f, got %.4f", want, got)
+	}
+	if value := os.Getenv("DRONE_CONFIDENCE_THRESHOLD"); value != "" {
+		t.Fatalf("expected the environment to be left alone, got %q", value)
+	}
+
+	t.Setenv("DRONE_CONFIDENCE_THRESHOLD", "0.8")
+	if got := detectionSettingsFromEnv(registry).ConfidenceThreshold; got != 0.8 {
+		t.Fatalf("expected an explicit threshold to win, got %.4f", got)
+	}
+	t.Setenv("DRONE_CONFIDENCE_THRESHOLD", "")
+
+	// Without noise prototypes nothing can be derived, so the reload drops back to the default
+	writeModel(modelPath, false)
+	reloader := &modelReloader{registry: registry, loadModel: loadModel}
+	if _, err := reloader.reload(context.Background()); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	if got := detectionSettingsFromEnv(registry).ConfidenceThreshold; got != 0.55 {
+		t.Fatalf("expected the default threshold after reloading a model without noise, got %.4f", got)
+	}
+}
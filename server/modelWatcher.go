@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"song-recognition/utils"
+)
+
+const modelWatchPollInterval = 500 * time.Millisecond
+
+// fileStamp identifies one version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// modelWatcher polls the default model file and reloads it once a change has settled
+// for debounce, so a model regenerated by another process goes live without a manual
+// POST /api/model/reload. The server's own prototype saves also trigger a reload,
+// which simply re-reads what was just written.
+type modelWatcher struct {
+	path     string
+	interval time.Duration
+	debounce time.Duration
+	reload   func(ctx context.Context) (modelReloadResponse, error)
+}
+
+// newModelWatcherFromEnv returns a watcher for path when DRONE_MODEL_WATCH is true, and
+// nil otherwise.
+func newModelWatcherFromEnv(path string, reloader *modelReloader) *modelWatcher {
+	if utils.GetEnv("DRONE_MODEL_WATCH", "false") != "true" {
+		return nil
+	}
+	debounce, err := time.ParseDuration(utils.GetEnv("DRONE_MODEL_WATCH_DEBOUNCE", "2s"))
+	if err != nil || debounce < 0 {
+		debounce = 2 * time.Second
+	}
+	return &modelWatcher{
+		path:     path,
+		interval: modelWatchPollInterval,
+		debounce: debounce,
+		reload:   reloader.reload,
+	}
+}
+
+// run polls until ctx is cancelled. A failed reload is logged and not retried until
+// the file changes again.
+func (mw *modelWatcher) run(ctx context.Context) {
+	logger := utils.GetLogger()
+	ticker := time.NewTicker(mw.interval)
+	defer ticker.Stop()
+
+	loaded, _ := mw.stamp()
+	var pending fileStamp
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			current, ok := mw.stamp()
+			if !ok || current == loaded {
+				// Missing mid-rename, or unchanged since the last reload
+				continue
+			}
+			if current != pending {
+				pending, changedAt = current, now
+				continue
+			}
+			if now.Sub(changedAt) < mw.debounce {
+				continue
+			}
+
+			loaded = current
+			logger.InfoContext(ctx, "model file changed, reloading", slog.String("path", mw.path))
+			if _, err := mw.reload(ctx); err != nil {
+				logger.ErrorContext(ctx, "automatic model reload failed", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func (mw *modelWatcher) stamp() (fileStamp, bool) {
+	info, err := os.Stat(mw.path)
+	if err != nil {
+		return fileStamp{}, false
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"song-recognition/drone"
+)
+
+func TestModelWatcherReloadsChangedModel(t *testing.T) {
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha")
+	loadModel := func() (*drone.Classifier, error) { return drone.NewClassifierFromFile(modelPath, 1) }
+	classifier, err := loadModel()
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	registry := newModelRegistry(classifier)
+	reloader := &modelReloader{registry: registry, loadModel: loadModel}
+
+	var reloads atomic.Int32
+	watcher := &modelWatcher{
+		path:     modelPath,
+		interval: 10 * time.Millisecond,
+		debounce: 100 * time.Millisecond,
+		reload: func(ctx context.Context) (modelReloadResponse, error) {
+			reloads.Add(1)
+			return reloader.reload(ctx)
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.run(ctx)
+	time.Sleep(30 * time.Millisecond)
+
+	// A burst of writes, as from a tool regenerating the model, settles into one reload
+	writeTestModel(t, modelPath, "alpha", "beta")
+	time.Sleep(20 * time.Millisecond)
+	writeTestModel(t, modelPath, "alpha", "beta", "gamma")
+
+	deadline := time.Now().Add(3 * time.Second)
+	for registry.defaultClassifier().Stats().PrototypeCount != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the watcher to load the rewritten model, still serving %d prototypes",
+				registry.defaultClassifier().Stats().PrototypeCount)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if got := reloads.Load(); got != 1 {
+		t.Fatalf("expected one debounced reload, got %d", got)
+	}
+}
+
+func TestModelWatcherIsDisabledByDefault(t *testing.T) {
+	t.Setenv("DRONE_MODEL_WATCH", "")
+	reloader := &modelReloader{registry: newModelRegistry(nil)}
+	if watcher := newModelWatcherFromEnv("model.json", reloader); watcher != nil {
+		t.Fatalf("expected no watcher unless DRONE_MODEL_WATCH is set")
+	}
+
+	t.Setenv("DRONE_MODEL_WATCH", "true")
+	t.Setenv("DRONE_MODEL_WATCH_DEBOUNCE", "500ms")
+	watcher := newModelWatcherFromEnv("model.json", reloader)
+	if watcher == nil || watcher.debounce != 500*time.Millisecond {
+		t.Fatalf("expected a watcher with a 500ms debounce, got %+v", watcher)
+	}
+}
@@ -18,23 +18,61 @@ type RecordData struct {
 	SampleSize int      `json:"sampleSize"`
 	Latitude   *float64 `json:"latitude,omitempty"`
 	Longitude  *float64 `json:"longitude,omitempty"`
+	Model      string   `json:"model,omitempty"`
 }
 
 // Detection represents a stored drone detection with location and metadata
 type Detection struct {
-	ID              int64                  `json:"id"`
-	Timestamp       time.Time              `json:"timestamp"`
-	Latitude        *float64               `json:"latitude,omitempty"`
-	Longitude       *float64               `json:"longitude,omitempty"`
-	IsDrone         bool                   `json:"isDrone"`
-	PrimaryType     string                 `json:"primaryType,omitempty"`
-	PrimaryLabel    string                 `json:"primaryLabel,omitempty"`
-	PrimaryCategory string                 `json:"primaryCategory,omitempty"`
-	Confidence      float64                `json:"confidence"`
-	SNRDb           float64                `json:"snrDb,omitempty"`
-	LatencyMs       float64                `json:"latencyMs"`
-	Predictions     json.RawMessage        `json:"predictions"` // Store as JSON
-	Metadata        map[string]interface{} `json:"metadata,omitempty"`
-	CountryOfOrigin string                 `json:"countryOfOrigin,omitempty"`
-	RecordingPath   string                 `json:"recordingPath,omitempty"`
+	ID               int64                  `json:"id"`
+	Timestamp        time.Time              `json:"timestamp"`
+	Latitude         *float64               `json:"latitude,omitempty"`
+	Longitude        *float64               `json:"longitude,omitempty"`
+	IsDrone          bool                   `json:"isDrone"`
+	PrimaryType      string                 `json:"primaryType,omitempty"`
+	PrimaryLabel     string                 `json:"primaryLabel,omitempty"`
+	PrimaryCategory  string                 `json:"primaryCategory,omitempty"`
+	Confidence       float64                `json:"confidence"`
+	SNRDb            float64                `json:"snrDb,omitempty"`
+	LatencyMs        float64                `json:"latencyMs"`
+	Predictions      json.RawMessage        `json:"predictions"` // Store as JSON
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	CountryOfOrigin  string                 `json:"countryOfOrigin,omitempty"`
+	RecordingPath    string                 `json:"recordingPath,omitempty"`
+	RecordingHash    string                 `json:"recordingHash,omitempty"`    // SHA-256 of the analysed WAV, survives renames
+	ModelFingerprint string                 `json:"modelFingerprint,omitempty"` // Fingerprint of the model that made the call
+	Feedback         *DetectionFeedback     `json:"feedback,omitempty"`
+	Timeline         json.RawMessage        `json:"timeline,omitempty"` // Compact per-window predictions, kept when DRONE_STORE_TIMELINE is set
+}
+
+// DetectionFeedback is an operator's correction of a detection, used to improve the model
+type DetectionFeedback struct {
+	CorrectLabel string    `json:"correctLabel,omitempty"`
+	IsDrone      *bool     `json:"isDrone,omitempty"`
+	SubmittedAt  time.Time `json:"submittedAt"`
+	CandidateID  string    `json:"candidateId,omitempty"` // Prototype candidate queued for review
+}
+
+// BoundingBox is a map viewport in degrees. A MinLon greater than MaxLon describes a box
+// crossing the antimeridian, e.g. from 170 east to 170 west.
+type BoundingBox struct {
+	MinLat float64 `json:"minLat"`
+	MinLon float64 `json:"minLon"`
+	MaxLat float64 `json:"maxLat"`
+	MaxLon float64 `json:"maxLon"`
+}
+
+// CrossesAntimeridian reports whether the box wraps from 180 to -180 longitude.
+func (b BoundingBox) CrossesAntimeridian() bool {
+	return b.MinLon > b.MaxLon
+}
+
+// Contains reports whether lat/lon lies inside the box, edges included.
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.CrossesAntimeridian() {
+		return lon >= b.MinLon || lon <= b.MaxLon
+	}
+	return lon >= b.MinLon && lon <= b.MaxLon
 }
@@ -0,0 +1,116 @@
+package shazam
+
+// Short-Time Fourier Transform with Overlap-Add Reconstruction
+//
+// Spectrogram only analyses audio. Processing that edits a spectrum and turns it back
+// into audio, such as noise reduction, also needs the inverse, and cutting the signal
+// into frames naively leaves audible seams at the frame edges that show up as
+// spurious spectral features downstream.
+//
+// STFT and ISTFT avoid that with weighted overlap-add:
+//
+// 1. Analysis (STFT):
+//    - Frames of frameSize samples start every hop samples
+//    - The first frame starts frameSize-hop samples before the signal (zero padded),
+//      so every sample lies under the same number of frames
+//    - Each frame is multiplied by a periodic Hann window before its FFT
+//
+// 2. Synthesis (ISTFT):
+//    - Each (possibly modified) spectrum is inverse transformed
+//    - The frame is multiplied by the Hann window again, which fades out any edit
+//      smoothly at the frame edges
+//    - Frames are added back at their positions and each sample is divided by the sum
+//      of the squared windows covering it
+//
+// With unmodified spectra this reconstructs the input exactly, up to rounding, for any
+// hop up to frameSize/2.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// ErrInvalidFrame is returned for a frame size that is not a power of two or a hop
+// outside 1..frameSize/2.
+var ErrInvalidFrame = errors.New("invalid STFT frame")
+
+// STFT returns the spectrum of every Hann-windowed frame of samples, frameSize samples
+// long and hop samples apart. frameSize must be a power of two.
+func STFT(samples []float64, frameSize, hop int) ([][]complex128, error) {
+	if err := checkFrame(frameSize, hop); err != nil {
+		return nil, err
+	}
+
+	window := hannWindow(frameSize)
+	var frames [][]complex128
+	buffer := make([]float64, frameSize)
+	for start := hop - frameSize; start < len(samples); start += hop {
+		for i := range buffer {
+			buffer[i] = 0
+			if position := start + i; position >= 0 && position < len(samples) {
+				buffer[i] = samples[position] * window[i]
+			}
+		}
+		frames = append(frames, FFT(buffer))
+	}
+	return frames, nil
+}
+
+// ISTFT reconstructs length samples from frames produced by STFT with the same
+// frameSize and hop, overlap-adding the inverse transform of each frame.
+func ISTFT(frames [][]complex128, frameSize, hop, length int) ([]float64, error) {
+	if err := checkFrame(frameSize, hop); err != nil {
+		return nil, err
+	}
+
+	window := hannWindow(frameSize)
+	output := make([]float64, length)
+	weights := make([]float64, length)
+	conjugate := make([]complex128, frameSize)
+	for f, spectrum := range frames {
+		if len(spectrum) != frameSize {
+			return nil, fmt.Errorf("%w: frame %d has %d bins, want %d", ErrInvalidFrame, f, len(spectrum), frameSize)
+		}
+		// IFFT(X) = conj(FFT(conj(X))) / N, and only the real part is kept
+		for k, value := range spectrum {
+			conjugate[k] = cmplx.Conj(value)
+		}
+		frame := recursiveFFT(conjugate)
+
+		start := hop - frameSize + f*hop
+		for i := range frame {
+			if position := start + i; position >= 0 && position < length {
+				output[position] += real(frame[i]) / float64(frameSize) * window[i]
+				weights[position] += window[i] * window[i]
+			}
+		}
+	}
+
+	for i := range output {
+		if weights[i] > 1e-9 {
+			output[i] /= weights[i]
+		}
+	}
+	return output, nil
+}
+
+func checkFrame(frameSize, hop int) error {
+	if frameSize < 2 || frameSize&(frameSize-1) != 0 {
+		return fmt.Errorf("%w: frame size %d is not a power of two", ErrInvalidFrame, frameSize)
+	}
+	if hop < 1 || hop > frameSize/2 {
+		return fmt.Errorf("%w: hop %d must be between 1 and %d", ErrInvalidFrame, hop, frameSize/2)
+	}
+	return nil
+}
+
+// hannWindow returns a periodic Hann window, whose overlapping copies sum evenly.
+func hannWindow(size int) []float64 {
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(size)))
+	}
+	return window
+}
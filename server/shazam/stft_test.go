@@ -0,0 +1,44 @@
+package shazam
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestISTFTReconstructsSTFT(t *testing.T) {
+	// A chirp plus a transient, so every frame holds different content
+	samples := make([]float64, 5000)
+	for i := range samples {
+		time := float64(i) / 8000
+		samples[i] = 0.6*math.Sin(2*math.Pi*(200+900*time)*time) + 0.2*math.Sin(2*math.Pi*1750*time)
+	}
+	samples[2345] += 0.9
+
+	for _, config := range []struct{ frameSize, hop int }{{256, 128}, {512, 128}, {1024, 256}} {
+		frames, err := STFT(samples, config.frameSize, config.hop)
+		if err != nil {
+			t.Fatalf("STFT(%d, %d) returned error: %v", config.frameSize, config.hop, err)
+		}
+		reconstructed, err := ISTFT(frames, config.frameSize, config.hop, len(samples))
+		if err != nil {
+			t.Fatalf("ISTFT(%d, %d) returned error: %v", config.frameSize, config.hop, err)
+		}
+
+		var worst float64
+		for i := range samples {
+			worst = math.Max(worst, math.Abs(reconstructed[i]-samples[i]))
+		}
+		if worst > 1e-9 {
+			t.Fatalf("frame %d hop %d: expected ISTFT(STFT(x)) to match x, worst error %g", config.frameSize, config.hop, worst)
+		}
+	}
+}
+
+func TestSTFTRejectsInvalidFrames(t *testing.T) {
+	for _, config := range []struct{ frameSize, hop int }{{300, 150}, {256, 0}, {256, 200}} {
+		if _, err := STFT(make([]float64, 1000), config.frameSize, config.hop); !errors.Is(err, ErrInvalidFrame) {
+			t.Fatalf("STFT(%d, %d): expected ErrInvalidFrame, got %v", config.frameSize, config.hop, err)
+		}
+	}
+}
@@ -3,39 +3,92 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
-	"strconv"
+	"sync"
 	"time"
 
+	"song-recognition/db"
 	"song-recognition/detections"
 	"song-recognition/drone"
-	"song-recognition/embedding"
 	"song-recognition/models"
 	"song-recognition/utils"
+	"song-recognition/wav"
 
 	socketio "github.com/googollee/go-socket.io"
 	"github.com/mdobak/go-xerrors"
 )
 
 type socketController struct {
-	classifier        *drone.Classifier
-	templateMatcher   *drone.TemplateMatcher
-	persistRecordings bool
+	registry     *modelRegistry
+	classify     recordingPipeline // newRecording runs the same pipeline as HTTP and gRPC
+	extractor    drone.FeatureExtractor
+	noiseFloor   *drone.NoiseFloorTracker
+	calibrations *drone.NoiseCalibrationStore
+	detections   detections.DetectionStore
+
+	smoothersMu sync.Mutex
+	smoothers   map[string]*drone.DetectionSmoother // by socket ID
+
+	streamsMu sync.Mutex
+	streams   map[string]*audioStream // by socket ID
 }
 
 const (
-	socketSlidingWindowDurationSeconds  = 3.0
-	socketSlidingWindowOverlapSeconds   = 1.5
-	socketMinSlidingAnalysisDurationSec = 4.0
+	socketSlidingWindowDurationSeconds = 3.0
+	socketSlidingWindowOverlapSeconds  = 1.5
 )
 
-func newSocketController(classifier *drone.Classifier, matcher *drone.TemplateMatcher, persist bool) *socketController {
-	return &socketController{classifier: classifier, templateMatcher: matcher, persistRecordings: persist}
+func newSocketController(registry *modelRegistry, extractor drone.FeatureExtractor, matcher *drone.TemplateMatcher, persist bool, noiseFloor *drone.NoiseFloorTracker, calibrations *drone.NoiseCalibrationStore, store detections.DetectionStore) *socketController {
+	return &socketController{registry: registry, classify: newRecordingPipeline(registry, extractor, matcher, persist, noiseFloor, calibrations),
+		extractor: extractor, noiseFloor: noiseFloor, calibrations: calibrations, detections: store, smoothers: make(map[string]*drone.DetectionSmoother), streams: make(map[string]*audioStream)}
+}
+
+// newDetectionStoreFromEnv returns the SQLite database at DRONE_DB_PATH when it is set,
+// and the detections JSON file otherwise.
+func newDetectionStoreFromEnv() (detections.DetectionStore, error) {
+	path := utils.GetEnv("DRONE_DB_PATH", "")
+	if path == "" {
+		return detections.JSONStore{}, nil
+	}
+	client, err := db.NewSQLiteClient(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open detections database %s: %w", path, err)
+	}
+	return client, nil
+}
+
+// smoother returns the detection smoother of a client, creating it with settings on its
+// first recording, or nil when smoothing is disabled.
+func (c *socketController) smoother(socketID string, settings detectionSettings) *drone.DetectionSmoother {
+	if settings.SmoothingWindow <= 0 {
+		return nil
+	}
+	c.smoothersMu.Lock()
+	defer c.smoothersMu.Unlock()
+	smoother, ok := c.smoothers[socketID]
+	if !ok {
+		smoother = drone.NewDetectionSmoother(settings.SmoothingWindow, settings.SmoothingAgreement)
+		c.smoothers[socketID] = smoother
+	}
+	return smoother
+}
+
+// handleDisconnect drops the client's detection smoother and audio stream.
+func (c *socketController) handleDisconnect(socketID string) {
+	c.smoothersMu.Lock()
+	delete(c.smoothers, socketID)
+	c.smoothersMu.Unlock()
+
+	c.streamsMu.Lock()
+	delete(c.streams, socketID)
+	c.streamsMu.Unlock()
 }
 
 func (c *socketController) emitModelInfo(socket socketio.Conn) {
-	stats := c.classifier.Stats()
+	stats := c.registry.defaultClassifier().Stats()
 	socket.Emit("modelInfo", stats)
 }
 
@@ -55,7 +108,13 @@ func (c *socketController) handleNewRecording(socket socketio.Conn, recordData s
 
 	if recordData == "" {
 		logger.ErrorContext(ctx, "no data received in newRecording event")
-		socket.Emit("analysisError", map[string]string{"message": "no audio data received"})
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeInvalidRequest, "no audio data received", nil))
+		return
+	}
+
+	if err := wav.CheckFFmpegAvailable(); err != nil {
+		logger.ErrorContext(ctx, "rejecting recording, audio tooling unavailable", slog.Any("error", err))
+		emitClassifyError(socket, drone.AsClassifyError(err))
 		return
 	}
 
@@ -63,7 +122,7 @@ func (c *socketController) handleNewRecording(socket socketio.Conn, recordData s
 	if err := json.Unmarshal([]byte(recordData), &recData); err != nil {
 		err := xerrors.New(err)
 		logger.ErrorContext(ctx, "failed to parse record payload", slog.Any("error", err))
-		socket.Emit("analysisError", map[string]string{"message": "invalid audio payload"})
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeInvalidRequest, "invalid audio payload", err))
 		return
 	}
 
@@ -75,222 +134,47 @@ func (c *socketController) handleNewRecording(socket socketio.Conn, recordData s
 		slog.Int("channels", recData.Channels),
 		slog.Int("sampleSize", recData.SampleSize),
 		slog.Float64("duration", recData.Duration),
+		slog.String("model", recData.Model),
 	)
 
-	started := time.Now()
-
-	log.Printf("[handleNewRecording] Preparing audio sample for socket %s\n", socket.ID())
-	audioSample, err := drone.PrepareAudioSample(recData, c.persistRecordings)
-	if err != nil {
-		err := xerrors.New(err)
-		logger.ErrorContext(ctx, "failed to prepare audio sample", slog.Any("error", err))
-		socket.Emit("analysisError", map[string]string{"message": "unable to decode audio"})
-		return
-	}
-
-	logger.InfoContext(ctx, "prepared audio sample",
-		slog.String("socketID", socket.ID()),
-		slog.Int("sampleRate", audioSample.SampleRate),
-		slog.Int("frameCount", len(audioSample.Samples)),
-		slog.Float64("duration", audioSample.Duration),
-		slog.Bool("persisted", audioSample.Persisted != ""),
-	)
-
-	// Extract features - use PANNS if available and prototypes are PANNS-based
-	var features []float64
-	usePANNS := utils.GetEnv("USE_PANNS_EMBEDDINGS", "true") == "true"
-
-	if usePANNS && audioSample.Persisted != "" {
-		// Use PANNS embedding service
-		embeddingServiceURL := utils.GetEnv("EMBEDDING_SERVICE_URL", "http://localhost:5002")
-		pannsClient := embedding.NewPANNSClient(embeddingServiceURL)
-
-		// Call PANNS service to get embedding
-		embeddingVec, err := pannsClient.EmbedFile(audioSample.Persisted)
-		if err != nil {
-			logger.WarnContext(ctx, "PANNS embedding failed, falling back to legacy features",
-				slog.String("socketID", socket.ID()),
-				slog.Any("error", err))
-			// Fall back to old feature extraction
-			features, err = drone.ExtractFeatureVector(audioSample.Samples, audioSample.SampleRate)
-			if err != nil {
-				err := xerrors.New(err)
-				logger.ErrorContext(ctx, "failed to extract features", slog.Any("error", err))
-				socket.Emit("analysisError", map[string]string{"message": "unable to extract features"})
-				return
-			}
-		} else {
-			features = embeddingVec
-			logger.InfoContext(ctx, "extracted PANNS embedding",
-				slog.String("socketID", socket.ID()),
-				slog.Int("dimension", len(features)),
-			)
-		}
-	} else {
-		// Use legacy feature extraction
-		features, err = drone.ExtractFeatureVector(audioSample.Samples, audioSample.SampleRate)
-		if err != nil {
-			err := xerrors.New(err)
-			logger.ErrorContext(ctx, "failed to extract features", slog.Any("error", err))
-			socket.Emit("analysisError", map[string]string{"message": "unable to extract features"})
-			return
-		}
-		logger.InfoContext(ctx, "extracted legacy feature vector",
-			slog.String("socketID", socket.ID()),
-			slog.Int("length", len(features)),
-		)
-	}
-
 	log.Printf("[handleNewRecording] Running classifier for socket %s\n", socket.ID())
-
-	var predictions []drone.Prediction
-	var templatePredictions []drone.Prediction
-	var windowSummaries []drone.WindowPrediction
-
-	// Sliding windows are incompatible with PANNS embeddings (which are for entire files)
-	// Only use sliding windows for legacy feature extraction
-	useSliding := audioSample.Duration >= socketMinSlidingAnalysisDurationSec && len(features) != 2048
-	if useSliding {
-		windowPredictions, windows, err := c.classifier.PredictWithSlidingWindows(
-			audioSample.Samples,
-			audioSample.SampleRate,
-			socketSlidingWindowDurationSeconds,
-			socketSlidingWindowOverlapSeconds,
-		)
-		if err != nil {
-			logger.WarnContext(ctx, "sliding window analysis failed, falling back to single-pass",
-				slog.String("socketID", socket.ID()),
-				slog.Any("error", err),
-			)
-		} else {
-			if len(windowPredictions) > 0 {
-				predictions = windowPredictions
-			}
-			windowSummaries = windows
-			logger.InfoContext(ctx, "applied sliding window analysis",
-				slog.String("socketID", socket.ID()),
-				slog.Int("windowCount", len(windowSummaries)),
-			)
-		}
-	}
-
-	if len(predictions) == 0 {
-		var err error
-		predictions, err = c.classifier.Predict(features)
-		if err != nil {
-			err := xerrors.New(err)
-			log.Printf("[handleNewRecording] Classifier error for socket %s: %v\n", socket.ID(), err)
-			logger.ErrorContext(ctx, "failed to run classifier", slog.Any("error", err))
-			socket.Emit("analysisError", map[string]string{"message": "classifier error"})
-			return
-		}
-	}
-
-	if c.templateMatcher != nil {
-		templatePredictions = c.templateMatcher.Predict(features)
-		if len(templatePredictions) > 0 {
-			predictions = drone.MergePredictions(predictions, templatePredictions)
-		}
+	summary, err := c.classify(ctx, recData, recData.Model, drone.DefaultPreprocessingConfig())
+	if errors.Is(err, drone.ErrEmptyModel) {
+		socket.Emit("classification", summary)
+		return
 	}
-
-	latency := time.Since(started).Seconds() * 1000
-
-	// Get base threshold from environment or use default
-	baseThresholdStr := utils.GetEnv("DRONE_CONFIDENCE_THRESHOLD", "0.55")
-	baseThreshold, err := strconv.ParseFloat(baseThresholdStr, 64)
 	if err != nil {
-		baseThreshold = 0.55 // Default
-	}
-
-	// Use adaptive threshold based on SNR
-	adjustedThreshold := baseThreshold
-	if audioSample.SNRDb != 0.0 {
-		adjustedThreshold = drone.AdaptiveThreshold(baseThreshold, audioSample.SNRDb)
+		log.Printf("[handleNewRecording] Classifier error for socket %s: %v\n", socket.ID(), err)
+		emitClassifyError(socket, drone.AsClassifyError(err))
+		return
 	}
 
-	isDrone := drone.DetermineDroneLikelyWithSNR(predictions, baseThreshold, audioSample.SNRDb)
-	log.Printf("[handleNewRecording] Classification complete for socket %s: isDrone=%v, predictions=%d\n",
-		socket.ID(), isDrone, len(predictions))
-
-	if len(predictions) > 0 {
-		best := predictions[0]
-		logger.InfoContext(ctx, "classification complete",
-			slog.String("socketID", socket.ID()),
-			slog.Float64("latency_ms", latency),
-			slog.Bool("isDrone", isDrone),
-			slog.String("label", best.Label),
-			slog.String("type", best.Type),
-			slog.String("category", best.Category),
-			slog.Float64("confidence", best.Confidence),
-			slog.Int("support", best.Support),
-		)
-	} else {
-		logger.InfoContext(ctx, "classification complete",
-			slog.String("socketID", socket.ID()),
-			slog.Float64("latency_ms", latency),
-			slog.Bool("isDrone", isDrone),
-			slog.String("label", ""),
-			slog.Float64("confidence", 0),
-		)
-	}
-	summary := drone.ClassificationSummary{
-		Predictions:       predictions,
-		IsDrone:           isDrone,
-		LatencyMs:         latency,
-		FeatureVector:     features,
-		SNRDb:             audioSample.SNRDb,
-		AdjustedThreshold: adjustedThreshold,
-		Windows:           windowSummaries,
-		Latitude:          recData.Latitude,
-		Longitude:         recData.Longitude,
-		RecordingPath:     audioSample.Persisted,
-		TemplatePreds:     templatePredictions,
-	}
+	settings := detectionSettingsFromEnv(c.registry)
 
-	if len(predictions) > 0 {
-		summary.PrimaryType = predictions[0].Type
+	// Rapid recordings from one client are debounced so a single mis-fire does not flip its state
+	if smoother := c.smoother(socket.ID(), settings); smoother != nil {
+		summary.StableLabel, summary.StableConfidence = smoother.Update(summary)
 	}
 
-	// Save detection if it has location and predictions
-	if summary.Latitude != nil && summary.Longitude != nil && len(summary.Predictions) > 0 {
-		predictionsJSON, err := json.Marshal(summary.Predictions)
-		if err == nil {
-			detection := &models.Detection{
-				Timestamp:     time.Now(),
-				Latitude:      summary.Latitude,
-				Longitude:     summary.Longitude,
-				IsDrone:       summary.IsDrone,
-				PrimaryType:   summary.PrimaryType,
-				Confidence:    summary.Predictions[0].Confidence,
-				SNRDb:         summary.SNRDb,
-				LatencyMs:     summary.LatencyMs,
-				Predictions:   json.RawMessage(predictionsJSON),
-				RecordingPath: summary.RecordingPath,
-			}
-			if len(summary.Predictions) > 0 {
-				detection.PrimaryLabel = summary.Predictions[0].Label
-				detection.PrimaryCategory = summary.Predictions[0].Category
-				if summary.Predictions[0].Metadata != nil {
-					if country, ok := summary.Predictions[0].Metadata["country_of_origin"]; ok {
-						detection.CountryOfOrigin = country
-					}
-				}
-			}
-			if err := detections.SaveDetection(detection); err != nil {
-				log.Printf("[Socket] Failed to save detection: %v\n", err)
-			} else {
-				log.Printf("[Socket] Detection saved successfully\n")
-			}
-		}
-	}
+	c.saveDetection(summary)
 
 	log.Printf("[handleNewRecording] Preparing to emit classification for socket %s\n", socket.ID())
 	logger.InfoContext(ctx, "emitting classification result",
 		slog.String("socketID", socket.ID()),
-		slog.Int("predictionCount", len(predictions)),
-		slog.Bool("isDrone", isDrone),
+		slog.Int("predictionCount", len(summary.Predictions)),
+		slog.Bool("isDrone", summary.IsDrone),
 	)
 
+	// Decisions and the saved detection used every label; clients may only want the strongest few
+	summary.Predictions = drone.TopPredictions(summary.Predictions, settings.TopN)
+
+	if utils.GetEnv("DRONE_VERBOSE_RESPONSES", "true") != "true" {
+		summary.Windows = nil
+		summary.FeatureVector = nil
+	} else if utils.GetEnv("DRONE_WINDOW_DETAIL", "compact") != "full" {
+		summary.Windows = drone.CompactWindows(summary.Windows)
+	}
+
 	// Emit classification result
 	socket.Emit("classification", summary)
 	log.Printf("[handleNewRecording] Emitted classification for socket %s\n", socket.ID())
@@ -298,3 +182,46 @@ func (c *socketController) handleNewRecording(socket socketio.Conn, recordData s
 		slog.String("socketID", socket.ID()),
 	)
 }
+
+// saveDetection stores a located classification with predictions as a detection;
+// anything else is not saved. Failures are logged.
+func (c *socketController) saveDetection(summary drone.ClassificationSummary) {
+	if summary.Latitude == nil || summary.Longitude == nil || len(summary.Predictions) == 0 {
+		return
+	}
+	predictionsJSON, err := json.Marshal(summary.Predictions)
+	if err != nil {
+		log.Printf("[Socket] Failed to save detection: %v\n", err)
+		return
+	}
+
+	top := summary.Predictions[0]
+	detection := &models.Detection{
+		Timestamp:        time.Now(),
+		Latitude:         summary.Latitude,
+		Longitude:        summary.Longitude,
+		IsDrone:          summary.IsDrone,
+		PrimaryType:      summary.PrimaryType,
+		PrimaryLabel:     top.Label,
+		PrimaryCategory:  top.Category,
+		Confidence:       top.Confidence,
+		SNRDb:            summary.SNRDb,
+		LatencyMs:        summary.LatencyMs,
+		Predictions:      json.RawMessage(predictionsJSON),
+		CountryOfOrigin:  top.Metadata["country_of_origin"],
+		RecordingPath:    summary.RecordingPath,
+		RecordingHash:    summary.RecordingHash,
+		ModelFingerprint: summary.ModelFingerprint,
+	}
+	// The window timeline lets long clips be replayed, at the cost of a larger record
+	if utils.GetEnv("DRONE_STORE_TIMELINE", "false") == "true" && len(summary.Windows) > 0 {
+		if timeline, err := json.Marshal(drone.CompactWindows(summary.Windows)); err == nil {
+			detection.Timeline = timeline
+		}
+	}
+	if err := c.detections.StoreDetection(detection); err != nil {
+		log.Printf("[Socket] Failed to save detection: %v\n", err)
+	} else {
+		log.Printf("[Socket] Detection saved successfully\n")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"song-recognition/drone"
+	"song-recognition/models"
+	"song-recognition/utils"
+	"song-recognition/wav"
+)
+
+// Streaming Classification
+//
+// The streamAudio socket event carries one chunk of raw little-endian 16-bit PCM in the
+// same JSON envelope as newRecording (audio, sampleRate, channels, sampleSize, model and
+// location). Chunks are appended to a per-socket stream that is cut into the socket's
+// overlapping 3 s windows, and every completed window is classified on its own and
+// emitted as a classification event, so a client monitoring continuously gets a result
+// every 1.5 s without uploading whole recordings. When a window finds a drone after one
+// that did not, a detection event carries that window's summary and the detection is
+// saved like a located newRecording one. A chunk with a different format or model
+// starts a new stream; the stream is dropped when the socket disconnects.
+
+// socketEmitter is the part of socketio.Conn the stream handler uses.
+type socketEmitter interface {
+	ID() string
+	Emit(event string, v ...interface{})
+}
+
+// audioStream is one socket's stream session, whose chunks are handled one at a time.
+type audioStream struct {
+	mu      sync.Mutex
+	session *drone.StreamSession
+}
+
+// stream returns the socket's stream for chunk, starting a new one when the socket has
+// none or the chunk's format or model changed.
+func (c *socketController) stream(socketID string, chunk models.RecordData) (*audioStream, error) {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	if stream, ok := c.streams[socketID]; ok && stream.session.Continues(chunk.SampleRate, chunk.Channels, chunk.Model) {
+		return stream, nil
+	}
+	session, err := drone.NewStreamSession(chunk.SampleRate, chunk.Channels, chunk.Model,
+		socketSlidingWindowDurationSeconds, socketSlidingWindowOverlapSeconds)
+	if err != nil {
+		return nil, err
+	}
+	stream := &audioStream{session: session}
+	c.streams[socketID] = stream
+	return stream, nil
+}
+
+// decodeStreamChunk returns the mono samples of a streamAudio chunk, averaging
+// interleaved channels.
+func decodeStreamChunk(chunk models.RecordData) ([]float64, error) {
+	if chunk.SampleSize != 0 && chunk.SampleSize != 16 {
+		return nil, fmt.Errorf("unsupported sample size %d: stream chunks must be 16-bit PCM", chunk.SampleSize)
+	}
+	if chunk.Channels < 1 {
+		return nil, fmt.Errorf("invalid channel count %d", chunk.Channels)
+	}
+	pcm, err := base64.StdEncoding.DecodeString(chunk.Audio)
+	if err != nil {
+		return nil, fmt.Errorf("audio is not valid base64: %w", err)
+	}
+	if len(pcm)%(2*chunk.Channels) != 0 {
+		return nil, fmt.Errorf("chunk of %d bytes is not a whole number of %d-channel frames", len(pcm), chunk.Channels)
+	}
+	interleaved, err := wav.WavBytesToSamples(pcm)
+	if err != nil {
+		return nil, err
+	}
+	if chunk.Channels == 1 {
+		return interleaved, nil
+	}
+	mono := make([]float64, len(interleaved)/chunk.Channels)
+	for i := range mono {
+		var sum float64
+		for _, sample := range interleaved[i*chunk.Channels : (i+1)*chunk.Channels] {
+			sum += sample
+		}
+		mono[i] = sum / float64(chunk.Channels)
+	}
+	return mono, nil
+}
+
+// emitClassifyError reports a failed classification to the socket as an analysisError
+// event carrying the same JSON body as the HTTP error response.
+func emitClassifyError(socket socketEmitter, err *drone.ClassifyError) {
+	socket.Emit("analysisError", err)
+}
+
+func (c *socketController) handleStreamAudio(socket socketEmitter, msg string) {
+	logger := utils.GetLogger()
+	ctx := context.Background()
+
+	var chunk models.RecordData
+	if err := json.Unmarshal([]byte(msg), &chunk); err != nil {
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeInvalidRequest, "invalid audio payload", err))
+		return
+	}
+	samples, err := decodeStreamChunk(chunk)
+	if err != nil {
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeAudioUndecodable, err.Error(), err))
+		return
+	}
+	if !c.extractor.SupportsSlidingWindows() {
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeStreamingUnsupported,
+			"streaming needs per-window features, which the configured feature extractor does not provide", nil))
+		return
+	}
+	classifier, modelName, err := c.registry.resolve(chunk.Model)
+	if err != nil {
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeModelNotFound, err.Error(), err))
+		return
+	}
+	stream, err := c.stream(socket.ID(), chunk)
+	if err != nil {
+		emitClassifyError(socket, drone.NewClassifyError(drone.CodeInvalidRequest, err.Error(), err))
+		return
+	}
+
+	settings := detectionSettingsFromEnv(c.registry)
+
+	// Chunks of one socket are windowed and emitted in the order they arrive
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	for _, window := range stream.session.Push(samples) {
+		summary, err := c.classifyStreamWindow(classifier, modelName, settings, chunk, window)
+		if errors.Is(err, drone.ErrEmptyModel) {
+			socket.Emit("classification", summary)
+			continue
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to classify stream window",
+				slog.String("socketID", socket.ID()),
+				slog.Int("window", window.Index),
+				slog.Any("error", err),
+			)
+			emitClassifyError(socket, drone.AsClassifyError(err))
+			continue
+		}
+		if smoother := c.smoother(socket.ID(), settings); smoother != nil {
+			summary.StableLabel, summary.StableConfidence = smoother.Update(summary)
+		}
+		detected := stream.session.Observe(summary.IsDrone)
+		if detected {
+			c.saveDetection(summary)
+		}
+
+		// Decisions and the saved detection used every label; clients may only want the strongest few
+		summary.Predictions = drone.TopPredictions(summary.Predictions, settings.TopN)
+		socket.Emit("classification", summary)
+		if detected {
+			socket.Emit("detection", summary)
+		}
+	}
+}
+
+// classifyStreamWindow classifies one completed stream window with the same window
+// analysis, thresholds and decision rules as a recording, including the location's
+// calibration and learned noise floor. Templates and the two-stage screen are not
+// applied to stream windows. The summary keeps every prediction; callers trim it for
+// clients.
+func (c *socketController) classifyStreamWindow(classifier *drone.Classifier, modelName string, settings detectionSettings, chunk models.RecordData, window drone.StreamWindow) (drone.ClassificationSummary, error) {
+	started := time.Now()
+	preprocessing := drone.DefaultPreprocessingConfig()
+
+	snrDb := preprocessing.EstimateSNR(window.Samples, chunk.SampleRate)
+	quality := drone.AssessAudioQuality(window.Samples, chunk.SampleRate)
+	processed := drone.PreprocessAudio(window.Samples, chunk.SampleRate, preprocessing)
+
+	// The window is exactly one analysis window, so this yields a single window result
+	predictions, windows, err := classifier.PredictWithSlidingWindows(processed, chunk.SampleRate,
+		socketSlidingWindowDurationSeconds, socketSlidingWindowOverlapSeconds)
+	if errors.Is(err, drone.ErrEmptyModel) {
+		return drone.ClassificationSummary{
+			Predictions: []drone.Prediction{},
+			LatencyMs:   time.Since(started).Seconds() * 1000,
+			Latitude:    chunk.Latitude,
+			Longitude:   chunk.Longitude,
+			Model:       modelName,
+			ModelEmpty:  true,
+			Code:        drone.CodeModelEmpty,
+			Reason:      drone.ReasonEmptyModel,
+		}, err
+	}
+	if err != nil {
+		return drone.ClassificationSummary{}, err
+	}
+	for i := range windows {
+		windows[i].Index = window.Index
+		windows[i].Start += window.Start
+		windows[i].End += window.Start
+	}
+
+	decision := decideDrone(classifier, settings, predictions, snrDb, drone.SignalLevelDb(window.Samples),
+		chunk.Latitude, chunk.Longitude, c.noiseFloor, c.calibrations)
+
+	droneConfidence, noiseConfidence := drone.CategoryConfidences(predictions)
+	droneConfidence = classifier.CalibrateDroneConfidence(droneConfidence)
+	summary := drone.ClassificationSummary{
+		Predictions:        predictions,
+		IsDrone:            decision.isDrone,
+		Ambiguous:          decision.ambiguous,
+		DroneConfidence:    droneConfidence,
+		NoiseConfidence:    noiseConfidence,
+		LowDataMode:        decision.lowDataMode,
+		LatencyMs:          time.Since(started).Seconds() * 1000,
+		SNRDb:              snrDb,
+		AdjustedThreshold:  decision.adjustedThreshold,
+		CalibratedSNRDb:    decision.calibratedSNR,
+		Quality:            &quality,
+		AnalyzedSampleRate: chunk.SampleRate,
+		AnalyzedChannels:   1,
+		Windows:            drone.CompactWindows(windows),
+		WindowCount:        len(windows),
+		Latitude:           chunk.Latitude,
+		Longitude:          chunk.Longitude,
+		Model:              modelName,
+		ModelFingerprint:   classifier.Fingerprint(),
+	}
+	if len(predictions) > 0 {
+		summary.PrimaryType = predictions[0].Type
+	}
+	summary.ExplainOutcome()
+	recordClassificationMetrics(summary)
+	return summary, nil
+}
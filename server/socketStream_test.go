@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"song-recognition/detections"
+	"song-recognition/drone"
+	"song-recognition/models"
+)
+
+// recordingSocket is a socketEmitter that keeps what was emitted.
+type recordingSocket struct {
+	id     string
+	mu     sync.Mutex
+	events []string
+	values []interface{}
+}
+
+func (s *recordingSocket) ID() string { return s.id }
+
+func (s *recordingSocket) Emit(event string, v ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	s.values = append(s.values, v[0])
+}
+
+func TestStreamAudioEmitsClassificationPerWindow(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	writeTestModel(t, modelPath, "alpha", "beta")
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+	controller := newSocketController(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, nil, detections.JSONStore{})
+	socket := &recordingSocket{id: "stream-1"}
+
+	// Twelve half-second chunks make six seconds of audio
+	for range 12 {
+		msg, err := json.Marshal(models.RecordData{
+			Audio:      base64.StdEncoding.EncodeToString(testTonePCM(440, 0.5)),
+			SampleRate: testSampleRate,
+			Channels:   1,
+			SampleSize: 16,
+		})
+		if err != nil {
+			t.Fatalf("failed to encode chunk: %v", err)
+		}
+		controller.handleStreamAudio(socket, string(msg))
+	}
+
+	var starts []float64
+	for i, event := range socket.events {
+		if event != "classification" {
+			t.Fatalf("expected only classification events, got %s: %v", event, socket.values[i])
+		}
+		summary := socket.values[i].(drone.ClassificationSummary)
+		if len(summary.Windows) != 1 {
+			t.Fatalf("expected one window per emission, got %d", len(summary.Windows))
+		}
+		starts = append(starts, summary.Windows[0].Start)
+	}
+	if len(starts) < 2 {
+		t.Fatalf("expected at least two window emissions for 6 s of audio, got %d", len(starts))
+	}
+	for i := 1; i < len(starts); i++ {
+		if starts[i] <= starts[i-1] {
+			t.Fatalf("expected windows to advance through the stream, got starts %v", starts)
+		}
+	}
+
+	controller.handleDisconnect(socket.ID())
+	if _, ok := controller.streams[socket.ID()]; ok {
+		t.Fatal("expected disconnect to drop the socket's stream")
+	}
+}
+
+func TestStreamAudioDetectsDroneAcrossChunkBoundaries(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_PANNS_EMBEDDINGS", "false")
+	t.Setenv("DRONE_MIN_PROTOTYPES", "0")
+	t.Setenv("DRONE_TOP_N", "1")
+
+	// A faint 3 kHz background throughout, with a 180 Hz rotor tone from 3.25 s to
+	// 8.25 s, so it starts and stops mid-chunk
+	const droneFrom, droneTo = 3.25, 8.25
+	render := func(from, to float64, droneAt func(at float64) bool) []float64 {
+		samples := make([]float64, int((to-from)*testSampleRate))
+		for i := range samples {
+			at := from + float64(i)/testSampleRate
+			samples[i] = 0.05 * math.Sin(2*math.Pi*3000*at)
+			if droneAt(at) {
+				samples[i] += 0.5 * math.Sin(2*math.Pi*180*at)
+			}
+		}
+		return samples
+	}
+
+	// Prototypes from whole windows of each sound, prepared like the stream's windows
+	prototype := func(label, category string, withDrone bool) drone.Prototype {
+		t.Helper()
+		samples := render(0, socketSlidingWindowDurationSeconds, func(float64) bool { return withDrone })
+		processed := drone.PreprocessAudio(samples, testSampleRate, drone.DefaultPreprocessingConfig())
+		features, err := drone.ExtractFeatureVector(processed, testSampleRate)
+		if err != nil {
+			t.Fatalf("failed to extract %s features: %v", label, err)
+		}
+		return drone.Prototype{ID: label + "_1", Label: label, Category: category, Features: features}
+	}
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+	data, err := json.Marshal([]drone.Prototype{prototype("quad", "drone", true), prototype("wind", "noise", false)})
+	if err != nil {
+		t.Fatalf("failed to marshal model: %v", err)
+	}
+	if err := os.WriteFile(modelPath, data, 0644); err != nil {
+		t.Fatalf("failed to write model: %v", err)
+	}
+	classifier, err := drone.NewClassifierFromFile(modelPath, 2)
+	if err != nil {
+		t.Fatalf("failed to load model: %v", err)
+	}
+
+	// The site is calibrated on its background, which streams must pick up like recordings
+	lat, lon := 51.5, -0.12
+	calibrations := drone.NewNoiseCalibrationStore()
+	background := render(0, socketSlidingWindowDurationSeconds, func(float64) bool { return false })
+	calibrations.Calibrate(drone.LocationKey(&lat, &lon), &drone.AudioSample{LevelDb: drone.SignalLevelDb(background)}, time.Now())
+
+	controller := newSocketController(newModelRegistry(classifier), drone.NewLegacyExtractor(), nil, false, nil, calibrations, detections.JSONStore{})
+	socket := &recordingSocket{id: "stream-2"}
+
+	const chunkSeconds = 0.5
+	for from := 0.0; from < 12; from += chunkSeconds {
+		samples := render(from, from+chunkSeconds, func(at float64) bool { return at >= droneFrom && at < droneTo })
+		pcm := make([]byte, 2*len(samples))
+		for i, sample := range samples {
+			binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(sample*32767)))
+		}
+		msg, err := json.Marshal(models.RecordData{
+			Audio:      base64.StdEncoding.EncodeToString(pcm),
+			SampleRate: testSampleRate,
+			Channels:   1,
+			SampleSize: 16,
+			Latitude:   &lat,
+			Longitude:  &lon,
+		})
+		if err != nil {
+			t.Fatalf("failed to encode chunk: %v", err)
+		}
+		controller.handleStreamAudio(socket, string(msg))
+	}
+
+	var detected []drone.WindowPrediction
+	var outcomes []bool
+	for i, event := range socket.events {
+		summary, ok := socket.values[i].(drone.ClassificationSummary)
+		if !ok {
+			t.Fatalf("expected summaries only, got %s: %v", event, socket.values[i])
+		}
+		if len(summary.Predictions) != 1 || summary.CalibratedSNRDb == 0 {
+			t.Fatalf("expected %s to carry the top prediction and the calibrated SNR, got %d predictions at %.2f dB",
+				event, len(summary.Predictions), summary.CalibratedSNRDb)
+		}
+		switch event {
+		case "classification":
+			outcomes = append(outcomes, summary.IsDrone)
+		case "detection":
+			detected = append(detected, summary.Windows[0])
+		}
+	}
+	if len(outcomes) == 0 || outcomes[0] || outcomes[len(outcomes)-1] {
+		t.Fatalf("expected the background-only windows at either end to be negative, got %v", outcomes)
+	}
+	// One drone, heard over several windows, is one detection
+	if len(detected) != 1 {
+		t.Fatalf("expected exactly one detection, got %d (window outcomes %v)", len(detected), outcomes)
+	}
+	if window := detected[0]; window.End <= droneFrom || window.Start >= droneTo {
+		t.Fatalf("expected the detection window to overlap the drone at %.2f-%.2f s, got %.2f-%.2f s",
+			droneFrom, droneTo, window.Start, window.End)
+	}
+
+	// Like a newRecording detection, the saved one keeps every label
+	stored, err := detections.LoadDetections()
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("expected the detection to be saved once, got %d (%v)", len(stored), err)
+	}
+	var saved []drone.Prediction
+	if err := json.Unmarshal(stored[0].Predictions, &saved); err != nil || len(saved) != 2 {
+		t.Fatalf("expected both labels in the saved detection, got %s", stored[0].Predictions)
+	}
+}
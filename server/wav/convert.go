@@ -1,7 +1,9 @@
 package wav
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -9,15 +11,49 @@ import (
 	"strings"
 )
 
+// ErrFFmpegUnavailable is returned when audio conversion is requested but FFmpeg
+// cannot be found. Callers can match it with errors.Is to report a tooling problem
+// instead of a generic decode failure.
+var ErrFFmpegUnavailable = errors.New("audio tooling unavailable: FFmpeg is not installed or not in PATH")
+
+// FFmpegRemediation explains how to install FFmpeg on common platforms.
+const FFmpegRemediation = "Please install FFmpeg:\n" +
+	"  Windows: choco install ffmpeg OR download from https://www.gyan.dev/ffmpeg/builds/\n" +
+	"  macOS: brew install ffmpeg\n" +
+	"  Linux: sudo apt-get install ffmpeg\n" +
+	"After installing, restart your terminal and verify with: ffmpeg -version"
+
+// CommandRunner locates and runs the external audio tools. It is swappable so
+// tests can simulate missing or misbehaving tooling.
+type CommandRunner interface {
+	LookPath(file string) (string, error)
+	CombinedOutput(name string, args ...string) ([]byte, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (execRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+var runner CommandRunner = execRunner{}
+
+// SetRunner replaces the command runner and returns a function restoring the previous one.
+func SetRunner(r CommandRunner) (restore func()) {
+	previous := runner
+	runner = r
+	return func() { runner = previous }
+}
+
 // CheckFFmpegAvailable checks if FFmpeg is available in PATH
 func CheckFFmpegAvailable() error {
-	_, err := exec.LookPath("ffmpeg")
+	_, err := runner.LookPath("ffmpeg")
 	if err != nil {
-		return fmt.Errorf("FFmpeg is not installed or not in PATH. Please install FFmpeg:\n" +
-			"  Windows: choco install ffmpeg OR download from https://www.gyan.dev/ffmpeg/builds/\n" +
-			"  macOS: brew install ffmpeg\n" +
-			"  Linux: sudo apt-get install ffmpeg\n" +
-			"After installing, restart your terminal and verify with: ffmpeg -version")
+		return fmt.Errorf("%w. %s", ErrFFmpegUnavailable, FFmpegRemediation)
 	}
 	return nil
 }
@@ -33,6 +69,21 @@ func ConvertToWAV(inputFilePath string, channels int) (wavFilePath string, err e
 		channels = 1
 	}
 
+	// Pick the demuxer from the file contents rather than trusting the extension.
+	// Unknown content is still handed to FFmpeg, which supports more formats than we sniff.
+	format, err := DetectFormat(inputFilePath)
+	if err != nil && !errors.Is(err, ErrUnknownFormat) {
+		return "", err
+	}
+	args := []string{"-y"}
+	if demuxer, ok := ffmpegDemuxers[format]; ok {
+		if expected := formatFromExtension(inputFilePath); expected != "" && expected != format {
+			log.Printf("[wav] %s has a %s extension but contains %s data; decoding as %s\n",
+				filepath.Base(inputFilePath), expected, format, format)
+		}
+		args = append(args, "-f", demuxer)
+	}
+
 	fileExt := filepath.Ext(inputFilePath)
 	outputFile := strings.TrimSuffix(inputFilePath, fileExt) + ".wav"
 
@@ -41,23 +92,20 @@ func ConvertToWAV(inputFilePath string, channels int) (wavFilePath string, err e
 	tmpFile := filepath.Join(filepath.Dir(outputFile), "tmp_"+filepath.Base(outputFile))
 	defer os.Remove(tmpFile)
 
-	cmd := exec.Command(
-		"ffmpeg",
-		"-y",
+	args = append(args,
 		"-i", inputFilePath,
 		"-c", "pcm_s16le",
 		"-ar", "44100",
 		"-ac", fmt.Sprint(channels),
 		tmpFile,
 	)
-
-	output, err := cmd.CombinedOutput()
+	output, err := runner.CombinedOutput("ffmpeg", args...)
 	if err != nil {
 		// Check if the error is due to FFmpeg not being found
-		if strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file") {
-			return "", fmt.Errorf("FFmpeg is not installed or not in PATH. Please install FFmpeg and restart your terminal. Error: %v", err)
+		if errors.Is(err, exec.ErrNotFound) || strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file") {
+			return "", fmt.Errorf("%w: %v", ErrFFmpegUnavailable, err)
 		}
-		return "", fmt.Errorf("failed to convert to WAV: %v, output %v", err, string(output))
+		return "", fmt.Errorf("failed to convert %s data to WAV: %v, output %v", format, err, string(output))
 	}
 
 	// Rename the temporary file to the output file
@@ -76,10 +124,18 @@ func ReformatWAV(inputFilePath string, channels int) (reformatedFilePath string,
 		channels = 1
 	}
 
+	format, err := DetectFormat(inputFilePath)
+	if err != nil {
+		return "", err
+	}
+	if format != FormatWAV {
+		return "", fmt.Errorf("%w: %s contains %s data, expected wav", ErrFormatMismatch, filepath.Base(inputFilePath), format)
+	}
+
 	fileExt := filepath.Ext(inputFilePath)
 	outputFile := strings.TrimSuffix(inputFilePath, fileExt) + "rfm.wav"
 
-	cmd := exec.Command(
+	output, err := runner.CombinedOutput(
 		"ffmpeg",
 		"-y",
 		"-i", inputFilePath,
@@ -88,12 +144,10 @@ func ReformatWAV(inputFilePath string, channels int) (reformatedFilePath string,
 		"-ac", fmt.Sprint(channels),
 		outputFile,
 	)
-
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		// Check if the error is due to FFmpeg not being found
-		if strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file") {
-			return "", fmt.Errorf("FFmpeg is not installed or not in PATH. Please install FFmpeg and restart your terminal. Error: %v", err)
+		if errors.Is(err, exec.ErrNotFound) || strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file") {
+			return "", fmt.Errorf("%w: %v", ErrFFmpegUnavailable, err)
 		}
 		return "", fmt.Errorf("failed to convert to WAV: %v, output %v", err, string(output))
 	}
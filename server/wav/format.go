@@ -0,0 +1,119 @@
+package wav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Audio container formats recognised by DetectFormat.
+const (
+	FormatWAV     = "wav"
+	FormatMP3     = "mp3"
+	FormatAAC     = "aac"
+	FormatFLAC    = "flac"
+	FormatOgg     = "ogg"
+	FormatMP4     = "mp4"
+	FormatWebM    = "webm"
+	FormatAIFF    = "aiff"
+	FormatUnknown = "unknown"
+)
+
+// ErrUnknownFormat is returned when a file's contents match no known audio signature.
+var ErrUnknownFormat = errors.New("unrecognised audio format")
+
+// ErrFormatMismatch is returned when a file's contents do not match the format the
+// caller (or the file extension) expects, e.g. an MP4 saved with a .wav extension.
+var ErrFormatMismatch = errors.New("audio format mismatch")
+
+// formatSniffLength is enough to cover every signature checked below.
+const formatSniffLength = 12
+
+// extensionFormats maps file extensions to the container they normally hold.
+var extensionFormats = map[string]string{
+	".wav":  FormatWAV,
+	".wave": FormatWAV,
+	".mp3":  FormatMP3,
+	".aac":  FormatAAC,
+	".flac": FormatFLAC,
+	".ogg":  FormatOgg,
+	".oga":  FormatOgg,
+	".opus": FormatOgg,
+	".mp4":  FormatMP4,
+	".m4a":  FormatMP4,
+	".webm": FormatWebM,
+	".mkv":  FormatWebM,
+	".aif":  FormatAIFF,
+	".aiff": FormatAIFF,
+}
+
+// ffmpegDemuxers maps detected formats to the FFmpeg demuxer that decodes them.
+var ffmpegDemuxers = map[string]string{
+	FormatWAV:  "wav",
+	FormatMP3:  "mp3",
+	FormatAAC:  "aac",
+	FormatFLAC: "flac",
+	FormatOgg:  "ogg",
+	FormatMP4:  "mov",
+	FormatWebM: "matroska",
+	FormatAIFF: "aiff",
+}
+
+// DetectFormat sniffs the magic bytes at the start of path and returns the audio
+// container it holds. The file extension is ignored. Unrecognised content returns
+// FormatUnknown with an error wrapping ErrUnknownFormat.
+func DetectFormat(path string) (format string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, formatSniffLength)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return FormatUnknown, fmt.Errorf("failed to read audio header: %w", err)
+	}
+
+	if format := sniffFormat(header[:n]); format != FormatUnknown {
+		return format, nil
+	}
+	return FormatUnknown, fmt.Errorf("%w: %s", ErrUnknownFormat, filepath.Base(path))
+}
+
+func sniffFormat(header []byte) string {
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return FormatWAV
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("FORM")) &&
+		(bytes.Equal(header[8:12], []byte("AIFF")) || bytes.Equal(header[8:12], []byte("AIFC"))):
+		return FormatAIFF
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return FormatMP4
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FormatFLAC
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return FormatOgg
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return FormatWebM
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return FormatMP3
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		// ADTS sync word with layer bits 00
+		return FormatAAC
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		// MPEG audio frame sync without an ID3 tag
+		return FormatMP3
+	}
+	return FormatUnknown
+}
+
+// formatFromExtension returns the format implied by path's extension, or "" if the
+// extension is not a known audio extension.
+func formatFromExtension(path string) string {
+	return extensionFormats[strings.ToLower(filepath.Ext(path))]
+}
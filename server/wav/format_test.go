@@ -0,0 +1,105 @@
+package wav
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// mp4Header is the start of an ISO base media file: a box size followed by "ftyp".
+var mp4Header = []byte{0x00, 0x00, 0x00, 0x20, 'f', 't', 'y', 'p', 'M', '4', 'A', ' ', 0x00, 0x00, 0x00, 0x00}
+
+func TestDetectFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	wavPath := filepath.Join(dir, "tone.wav")
+	if err := WriteWavFile(wavPath, make([]byte, 441*2), 44100, 1, 16); err != nil {
+		t.Fatalf("failed to write wav: %v", err)
+	}
+
+	mp3Path := filepath.Join(dir, "clip.mp3")
+	writeTestFile(t, mp3Path, append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), 0xFF, 0xFB, 0x90, 0x00))
+
+	rawMP3Path := filepath.Join(dir, "raw.mp3")
+	writeTestFile(t, rawMP3Path, []byte{0xFF, 0xFB, 0x90, 0x00, 0x00, 0x00})
+
+	mislabeledPath := filepath.Join(dir, "recording.wav")
+	writeTestFile(t, mislabeledPath, mp4Header)
+
+	for path, want := range map[string]string{
+		wavPath:        FormatWAV,
+		mp3Path:        FormatMP3,
+		rawMP3Path:     FormatMP3,
+		mislabeledPath: FormatMP4,
+	} {
+		got, err := DetectFormat(path)
+		if err != nil {
+			t.Fatalf("DetectFormat(%s) returned error: %v", filepath.Base(path), err)
+		}
+		if got != want {
+			t.Fatalf("DetectFormat(%s) = %s, want %s", filepath.Base(path), got, want)
+		}
+	}
+
+	textPath := filepath.Join(dir, "notes.wav")
+	writeTestFile(t, textPath, []byte("not audio at all"))
+	if format, err := DetectFormat(textPath); !errors.Is(err, ErrUnknownFormat) || format != FormatUnknown {
+		t.Fatalf("expected unknown format error, got %s, %v", format, err)
+	}
+}
+
+func TestReformatWAVRejectsMislabeledFile(t *testing.T) {
+	recorder := &recordingRunner{}
+	t.Cleanup(SetRunner(recorder))
+
+	path := filepath.Join(t.TempDir(), "recording.wav")
+	writeTestFile(t, path, mp4Header)
+
+	_, err := ReformatWAV(path, 1)
+	if !errors.Is(err, ErrFormatMismatch) {
+		t.Fatalf("expected ErrFormatMismatch, got %v", err)
+	}
+	if recorder.args != nil {
+		t.Fatalf("expected FFmpeg not to run for mislabeled input, got %v", recorder.args)
+	}
+}
+
+func TestConvertToWAVDecodesByContent(t *testing.T) {
+	recorder := &recordingRunner{}
+	t.Cleanup(SetRunner(recorder))
+
+	path := filepath.Join(t.TempDir(), "recording.wav")
+	writeTestFile(t, path, mp4Header)
+
+	if _, err := ConvertToWAV(path, 1); err != nil {
+		t.Fatalf("ConvertToWAV returned error: %v", err)
+	}
+	demuxer := slices.Index(recorder.args, "-f")
+	if demuxer < 0 || recorder.args[demuxer+1] != "mov" {
+		t.Fatalf("expected FFmpeg to be told to demux mp4 content, got %v", recorder.args)
+	}
+}
+
+// recordingRunner captures the FFmpeg arguments and writes an empty output file.
+type recordingRunner struct {
+	args []string
+}
+
+func (r *recordingRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (r *recordingRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	r.args = args
+	return nil, os.WriteFile(args[len(args)-1], nil, 0644)
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log/slog"
+	"math"
 	"os"
 	"os/exec"
 	"song-recognition/models"
@@ -94,6 +95,17 @@ func WriteWavFile(filename string, data []byte, sampleRate int, channels int, bi
 	return err
 }
 
+// WriteSamplesToWav writes mono float64 samples in [-1, 1] as a 16-bit PCM WAV file.
+// Samples outside that range are clipped.
+func WriteSamplesToWav(filename string, samples []float64, sampleRate int) error {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		sample = math.Max(-1, math.Min(1, sample))
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(sample*32767)))
+	}
+	return WriteWavFile(filename, data, sampleRate, 1, 16)
+}
+
 // WavInfo defines a struct containing information extracted from the WAV header
 type WavInfo struct {
 	Channels      int